@@ -0,0 +1,34 @@
+// Command otasim runs a simulated online travel agency to connect the hotel's channel manager to
+// during development. Add a channel in the admin with its address and API key, map some rooms,
+// sync it, and then book through the simulator's API, e.g.
+//
+//	curl -H 'Authorization: Bearer dev' -d '{"room_code":"GQ","start_date":"2026-11-01","end_date":"2026-11-03","first_name":"Ann","last_name":"Lee"}' localhost:8090/reservations
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/NganJason/hotel-booking/internal/channels"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "Address to listen on")
+	apiKey := flag.String("key", "dev", "API key the channel manager has to send")
+	failures := flag.Int("fail", 0, "Number of requests to fail at startup, to try out retries")
+	flag.Parse()
+
+	sim := channels.NewSimulator(*apiKey)
+	sim.FailNext(*failures)
+
+	log.Printf("Simulated OTA is listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, logRequests(sim)))
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Println(r.Method, r.URL)
+		next.ServeHTTP(w, r)
+	})
+}
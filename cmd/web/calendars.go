@@ -0,0 +1,27 @@
+package main
+
+import (
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/handlers"
+)
+
+// calendarSyncInterval is how often bookings are imported from the other platforms' calendars
+const calendarSyncInterval = 30 * time.Minute
+
+// syncCalendarsPeriodically imports the calendars once at startup, so a restart doesn't leave rooms
+// open to double booking until the first tick, and then every calendarSyncInterval
+func syncCalendarsPeriodically() {
+	go func() {
+		ticker := time.NewTicker(calendarSyncInterval)
+		defer ticker.Stop()
+
+		for {
+			err := handlers.Repo.SyncCalendars()
+			if err != nil {
+				errorLog.Println(err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/handlers"
+)
+
+// channelSyncInterval is how often bookings are pulled from the channels and availability pushed to them.
+// It's short because a room sold here stays on sale on the channels until the next push.
+const channelSyncInterval = 5 * time.Minute
+
+func syncChannelsPeriodically() {
+	go func() {
+		ticker := time.NewTicker(channelSyncInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := handlers.Repo.SyncChannels()
+			if err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/handlers"
+)
+
+// eventInterval is how often the outbox is checked without being told of new events,
+// catching any saved while the publisher was busy or the app was down
+const eventInterval = 10 * time.Second
+
+func publishEvents() {
+	go func() {
+		ticker := time.NewTicker(eventInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.Events:
+			case <-ticker.C:
+			}
+
+			err := handlers.Repo.PublishEvents()
+			if err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/handlers"
+)
+
+// holdSweepInterval is how often rooms held by guests who walked away are released
+const holdSweepInterval = time.Minute
+
+func sweepExpiredHolds() {
+	go func() {
+		ticker := time.NewTicker(holdSweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := handlers.Repo.ReleaseExpiredHolds()
+			if err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/handlers"
+)
+
+// idempotencySweepInterval is how often idempotency keys that have outlived their use are forgotten
+const idempotencySweepInterval = time.Hour
+
+func sweepIdempotencyKeys() {
+	go func() {
+		ticker := time.NewTicker(idempotencySweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := handlers.Repo.ExpireIdempotencyKeys()
+			if err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+}
@@ -2,18 +2,23 @@ package main
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/NganJason/hotel-booking/internal/config"
 	"github.com/NganJason/hotel-booking/internal/driver"
+	"github.com/NganJason/hotel-booking/internal/events"
 	"github.com/NganJason/hotel-booking/internal/handlers"
 	"github.com/NganJason/hotel-booking/internal/helpers"
 	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/payments"
 	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/tokens"
 	"github.com/alexedwards/scs/v2"
 )
 
@@ -33,6 +38,13 @@ func main() {
 	defer db.SQL.Close()
 	defer close(app.MailChan)
 	listenForMail()
+	listenForWaitlist()
+	sweepExpiredHolds()
+	sweepIdempotencyKeys()
+	syncCalendarsPeriodically()
+	syncChannelsPeriodically()
+	deliverWebhooksPeriodically()
+	publishEvents()
 
 	
 	fmt.Printf("Server is listening to %s", PORT_NUMBER)
@@ -45,13 +57,19 @@ func main() {
 func run() (*driver.DB, error) {
 	// Define type of value to store in session
 	gob.Register(models.Reservation{})
+	gob.Register(models.BookingGroup{})
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
+	gob.Register(time.Time{})
 
 	mailChan := make(chan models.MailData)
 	app.MailChan = mailChan
+	app.Waitlist = make(chan models.FreedInventory, 100)
+	app.Webhooks = make(chan struct{}, 1)
+	app.Bus = events.NewBus()
+	app.Events = make(chan struct{}, 1)
 
 
 	// read flags
@@ -72,6 +90,30 @@ func run() (*driver.DB, error) {
 	// }
 	// Change this to true when in production
 	app.InProduction = true
+	// prices are stored in this currency; changing it does not convert existing amounts
+	app.BaseCurrency = strings.ToUpper(os.Getenv("BASE_CURRENCY"))
+	if app.BaseCurrency == "" {
+		app.BaseCurrency = "USD"
+	} else if len(app.BaseCurrency) != 3 {
+		return nil, fmt.Errorf("BASE_CURRENCY must be a three letter currency code, got %q", app.BaseCurrency)
+	}
+	app.Payments = payments.NewFakeGateway()
+
+	// links in guest emails are built on this, so it has to be the address guests reach the site at
+	app.BaseURL = strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if app.BaseURL == "" {
+		return nil, errors.New("BASE_URL must be set to the public address of the site, such as https://example.com")
+	}
+
+	// links in guest emails are signed with this key, so it has to stay the same across restarts
+	signingKey := os.Getenv("SIGNING_KEY")
+	if len(signingKey) < 32 {
+		return nil, errors.New("SIGNING_KEY must be set to a secret of at least 32 characters")
+	}
+	app.Links = tokens.NewSigner([]byte(signingKey))
+
+	// calendar sources can only read file:// feeds kept in this directory; left unset they can't read files at all
+	app.CalendarFeedDir = os.Getenv("CALENDAR_FEED_DIR")
 
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -109,6 +151,12 @@ func run() (*driver.DB, error) {
 	// Initiate repository pattern
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandlers(repo)
+	repo.Subscribe(app.Bus)
+
+	err = repo.LoadCurrencies()
+	if err != nil {
+		return nil, err
+	}
 
 	return db, nil
 }
\ No newline at end of file
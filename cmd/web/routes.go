@@ -25,13 +25,41 @@ func routes(app *config.AppConfig) http.Handler {
 	router.HandleFunc("/search-availability", handlers.Repo.HandleSearchAvailability).Methods("GET")
 	router.HandleFunc("/search-availability", handlers.Repo.PostAvailability).Methods("POST")
 	router.HandleFunc("/search-availability-json", handlers.Repo.AvailabilityJSON).Methods("POST")
-	router.HandleFunc("/choose-room/{id}", handlers.Repo.ChooseRoom).Methods("GET")
-	router.HandleFunc("/book-room", handlers.Repo.BookRoom).Methods("GET")
+	router.HandleFunc("/availability-calendar", handlers.Repo.AvailabilityCalendar).Methods("GET")
+	router.HandleFunc("/choose-room/{id}", handlers.Repo.ChooseRoom).Methods("POST")
+	router.HandleFunc("/book-room", handlers.Repo.BookRoom).Methods("POST")
 
 	router.HandleFunc("/make-reservation", handlers.Repo.HandlerMakeReservation).Methods("GET")
 	router.HandleFunc("/post-reservation", handlers.Repo.PostReservation).Methods("POST")
+	router.HandleFunc("/payment", handlers.Repo.Payment).Methods("GET")
+	router.HandleFunc("/payment", handlers.Repo.PostPayment).Methods("POST")
 	router.HandleFunc("/reservation-summary", handlers.Repo.ReservationSummary)
 
+	router.HandleFunc("/choose-rooms", handlers.Repo.PostChooseRooms).Methods("POST")
+	router.HandleFunc("/make-group-reservation", handlers.Repo.MakeGroupReservation).Methods("GET")
+	router.HandleFunc("/post-group-reservation", handlers.Repo.PostGroupReservation).Methods("POST")
+	router.HandleFunc("/group-payment", handlers.Repo.GroupPayment).Methods("GET")
+	router.HandleFunc("/group-payment", handlers.Repo.PostGroupPayment).Methods("POST")
+	router.HandleFunc("/group-summary", handlers.Repo.GroupSummary).Methods("GET")
+	router.HandleFunc("/book-split-stay", handlers.Repo.PostSplitStay).Methods("POST")
+
+	router.HandleFunc("/manage/{token}", handlers.Repo.ManageBooking).Methods("GET")
+	router.HandleFunc("/manage/{token}", handlers.Repo.PostManageBooking).Methods("POST")
+	router.HandleFunc("/manage/{token}/cancel", handlers.Repo.PostManageCancel).Methods("POST")
+	router.HandleFunc("/manage/{token}/dates", handlers.Repo.PostManageDates).Methods("POST")
+	router.HandleFunc("/manage/{token}/payment", handlers.Repo.ManagePayment).Methods("GET")
+	router.HandleFunc("/manage/{token}/payment", handlers.Repo.PostManagePayment).Methods("POST")
+
+	router.HandleFunc("/waitlist", handlers.Repo.Waitlist).Methods("GET")
+	router.HandleFunc("/waitlist", handlers.Repo.PostWaitlist).Methods("POST")
+	router.HandleFunc("/waitlist/{token}", handlers.Repo.WaitlistOffer).Methods("GET")
+	router.HandleFunc("/waitlist/leave/{token}", handlers.Repo.LeaveWaitlist).Methods("GET")
+	router.HandleFunc("/waitlist/leave/{token}", handlers.Repo.PostLeaveWaitlist).Methods("POST")
+
+	router.HandleFunc("/ical/{token}.ics", handlers.Repo.CalendarFeed).Methods("GET")
+
+	router.HandleFunc("/currency/{code}", handlers.Repo.SetCurrency).Methods("GET")
+
 	router.HandleFunc("/user/login", handlers.Repo.ShowLogin).Methods("GET")
 	router.HandleFunc("/user/login", handlers.Repo.PostShowLogin).Methods("POST")
 	router.HandleFunc("/user/logout", handlers.Repo.Logout).Methods("GET")
@@ -43,11 +71,99 @@ func routes(app *config.AppConfig) http.Handler {
 	secureRoute.HandleFunc("/reservations-all", handlers.Repo.AdminAllReservations).Methods("GET")
 	secureRoute.HandleFunc("/reservations-calendar", handlers.Repo.AdminReservationsCalendar).Methods("GET")
 	secureRoute.HandleFunc("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar).Methods("POST")
-	secureRoute.HandleFunc("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation).Methods("GET")
-	secureRoute.HandleFunc("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation).Methods("GET")
+
+	secureRoute.HandleFunc("/arrivals", handlers.Repo.AdminArrivals).Methods("GET")
+	secureRoute.HandleFunc("/arrivals/{id:[0-9]+}/check-in", handlers.Repo.AdminCheckIn).Methods("POST")
+	secureRoute.HandleFunc("/departures", handlers.Repo.AdminDepartures).Methods("GET")
+	secureRoute.HandleFunc("/departures/{id:[0-9]+}/check-out", handlers.Repo.AdminCheckOut).Methods("POST")
+
+	secureRoute.HandleFunc("/waitlist", handlers.Repo.AdminWaitlist).Methods("GET")
 
 	secureRoute.HandleFunc("/reservations/{src}/{id}", handlers.Repo.AdminShowReservations).Methods("GET")
 	secureRoute.HandleFunc("/reservations/{src}/{id}", handlers.Repo.AdminShowPostReservation).Methods("POST")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/status", handlers.Repo.AdminReservationStatus).Methods("POST")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/dates", handlers.Repo.AdminPostReservationDates).Methods("POST")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/move", handlers.Repo.AdminShowMoveRoom).Methods("GET")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/move", handlers.Repo.AdminPostMoveRoom).Methods("POST")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/payments", handlers.Repo.AdminRecordPayment).Methods("POST")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/invoice", handlers.Repo.AdminReservationInvoice).Methods("GET")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/invoice.pdf", handlers.Repo.AdminReservationInvoicePDF).Methods("GET")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/invoice", handlers.Repo.AdminIssueInvoice).Methods("POST")
+	secureRoute.HandleFunc("/reservations/{src}/{id:[0-9]+}/revoke-links", handlers.Repo.AdminRevokeManageLink).Methods("POST")
+
+	secureRoute.HandleFunc("/groups/{id:[0-9]+}", handlers.Repo.AdminShowGroup).Methods("GET")
+	secureRoute.HandleFunc("/groups/{id:[0-9]+}", handlers.Repo.AdminPostGroup).Methods("POST")
+	secureRoute.HandleFunc("/groups/{id:[0-9]+}/dates", handlers.Repo.AdminGroupDates).Methods("POST")
+	secureRoute.HandleFunc("/groups/{id:[0-9]+}/cancel", handlers.Repo.AdminCancelGroup).Methods("POST")
+
+	secureRoute.HandleFunc("/payments/{id:[0-9]+}/capture", handlers.Repo.AdminCapturePayment).Methods("POST")
+	secureRoute.HandleFunc("/payments/{id:[0-9]+}/void", handlers.Repo.AdminVoidPayment).Methods("POST")
+	secureRoute.HandleFunc("/payments/{id:[0-9]+}/refund", handlers.Repo.AdminRefundPayment).Methods("POST")
+
+	secureRoute.HandleFunc("/blocks", handlers.Repo.AdminBlocks).Methods("GET")
+	secureRoute.HandleFunc("/blocks/new", handlers.Repo.AdminShowBlock).Methods("GET")
+	secureRoute.HandleFunc("/blocks/new", handlers.Repo.AdminPostBlock).Methods("POST")
+	secureRoute.HandleFunc("/blocks/{id:[0-9]+}", handlers.Repo.AdminShowBlock).Methods("GET")
+	secureRoute.HandleFunc("/blocks/{id:[0-9]+}", handlers.Repo.AdminPostBlock).Methods("POST")
+	secureRoute.HandleFunc("/delete-block/{id}", handlers.Repo.AdminDeleteBlock).Methods("GET")
+
+	secureRoute.HandleFunc("/rooms", handlers.Repo.AdminRooms).Methods("GET")
+	secureRoute.HandleFunc("/rooms", handlers.Repo.AdminPostRooms).Methods("POST")
+
+	secureRoute.HandleFunc("/promotions", handlers.Repo.AdminPromotions).Methods("GET")
+	secureRoute.HandleFunc("/promotions/new", handlers.Repo.AdminShowPromotion).Methods("GET")
+	secureRoute.HandleFunc("/promotions/new", handlers.Repo.AdminPostPromotion).Methods("POST")
+	secureRoute.HandleFunc("/promotions/{id:[0-9]+}", handlers.Repo.AdminShowPromotion).Methods("GET")
+	secureRoute.HandleFunc("/promotions/{id:[0-9]+}", handlers.Repo.AdminPostPromotion).Methods("POST")
+
+	secureRoute.HandleFunc("/extras", handlers.Repo.AdminExtras).Methods("GET")
+	secureRoute.HandleFunc("/extras/new", handlers.Repo.AdminShowExtra).Methods("GET")
+	secureRoute.HandleFunc("/extras/new", handlers.Repo.AdminPostExtra).Methods("POST")
+	secureRoute.HandleFunc("/extras/{id:[0-9]+}", handlers.Repo.AdminShowExtra).Methods("GET")
+	secureRoute.HandleFunc("/extras/{id:[0-9]+}", handlers.Repo.AdminPostExtra).Methods("POST")
+
+	secureRoute.HandleFunc("/taxes", handlers.Repo.AdminTaxRules).Methods("GET")
+	secureRoute.HandleFunc("/taxes/new", handlers.Repo.AdminShowTaxRule).Methods("GET")
+	secureRoute.HandleFunc("/taxes/new", handlers.Repo.AdminPostTaxRule).Methods("POST")
+	secureRoute.HandleFunc("/taxes/{id:[0-9]+}", handlers.Repo.AdminShowTaxRule).Methods("GET")
+	secureRoute.HandleFunc("/taxes/{id:[0-9]+}", handlers.Repo.AdminPostTaxRule).Methods("POST")
+
+	secureRoute.HandleFunc("/currencies", handlers.Repo.AdminCurrencies).Methods("GET")
+	secureRoute.HandleFunc("/currencies", handlers.Repo.AdminPostCurrencies).Methods("POST")
+
+	secureRoute.HandleFunc("/calendar-sync", handlers.Repo.AdminCalendarSync).Methods("GET")
+	secureRoute.HandleFunc("/calendar-sync/sync", handlers.Repo.AdminSyncCalendars).Methods("POST")
+	secureRoute.HandleFunc("/calendar-sync/feeds/{id:[0-9]+}/reset", handlers.Repo.AdminResetCalendarFeed).Methods("POST")
+	secureRoute.HandleFunc("/calendar-sync/sources", handlers.Repo.AdminPostCalendarSource).Methods("POST")
+	secureRoute.HandleFunc("/calendar-sync/sources/{id:[0-9]+}", handlers.Repo.AdminPostCalendarSource).Methods("POST")
+	secureRoute.HandleFunc("/calendar-sync/sources/{id:[0-9]+}/delete", handlers.Repo.AdminDeleteCalendarSource).Methods("POST")
+	secureRoute.HandleFunc("/calendar-sync/sources/{id:[0-9]+}/sync", handlers.Repo.AdminSyncCalendarSource).Methods("POST")
+
+	secureRoute.HandleFunc("/channels", handlers.Repo.AdminChannels).Methods("GET")
+	secureRoute.HandleFunc("/channels/new", handlers.Repo.AdminShowChannel).Methods("GET")
+	secureRoute.HandleFunc("/channels/new", handlers.Repo.AdminPostChannel).Methods("POST")
+	secureRoute.HandleFunc("/channels/{id:[0-9]+}", handlers.Repo.AdminShowChannel).Methods("GET")
+	secureRoute.HandleFunc("/channels/{id:[0-9]+}", handlers.Repo.AdminPostChannel).Methods("POST")
+	secureRoute.HandleFunc("/channels/{id:[0-9]+}/delete", handlers.Repo.AdminDeleteChannel).Methods("POST")
+	secureRoute.HandleFunc("/channels/{id:[0-9]+}/sync", handlers.Repo.AdminSyncChannel).Methods("POST")
+	secureRoute.HandleFunc("/channels/conflicts/{id:[0-9]+}/resolve", handlers.Repo.AdminResolveChannelConflict).Methods("POST")
+
+	secureRoute.HandleFunc("/webhooks", handlers.Repo.AdminWebhooks).Methods("GET")
+	secureRoute.HandleFunc("/webhooks/new", handlers.Repo.AdminShowWebhook).Methods("GET")
+	secureRoute.HandleFunc("/webhooks/new", handlers.Repo.AdminPostWebhook).Methods("POST")
+	secureRoute.HandleFunc("/webhooks/{id:[0-9]+}", handlers.Repo.AdminShowWebhook).Methods("GET")
+	secureRoute.HandleFunc("/webhooks/{id:[0-9]+}", handlers.Repo.AdminPostWebhook).Methods("POST")
+	secureRoute.HandleFunc("/webhooks/{id:[0-9]+}/delete", handlers.Repo.AdminDeleteWebhook).Methods("POST")
+	secureRoute.HandleFunc("/webhooks/{id:[0-9]+}/test", handlers.Repo.AdminTestWebhook).Methods("POST")
+	secureRoute.HandleFunc("/webhooks/deliveries/{id:[0-9]+}/retry", handlers.Repo.AdminRetryWebhookDelivery).Methods("POST")
+
+	secureRoute.HandleFunc("/audit", handlers.Repo.AdminAudit).Methods("GET")
+
+	secureRoute.HandleFunc("/policies", handlers.Repo.AdminPolicies).Methods("GET")
+	secureRoute.HandleFunc("/policies/new", handlers.Repo.AdminShowPolicy).Methods("GET")
+	secureRoute.HandleFunc("/policies/new", handlers.Repo.AdminPostPolicy).Methods("POST")
+	secureRoute.HandleFunc("/policies/{id:[0-9]+}", handlers.Repo.AdminShowPolicy).Methods("GET")
+	secureRoute.HandleFunc("/policies/{id:[0-9]+}", handlers.Repo.AdminPostPolicy).Methods("POST")
 
 	fs := http.FileServer(http.Dir("./static/"))
 
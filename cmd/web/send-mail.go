@@ -15,13 +15,16 @@ func listenForMail() {
 		fmt.Println("Listening for email")
 		for {
 			m := <- app.MailChan
-			sendMsg(m)
+			err := sendMsg(m)
+			if m.Sent != nil {
+				m.Sent <- err
+			}
 		}
 	}()
 
 }
 
-func sendMsg(m models.MailData) {
+func sendMsg(m models.MailData) error {
 	server := mail.NewSMTPClient()
 	server.Host = "localhost"
 	server.Port = 1025
@@ -32,6 +35,7 @@ func sendMsg(m models.MailData) {
 	client, err := server.Connect()
 	if err != nil {
 		errorLog.Println(err)
+		return err
 	}
 
 	email := mail.NewMSG()
@@ -41,7 +45,9 @@ func sendMsg(m models.MailData) {
 	err = email.Send(client)
 	if err != nil {
 		log.Println(err)
-	} else {
-		log.Println("Email sent")
+		return err
 	}
+
+	log.Println("Email sent")
+	return nil
 }
\ No newline at end of file
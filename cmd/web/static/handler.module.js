@@ -27,13 +27,18 @@ export let checkAvailabilityHandler = function () {
               showConfirmButton: false,
               msg:
                 "<p> Room is available!</p>" +
-                '<p><a href="/book-room?id=' +
+                '<form method="post" action="/book-room">' +
+                '<input type="hidden" name="id" value="' +
                 data.room_id +
-                "&s=" +
+                '" />' +
+                '<input type="hidden" name="s" value="' +
                 data.start_date +
-                "&e=" +
+                '" />' +
+                '<input type="hidden" name="e" value="' +
                 data.end_date +
-                '" class="btn btn-primary">Book now!</a></p>',
+                '" />' +
+                '<p><input type="submit" class="btn btn-primary" value="Book now!" /></p>' +
+                "</form>",
             });
           } else {
             attention.error({
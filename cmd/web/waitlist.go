@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/handlers"
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// waitlistInterval is how often the waitlist is checked without being told rooms came free,
+// so expired offers pass to the next guest
+const waitlistInterval = 5 * time.Minute
+
+func listenForWaitlist() {
+	go func() {
+		fmt.Println("Listening for freed rooms")
+		ticker := time.NewTicker(waitlistInterval)
+		defer ticker.Stop()
+
+		for {
+			var freed models.FreedInventory
+			select {
+			case freed = <-app.Waitlist:
+			case <-ticker.C:
+			}
+
+			err := handlers.Repo.OfferWaitlist(freed)
+			if err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/handlers"
+)
+
+// webhookInterval is how often deliveries due a retry are looked for without being told of new ones
+const webhookInterval = 30 * time.Second
+
+func deliverWebhooksPeriodically() {
+	go func() {
+		ticker := time.NewTicker(webhookInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.Webhooks:
+			case <-ticker.C:
+			}
+
+			err := handlers.Repo.DeliverWebhooks()
+			if err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+}
@@ -29,6 +29,7 @@ require (
 	github.com/jackc/pgconn v1.8.1
 	github.com/jackc/pgx/v4 v4.11.0
 	github.com/jmoiron/sqlx v1.3.3 // indirect
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/justinas/nosurf v1.1.1
 	github.com/lib/pq v1.10.0 // indirect
 	github.com/mattn/go-shellwords v1.0.11 // indirect
@@ -0,0 +1,224 @@
+// Package availability works out which rooms are free on which nights from the room restrictions
+// loaded for a range of dates, so questions about the whole range need only one query
+package availability
+
+import (
+	"sort"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+const layout = "2006-01-02"
+
+// maxSplits is the most split stays suggested, so they don't crowd out the shifted dates
+const maxSplits = 2
+
+// Grid is the nights each room is taken
+type Grid struct {
+	Rooms []models.Room
+	taken map[int]map[string]bool
+}
+
+// NewGrid marks every night covered by the restrictions as taken
+func NewGrid(rooms []models.Room, restrictions []models.RoomRestriction) *Grid {
+	g := &Grid{
+		Rooms: rooms,
+		taken: make(map[int]map[string]bool),
+	}
+
+	for _, rr := range restrictions {
+		if g.taken[rr.RoomID] == nil {
+			g.taken[rr.RoomID] = make(map[string]bool)
+		}
+		for d := rr.StartDate; d.Before(rr.EndDate); d = d.AddDate(0, 0, 1) {
+			g.taken[rr.RoomID][d.Format(layout)] = true
+		}
+	}
+
+	return g
+}
+
+// Taken reports whether the room is taken the night of date
+func (g *Grid) Taken(roomID int, date time.Time) bool {
+	return g.taken[roomID][date.Format(layout)]
+}
+
+// Free reports whether the room is free every night from start up to end
+func (g *Grid) Free(roomID int, start, end time.Time) bool {
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		if g.Taken(roomID, d) {
+			return false
+		}
+	}
+	return true
+}
+
+// FreeRooms returns the rooms free every night from start up to end
+func (g *Grid) FreeRooms(start, end time.Time) []models.Room {
+	var rooms []models.Room
+	for _, room := range g.Rooms {
+		if g.Free(room.ID, start, end) {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms
+}
+
+// Day is how many of the grid's rooms are free one night, and the lowest nightly price among them
+type Day struct {
+	Date      time.Time
+	RoomsFree int
+	Price     int
+}
+
+// Calendar returns each night from start up to end. A night before earliest, such as one already past,
+// is never free.
+func (g *Grid) Calendar(start, end, earliest time.Time) []Day {
+	var days []Day
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		day := Day{Date: d}
+		if !d.Before(earliest) {
+			for _, room := range g.Rooms {
+				if g.Taken(room.ID, d) {
+					continue
+				}
+				if day.RoomsFree == 0 || room.Price < day.Price {
+					day.Price = room.Price
+				}
+				day.RoomsFree++
+			}
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// Suggest proposes stays close to start-end for a search that found no room free for all of it:
+// another room free for the same dates, the same number of nights moved up to days either way, and,
+// only when no room is free for the whole of the dates searched, those dates split across two rooms.
+// When roomID is set the search was for that room, so moved dates are only suggested in it.
+// Whole rooms come first, those closest to what was asked for first, split stays after them,
+// and nothing arriving before earliest is suggested. The grid has to cover days either side of the dates searched.
+func Suggest(g *Grid, roomID int, start, end, earliest time.Time, days, limit int) []models.Alternative {
+	var alternatives []models.Alternative
+	sameDates := false
+
+	for _, shift := range shifts(days) {
+		s, e := start.AddDate(0, 0, shift), end.AddDate(0, 0, shift)
+		if s.Before(earliest) {
+			continue
+		}
+
+		var rooms []models.Room
+		for _, room := range g.FreeRooms(s, e) {
+			if room.ID == roomID && shift == 0 {
+				continue
+			}
+			if roomID > 0 && room.ID != roomID && shift != 0 {
+				continue
+			}
+			rooms = append(rooms, room)
+		}
+		if len(rooms) == 0 {
+			continue
+		}
+
+		kind := models.AlternativeShifted
+		if shift == 0 {
+			kind = models.AlternativeRoom
+			sameDates = true
+		}
+
+		alternatives = append(alternatives, models.Alternative{
+			Kind:      kind,
+			StartDate: s,
+			EndDate:   e,
+			ShiftDays: shift,
+			Rooms:     rooms,
+		})
+	}
+
+	if !sameDates {
+		alternatives = append(alternatives, splits(g, start, end)...)
+	}
+
+	if len(alternatives) > limit {
+		alternatives = alternatives[:limit]
+	}
+
+	return alternatives
+}
+
+// shifts returns the days a stay can be moved by, up to days either way, the smallest moves first
+func shifts(days int) []int {
+	out := []int{0}
+	for d := 1; d <= days; d++ {
+		out = append(out, -d, d)
+	}
+	return out
+}
+
+// splits returns the cheapest ways to stay from start to end in one room and then another,
+// at most one for each night the guest could change rooms, cheapest first
+func splits(g *Grid, start, end time.Time) []models.Alternative {
+	type priced struct {
+		alt  models.Alternative
+		cost int
+	}
+	var found []priced
+
+	for change := start.AddDate(0, 0, 1); change.Before(end); change = change.AddDate(0, 0, 1) {
+		first, second := g.FreeRooms(start, change), g.FreeRooms(change, end)
+		firstNights, secondNights := nights(start, change), nights(change, end)
+
+		best := priced{cost: -1}
+		for _, a := range first {
+			for _, b := range second {
+				if a.ID == b.ID {
+					continue
+				}
+
+				cost := a.Price*firstNights + b.Price*secondNights
+				if best.cost >= 0 && cost >= best.cost {
+					continue
+				}
+
+				best = priced{
+					alt: models.Alternative{
+						Kind:      models.AlternativeSplit,
+						StartDate: start,
+						EndDate:   end,
+						Legs: []models.AlternativeLeg{
+							{Room: a, StartDate: start, EndDate: change},
+							{Room: b, StartDate: change, EndDate: end},
+						},
+					},
+					cost: cost,
+				}
+			}
+		}
+
+		if best.cost >= 0 {
+			found = append(found, best)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].cost < found[j].cost
+	})
+
+	var alternatives []models.Alternative
+	for _, f := range found {
+		if len(alternatives) == maxSplits {
+			break
+		}
+		alternatives = append(alternatives, f.alt)
+	}
+
+	return alternatives
+}
+
+func nights(start, end time.Time) int {
+	return int(end.Sub(start).Hours() / 24)
+}
@@ -0,0 +1,202 @@
+package availability
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// taken restricts the room for the nights from start up to end
+func taken(roomID int, start, end string) models.RoomRestriction {
+	return models.RoomRestriction{RoomID: roomID, StartDate: date(start), EndDate: date(end)}
+}
+
+// describe writes an alternative out in one line, to compare suggestions in a readable way
+func describe(a models.Alternative) string {
+	if a.Kind == models.AlternativeSplit {
+		return fmt.Sprintf("split room %d until %s, then room %d",
+			a.Legs[0].Room.ID, a.Legs[0].EndDate.Format(layout), a.Legs[1].Room.ID)
+	}
+
+	var ids []string
+	for _, room := range a.Rooms {
+		ids = append(ids, fmt.Sprint(room.ID))
+	}
+	if a.Kind == models.AlternativeRoom {
+		return fmt.Sprintf("same dates, rooms %s", strings.Join(ids, ","))
+	}
+	return fmt.Sprintf("%+d days from %s, rooms %s", a.ShiftDays, a.StartDate.Format(layout), strings.Join(ids, ","))
+}
+
+func TestSuggest(t *testing.T) {
+	rooms := []models.Room{{ID: 1, Price: 10000}, {ID: 2, Price: 15000}}
+
+	tests := []struct {
+		name         string
+		roomID       int
+		restrictions []models.RoomRestriction
+		earliest     string
+		days         int
+		limit        int
+		want         []string
+	}{
+		{
+			name:         "nearest shifts first",
+			restrictions: []models.RoomRestriction{taken(1, "2026-06-10", "2026-06-11"), taken(2, "2026-06-10", "2026-06-13")},
+			earliest:     "2026-06-01",
+			days:         3,
+			limit:        10,
+			want: []string{
+				"+1 days from 2026-06-11, rooms 1",
+				"+2 days from 2026-06-12, rooms 1",
+				"-3 days from 2026-06-07, rooms 1,2",
+				"+3 days from 2026-06-13, rooms 1,2",
+			},
+		},
+		{
+			name:         "limited to the closest",
+			restrictions: []models.RoomRestriction{taken(1, "2026-06-10", "2026-06-11"), taken(2, "2026-06-10", "2026-06-13")},
+			earliest:     "2026-06-01",
+			days:         3,
+			limit:        2,
+			want: []string{
+				"+1 days from 2026-06-11, rooms 1",
+				"+2 days from 2026-06-12, rooms 1",
+			},
+		},
+		{
+			name:         "split stays cheapest first",
+			restrictions: []models.RoomRestriction{taken(1, "2026-06-12", "2026-06-13"), taken(2, "2026-06-10", "2026-06-11")},
+			earliest:     "2026-06-01",
+			days:         0,
+			limit:        10,
+			want: []string{
+				"split room 1 until 2026-06-12, then room 2",
+				"split room 1 until 2026-06-11, then room 2",
+			},
+		},
+		{
+			name:         "split stays after every whole room",
+			restrictions: []models.RoomRestriction{taken(1, "2026-06-12", "2026-06-13"), taken(2, "2026-06-10", "2026-06-11")},
+			earliest:     "2026-06-01",
+			days:         2,
+			limit:        10,
+			want: []string{
+				"-1 days from 2026-06-09, rooms 1",
+				"+1 days from 2026-06-11, rooms 2",
+				"-2 days from 2026-06-08, rooms 1",
+				"+2 days from 2026-06-12, rooms 2",
+				"split room 1 until 2026-06-12, then room 2",
+				"split room 1 until 2026-06-11, then room 2",
+			},
+		},
+		{
+			name:         "another room for the same dates first, and no split",
+			roomID:       1,
+			restrictions: []models.RoomRestriction{taken(1, "2026-06-11", "2026-06-12")},
+			earliest:     "2026-06-01",
+			days:         1,
+			limit:        10,
+			want: []string{
+				"same dates, rooms 2",
+			},
+		},
+		{
+			name:         "moved dates only in the room searched",
+			roomID:       1,
+			restrictions: []models.RoomRestriction{taken(1, "2026-06-10", "2026-06-11"), taken(2, "2026-06-10", "2026-06-11")},
+			earliest:     "2026-06-01",
+			days:         1,
+			limit:        10,
+			want: []string{
+				"+1 days from 2026-06-11, rooms 1",
+			},
+		},
+		{
+			name:         "nothing arriving before earliest",
+			restrictions: []models.RoomRestriction{taken(1, "2026-06-10", "2026-06-13"), taken(2, "2026-06-10", "2026-06-13")},
+			earliest:     "2026-06-09",
+			days:         3,
+			limit:        10,
+			want: []string{
+				"+3 days from 2026-06-13, rooms 1,2",
+			},
+		},
+		{
+			name:         "no room changes into itself",
+			restrictions: []models.RoomRestriction{taken(2, "2026-06-10", "2026-06-13"), taken(1, "2026-06-11", "2026-06-12")},
+			earliest:     "2026-06-10",
+			days:         0,
+			limit:        10,
+			want:         nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := date("2026-06-10"), date("2026-06-13")
+			g := NewGrid(rooms, tt.restrictions)
+
+			var got []string
+			for _, a := range Suggest(g, tt.roomID, start, end, date(tt.earliest), tt.days, tt.limit) {
+				got = append(got, describe(a))
+			}
+
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	// the dearer room comes first, so the price has to be the lowest of those free, not the first
+	rooms := []models.Room{{ID: 2, Price: 15000}, {ID: 1, Price: 10000}}
+	g := NewGrid(rooms, []models.RoomRestriction{
+		taken(1, "2026-06-11", "2026-06-13"),
+		taken(2, "2026-06-12", "2026-06-13"),
+	})
+
+	tests := []struct {
+		date      string
+		roomsFree int
+		price     int
+	}{
+		{"2026-06-09", 0, 0},
+		{"2026-06-10", 2, 10000},
+		{"2026-06-11", 1, 15000},
+		{"2026-06-12", 0, 0},
+		{"2026-06-13", 2, 10000},
+	}
+
+	days := g.Calendar(date("2026-06-09"), date("2026-06-14"), date("2026-06-10"))
+	if len(days) != len(tests) {
+		t.Fatalf("got %d days, want %d", len(days), len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			day := days[i]
+			if !day.Date.Equal(date(tt.date)) {
+				t.Errorf("date = %s, want %s", day.Date.Format(layout), tt.date)
+			}
+			if day.RoomsFree != tt.roomsFree {
+				t.Errorf("rooms free = %d, want %d", day.RoomsFree, tt.roomsFree)
+			}
+			if day.Price != tt.price {
+				t.Errorf("price = %d, want %d", day.Price, tt.price)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Package channels connects the hotel to the online travel agencies (OTAs) that sell its rooms:
+// availability and rates are pushed to them, and the reservations they take are pulled back
+package channels
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRejected is returned when the channel refused a request, so sending it again won't help
+var ErrRejected = errors.New("rejected by the channel")
+
+// Channel is an online travel agency. Rooms are known to it by its own room codes.
+// PullReservations leaves out the bookings it can't read, returning why each was skipped,
+// so that one booking the channel got wrong doesn't hold up all the others.
+type Channel interface {
+	PushAvailability(updates []Availability) error
+	PullReservations(since time.Time) (bookings []Booking, skipped []error, err error)
+}
+
+// Availability is whether a room can be sold for one night, and its rate in cents
+type Availability struct {
+	RoomCode string
+	Date     time.Time
+	Open     bool
+	Rate     int
+}
+
+// Booking statuses
+const (
+	BookingConfirmed = "confirmed"
+	BookingCancelled = "cancelled"
+)
+
+// Booking is a reservation taken by a channel, identified within it by Reference.
+// Total is what the guest paid the channel, in cents.
+type Booking struct {
+	Reference string
+	RoomCode  string
+	StartDate time.Time
+	EndDate   time.Time
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Guests    int
+	Total     int
+	Status    string
+	UpdatedAt time.Time
+}
+
+// Retry calls fn until it succeeds, it has been called attempts times or it fails with ErrRejected.
+// It waits backoff before the second call and twice as long before each one after that.
+// It returns how many calls were made and the last error.
+func Retry(attempts int, backoff time.Duration, fn func() error) (int, error) {
+	var err error
+	for n := 1; ; n++ {
+		err = fn()
+		if err == nil || errors.Is(err, ErrRejected) || n >= attempts {
+			return n, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,76 @@
+package channels
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	outage := errors.New("503 Service Unavailable")
+
+	tests := []struct {
+		name     string
+		failures []error
+		attempts int
+		wantN    int
+		wantErr  error
+	}{
+		{"first time", nil, 3, 1, nil},
+		{"after an outage", []error{outage}, 3, 2, nil},
+		{"gives up", []error{outage, outage, outage}, 3, 3, outage},
+		{"not retried once rejected", []error{fmt.Errorf("%w: bad request", ErrRejected)}, 3, 1, ErrRejected},
+		{"a single attempt", []error{outage}, 1, 1, outage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			n, err := Retry(tt.attempts, time.Millisecond, func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+
+			if n != tt.wantN || calls != tt.wantN {
+				t.Errorf("made %d calls and returned %d, want %d", calls, n, tt.wantN)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPullReservationsSkipsMalformed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"reference": "A", "room_code": "DBL", "start_date": "2026-06-10", "end_date": "2026-06-12", "status": "confirmed"},
+			{"reference": "B", "room_code": "DBL", "start_date": "10/06/2026", "end_date": "2026-06-12", "status": "confirmed"},
+			{"reference": "C", "room_code": "DBL", "start_date": "2026-06-12", "end_date": "2026-06-12", "status": "confirmed"},
+			{"reference": "D", "room_code": "SGL", "start_date": "2026-06-20", "end_date": "2026-06-21", "status": "cancelled"}
+		]`)
+	}))
+	defer srv.Close()
+
+	bookings, skipped, err := NewHTTPChannel(srv.URL, "secret").PullReservations(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var refs []string
+	for _, b := range bookings {
+		refs = append(refs, b.Reference)
+	}
+	if fmt.Sprint(refs) != "[A D]" {
+		t.Errorf("pulled %v, want [A D]", refs)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("skipped %v, want bookings B and C", skipped)
+	}
+}
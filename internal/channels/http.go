@@ -0,0 +1,182 @@
+package channels
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// requestTimeout is how long the channel has to answer one request
+const requestTimeout = 30 * time.Second
+
+// availabilityJSON and bookingJSON are the wire format of the channel API
+type availabilityJSON struct {
+	RoomCode string `json:"room_code"`
+	Date     string `json:"date"`
+	Open     bool   `json:"open"`
+	Rate     int    `json:"rate"`
+}
+
+type bookingJSON struct {
+	Reference string    `json:"reference"`
+	RoomCode  string    `json:"room_code"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Guests    int       `json:"guests"`
+	Total     int       `json:"total"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func toBookingJSON(b Booking) bookingJSON {
+	return bookingJSON{
+		Reference: b.Reference,
+		RoomCode:  b.RoomCode,
+		StartDate: b.StartDate.Format(dateLayout),
+		EndDate:   b.EndDate.Format(dateLayout),
+		FirstName: b.FirstName,
+		LastName:  b.LastName,
+		Email:     b.Email,
+		Phone:     b.Phone,
+		Guests:    b.Guests,
+		Total:     b.Total,
+		Status:    b.Status,
+		UpdatedAt: b.UpdatedAt,
+	}
+}
+
+func fromBookingJSON(j bookingJSON) (Booking, error) {
+	start, err := time.Parse(dateLayout, j.StartDate)
+	if err != nil {
+		return Booking{}, fmt.Errorf("booking %s: invalid start date %q", j.Reference, j.StartDate)
+	}
+
+	end, err := time.Parse(dateLayout, j.EndDate)
+	if err != nil || !end.After(start) {
+		return Booking{}, fmt.Errorf("booking %s: invalid end date %q", j.Reference, j.EndDate)
+	}
+
+	return Booking{
+		Reference: j.Reference,
+		RoomCode:  j.RoomCode,
+		StartDate: start,
+		EndDate:   end,
+		FirstName: j.FirstName,
+		LastName:  j.LastName,
+		Email:     j.Email,
+		Phone:     j.Phone,
+		Guests:    j.Guests,
+		Total:     j.Total,
+		Status:    j.Status,
+		UpdatedAt: j.UpdatedAt,
+	}, nil
+}
+
+// HTTPChannel talks to a channel over its JSON API, authenticating with an API key:
+//
+//	PUT /availability                   sets the availability and rate of room codes by night
+//	GET /reservations?since=<RFC 3339>  lists the bookings made, changed or cancelled since then
+type HTTPChannel struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewHTTPChannel returns a channel whose API is at baseURL
+func NewHTTPChannel(baseURL, apiKey string) *HTTPChannel {
+	return &HTTPChannel{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (c *HTTPChannel) PushAvailability(updates []Availability) error {
+	body := make([]availabilityJSON, 0, len(updates))
+	for _, u := range updates {
+		body = append(body, availabilityJSON{
+			RoomCode: u.RoomCode,
+			Date:     u.Date.Format(dateLayout),
+			Open:     u.Open,
+			Rate:     u.Rate,
+		})
+	}
+
+	out, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	return c.do(http.MethodPut, "/availability", bytes.NewReader(out), nil)
+}
+
+func (c *HTTPChannel) PullReservations(since time.Time) ([]Booking, []error, error) {
+	path := "/reservations"
+	if !since.IsZero() {
+		path += "?since=" + url.QueryEscape(since.UTC().Format(time.RFC3339))
+	}
+
+	var body []bookingJSON
+	err := c.do(http.MethodGet, path, nil, &body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bookings []Booking
+	var skipped []error
+	for _, j := range body {
+		b, err := fromBookingJSON(j)
+		if err != nil {
+			skipped = append(skipped, err)
+			continue
+		}
+		bookings = append(bookings, b)
+	}
+
+	return bookings, skipped, nil
+}
+
+// do sends a request and decodes the response into out, if given. A 4xx response other than
+// a timeout or rate limit is ErrRejected; anything else going wrong may be worth retrying.
+func (c *HTTPChannel) do(method, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %v", ErrRejected, err)
+		}
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
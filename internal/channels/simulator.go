@@ -0,0 +1,280 @@
+package channels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by the simulator for a booking of a night the hotel hasn't opened for sale
+var ErrClosed = errors.New("room is not available for those dates")
+
+// Simulator is an in-memory OTA speaking the API HTTPChannel expects, for development and tests.
+// Guests book on it through Book, or by posting a booking to /reservations, and only nights
+// last pushed as open can be booked. Because its copy of the availability is only as fresh as
+// the last push, it will take bookings for rooms the hotel has since sold, just as a real OTA can.
+//
+// Besides the channel API it serves:
+//
+//	POST /reservations                   books a room, returning the booking with its reference
+//	POST /reservations/{reference}/cancel cancels a booking
+//	GET  /availability                   lists the availability pushed so far
+type Simulator struct {
+	mu           sync.Mutex
+	apiKey       string
+	next         int
+	failures     int
+	availability map[string]map[string]Availability
+	bookings     []Booking
+}
+
+// NewSimulator returns a simulator with nothing for sale that accepts requests carrying apiKey
+func NewSimulator(apiKey string) *Simulator {
+	return &Simulator{
+		apiKey:       apiKey,
+		availability: make(map[string]map[string]Availability),
+	}
+}
+
+// FailNext makes the next n requests fail with 503 Service Unavailable, to try out retries
+func (s *Simulator) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = n
+}
+
+// Book books the room code for the nights from b.StartDate up to b.EndDate, priced at the pushed rates
+func (s *Simulator) Book(b Booking) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !b.EndDate.After(b.StartDate) {
+		return Booking{}, errors.New("departure must be after arrival")
+	}
+
+	b.Total = 0
+	for d := b.StartDate; d.Before(b.EndDate); d = d.AddDate(0, 0, 1) {
+		a, ok := s.availability[b.RoomCode][d.Format(dateLayout)]
+		if !ok || !a.Open {
+			return Booking{}, ErrClosed
+		}
+		b.Total += a.Rate
+	}
+
+	for d := b.StartDate; d.Before(b.EndDate); d = d.AddDate(0, 0, 1) {
+		a := s.availability[b.RoomCode][d.Format(dateLayout)]
+		a.Open = false
+		s.availability[b.RoomCode][d.Format(dateLayout)] = a
+	}
+
+	s.next++
+	b.Reference = fmt.Sprintf("SIM-%06d", s.next)
+	b.Status = BookingConfirmed
+	b.UpdatedAt = time.Now()
+	if b.Guests == 0 {
+		b.Guests = 1
+	}
+	s.bookings = append(s.bookings, b)
+
+	return b, nil
+}
+
+// Cancel cancels the booking, reopening its nights
+func (s *Simulator) Cancel(reference string) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, b := range s.bookings {
+		if b.Reference != reference {
+			continue
+		}
+		if b.Status == BookingCancelled {
+			return b, nil
+		}
+
+		for d := b.StartDate; d.Before(b.EndDate); d = d.AddDate(0, 0, 1) {
+			if a, ok := s.availability[b.RoomCode][d.Format(dateLayout)]; ok {
+				a.Open = true
+				s.availability[b.RoomCode][d.Format(dateLayout)] = a
+			}
+		}
+
+		s.bookings[i].Status = BookingCancelled
+		s.bookings[i].UpdatedAt = time.Now()
+		return s.bookings[i], nil
+	}
+
+	return Booking{}, fmt.Errorf("unknown booking %s", reference)
+}
+
+// Bookings returns the bookings changed since then, oldest change first. A zero since returns them all.
+func (s *Simulator) Bookings(since time.Time) []Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bookings []Booking
+	for _, b := range s.bookings {
+		if since.IsZero() || !b.UpdatedAt.Before(since) {
+			bookings = append(bookings, b)
+		}
+	}
+
+	sort.SliceStable(bookings, func(i, j int) bool {
+		return bookings[i].UpdatedAt.Before(bookings[j].UpdatedAt)
+	})
+
+	return bookings
+}
+
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	failing := s.failures > 0
+	if failing {
+		s.failures--
+	}
+	s.mu.Unlock()
+
+	if failing {
+		http.Error(w, "simulated outage", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/availability" && r.Method == http.MethodPut:
+		s.putAvailability(w, r)
+	case r.URL.Path == "/availability" && r.Method == http.MethodGet:
+		s.getAvailability(w)
+	case r.URL.Path == "/reservations" && r.Method == http.MethodGet:
+		s.getReservations(w, r)
+	case r.URL.Path == "/reservations" && r.Method == http.MethodPost:
+		s.postReservation(w, r)
+	case strings.HasPrefix(r.URL.Path, "/reservations/") && strings.HasSuffix(r.URL.Path, "/cancel") && r.Method == http.MethodPost:
+		reference := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/reservations/"), "/cancel")
+		b, err := s.Cancel(reference)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, toBookingJSON(b))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Simulator) putAvailability(w http.ResponseWriter, r *http.Request) {
+	var body []availabilityJSON
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var updates []Availability
+	for _, j := range body {
+		date, err := time.Parse(dateLayout, j.Date)
+		if err != nil || j.RoomCode == "" || j.Rate < 0 {
+			http.Error(w, fmt.Sprintf("invalid availability for %q on %q", j.RoomCode, j.Date), http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, Availability{RoomCode: j.RoomCode, Date: date, Open: j.Open, Rate: j.Rate})
+	}
+
+	s.mu.Lock()
+	for _, u := range updates {
+		if s.availability[u.RoomCode] == nil {
+			s.availability[u.RoomCode] = make(map[string]Availability)
+		}
+		s.availability[u.RoomCode][u.Date.Format(dateLayout)] = u
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Simulator) getAvailability(w http.ResponseWriter) {
+	s.mu.Lock()
+	body := []availabilityJSON{}
+	for _, nights := range s.availability {
+		for _, a := range nights {
+			body = append(body, availabilityJSON{RoomCode: a.RoomCode, Date: a.Date.Format(dateLayout), Open: a.Open, Rate: a.Rate})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(body, func(i, j int) bool {
+		if body[i].RoomCode != body[j].RoomCode {
+			return body[i].RoomCode < body[j].RoomCode
+		}
+		return body[i].Date < body[j].Date
+	})
+
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Simulator) getReservations(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+
+	body := []bookingJSON{}
+	for _, b := range s.Bookings(since) {
+		body = append(body, toBookingJSON(b))
+	}
+
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Simulator) postReservation(w http.ResponseWriter, r *http.Request) {
+	var j bookingJSON
+	err := json.NewDecoder(r.Body).Decode(&j)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err := fromBookingJSON(j)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err = s.Book(b)
+	if errors.Is(err, ErrClosed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toBookingJSON(b))
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	out, err := json.MarshalIndent(body, "", "     ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
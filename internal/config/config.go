@@ -4,7 +4,10 @@ import (
 	"html/template"
 	"log"
 
+	"github.com/NganJason/hotel-booking/internal/events"
 	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/payments"
+	"github.com/NganJason/hotel-booking/internal/tokens"
 	"github.com/alexedwards/scs/v2"
 )
 
@@ -15,4 +18,13 @@ type AppConfig struct {
 	InfoLog 		*log.Logger
 	ErrorLog 		*log.Logger
 	MailChan		chan models.MailData
+	BaseCurrency	string
+	Payments		payments.Gateway
+	Links			*tokens.Signer
+	BaseURL			string
+	Waitlist		chan models.FreedInventory
+	Webhooks		chan struct{}
+	Bus				*events.Bus
+	Events			chan struct{}
+	CalendarFeedDir	string
 }
\ No newline at end of file
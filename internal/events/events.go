@@ -0,0 +1,262 @@
+// Package events is an in-process bus for things that happen in the hotel, such as a reservation being made,
+// so side effects like emails and webhooks subscribe to them instead of being called from every handler.
+//
+// Events are not published straight away. They are saved to an outbox in the same transaction as the change
+// they describe, and published from there once it has been committed, so subscribers never hear of a change
+// that was rolled back.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is something that has happened
+type Event interface {
+	// Name identifies the type of event in the outbox
+	Name() string
+}
+
+// Where reservations are made
+const (
+	SourceWebsite = "website"
+	SourceGroup   = "group"
+	SourceChannel = "channel"
+)
+
+// ReservationCreated is published when a reservation is made, from Source
+type ReservationCreated struct {
+	ReservationID int    `json:"reservation_id"`
+	Source        string `json:"source"`
+}
+
+func (ReservationCreated) Name() string { return "reservation.created" }
+
+// ReservationConfirmed is published when a pending reservation is confirmed, once its deposit is paid or by staff
+type ReservationConfirmed struct {
+	ReservationID int `json:"reservation_id"`
+}
+
+func (ReservationConfirmed) Name() string { return "reservation.confirmed" }
+
+// ReservationCancelled is published when a reservation is cancelled, by the guest, staff, the system or a channel.
+// Actor is who cancelled it, if it was through a status change, and Refunded what was refunded to the guest.
+type ReservationCancelled struct {
+	ReservationID int    `json:"reservation_id"`
+	Actor         string `json:"actor,omitempty"`
+	Refunded      int    `json:"refunded,omitempty"`
+}
+
+func (ReservationCancelled) Name() string { return "reservation.cancelled" }
+
+// ReservationModified is published when a reservation's guest details, dates, room or status change,
+// other than by it being cancelled
+type ReservationModified struct {
+	ReservationID int `json:"reservation_id"`
+}
+
+func (ReservationModified) Name() string { return "reservation.modified" }
+
+// DatesChanged is published once a reservation moved to new dates has been settled, having been refunded
+// Refunded or owing a further deposit of Due. The rest of the fields are what the reservation was before.
+type DatesChanged struct {
+	ReservationID int       `json:"reservation_id"`
+	StartDate     time.Time `json:"start_date"`
+	EndDate       time.Time `json:"end_date"`
+	Total         int       `json:"total"`
+	Refunded      int       `json:"refunded"`
+	Due           int       `json:"due"`
+}
+
+func (DatesChanged) Name() string { return "reservation.dates_changed" }
+
+// GroupBooked is published when the last room of a booking group still pending is confirmed
+type GroupBooked struct {
+	GroupID int `json:"group_id"`
+}
+
+func (GroupBooked) Name() string { return "group.booked" }
+
+// WaitlistJoined is published when a guest joins the waitlist
+type WaitlistJoined struct {
+	EntryID int `json:"entry_id"`
+}
+
+func (WaitlistJoined) Name() string { return "waitlist.joined" }
+
+// WaitlistOffered is published when a room that has come free is offered to a guest on the waitlist
+type WaitlistOffered struct {
+	EntryID int `json:"entry_id"`
+}
+
+func (WaitlistOffered) Name() string { return "waitlist.offered" }
+
+// BlockAdded is published when a room is taken off sale. BlockID is the block's, or 0 for a single night
+// blocked from the reservations calendar.
+type BlockAdded struct {
+	BlockID   int       `json:"block_id"`
+	RoomID    int       `json:"room_id"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
+
+func (BlockAdded) Name() string { return "block.added" }
+
+// BlockChanged is published when a block is moved, resized or deleted, so nights may have been taken off sale
+// or put back on it. BlockID is the block's, or 0 for a single night unblocked from the reservations calendar.
+// The dates are the block's after the change, or before it for a deletion.
+type BlockChanged struct {
+	BlockID   int       `json:"block_id"`
+	RoomID    int       `json:"room_id"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	Deleted   bool      `json:"deleted"`
+}
+
+func (BlockChanged) Name() string { return "block.changed" }
+
+// UserLoggedIn is published when a staff user logs in
+type UserLoggedIn struct {
+	UserID    int    `json:"user_id"`
+	IPAddress string `json:"ip_address"`
+}
+
+func (UserLoggedIn) Name() string { return "user.logged_in" }
+
+// Encode returns the event as saved in the outbox
+func Encode(e Event) (string, error) {
+	out, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// Decode returns the event with the name saved in the outbox
+func Decode(name, payload string) (Event, error) {
+	var e Event
+	var err error
+
+	switch name {
+	case ReservationCreated{}.Name():
+		var created ReservationCreated
+		err = json.Unmarshal([]byte(payload), &created)
+		e = created
+	case ReservationConfirmed{}.Name():
+		var confirmed ReservationConfirmed
+		err = json.Unmarshal([]byte(payload), &confirmed)
+		e = confirmed
+	case ReservationCancelled{}.Name():
+		var cancelled ReservationCancelled
+		err = json.Unmarshal([]byte(payload), &cancelled)
+		e = cancelled
+	case ReservationModified{}.Name():
+		var modified ReservationModified
+		err = json.Unmarshal([]byte(payload), &modified)
+		e = modified
+	case DatesChanged{}.Name():
+		var changed DatesChanged
+		err = json.Unmarshal([]byte(payload), &changed)
+		e = changed
+	case GroupBooked{}.Name():
+		var booked GroupBooked
+		err = json.Unmarshal([]byte(payload), &booked)
+		e = booked
+	case WaitlistJoined{}.Name():
+		var joined WaitlistJoined
+		err = json.Unmarshal([]byte(payload), &joined)
+		e = joined
+	case WaitlistOffered{}.Name():
+		var offered WaitlistOffered
+		err = json.Unmarshal([]byte(payload), &offered)
+		e = offered
+	case BlockAdded{}.Name():
+		var added BlockAdded
+		err = json.Unmarshal([]byte(payload), &added)
+		e = added
+	case BlockChanged{}.Name():
+		var changed BlockChanged
+		err = json.Unmarshal([]byte(payload), &changed)
+		e = changed
+	case UserLoggedIn{}.Name():
+		var login UserLoggedIn
+		err = json.Unmarshal([]byte(payload), &login)
+		e = login
+	default:
+		return nil, fmt.Errorf("unknown event %q", name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Handler reacts to an event
+type Handler func(e Event) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// Bus passes each event published to the handlers subscribed to its type
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[string][]subscriber
+}
+
+// NewBus returns a bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[string][]subscriber)}
+}
+
+// Subscribe calls h with every event published of the same type as e, after the handlers subscribed before it.
+// The name tells which handlers have already handled an event, so it has to be unique for the type of event.
+func (b *Bus) Subscribe(e Event, name string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, s := range b.subscribers[e.Name()] {
+		if s.name == name {
+			panic(fmt.Sprintf("events: %s already has a subscriber named %s", e.Name(), name))
+		}
+	}
+
+	b.subscribers[e.Name()] = append(b.subscribers[e.Name()], subscriber{name: name, handler: h})
+}
+
+// Publish calls the handlers subscribed to the event in turn, leaving out those named in done, which have
+// already handled it. Every handler is called even if one fails. It returns the names of the handlers that
+// succeeded, and the failures together.
+func (b *Bus) Publish(e Event, done map[string]bool) ([]string, error) {
+	b.mu.RLock()
+	subscribers := b.subscribers[e.Name()]
+	b.mu.RUnlock()
+
+	var handled []string
+	var failed []string
+	for _, s := range subscribers {
+		if done[s.name] {
+			continue
+		}
+
+		err := s.handler(e)
+		if err != nil {
+			failed = append(failed, s.name+": "+err.Error())
+			continue
+		}
+		handled = append(handled, s.name)
+	}
+
+	if len(failed) > 0 {
+		return handled, fmt.Errorf("%s: %s", e.Name(), strings.Join(failed, "; "))
+	}
+
+	return handled, nil
+}
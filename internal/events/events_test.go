@@ -0,0 +1,109 @@
+package events
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name        string
+		failing     map[string]bool
+		done        map[string]bool
+		wantCalled  []string
+		wantHandled []string
+		wantErr     bool
+	}{
+		{"all succeed", nil, nil, []string{"a", "b", "c"}, []string{"a", "b", "c"}, false},
+		{"one fails, the rest still run", map[string]bool{"b": true}, nil, []string{"a", "b", "c"}, []string{"a", "c"}, true},
+		{"all fail", map[string]bool{"a": true, "b": true, "c": true}, nil, []string{"a", "b", "c"}, nil, true},
+		{"retry skips those done", nil, map[string]bool{"a": true, "c": true}, []string{"b"}, []string{"b"}, false},
+		{"retry fails again", map[string]bool{"b": true}, map[string]bool{"a": true}, []string{"b", "c"}, []string{"c"}, true},
+		{"nothing left to do", nil, map[string]bool{"a": true, "b": true, "c": true}, nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		var called []string
+		bus := NewBus()
+		for _, name := range []string{"a", "b", "c"} {
+			name := name
+			bus.Subscribe(ReservationCreated{}, name, func(e Event) error {
+				called = append(called, name)
+				if tt.failing[name] {
+					return errors.New("failed")
+				}
+				return nil
+			})
+		}
+		bus.Subscribe(ReservationCancelled{}, "a", func(e Event) error {
+			t.Errorf("%s: handler of another event called", tt.name)
+			return nil
+		})
+
+		handled, err := bus.Publish(ReservationCreated{ReservationID: 1}, tt.done)
+
+		if !reflect.DeepEqual(called, tt.wantCalled) {
+			t.Errorf("%s: called %v, want %v", tt.name, called, tt.wantCalled)
+		}
+		if !reflect.DeepEqual(handled, tt.wantHandled) {
+			t.Errorf("%s: handled %v, want %v", tt.name, handled, tt.wantHandled)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSubscribeSameNameTwice(t *testing.T) {
+	bus := NewBus()
+	bus.Subscribe(ReservationCreated{}, "a", func(e Event) error { return nil })
+	bus.Subscribe(ReservationCancelled{}, "a", func(e Event) error { return nil })
+
+	defer func() {
+		if recover() == nil {
+			t.Error("subscribing a second handler named a to the same event didn't panic")
+		}
+	}()
+	bus.Subscribe(ReservationCreated{}, "a", func(e Event) error { return nil })
+}
+
+func TestEncodeDecode(t *testing.T) {
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	tests := []Event{
+		ReservationCreated{ReservationID: 1, Source: SourceWebsite},
+		ReservationConfirmed{ReservationID: 2},
+		ReservationCancelled{ReservationID: 2, Actor: "guest", Refunded: 5000},
+		ReservationModified{ReservationID: 3},
+		DatesChanged{ReservationID: 3, StartDate: start, EndDate: start.AddDate(0, 0, 1), Total: 10000, Refunded: 2500},
+		GroupBooked{GroupID: 7},
+		WaitlistJoined{EntryID: 8},
+		WaitlistOffered{EntryID: 8},
+		BlockAdded{BlockID: 4, RoomID: 5, StartDate: start, EndDate: start.AddDate(0, 0, 2)},
+		BlockChanged{BlockID: 4, RoomID: 5, StartDate: start, EndDate: start.AddDate(0, 0, 1), Deleted: true},
+		UserLoggedIn{UserID: 6, IPAddress: "192.0.2.1"},
+	}
+
+	for _, e := range tests {
+		payload, err := Encode(e)
+		if err != nil {
+			t.Errorf("Encode(%#v): %v", e, err)
+			continue
+		}
+
+		got, err := Decode(e.Name(), payload)
+		if err != nil {
+			t.Errorf("Decode(%s, %s): %v", e.Name(), payload, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, e) {
+			t.Errorf("Decode(%s, %s) = %#v, want %#v", e.Name(), payload, got, e)
+		}
+	}
+
+	if _, err := Decode("no.such.event", "{}"); err == nil {
+		t.Error("Decode of an unknown event didn't fail")
+	}
+}
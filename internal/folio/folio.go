@@ -0,0 +1,102 @@
+package folio
+
+import (
+	"fmt"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/pricing"
+)
+
+// New builds the folio of a reservation from the charges it was sold with and the payments taken against it
+func New(res models.Reservation, payments []models.Payment) models.Folio {
+	var f models.Folio
+
+	// the room charge is posted night by night; any rounding remainder goes on the last night
+	nights := pricing.Nights(res.StartDate, res.EndDate)
+	if nights > 0 {
+		nightly := res.Subtotal / nights
+		for i := 0; i < nights; i++ {
+			amount := nightly
+			if i == nights-1 {
+				amount = res.Subtotal - nightly*(nights-1)
+			}
+			charge(&f, models.FolioLine{
+				Date:        res.StartDate.AddDate(0, 0, i),
+				Description: fmt.Sprintf("Room %s", res.Room.RoomName),
+				Quantity:    1,
+				Amount:      amount,
+			})
+		}
+	}
+
+	if res.Discount > 0 {
+		charge(&f, models.FolioLine{
+			Date:        res.StartDate,
+			Description: fmt.Sprintf("Discount %s", res.PromoCode),
+			Quantity:    1,
+			Amount:      -res.Discount,
+		})
+	}
+
+	for _, e := range res.Extras {
+		charge(&f, models.FolioLine{
+			Date:        res.StartDate,
+			Description: e.Name,
+			Quantity:    e.Quantity,
+			Amount:      e.Amount,
+		})
+	}
+
+	for _, t := range res.Taxes {
+		charge(&f, models.FolioLine{
+			Date:        res.StartDate,
+			Description: t.Name,
+			Quantity:    t.Quantity,
+			Amount:      t.Amount,
+		})
+	}
+
+	for _, p := range payments {
+		if p.Status != models.PaymentCaptured && p.Status != models.PaymentRefunded {
+			continue
+		}
+
+		credit(&f, models.FolioLine{
+			Date:        p.CreatedAt,
+			Description: cardDescription("Payment", p),
+			Quantity:    1,
+			Amount:      p.Amount,
+		})
+
+		if p.RefundedAmount > 0 {
+			credit(&f, models.FolioLine{
+				Date:        p.UpdatedAt,
+				Description: cardDescription("Refund", p),
+				Quantity:    1,
+				Amount:      -p.RefundedAmount,
+			})
+		}
+	}
+
+	f.Balance = f.Charges - f.Paid
+
+	return f
+}
+
+func charge(f *models.Folio, line models.FolioLine) {
+	f.Lines = append(f.Lines, line)
+	f.Charges += line.Amount
+}
+
+func credit(f *models.Folio, line models.FolioLine) {
+	line.Credit = true
+	f.Lines = append(f.Lines, line)
+	f.Paid += line.Amount
+}
+
+func cardDescription(what string, p models.Payment) string {
+	if p.CardLast4 == "" {
+		return what
+	}
+	return fmt.Sprintf("%s card ending %s", what, p.CardLast4)
+}
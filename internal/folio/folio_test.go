@@ -0,0 +1,100 @@
+package folio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+func TestNew(t *testing.T) {
+	arrival := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	res := models.Reservation{
+		StartDate: arrival,
+		EndDate:   arrival.AddDate(0, 0, 3),
+		Room:      models.Room{RoomName: "General's Quarters"},
+		Subtotal:  10001,
+		Discount:  1000,
+		PromoCode: "SUMMER",
+		Extras:    []models.ReservationExtra{{Name: "Breakfast", Quantity: 3, Amount: 1500}},
+		Taxes:     []models.ReservationTax{{Name: "City tax", Quantity: 3, Amount: 700}},
+	}
+
+	tests := []struct {
+		name     string
+		payments []models.Payment
+		credits  []int
+		paid     int
+	}{
+		{"nothing paid", nil, nil, 0},
+		{
+			name: "only captured and refunded payments count",
+			payments: []models.Payment{
+				{Status: models.PaymentCaptured, Amount: 5000, RefundedAmount: 1000, CardLast4: "4242"},
+				{Status: models.PaymentAuthorized, Amount: 3000},
+				{Status: models.PaymentFailed, Amount: 3000},
+				{Status: models.PaymentVoided, Amount: 3000},
+				{Status: models.PaymentRefunded, Amount: 2000, RefundedAmount: 2000},
+			},
+			credits: []int{5000, -1000, 2000, -2000},
+			paid:    4000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := New(res, tt.payments)
+
+			var charges, credits []int
+			for _, l := range f.Lines {
+				if l.Credit {
+					credits = append(credits, l.Amount)
+				} else {
+					charges = append(charges, l.Amount)
+				}
+			}
+
+			// three nights split 3333, 3333 and the remainder, then discount, extra and tax
+			wantCharges := []int{3333, 3333, 3335, -1000, 1500, 700}
+			if !equal(charges, wantCharges) {
+				t.Errorf("charges: got %v, want %v", charges, wantCharges)
+			}
+			if !equal(credits, tt.credits) {
+				t.Errorf("credits: got %v, want %v", credits, tt.credits)
+			}
+			if f.Charges != 11201 {
+				t.Errorf("total charges: got %d, want 11201", f.Charges)
+			}
+			if f.Paid != tt.paid {
+				t.Errorf("paid: got %d, want %d", f.Paid, tt.paid)
+			}
+			if f.Balance != f.Charges-tt.paid {
+				t.Errorf("balance: got %d, want %d", f.Balance, f.Charges-tt.paid)
+			}
+			if f.Lines[2].Date != arrival.AddDate(0, 0, 2) {
+				t.Errorf("last night posted on %s", f.Lines[2].Date)
+			}
+		})
+	}
+}
+
+func TestNewWithoutNights(t *testing.T) {
+	arrival := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	f := New(models.Reservation{StartDate: arrival, EndDate: arrival}, nil)
+
+	if len(f.Lines) != 0 || f.Balance != 0 {
+		t.Errorf("expected an empty folio, got %+v", f)
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package folio
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// WritePDF renders an invoice for the folio as an A4 PDF. money formats amounts in cents of the base currency.
+func WritePDF(w io.Writer, inv models.Invoice, res models.Reservation, f models.Folio, money func(int) string) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetTitle(inv.Label(), true)
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, "Invoice "+inv.Label(), "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 5, "Issued: "+inv.IssuedAt.Format("2006-01-02"), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 5, fmt.Sprintf("Reservation: #%d", res.ID), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(0, 5, "Bill to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 5, tr(res.FirstName+" "+res.LastName), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 5, tr(res.Email), "", 1, "L", false, 0, "")
+	if res.Phone != "" {
+		pdf.CellFormat(0, 5, tr(res.Phone), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(2)
+	pdf.CellFormat(0, 5, tr(fmt.Sprintf("%s, %s to %s", res.Room.RoomName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"))), "", 1, "L", false, 0, "")
+	pdf.Ln(6)
+
+	widths := []float64{30, 90, 15, 35}
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(230, 230, 230)
+	for i, heading := range []string{"Date", "Description", "Qty", "Amount"} {
+		align := "L"
+		if i >= 2 {
+			align = "R"
+		}
+		pdf.CellFormat(widths[i], 7, heading, "B", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range f.Lines {
+		pdf.CellFormat(widths[0], 6, line.Date.Format("2006-01-02"), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 6, tr(line.Description), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[2], 6, fmt.Sprintf("%d", line.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, tr(money(line.Signed())), "", 1, "R", false, 0, "")
+	}
+
+	pdf.Ln(2)
+	totals := widths[0] + widths[1] + widths[2]
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(totals, 6, "Total charges", "T", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[3], 6, tr(money(f.Charges)), "T", 1, "R", false, 0, "")
+	pdf.CellFormat(totals, 6, "Paid", "", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[3], 6, tr(money(f.Paid)), "", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(totals, 7, "Balance due", "", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[3], 7, tr(money(f.Balance)), "", 1, "R", false, 0, "")
+
+	return pdf.Output(w)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/availability"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// alternativeDays is how many days either side of the dates searched alternatives are looked for
+const alternativeDays = 3
+
+// maxAlternatives is the most alternatives suggested for one search
+const maxAlternatives = 6
+
+// alternativeJSON is an alternative stay in the availability API
+type alternativeJSON struct {
+	Kind      string     `json:"kind"`
+	StartDate string     `json:"start_date"`
+	EndDate   string     `json:"end_date"`
+	ShiftDays int        `json:"shift_days,omitempty"`
+	Rooms     []roomJSON `json:"rooms,omitempty"`
+	Legs      []legJSON  `json:"legs,omitempty"`
+}
+
+type roomJSON struct {
+	ID       int    `json:"id"`
+	RoomName string `json:"room_name"`
+}
+
+type legJSON struct {
+	Room      roomJSON `json:"room"`
+	StartDate string   `json:"start_date"`
+	EndDate   string   `json:"end_date"`
+}
+
+// suggestAlternatives returns the stays closest to the dates searched, in rooms that sleep guests,
+// when the room searched, or with roomID 0 every room, isn't free for all of them
+func (repo *Repository) suggestAlternatives(start, end time.Time, guests, roomID int) ([]models.Alternative, error) {
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	restrictions, err := repo.DB.GetRestrictionsForAllRoomsByDate(start.AddDate(0, 0, -alternativeDays), end.AddDate(0, 0, alternativeDays))
+	if err != nil {
+		return nil, err
+	}
+
+	grid := availability.NewGrid(roomsFor(rooms, guests), restrictions)
+	today := dayOf(time.Now())
+
+	return availability.Suggest(grid, roomID, start, end, today, alternativeDays, maxAlternatives), nil
+}
+
+func alternativesJSON(alternatives []models.Alternative) []alternativeJSON {
+	layout := "2006-01-02"
+
+	var out []alternativeJSON
+	for _, alt := range alternatives {
+		a := alternativeJSON{
+			Kind:      alt.Kind,
+			StartDate: alt.StartDate.Format(layout),
+			EndDate:   alt.EndDate.Format(layout),
+			ShiftDays: alt.ShiftDays,
+		}
+		for _, room := range alt.Rooms {
+			a.Rooms = append(a.Rooms, roomJSON{ID: room.ID, RoomName: room.RoomName})
+		}
+		for _, leg := range alt.Legs {
+			a.Legs = append(a.Legs, legJSON{
+				Room:      roomJSON{ID: leg.Room.ID, RoomName: leg.Room.RoomName},
+				StartDate: leg.StartDate.Format(layout),
+				EndDate:   leg.EndDate.Format(layout),
+			})
+		}
+		out = append(out, a)
+	}
+
+	return out
+}
+
+// PostSplitStay starts booking a suggested split stay: one room up to the change date, another room after it.
+// The two rooms are booked together like a group, so the guest gets both or neither.
+func (repo *Repository) PostSplitStay(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	start, end, err := parseStayDates(r)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	change, err := time.Parse("2006-01-02", r.Form.Get("change_date"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	firstID, err := strconv.Atoi(r.Form.Get("first_room_id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	secondID, err := strconv.Atoi(r.Form.Get("second_room_id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !change.After(start) || !end.After(change) || firstID == secondID || start.Before(dayOf(time.Now())) {
+		repo.App.Session.Put(r.Context(), "error", "That split stay is no longer valid, please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	var group models.BookingGroup
+	legs := []models.AlternativeLeg{
+		{Room: models.Room{ID: firstID}, StartDate: start, EndDate: change},
+		{Room: models.Room{ID: secondID}, StartDate: change, EndDate: end},
+	}
+	for _, leg := range legs {
+		room, err := repo.DB.GetRoomByID(leg.Room.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		policy, err := repo.policyForRoom(room)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		group.Reservations = append(group.Reservations, models.Reservation{
+			RoomID:    room.ID,
+			Room:      room,
+			StartDate: leg.StartDate,
+			EndDate:   leg.EndDate,
+			Guests:    1,
+			Policy:    policy,
+		})
+	}
+
+	_, err = repo.holdRooms(r, group.Reservations)
+	if err == repository.ErrRoomUnavailable {
+		repo.groupRoomTaken(w, r)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "group", group)
+	http.Redirect(w, r, "/make-group-reservation", http.StatusSeeOther)
+}
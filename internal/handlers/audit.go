@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// auditLogSize is the most entries shown on the audit log page
+const auditLogSize = 200
+
+// auditHistorySize is the most entries shown in a reservation's history
+const auditHistorySize = 50
+
+// auditedReservation is what the audit log keeps of a reservation
+type auditedReservation struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	Status    string `json:"status"`
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Total     string `json:"total"`
+}
+
+func auditReservation(res models.Reservation) auditedReservation {
+	return auditedReservation{
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		Phone:     res.Phone,
+		Status:    res.Status,
+		RoomID:    res.RoomID,
+		StartDate: res.StartDate.Format("2006-01-02"),
+		EndDate:   res.EndDate.Format("2006-01-02"),
+		Total:     render.FormatMoney(res.Total),
+	}
+}
+
+// auditedPayment is what the audit log keeps of a payment against a reservation. A payment taken at the
+// front desk is audited before it is saved, so without its id.
+type auditedPayment struct {
+	PaymentID int    `json:"payment_id,omitempty"`
+	Amount    string `json:"amount"`
+	Refunded  string `json:"refunded"`
+	Status    string `json:"payment_status"`
+	Message   string `json:"message"`
+}
+
+func auditPayment(p models.Payment) auditedPayment {
+	return auditedPayment{
+		PaymentID: p.ID,
+		Amount:    render.FormatMoney(p.Amount),
+		Refunded:  render.FormatMoney(p.RefundedAmount),
+		Status:    p.Status,
+		Message:   p.Message,
+	}
+}
+
+// auditedGroup is what the audit log keeps of a booking group
+type auditedGroup struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+}
+
+func auditGroup(g models.BookingGroup) auditedGroup {
+	return auditedGroup{
+		FirstName: g.FirstName,
+		LastName:  g.LastName,
+		Email:     g.Email,
+		Phone:     g.Phone,
+	}
+}
+
+// auditedBlock is what the audit log keeps of a block
+type auditedBlock struct {
+	RoomID      int    `json:"room_id"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Reason      string `json:"reason"`
+	Recurrence  string `json:"recurrence"`
+	RepeatUntil string `json:"repeat_until,omitempty"`
+}
+
+func auditBlock(b models.Block) auditedBlock {
+	a := auditedBlock{
+		RoomID:     b.RoomID,
+		StartDate:  b.StartDate.Format("2006-01-02"),
+		EndDate:    b.EndDate.Format("2006-01-02"),
+		Reason:     b.Reason,
+		Recurrence: b.Recurrence,
+	}
+	if !b.RepeatUntil.IsZero() {
+		a.RepeatUntil = b.RepeatUntil.Format("2006-01-02")
+	}
+	return a
+}
+
+// auditedLinks is what the audit log keeps of a reservation's manage links
+type auditedLinks struct {
+	Version int `json:"manage_link_version"`
+}
+
+// auditedPromotion is what the audit log keeps of a promotion
+type auditedPromotion struct {
+	Code         string `json:"code"`
+	Description  string `json:"description"`
+	DiscountType string `json:"discount_type"`
+	Amount       string `json:"amount"`
+	ValidFrom    string `json:"valid_from"`
+	ValidTo      string `json:"valid_to"`
+	MinNights    int    `json:"min_nights"`
+	MaxUses      int    `json:"max_uses"`
+	Active       bool   `json:"active"`
+	RoomIDs      []int  `json:"room_ids"`
+}
+
+func auditPromotion(p models.Promotion) auditedPromotion {
+	a := auditedPromotion{
+		Code:         p.Code,
+		Description:  p.Description,
+		DiscountType: p.DiscountType,
+		Amount:       render.FormatMoney(p.Amount),
+		ValidFrom:    p.ValidFrom.Format("2006-01-02"),
+		ValidTo:      p.ValidTo.Format("2006-01-02"),
+		MinNights:    p.MinNights,
+		MaxUses:      p.MaxUses,
+		Active:       p.Active,
+		RoomIDs:      p.RoomIDs,
+	}
+	if p.DiscountType == models.DiscountPercent {
+		a.Amount = fmt.Sprintf("%d%%", p.Amount)
+	}
+	return a
+}
+
+// auditedTaxRule is what the audit log keeps of a tax or fee rule
+type auditedTaxRule struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Basis  string `json:"basis"`
+	Amount string `json:"amount"`
+	Active bool   `json:"active"`
+}
+
+func auditTaxRule(t models.TaxRule) auditedTaxRule {
+	a := auditedTaxRule{
+		Name:   t.Name,
+		Kind:   t.Kind,
+		Basis:  t.Basis,
+		Amount: render.FormatMoney(t.Amount),
+		Active: t.Active,
+	}
+	if t.Basis == models.TaxPercentage {
+		a.Amount = render.FormatAmount(t.Amount) + "%"
+	}
+	return a
+}
+
+// auditedPolicy is what the audit log keeps of a cancellation policy
+type auditedPolicy struct {
+	Name                 string `json:"name"`
+	FreeCancellationDays int    `json:"free_cancellation_days"`
+	PenaltyPercent       int    `json:"penalty_percent"`
+	NonRefundable        bool   `json:"non_refundable"`
+	DepositPercent       int    `json:"deposit_percent"`
+	BalanceDueDays       int    `json:"balance_due_days"`
+}
+
+func auditPolicy(p models.CancellationPolicy) auditedPolicy {
+	return auditedPolicy{
+		Name:                 p.Name,
+		FreeCancellationDays: p.FreeCancellationDays,
+		PenaltyPercent:       p.PenaltyPercent,
+		NonRefundable:        p.NonRefundable,
+		DepositPercent:       p.DepositPercent,
+		BalanceDueDays:       p.BalanceDueDays,
+	}
+}
+
+// auditedExtra is what the audit log keeps of an extra
+type auditedExtra struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Price       string `json:"price"`
+	PricingUnit string `json:"pricing_unit"`
+	Active      bool   `json:"active"`
+}
+
+func auditExtra(e models.Extra) auditedExtra {
+	return auditedExtra{
+		Name:        e.Name,
+		Description: e.Description,
+		Price:       render.FormatMoney(e.Price),
+		PricingUnit: e.PricingUnit,
+		Active:      e.Active,
+	}
+}
+
+// auditedCurrency is what the audit log keeps of a currency and its exchange rate
+type auditedCurrency struct {
+	Code     string  `json:"code"`
+	Symbol   string  `json:"symbol"`
+	Decimals int     `json:"decimals"`
+	Rate     float64 `json:"rate"`
+	Active   bool    `json:"active"`
+}
+
+func auditCurrency(c models.Currency) auditedCurrency {
+	return auditedCurrency{
+		Code:     c.Code,
+		Symbol:   c.Symbol,
+		Decimals: c.Decimals,
+		Rate:     c.Rate,
+		Active:   c.Active,
+	}
+}
+
+// auditedWebhook is what the audit log keeps of a webhook. The signing secret is redacted.
+type auditedWebhook struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+}
+
+func auditWebhook(w models.Webhook) auditedWebhook {
+	return auditedWebhook{
+		Name:   w.Name,
+		URL:    auditURL(w.URL),
+		Secret: redacted(w.Secret),
+		Events: w.Events,
+		Active: w.Active,
+	}
+}
+
+// auditedChannel is what the audit log keeps of a channel, with the code of each room sold on it by room id.
+// The API key is redacted.
+type auditedChannel struct {
+	Name      string         `json:"name"`
+	URL       string         `json:"url"`
+	APIKey    string         `json:"api_key"`
+	Active    bool           `json:"active"`
+	RoomCodes map[int]string `json:"room_codes"`
+}
+
+func auditChannel(c models.Channel) auditedChannel {
+	a := auditedChannel{
+		Name:      c.Name,
+		URL:       auditURL(c.URL),
+		APIKey:    redacted(c.APIKey),
+		Active:    c.Active,
+		RoomCodes: make(map[int]string),
+	}
+	for _, cr := range c.Rooms {
+		a.RoomCodes[cr.RoomID] = cr.RoomCode
+	}
+	return a
+}
+
+// auditedCalendarSource is what the audit log keeps of a calendar source
+type auditedCalendarSource struct {
+	RoomID int    `json:"room_id"`
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+}
+
+func auditCalendarSource(s models.CalendarSource) auditedCalendarSource {
+	return auditedCalendarSource{
+		RoomID: s.RoomID,
+		Name:   s.Name,
+		URL:    auditURL(s.URL),
+	}
+}
+
+// auditedFrontDesk is what the audit log keeps of the key and identification recorded at check-in.
+// The document number is redacted.
+type auditedFrontDesk struct {
+	RoomKey    string `json:"room_key"`
+	IDDocument string `json:"id_document"`
+}
+
+func auditFrontDesk(res models.Reservation) auditedFrontDesk {
+	return auditedFrontDesk{
+		RoomKey:    res.RoomKey,
+		IDDocument: redacted(res.IDDocument),
+	}
+}
+
+// redacted keeps only the last four characters of a secret, key or document number, enough to tell one
+// from another in the audit log. Anything shorter is hidden completely.
+func redacted(s string) string {
+	r := []rune(s)
+	if len(r) <= 4 {
+		return strings.Repeat("*", len(r))
+	}
+	return "****" + string(r[len(r)-4:])
+}
+
+// auditURL drops the credentials, query and fragment from an address, as they often carry an access token
+func auditURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	return u.String()
+}
+
+// auditedSave returns the repository to create or update an entity through, audited as audited does.
+// An entity with no id is being created, so there is nothing before.
+func (repo *Repository) auditedSave(r *http.Request, entity string, entityID int, before, after interface{}) (repository.DatabaseRepo, error) {
+	if entityID == 0 {
+		return repo.audited(r, models.AuditCreate, entity, 0, nil, after)
+	}
+	return repo.audited(r, models.AuditUpdate, entity, entityID, before, after)
+}
+
+// audited returns the repository to save a change made by the logged in user through, which records the
+// change in the audit log in the same transaction, with what the entity was like before and after. Pass nil
+// for before when something is created and for after when it is deleted. The id of an entity that is yet
+// to be created is 0, and is filled in once it has been.
+func (repo *Repository) audited(r *http.Request, action, entity string, entityID int, before, after interface{}) (repository.DatabaseRepo, error) {
+	e, err := repo.auditEntry(r, action, entity, entityID, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.DB.Audited(e), nil
+}
+
+// auditLogin records a staff user logging in. It is called from the event bus.
+func (repo *Repository) auditLogin(e events.Event) error {
+	login := e.(events.UserLoggedIn)
+
+	u, err := repo.DB.GetUserByID(login.UserID)
+	if err != nil {
+		return err
+	}
+
+	return repo.DB.InsertAuditEntry(models.AuditEntry{
+		UserID:    login.UserID,
+		UserName:  u.FirstName + " " + u.LastName,
+		IPAddress: login.IPAddress,
+		Action:    models.AuditLogin,
+		Entity:    models.AuditUser,
+		EntityID:  login.UserID,
+	})
+}
+
+// auditEntry describes a change made by the logged in user, as audited does
+func (repo *Repository) auditEntry(r *http.Request, action, entity string, entityID int, before, after interface{}) (models.AuditEntry, error) {
+	e := models.AuditEntry{
+		UserID:    repo.App.Session.GetInt(r.Context(), "user_id"),
+		IPAddress: helpers.ClientIP(r),
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+	}
+
+	if e.UserID > 0 {
+		u, err := repo.DB.GetUserByID(e.UserID)
+		if err != nil {
+			return e, err
+		}
+		e.UserName = u.FirstName + " " + u.LastName
+	}
+
+	var err error
+	e.Before, err = auditJSON(before)
+	if err != nil {
+		return e, err
+	}
+	e.After, err = auditJSON(after)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func auditJSON(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// AdminAudit shows the audit log, filtered by the user, action, entity and dates in the query string
+func (repo *Repository) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var filter models.AuditFilter
+	filter.UserID, _ = strconv.Atoi(q.Get("user"))
+	filter.EntityID, _ = strconv.Atoi(q.Get("entity_id"))
+	filter.Action = q.Get("action")
+	filter.Entity = q.Get("entity")
+
+	// dates are inclusive, so the filter runs to the start of the day after
+	if from, err := time.Parse("2006-01-02", q.Get("from")); err == nil {
+		filter.From = from
+	}
+	if to, err := time.Parse("2006-01-02", q.Get("to")); err == nil {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	entries, err := repo.DB.AuditEntries(filter, auditLogSize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	users, err := repo.DB.ListUsers()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["audit"] = entries
+	data["users"] = users
+	data["actions"] = []string{models.AuditCreate, models.AuditUpdate, models.AuditDelete, models.AuditStatus,
+		models.AuditDates, models.AuditMove, models.AuditPayment, models.AuditRevokeLinks, models.AuditLogin}
+	data["entities"] = []string{models.AuditReservation, models.AuditGroup, models.AuditBlock, models.AuditRestriction, models.AuditUser,
+		models.AuditRoom, models.AuditPromotion, models.AuditTaxRule, models.AuditPolicy, models.AuditExtra, models.AuditCurrency,
+		models.AuditWebhook, models.AuditChannel, models.AuditCalendarSource}
+
+	stringMap := make(map[string]string)
+	stringMap["user"] = q.Get("user")
+	stringMap["action"] = filter.Action
+	stringMap["entity"] = filter.Entity
+	stringMap["entity_id"] = q.Get("entity_id")
+	stringMap["from"] = q.Get("from")
+	stringMap["to"] = q.Get("to")
+
+	intMap := make(map[string]int)
+	intMap["limit"] = auditLogSize
+
+	render.Template(w, r, "admin-audit.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+	})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// AdminBlocks lists all owner blocks
+func (repo *Repository) AdminBlocks(w http.ResponseWriter, r *http.Request) {
+	blocks, err := repo.DB.AllBlocks()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["blocks"] = blocks
+
+	render.Template(w, r, "admin-blocks.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowBlock shows the form to create a new block or edit an existing one
+func (repo *Repository) AdminShowBlock(w http.ResponseWriter, r *http.Request) {
+	var block models.Block
+
+	if mux.Vars(r)["id"] != "" {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		block, err = repo.DB.GetBlockByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.renderBlockForm(w, r, block, forms.New(nil))
+}
+
+// AdminPostBlock creates a new block or saves changes to an existing one
+func (repo *Repository) AdminPostBlock(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var block models.Block
+
+	if mux.Vars(r)["id"] != "" {
+		block.ID, err = strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "start_date", "end_date")
+
+	layout := "2006-01-02"
+	block.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	block.Reason = r.Form.Get("reason")
+	block.Recurrence = r.Form.Get("recurrence")
+
+	block.StartDate, err = time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+
+	block.EndDate, err = time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Invalid date")
+	} else if !block.EndDate.After(block.StartDate) {
+		form.Errors.Add("end_date", "End date must be after start date")
+	}
+
+	if block.Recurrence == models.RecurrenceWeekly {
+		block.RepeatUntil, err = time.Parse(layout, r.Form.Get("repeat_until"))
+		if err != nil {
+			form.Errors.Add("repeat_until", "A weekly block needs an end date for the repetition")
+		} else if block.RepeatUntil.Before(block.StartDate) {
+			form.Errors.Add("repeat_until", "Repeat until must not be before start date")
+		} else if block.OccurrenceCount() > models.MaxBlockOccurrences {
+			form.Errors.Add("repeat_until", fmt.Sprintf("A weekly block can repeat at most %d times", models.MaxBlockOccurrences))
+		}
+	} else if block.Recurrence != models.RecurrenceNone {
+		form.Errors.Add("recurrence", "Unknown recurrence")
+	}
+
+	if !form.Valid() {
+		repo.renderBlockForm(w, r, block, form)
+		return
+	}
+
+	if block.ID > 0 {
+		var before models.Block
+		before, err = repo.DB.GetBlockByID(block.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		var db repository.DatabaseRepo
+		db, err = repo.audited(r, models.AuditUpdate, models.AuditBlock, block.ID, auditBlock(before), auditBlock(block))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		err = db.UpdateBlock(block)
+		if err == nil {
+			// a block moved or shortened frees nights, all through the year if it repeats
+			repo.inventoryFreed(time.Time{}, time.Time{})
+		}
+	} else {
+		var db repository.DatabaseRepo
+		db, err = repo.audited(r, models.AuditCreate, models.AuditBlock, 0, nil, auditBlock(block))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		block.ID, err = db.InsertBlock(block)
+	}
+	if err == repository.ErrRoomUnavailable {
+		form.Errors.Add("start_date", "The room is reserved by a guest during this block")
+		repo.renderBlockForm(w, r, block, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.eventsSaved()
+
+	repo.App.Session.Put(r.Context(), "flash", "Block saved")
+	http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+}
+
+// AdminDeleteBlock deletes a block and all of its occurrences
+func (repo *Repository) AdminDeleteBlock(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	block, err := repo.DB.GetBlockByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	db, err := repo.audited(r, models.AuditDelete, models.AuditBlock, id, auditBlock(block), nil)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = db.DeleteBlock(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.eventsSaved()
+
+	// a recurring block frees nights all through the year, so every waiting guest is checked
+	repo.inventoryFreed(time.Time{}, time.Time{})
+
+	repo.App.Session.Put(r.Context(), "flash", "Block is deleted")
+	http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+}
+
+func (repo *Repository) renderBlockForm(w http.ResponseWriter, r *http.Request, block models.Block, form *forms.Form) {
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["block"] = block
+	data["rooms"] = rooms
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = "/admin/blocks/new"
+	if block.ID > 0 {
+		stringMap["action"] = fmt.Sprintf("/admin/blocks/%d", block.ID)
+	}
+
+	render.Template(w, r, "admin-block-show.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/availability"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// maxCalendarDays is the longest window the availability calendar returns at once
+const maxCalendarDays = 93
+
+type calendarResponse struct {
+	RoomID    int           `json:"room_id,omitempty"`
+	StartDate string        `json:"start_date"`
+	EndDate   string        `json:"end_date"`
+	Currency  string        `json:"currency"`
+	Days      []calendarDay `json:"days"`
+}
+
+type calendarDay struct {
+	Date      string `json:"date"`
+	Available bool   `json:"available"`
+	RoomsFree int    `json:"rooms_free"`
+	Price     int    `json:"price,omitempty"`
+}
+
+// AvailabilityCalendar returns whether each night can be booked, and its nightly price when it can,
+// for the booking widget's date picker. It covers ?month=YYYY-MM or ?start=&end= for the room in ?room_id=,
+// or for any room when there is none, in which case the price is the cheapest room free that night.
+func (repo *Repository) AvailabilityCalendar(w http.ResponseWriter, r *http.Request) {
+	layout := "2006-01-02"
+	query := r.URL.Query()
+
+	var start, end time.Time
+	var err error
+	if query.Get("month") != "" {
+		start, err = time.Parse("2006-01", query.Get("month"))
+		end = start.AddDate(0, 1, 0)
+	} else {
+		start, err = time.Parse(layout, query.Get("start"))
+		if err == nil {
+			end, err = time.Parse(layout, query.Get("end"))
+		}
+	}
+	if err != nil || !end.After(start) || end.After(start.AddDate(0, 0, maxCalendarDays)) {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var rooms []models.Room
+	roomID := 0
+	if query.Get("room_id") != "" {
+		roomID, err = strconv.Atoi(query.Get("room_id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		room, err := repo.DB.GetRoomByID(roomID)
+		if err == sql.ErrNoRows {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		rooms = append(rooms, room)
+	} else {
+		rooms, err = repo.DB.AllRooms()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	restrictions, err := repo.DB.GetRestrictionsForAllRoomsByDate(start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	grid := availability.NewGrid(rooms, restrictions)
+	today := dayOf(time.Now())
+
+	resp := calendarResponse{
+		RoomID:    roomID,
+		StartDate: start.Format(layout),
+		EndDate:   end.Format(layout),
+		Currency:  repo.App.BaseCurrency,
+	}
+	for _, day := range grid.Calendar(start, end, today) {
+		resp.Days = append(resp.Days, calendarDay{
+			Date:      day.Date.Format(layout),
+			Available: day.RoomsFree > 0,
+			RoomsFree: day.RoomsFree,
+			Price:     day.Price,
+		})
+	}
+
+	out, err := json.MarshalIndent(resp, "", "     ")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/ical"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// calendarFetchTimeout is how long a calendar source has to answer
+const calendarFetchTimeout = 20 * time.Second
+
+// maxCalendarSize is the largest feed read from a calendar source
+const maxCalendarSize = 5 << 20
+
+// calendarSyncLogSize is how many imports are shown in the sync log
+const calendarSyncLogSize = 50
+
+// errFileFeedsDisabled is returned for a file URL when no directory has been set aside for feed files
+var errFileFeedsDisabled = errors.New("file:// feeds are turned off, set CALENDAR_FEED_DIR to the directory they are kept in")
+
+// fetchCalendar reads the events of the feed at an http or https URL, or at a file URL in feedDir,
+// which is handy for trying a feed out from a local file
+func fetchCalendar(feed, feedDir string) ([]ical.Event, error) {
+	u, err := url.Parse(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.ReadCloser
+	switch u.Scheme {
+	case "http", "https":
+		client := http.Client{Timeout: calendarFetchTimeout}
+		resp, err := client.Get(feed)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("feed returned %s", resp.Status)
+		}
+		body = resp.Body
+	case "file":
+		path, err := feedFilePath(u, feedDir)
+		if err != nil {
+			return nil, err
+		}
+		body, err = os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported feed URL %q", feed)
+	}
+	defer body.Close()
+
+	return ical.Parse(io.LimitReader(body, maxCalendarSize))
+}
+
+// feedFilePath returns the path of the file a file URL points to, as long as it is in feedDir,
+// so that a calendar source can't be used to read any other file on the server
+func feedFilePath(u *url.URL, feedDir string) (string, error) {
+	if feedDir == "" {
+		return "", errFileFeedsDisabled
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("file:// feeds have to be on this server, not %s", u.Host)
+	}
+
+	dir, err := filepath.EvalSymlinks(feedDir)
+	if err != nil {
+		return "", err
+	}
+
+	// links are followed before checking, so one in the directory can't point outside it
+	path, err := filepath.EvalSymlinks(filepath.Clean(u.Path))
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file:// feeds have to be in %s", feedDir)
+	}
+
+	return path, nil
+}
+
+// externalBookings turns the feed's events into bookings, leaving out those already over.
+// Events sharing a UID, such as the occurrences of a repeating event, are told apart by their start date.
+func externalBookings(events []ical.Event, today time.Time) []models.ExternalBooking {
+	var bookings []models.ExternalBooking
+	seen := make(map[string]bool)
+
+	for _, e := range events {
+		if !e.End.After(today) {
+			continue
+		}
+
+		uid := e.UID
+		if uid == "" || seen[uid] {
+			uid = fmt.Sprintf("%s#%s", e.UID, e.Start.Format("2006-01-02"))
+		}
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+
+		bookings = append(bookings, models.ExternalBooking{
+			UID:       uid,
+			StartDate: e.Start,
+			EndDate:   e.End,
+		})
+	}
+
+	return bookings
+}
+
+// syncCalendarSource imports the source's feed and logs how it went. A feed that can't be read or parsed
+// is logged as failed, leaving the bookings imported before untouched.
+func (repo *Repository) syncCalendarSource(source models.CalendarSource) (models.CalendarSyncLog, error) {
+	today := dayOf(time.Now())
+
+	var result models.CalendarSyncLog
+	events, err := fetchCalendar(source.URL, repo.App.CalendarFeedDir)
+	if err == nil {
+		result, err = repo.DB.ReconcileExternalBookings(source, externalBookings(events, today))
+	}
+
+	if err != nil {
+		result = models.CalendarSyncLog{Status: models.SyncFailed, Message: helpers.Truncate(err.Error(), 255)}
+	} else if result.Conflicts > 0 {
+		result.Message = fmt.Sprintf("%d external booking(s) overlap our reservations", result.Conflicts)
+	}
+	result.SourceID = source.ID
+
+	err = repo.DB.InsertCalendarSyncLog(result)
+	if err != nil {
+		return result, err
+	}
+
+	if result.Removed > 0 || result.Updated > 0 {
+		repo.inventoryFreed(time.Time{}, time.Time{})
+	}
+
+	return result, nil
+}
+
+// SyncCalendars imports every calendar source. A source that fails is logged and the others still sync.
+func (repo *Repository) SyncCalendars() error {
+	sources, err := repo.DB.AllCalendarSources()
+	if err != nil {
+		return err
+	}
+
+	for _, source := range sources {
+		_, err = repo.syncCalendarSource(source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AdminPostCalendarSource adds a calendar source, or saves the one in the URL
+func (repo *Repository) AdminPostCalendarSource(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	source := models.CalendarSource{
+		Name: strings.TrimSpace(r.Form.Get("name")),
+		URL:  strings.TrimSpace(r.Form.Get("url")),
+	}
+
+	if mux.Vars(r)["id"] != "" {
+		source.ID, err = strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	source.RoomID, err = strconv.Atoi(r.Form.Get("room_id"))
+	if err != nil {
+		repo.App.Session.Put(r.Context(), "error", "Choose the room the calendar is for")
+		http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+		return
+	}
+
+	u, err := url.Parse(source.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file") || len(source.URL) > 255 {
+		repo.App.Session.Put(r.Context(), "error", "The feed URL has to start with http://, https:// or file://")
+		http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+		return
+	}
+
+	if u.Scheme == "file" {
+		_, err = feedFilePath(u, repo.App.CalendarFeedDir)
+		if err != nil {
+			repo.App.Session.Put(r.Context(), "error", err.Error())
+			http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+			return
+		}
+	}
+
+	var before models.CalendarSource
+	if source.ID > 0 {
+		before, err = repo.DB.GetCalendarSourceByID(source.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	db, err := repo.auditedSave(r, models.AuditCalendarSource, source.ID, auditCalendarSource(before), auditCalendarSource(source))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if source.ID > 0 {
+		err = db.UpdateCalendarSource(source)
+	} else {
+		_, err = db.InsertCalendarSource(source)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Calendar source saved")
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
+
+// AdminDeleteCalendarSource deletes a calendar source and the external bookings imported from it
+func (repo *Repository) AdminDeleteCalendarSource(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	source, err := repo.DB.GetCalendarSourceByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	db, err := repo.audited(r, models.AuditDelete, models.AuditCalendarSource, id, auditCalendarSource(source), nil)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = db.DeleteCalendarSource(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.inventoryFreed(time.Time{}, time.Time{})
+
+	repo.App.Session.Put(r.Context(), "flash", "Calendar source deleted")
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
+
+// AdminSyncCalendarSource imports one calendar source now
+func (repo *Repository) AdminSyncCalendarSource(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	source, err := repo.DB.GetCalendarSourceByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	result, err := repo.syncCalendarSource(source)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if result.Status == models.SyncFailed {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sync failed: %s", result.Message))
+	} else {
+		repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Synced: %d added, %d changed, %d removed", result.Created, result.Updated, result.Removed))
+	}
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
+
+// AdminSyncCalendars imports every calendar source now
+func (repo *Repository) AdminSyncCalendars(w http.ResponseWriter, r *http.Request) {
+	err := repo.SyncCalendars()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "All calendars synced, see the log for details")
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFeedFilePath(t *testing.T) {
+	root, err := ioutil.TempDir("", "feeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "feeds")
+	inside := filepath.Join(dir, "room.ics")
+	outside := filepath.Join(root, "secret.ics")
+	for _, path := range []string{inside, outside} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("BEGIN:VCALENDAR\r\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link.ics")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		feed    string
+		dir     string
+		wantErr bool
+	}{
+		{"in the directory", "file://" + inside, dir, false},
+		{"on localhost", "file://localhost" + inside, dir, false},
+		{"file feeds turned off", "file://" + inside, "", true},
+		{"outside the directory", "file://" + outside, dir, true},
+		{"climbing out", "file://" + dir + "/../secret.ics", dir, true},
+		{"link pointing out", "file://" + dir + "/link.ics", dir, true},
+		{"another host", "file://example.com" + inside, dir, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.feed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = feedFilePath(u, tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
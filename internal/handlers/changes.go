@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/pricing"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// errInvalidDates is returned for a date change that doesn't make a stay
+var errInvalidDates = errors.New("Departure must be after arrival")
+
+// PostManageDates lets the guest move their stay to new dates
+func (repo *Repository) PostManageDates(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.manageReservation(w, r)
+	if !ok {
+		return
+	}
+
+	back := fmt.Sprintf("/manage/%s", mux.Vars(r)["token"])
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !canCancel(res, time.Now()) {
+		repo.App.Session.Put(r.Context(), "error", "This booking can no longer be changed online")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	start, end, err := parseStayDates(r)
+	if err == nil && start.Before(dayOf(time.Now())) {
+		err = errors.New("Arrival can't be in the past")
+	}
+	if err != nil {
+		repo.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	updated, err := repo.changeDates(r, res, start, end, r.Form.Get("drop_promotion") != "")
+	if lost, ok := err.(*promotionLost); ok {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s. Tick \"Give up my discount\" to change them anyway.", lost))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err == repository.ErrRoomUnavailable {
+		repo.App.Session.Put(r.Context(), "error", "Sorry, the room isn't available for those dates")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	refunded, due, err := repo.settleDateChange(updated)
+	repo.datesChanged(res, updated, refunded, due)
+	if err != nil {
+		repo.App.ErrorLog.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Your dates have been changed, but we couldn't settle the difference in price. We'll be in touch.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	msg := fmt.Sprintf("Your dates have been changed. The new total is %s.", render.FormatMoney(updated.Total))
+	if refunded > 0 {
+		msg += fmt.Sprintf(" %s has been refunded to your card.", render.FormatMoney(refunded))
+	}
+
+	if due > 0 {
+		repo.App.Session.Put(r.Context(), "flash", msg+fmt.Sprintf(" Please pay the further deposit of %s.", render.FormatMoney(due)))
+		http.Redirect(w, r, back+"/payment", http.StatusSeeOther)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", msg)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminPostReservationDates moves a reservation to new dates from the admin reservation page
+func (repo *Repository) AdminPostReservationDates(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/reservations/%s/%d", mux.Vars(r)["src"], id)
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !res.Active() || res.Status == models.StatusCheckedOut {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("A %s reservation can't be moved", res.StatusLabel()))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	start, end, err := parseStayDates(r)
+	if err != nil {
+		repo.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	updated, err := repo.changeDates(r, res, start, end, r.Form.Get("drop_promotion") != "")
+	if lost, ok := err.(*promotionLost); ok {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s. Tick \"Drop the promotion\" to change them anyway.", lost))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err == repository.ErrRoomUnavailable {
+		repo.App.Session.Put(r.Context(), "error", "The room isn't available for those dates")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	refunded, due, err := repo.settleDateChange(updated)
+	repo.datesChanged(res, updated, refunded, due)
+	if err != nil {
+		repo.App.ErrorLog.Println(err)
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Dates changed, new total %s, but the difference could not be refunded: %s", render.FormatMoney(updated.Total), err))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	msg := fmt.Sprintf("Dates changed, new total %s", render.FormatMoney(updated.Total))
+	if refunded > 0 {
+		msg += fmt.Sprintf(", %s refunded", render.FormatMoney(refunded))
+	}
+	if due > 0 {
+		msg += fmt.Sprintf(", a further deposit of %s is due", render.FormatMoney(due))
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", msg)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// dayOf returns the hotel's calendar date at t, in the same form as stay dates: midnight UTC.
+// Truncating t itself would give the UTC date, which is the wrong day for part of every day.
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func parseStayDates(r *http.Request) (time.Time, time.Time, error) {
+	layout := "2006-01-02"
+
+	start, err := time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		return start, start, errors.New("Invalid arrival date")
+	}
+
+	end, err := time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		return start, end, errors.New("Invalid departure date")
+	}
+
+	if !end.After(start) {
+		return start, end, errInvalidDates
+	}
+
+	return start, end, nil
+}
+
+// changeDates re-prices the reservation for the new dates and saves it, moving its room restriction with it.
+// Unless dropPromotion is set, a change that would take the promotion's discount away is refused with a *promotionLost.
+// A change made by the logged in staff user is recorded in the audit log.
+func (repo *Repository) changeDates(r *http.Request, res models.Reservation, start, end time.Time, dropPromotion bool) (models.Reservation, error) {
+	if !end.After(start) {
+		return res, errInvalidDates
+	}
+
+	updated := res
+	updated.StartDate = start
+	updated.EndDate = end
+
+	updated, err := repo.repriceReservation(updated)
+	if _, ok := err.(*promotionLost); ok && dropPromotion {
+		err = nil
+	}
+	if err != nil {
+		return updated, err
+	}
+
+	db := repo.DB
+	if helpers.IsAuthenticated(r) {
+		db, err = repo.audited(r, models.AuditDates, models.AuditReservation, res.ID, auditReservation(res), auditReservation(updated))
+		if err != nil {
+			return updated, err
+		}
+	}
+
+	err = db.ChangeReservationDates(updated)
+	if err != nil {
+		return updated, err
+	}
+
+	repo.eventsSaved()
+	repo.datesFreed(res, updated)
+
+	return updated, nil
+}
+
+// datesFreed tells the waitlist process when a date change gave up nights the reservation held
+func (repo *Repository) datesFreed(old, updated models.Reservation) {
+	if updated.StartDate.After(old.StartDate) || updated.EndDate.Before(old.EndDate) {
+		repo.inventoryFreed(old.StartDate, old.EndDate)
+	}
+}
+
+// settleDateChange squares what the guest has paid with the new price after a date change. Anything paid
+// beyond the new total is refunded; a larger deposit isn't taken here but returned as due, for the guest
+// to pay from their manage page or staff to take at the desk. An issued invoice can't go stale, as
+// invoices are only issued after check-out and a checked-out stay can't be moved.
+func (repo *Repository) settleDateChange(res models.Reservation) (refunded, due int, err error) {
+	refunded, err = repo.refundOverpayment(res)
+	if err != nil {
+		return refunded, 0, err
+	}
+
+	due, err = repo.depositDue(res)
+	return refunded, due, err
+}
+
+// repriceReservation quotes the reservation again at current rates, keeping its guests, extras and promotion.
+// A promotion that no longer covers the stay is dropped, and if that takes a discount away a *promotionLost
+// is returned with the reservation priced without it.
+func (repo *Repository) repriceReservation(res models.Reservation) (models.Reservation, error) {
+	discount := res.Discount
+
+	room, err := repo.DB.GetRoomByID(res.RoomID)
+	if err != nil {
+		return res, err
+	}
+
+	taxRules, err := repo.activeTaxRules()
+	if err != nil {
+		return res, err
+	}
+
+	var extras []models.Extra
+	for _, e := range res.Extras {
+		if e.ExtraID == 0 {
+			continue
+		}
+		extra, err := repo.DB.GetExtraByID(e.ExtraID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return res, err
+		}
+		extras = append(extras, extra)
+	}
+
+	stay := pricing.Stay{
+		Room:      room,
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+		Guests:    res.Guests,
+		Extras:    extras,
+		TaxRules:  taxRules,
+	}
+
+	// the promotion has to cover the new stay too, but this reservation's own redemption doesn't use it up
+	var lost error
+	if res.PromotionID > 0 {
+		promo, err := repo.DB.GetPromotionByID(res.PromotionID)
+		if err == sql.ErrNoRows {
+			lost = errors.New("The promotion has ended")
+		} else if err != nil {
+			return res, err
+		} else {
+			promo.TimesUsed--
+			lost = pricing.CheckPromotion(promo, stay)
+			if lost == nil {
+				stay.Promotion = &promo
+			}
+		}
+	}
+
+	quote := pricing.NewQuote(stay)
+	res.Subtotal = quote.Subtotal
+	res.Discount = quote.Discount
+	res.Extras = quote.Extras
+	res.ExtrasTotal = quote.ExtrasTotal
+	res.Taxes = quote.Taxes
+	res.TaxTotal = quote.TaxTotal
+	res.Total = quote.Total
+
+	if lost != nil && discount > 0 {
+		return res, &promotionLost{reason: lost.Error(), discount: discount}
+	}
+
+	return res, nil
+}
+
+// promotionLost is returned by repriceReservation when the promotion a reservation was booked with doesn't
+// cover its stay any more, along with the reservation priced without it
+type promotionLost struct {
+	reason   string
+	discount int
+}
+
+func (e *promotionLost) Error() string {
+	return fmt.Sprintf("%s, so the discount of %s would be lost", strings.TrimSuffix(e.reason, "."), render.FormatMoney(e.discount))
+}
+
+// datesChanged saves the event that tells the guest of their new dates, once the change has been settled.
+// The change itself is already saved, and the money moved, so an event that can't be saved is only logged.
+func (repo *Repository) datesChanged(old, res models.Reservation, refunded, due int) {
+	err := repo.DB.InsertOutboxEvent(events.DatesChanged{
+		ReservationID: res.ID,
+		StartDate:     old.StartDate,
+		EndDate:       old.EndDate,
+		Total:         old.Total,
+		Refunded:      refunded,
+		Due:           due,
+	})
+	if err != nil {
+		repo.App.ErrorLog.Println(err)
+		return
+	}
+
+	repo.eventsSaved()
+}
+
+// emailDateChange tells the guest of their new dates. It is called from the event bus.
+func (repo *Repository) emailDateChange(e events.Event) error {
+	changed := e.(events.DatesChanged)
+
+	res, err := repo.DB.GetReservationByID(changed.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	old := res
+	old.StartDate = changed.StartDate
+	old.EndDate = changed.EndDate
+	old.Total = changed.Total
+
+	return repo.sendDateChange(old, res, changed.Refunded, changed.Due)
+}
+
+// sendDateChange emails the guest the new dates and price of their reservation, with any refund made or deposit due
+func (repo *Repository) sendDateChange(old, res models.Reservation, refunded, due int) error {
+	var settlement string
+	if refunded > 0 {
+		settlement += fmt.Sprintf("Refunded to your card: %s<br>", render.FormatMoney(refunded))
+	}
+	if due > 0 {
+		settlement += fmt.Sprintf("Further deposit due: %s<br>", render.FormatMoney(due))
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Reservation Changed</strong><br>
+		Dear %s: <br>
+		Your reservation has been moved from %s - %s to %s - %s.<br>
+		Previous total: %s<br>
+		New total: %s<br>
+		%s
+		<br>
+		You can view your booking here: <a href="%s">%s</a>
+	`, res.FirstName,
+		old.StartDate.Format("2006-01-02"), old.EndDate.Format("2006-01-02"),
+		res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"),
+		render.FormatMoney(old.Total), render.FormatMoney(res.Total),
+		settlement,
+		repo.manageLink(res), repo.manageLink(res))
+
+	return repo.sendMail(models.MailData{
+		To:      res.Email,
+		From:    "me@here.com",
+		Subject: "Reservation Changed",
+		Content: htmlMessage,
+	})
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+func TestDayOf(t *testing.T) {
+	kualaLumpur := time.FixedZone("MYT", 8*60*60)
+	losAngeles := time.FixedZone("PDT", -7*60*60)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"early morning east of UTC", time.Date(2026, 6, 10, 2, 0, 0, 0, kualaLumpur), time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)},
+		{"late evening west of UTC", time.Date(2026, 6, 10, 22, 0, 0, 0, losAngeles), time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)},
+		{"midnight UTC", time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC), time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := dayOf(tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDatesFreed(t *testing.T) {
+	start := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	old := models.Reservation{StartDate: start, EndDate: start.AddDate(0, 0, 3)}
+
+	tests := []struct {
+		name      string
+		start     time.Time
+		end       time.Time
+		wantFreed bool
+	}{
+		{"shortened at the end", start, start.AddDate(0, 0, 2), true},
+		{"shortened at the start", start.AddDate(0, 0, 1), start.AddDate(0, 0, 3), true},
+		{"moved later", start.AddDate(0, 0, 7), start.AddDate(0, 0, 10), true},
+		{"extended", start.AddDate(0, 0, -1), start.AddDate(0, 0, 4), false},
+		{"unchanged", start, start.AddDate(0, 0, 3), false},
+	}
+
+	for _, tt := range tests {
+		app := &config.AppConfig{Waitlist: make(chan models.FreedInventory, 1)}
+		repo := &Repository{App: app}
+
+		updated := old
+		updated.StartDate, updated.EndDate = tt.start, tt.end
+		repo.datesFreed(old, updated)
+
+		if freed := len(app.Waitlist) > 0; freed != tt.wantFreed {
+			t.Errorf("%s: waitlist woken %v, want %v", tt.name, freed, tt.wantFreed)
+			continue
+		}
+		if tt.wantFreed {
+			if got := <-app.Waitlist; !got.StartDate.Equal(old.StartDate) || !got.EndDate.Equal(old.EndDate) {
+				t.Errorf("%s: freed %s to %s, want the old dates", tt.name, got.StartDate, got.EndDate)
+			}
+		}
+	}
+}
+
+// priceDB has the room and promotions a reservation is re-priced with
+type priceDB struct {
+	repository.DatabaseRepo
+	room       models.Room
+	promotions map[int]models.Promotion
+}
+
+func (db *priceDB) GetRoomByID(id int) (models.Room, error) {
+	return db.room, nil
+}
+
+func (db *priceDB) AllTaxRules() ([]models.TaxRule, error) {
+	return nil, nil
+}
+
+func (db *priceDB) GetPromotionByID(id int) (models.Promotion, error) {
+	p, ok := db.promotions[id]
+	if !ok {
+		return p, sql.ErrNoRows
+	}
+	return p, nil
+}
+
+// TestRepricePromotion keeps the discount while the promotion covers the new stay, and says so when it doesn't
+func TestRepricePromotion(t *testing.T) {
+	june := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	summer := models.Promotion{ID: 1, DiscountType: models.DiscountPercent, Amount: 10, Active: true,
+		ValidFrom: june, ValidTo: june.AddDate(0, 0, 29)}
+	lastOne := summer
+	lastOne.ID, lastOne.MaxUses, lastOne.TimesUsed = 2, 1, 1
+
+	db := &priceDB{
+		room:       models.Room{ID: 1, Price: 10000},
+		promotions: map[int]models.Promotion{1: summer, 2: lastOne},
+	}
+	app := &config.AppConfig{BaseCurrency: "USD"}
+	render.NewRenderer(app)
+	repo := &Repository{App: app, DB: db}
+
+	tests := []struct {
+		name         string
+		promotionID  int
+		discount     int
+		start        time.Time
+		wantDiscount int
+		wantLost     bool
+	}{
+		{"still inside the promotion", 1, 2000, june.AddDate(0, 0, 10), 2000, false},
+		{"moved past the promotion", 1, 2000, june.AddDate(0, 1, 10), 0, true},
+		{"its own redemption was the last", 2, 2000, june.AddDate(0, 0, 10), 2000, false},
+		{"promotion deleted", 3, 2000, june.AddDate(0, 0, 10), 0, true},
+		{"no discount to lose", 1, 0, june.AddDate(0, 1, 10), 0, false},
+	}
+
+	for _, tt := range tests {
+		res := models.Reservation{RoomID: 1, Guests: 1, PromotionID: tt.promotionID, Discount: tt.discount,
+			StartDate: tt.start, EndDate: tt.start.AddDate(0, 0, 2)}
+
+		got, err := repo.repriceReservation(res)
+		_, lost := err.(*promotionLost)
+		if err != nil && !lost {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if lost != tt.wantLost {
+			t.Errorf("%s: promotion lost %v, want %v", tt.name, lost, tt.wantLost)
+		}
+		if got.Discount != tt.wantDiscount {
+			t.Errorf("%s: discount %d, want %d", tt.name, got.Discount, tt.wantDiscount)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/availability"
+	"github.com/NganJason/hotel-booking/internal/channels"
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/gorilla/mux"
+)
+
+// channelHorizonDays is how far ahead availability and rates are pushed to channels
+const channelHorizonDays = 365
+
+// channelSyncAttempts is how many times the periodic sync makes a call to a channel before the sync is logged as failed
+const channelSyncAttempts = 3
+
+// channelRetryBackoff is the wait before the first retry of a call to a channel, doubling after that
+const channelRetryBackoff = 2 * time.Second
+
+// channelPullOverlap re-reads a little before the last pull, so bookings changed while it ran aren't missed.
+// Pulling a booking twice does no harm.
+const channelPullOverlap = 5 * time.Minute
+
+// channelSyncLogSize is how many syncs are shown in the sync log
+const channelSyncLogSize = 50
+
+// channelClient connects to the channel's API
+func channelClient(ch models.Channel) channels.Channel {
+	return channels.NewHTTPChannel(ch.URL, ch.APIKey)
+}
+
+// syncChannel pulls the bookings the channel has taken since the last sync, then pushes our availability
+// and rates to it, so what is pushed already counts the bookings just pulled.
+// Each call to the channel is made up to tries times, and however the sync went it is logged.
+func (repo *Repository) syncChannel(ch models.Channel, tries int) (models.ChannelSyncLog, error) {
+	result := models.ChannelSyncLog{ChannelID: ch.ID, Status: models.SyncOK}
+	client := channelClient(ch)
+
+	since := ch.PulledUntil
+	if !since.IsZero() {
+		since = since.Add(-channelPullOverlap)
+	}
+	started := time.Now()
+
+	var pulledUntil time.Time
+	var bookings []channels.Booking
+	var skipped []error
+	var notes []string
+
+	attempts, err := channels.Retry(tries, channelRetryBackoff, func() error {
+		var err error
+		bookings, skipped, err = client.PullReservations(since)
+		return err
+	})
+	result.Attempts += attempts
+
+	for _, e := range skipped {
+		notes = append(notes, "skipped "+e.Error())
+	}
+
+	if err == nil {
+		var imported []string
+		imported, err = repo.importChannelBookings(ch, bookings, &result)
+		notes = append(notes, imported...)
+	}
+
+	if err == nil {
+		pulledUntil = started
+
+		var updates []channels.Availability
+		updates, err = repo.channelAvailability(ch)
+		if err == nil && len(updates) > 0 {
+			attempts, err = channels.Retry(tries, channelRetryBackoff, func() error {
+				return client.PushAvailability(updates)
+			})
+			result.Attempts += attempts
+			if err == nil {
+				result.Pushed = len(updates)
+			}
+		}
+	}
+
+	if err != nil {
+		result.Status = models.SyncFailed
+		notes = append([]string{err.Error()}, notes...)
+	}
+	if result.Conflicts > 0 {
+		notes = append(notes, fmt.Sprintf("%d booking(s) clash with ours", result.Conflicts))
+	}
+
+	result.Message = helpers.Truncate(strings.Join(notes, "; "), 255)
+
+	err = repo.DB.InsertChannelSyncLog(result, pulledUntil)
+	if err != nil {
+		return result, err
+	}
+
+	if result.Cancelled > 0 {
+		repo.inventoryFreed(time.Time{}, time.Time{})
+	}
+
+	return result, nil
+}
+
+// importChannelBookings imports each booking pulled from the channel, counting them in result.
+// Bookings for rooms that aren't mapped are skipped, with a note saying so.
+func (repo *Repository) importChannelBookings(ch models.Channel, bookings []channels.Booking, result *models.ChannelSyncLog) ([]string, error) {
+	var notes []string
+
+	rooms := make(map[string]int)
+	for _, cr := range ch.Rooms {
+		rooms[cr.RoomCode] = cr.RoomID
+	}
+
+	for _, b := range bookings {
+		roomID, ok := rooms[b.RoomCode]
+		if !ok {
+			notes = append(notes, fmt.Sprintf("booking %s is for unmapped room code %s", b.Reference, b.RoomCode))
+			continue
+		}
+
+		cr := models.ChannelReservation{
+			ChannelID: ch.ID,
+			Reference: b.Reference,
+			RoomID:    roomID,
+			StartDate: b.StartDate,
+			EndDate:   b.EndDate,
+			GuestName: strings.TrimSpace(b.FirstName + " " + b.LastName),
+			Status:    models.ChannelBooked,
+			Channel:   ch,
+		}
+		if b.Status == channels.BookingCancelled {
+			cr.Status = models.ChannelCancelled
+		}
+
+		guests := b.Guests
+		if guests < 1 {
+			guests = 1
+		}
+
+		res := models.Reservation{
+			FirstName: b.FirstName,
+			LastName:  b.LastName,
+			Email:     b.Email,
+			Phone:     b.Phone,
+			StartDate: b.StartDate,
+			EndDate:   b.EndDate,
+			RoomID:    roomID,
+			Guests:    guests,
+			Subtotal:  b.Total,
+			Total:     b.Total,
+		}
+
+		_, change, err := repo.DB.ImportChannelReservation(cr, res)
+		if err != nil {
+			return notes, err
+		}
+
+		switch change {
+		case models.ChannelAdded:
+			result.Pulled++
+			repo.eventsSaved()
+		case models.ChannelMoved:
+			result.Pulled++
+			repo.eventsSaved()
+		case models.ChannelCancelled:
+			result.Cancelled++
+			repo.eventsSaved()
+		case models.ChannelConflict:
+			result.Conflicts++
+		}
+	}
+
+	return notes, nil
+}
+
+// channelAvailability returns, for each night up to channelHorizonDays ahead, whether each room the
+// channel sells is free and its rate
+func (repo *Repository) channelAvailability(ch models.Channel) ([]channels.Availability, error) {
+	var updates []channels.Availability
+
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		return updates, err
+	}
+
+	today := dayOf(time.Now())
+	end := today.AddDate(0, 0, channelHorizonDays)
+
+	restrictions, err := repo.DB.GetRestrictionsForAllRoomsByDate(today, end)
+	if err != nil {
+		return updates, err
+	}
+
+	grid := availability.NewGrid(rooms, restrictions)
+
+	for _, room := range rooms {
+		code := ch.RoomCode(room.ID)
+		if code == "" {
+			continue
+		}
+
+		for d := today; d.Before(end); d = d.AddDate(0, 0, 1) {
+			updates = append(updates, channels.Availability{
+				RoomCode: code,
+				Date:     d,
+				Open:     !grid.Taken(room.ID, d),
+				Rate:     room.Price,
+			})
+		}
+	}
+
+	return updates, nil
+}
+
+// SyncChannels syncs every active channel. A channel that fails is logged and the others still sync.
+func (repo *Repository) SyncChannels() error {
+	all, err := repo.DB.AllChannels()
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range all {
+		if !ch.Active {
+			continue
+		}
+
+		_, err = repo.syncChannel(ch, channelSyncAttempts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushChannelAvailability pushes our availability and rates to every active channel as soon as a room is
+// taken off sale, rather than leaving it on sale on the channels until the next sync. It is called from the
+// event bus, so a push that fails is made again later.
+func (repo *Repository) pushChannelAvailability(e events.Event) error {
+	all, err := repo.DB.AllChannels()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, ch := range all {
+		if !ch.Active {
+			continue
+		}
+
+		updates, err := repo.channelAvailability(ch)
+		if err == nil && len(updates) > 0 {
+			err = channelClient(ch).PushAvailability(updates)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", ch.Name, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// AdminChannels lists the channels, the bookings from them that clash with ours and the sync log
+func (repo *Repository) AdminChannels(w http.ResponseWriter, r *http.Request) {
+	all, err := repo.DB.AllChannels()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	conflicts, err := repo.DB.ChannelConflicts()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	logs, err := repo.DB.RecentChannelSyncLogs(channelSyncLogSize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["channels"] = all
+	data["conflicts"] = conflicts
+	data["channel_logs"] = logs
+
+	render.Template(w, r, "admin-channels.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowChannel shows the form to create or edit a channel and its room mapping
+func (repo *Repository) AdminShowChannel(w http.ResponseWriter, r *http.Request) {
+	ch := models.Channel{Active: true}
+
+	if mux.Vars(r)["id"] != "" {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		ch, err = repo.DB.GetChannelByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.renderChannelForm(w, r, ch, forms.New(nil))
+}
+
+// AdminPostChannel creates or updates a channel and its room mapping
+func (repo *Repository) AdminPostChannel(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var ch models.Channel
+
+	if mux.Vars(r)["id"] != "" {
+		ch.ID, err = strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "url")
+
+	ch.Name = strings.TrimSpace(r.Form.Get("name"))
+	ch.URL = strings.TrimSpace(r.Form.Get("url"))
+	ch.APIKey = strings.TrimSpace(r.Form.Get("api_key"))
+	ch.Active = r.Form.Get("active") != ""
+
+	u, err := url.Parse(ch.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		form.Errors.Add("url", "Enter the address of the channel's API, starting with http:// or https://")
+	}
+
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// rooms left without a code aren't sold on the channel
+	codes := make(map[string]bool)
+	for _, room := range rooms {
+		code := strings.TrimSpace(r.Form.Get(fmt.Sprintf("room_code_%d", room.ID)))
+		if code == "" {
+			continue
+		}
+		if codes[code] {
+			form.Errors.Add("room_codes", fmt.Sprintf("The room code %s is used for more than one room", code))
+		}
+		codes[code] = true
+
+		ch.Rooms = append(ch.Rooms, models.ChannelRoom{ChannelID: ch.ID, RoomID: room.ID, RoomCode: code})
+	}
+
+	if !form.Valid() {
+		repo.renderChannelForm(w, r, ch, form)
+		return
+	}
+
+	var before models.Channel
+	if ch.ID > 0 {
+		before, err = repo.DB.GetChannelByID(ch.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	db, err := repo.auditedSave(r, models.AuditChannel, ch.ID, auditChannel(before), auditChannel(ch))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if ch.ID > 0 {
+		err = db.UpdateChannel(ch)
+	} else {
+		_, err = db.InsertChannel(ch)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Channel saved")
+	http.Redirect(w, r, "/admin/channels", http.StatusSeeOther)
+}
+
+func (repo *Repository) renderChannelForm(w http.ResponseWriter, r *http.Request, ch models.Channel, form *forms.Form) {
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	codes := make(map[int]string)
+	for _, cr := range ch.Rooms {
+		codes[cr.RoomID] = cr.RoomCode
+	}
+
+	data := make(map[string]interface{})
+	data["channel"] = ch
+	data["rooms"] = rooms
+	data["room_codes"] = codes
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = "/admin/channels/new"
+	if ch.ID > 0 {
+		stringMap["action"] = fmt.Sprintf("/admin/channels/%d", ch.ID)
+	}
+
+	render.Template(w, r, "admin-channel-show.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// AdminDeleteChannel deletes a channel. Reservations already imported from it are kept.
+func (repo *Repository) AdminDeleteChannel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	ch, err := repo.DB.GetChannelByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	db, err := repo.audited(r, models.AuditDelete, models.AuditChannel, id, auditChannel(ch), nil)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = db.DeleteChannel(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Channel deleted")
+	http.Redirect(w, r, "/admin/channels", http.StatusSeeOther)
+}
+
+// AdminSyncChannel syncs one channel now
+func (repo *Repository) AdminSyncChannel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	ch, err := repo.DB.GetChannelByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !ch.Active {
+		repo.App.Session.Put(r.Context(), "error", "Turn the channel on before syncing it")
+		http.Redirect(w, r, "/admin/channels", http.StatusSeeOther)
+		return
+	}
+
+	// calls aren't retried here, as waiting between tries would keep the page loading;
+	// the next periodic sync tries again
+	result, err := repo.syncChannel(ch, 1)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if result.Status == models.SyncFailed {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sync failed, it will be tried again with the next automatic sync: %s", result.Message))
+	} else {
+		repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Synced: %d booked, %d cancelled, %d conflicts, %d nights pushed",
+			result.Pulled, result.Cancelled, result.Conflicts, result.Pushed))
+	}
+	http.Redirect(w, r, "/admin/channels", http.StatusSeeOther)
+}
+
+// AdminResolveChannelConflict marks a clashing booking as sorted out with the guest
+func (repo *Repository) AdminResolveChannelConflict(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = repo.DB.ResolveChannelConflict(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Conflict marked as resolved")
+	http.Redirect(w, r, "/admin/channels", http.StatusSeeOther)
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/channels"
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// channelDB keeps what a channel sync reads and writes in memory. The rest of the
+// repository is left nil, so the test fails loudly if the sync reaches for it.
+type channelDB struct {
+	repository.DatabaseRepo
+	rooms        []models.Room
+	restrictions []models.RoomRestriction
+	imported     map[string]models.ChannelReservation
+	pulledUntil  time.Time
+	channels     []models.Channel
+}
+
+func (db *channelDB) AllChannels() ([]models.Channel, error) {
+	return db.channels, nil
+}
+
+func (db *channelDB) AllRooms() ([]models.Room, error) {
+	return db.rooms, nil
+}
+
+func (db *channelDB) GetRestrictionsForAllRoomsByDate(start, end time.Time) ([]models.RoomRestriction, error) {
+	return db.restrictions, nil
+}
+
+func (db *channelDB) ImportChannelReservation(cr models.ChannelReservation, res models.Reservation) (models.ChannelReservation, string, error) {
+	if saved, ok := db.imported[cr.Reference]; ok {
+		return saved, "", nil
+	}
+
+	for _, rr := range db.restrictions {
+		if rr.RoomID == cr.RoomID && cr.StartDate.Before(rr.EndDate) && cr.EndDate.After(rr.StartDate) {
+			cr.Status = models.ChannelConflict
+			db.imported[cr.Reference] = cr
+			return cr, models.ChannelConflict, nil
+		}
+	}
+
+	cr.ReservationID = len(db.imported) + 1
+	db.imported[cr.Reference] = cr
+	db.restrictions = append(db.restrictions, models.RoomRestriction{RoomID: cr.RoomID, StartDate: cr.StartDate, EndDate: cr.EndDate})
+	return cr, models.ChannelAdded, nil
+}
+
+func (db *channelDB) InsertChannelSyncLog(l models.ChannelSyncLog, pulledUntil time.Time) error {
+	if !pulledUntil.IsZero() {
+		db.pulledUntil = pulledUntil
+	}
+	return nil
+}
+
+// TestSyncChannel syncs with the simulated OTA, one step after another, as the periodic sync would
+func TestSyncChannel(t *testing.T) {
+	sim := channels.NewSimulator("secret")
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+
+	db := &channelDB{
+		rooms:    []models.Room{{ID: 1, RoomName: "Double", Price: 10000}},
+		imported: make(map[string]models.ChannelReservation),
+	}
+	repo := &Repository{App: &config.AppConfig{}, DB: db}
+	ch := models.Channel{ID: 1, URL: srv.URL, APIKey: "secret", Active: true, Rooms: []models.ChannelRoom{{RoomID: 1, RoomCode: "DBL"}}}
+
+	today := dayOf(time.Now())
+	book := func(from, nights int) {
+		_, err := sim.Book(channels.Booking{
+			RoomCode:  "DBL",
+			StartDate: today.AddDate(0, 0, from),
+			EndDate:   today.AddDate(0, 0, from+nights),
+			FirstName: "Jane",
+			LastName:  "Smith",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		before       func()
+		tries        int
+		status       string
+		pulled       int
+		conflicts    int
+		attempts     int
+		pushed       bool
+		message      string
+		pullAdvanced bool
+	}{
+		{
+			name:         "first push",
+			before:       func() {},
+			tries:        channelSyncAttempts,
+			status:       models.SyncOK,
+			attempts:     2,
+			pushed:       true,
+			pullAdvanced: true,
+		},
+		{
+			name: "booked on the channel after we sold the room",
+			before: func() {
+				// the hotel sells nights 11 and 12 itself, which the channel hears of only with the next push
+				db.restrictions = append(db.restrictions, models.RoomRestriction{RoomID: 1, StartDate: today.AddDate(0, 0, 11), EndDate: today.AddDate(0, 0, 13)})
+				book(10, 2)
+				book(20, 2)
+			},
+			tries:        channelSyncAttempts,
+			status:       models.SyncOK,
+			pulled:       1,
+			conflicts:    1,
+			attempts:     2,
+			pushed:       true,
+			message:      "1 booking(s) clash with ours",
+			pullAdvanced: true,
+		},
+		{
+			name: "retried through an outage",
+			before: func() {
+				book(30, 3)
+				sim.FailNext(1)
+			},
+			tries:        channelSyncAttempts,
+			status:       models.SyncOK,
+			pulled:       1,
+			attempts:     3,
+			pushed:       true,
+			pullAdvanced: true,
+		},
+		{
+			name: "failed without retrying",
+			before: func() {
+				book(40, 1)
+				sim.FailNext(1)
+			},
+			tries:    1,
+			status:   models.SyncFailed,
+			attempts: 1,
+			message:  "503",
+		},
+		{
+			name:         "picked up by the next sync",
+			before:       func() {},
+			tries:        channelSyncAttempts,
+			status:       models.SyncOK,
+			pulled:       1,
+			attempts:     2,
+			pushed:       true,
+			pullAdvanced: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.before()
+
+			ch.PulledUntil = db.pulledUntil
+			before := db.pulledUntil
+
+			result, err := repo.syncChannel(ch, tt.tries)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Status != tt.status {
+				t.Errorf("status = %s (%s), want %s", result.Status, result.Message, tt.status)
+			}
+			if result.Pulled != tt.pulled {
+				t.Errorf("pulled = %d, want %d", result.Pulled, tt.pulled)
+			}
+			if result.Conflicts != tt.conflicts {
+				t.Errorf("conflicts = %d, want %d", result.Conflicts, tt.conflicts)
+			}
+			if result.Attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", result.Attempts, tt.attempts)
+			}
+			if pushed := result.Pushed == channelHorizonDays; pushed != tt.pushed {
+				t.Errorf("pushed %d nights, want the whole horizon pushed %v", result.Pushed, tt.pushed)
+			}
+			if !strings.Contains(result.Message, tt.message) {
+				t.Errorf("message = %q, want it to mention %q", result.Message, tt.message)
+			}
+			if advanced := db.pulledUntil.After(before); advanced != tt.pullAdvanced {
+				t.Errorf("pulled until advanced %v, want %v", advanced, tt.pullAdvanced)
+			}
+		})
+	}
+
+	// the nights the hotel sold are closed on the channel again with the push that followed
+	open := 0
+	for d := 11; d < 13; d++ {
+		_, err := sim.Book(channels.Booking{RoomCode: "DBL", StartDate: today.AddDate(0, 0, d), EndDate: today.AddDate(0, 0, d+1)})
+		if err == nil {
+			open++
+		}
+	}
+	if open > 0 {
+		t.Errorf("%d night(s) we sold are still on sale on the channel", open)
+	}
+}
+
+// TestPushChannelAvailability takes a room off sale on the channel as soon as it is blocked, and back on when the block is lifted
+func TestPushChannelAvailability(t *testing.T) {
+	sim := channels.NewSimulator("secret")
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+
+	today := dayOf(time.Now())
+	rooms := []models.ChannelRoom{{RoomID: 1, RoomCode: "DBL"}}
+	db := &channelDB{
+		rooms: []models.Room{{ID: 1, RoomName: "Double", Price: 10000}},
+		channels: []models.Channel{
+			{ID: 1, Name: "OTA", URL: srv.URL, APIKey: "secret", Active: true, Rooms: rooms},
+			// never called, or the push would fail
+			{ID: 2, Name: "Paused", URL: "http://127.0.0.1:1", APIKey: "secret", Active: false, Rooms: rooms},
+		},
+	}
+	repo := &Repository{App: &config.AppConfig{}, DB: db}
+
+	block := events.BlockAdded{BlockID: 1, RoomID: 1, StartDate: today.AddDate(0, 0, 5), EndDate: today.AddDate(0, 0, 6)}
+	db.restrictions = append(db.restrictions, models.RoomRestriction{RoomID: 1, StartDate: block.StartDate, EndDate: block.EndDate})
+
+	sim.FailNext(1)
+	if err := repo.pushChannelAvailability(block); err == nil {
+		t.Fatal("push to a channel that is down didn't fail, so it wouldn't be retried")
+	}
+
+	if err := repo.pushChannelAvailability(block); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		night int
+		open  bool
+	}{
+		{4, true},
+		{5, false},
+		{6, true},
+	}
+
+	for _, tt := range tests {
+		_, err := sim.Book(channels.Booking{RoomCode: "DBL", StartDate: today.AddDate(0, 0, tt.night), EndDate: today.AddDate(0, 0, tt.night+1)})
+		if open := err == nil; open != tt.open {
+			t.Errorf("night %d on sale %v, want %v", tt.night, open, tt.open)
+		}
+	}
+
+	// lifting the block puts the night back on sale
+	db.restrictions = nil
+	bus := events.NewBus()
+	repo.Subscribe(bus)
+
+	handled, err := bus.Publish(events.BlockChanged{BlockID: 1, RoomID: 1, StartDate: block.StartDate, EndDate: block.EndDate, Deleted: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 1 || handled[0] != "channels" {
+		t.Errorf("block change handled by %v, want channels", handled)
+	}
+
+	_, err = sim.Book(channels.Booking{RoomCode: "DBL", StartDate: block.StartDate, EndDate: block.EndDate})
+	if err != nil {
+		t.Errorf("night 5 not back on sale after the block was lifted: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/gorilla/mux"
+)
+
+// SetCurrency stores the guest's display currency in the session and sends them back where they came from
+func (repo *Repository) SetCurrency(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(mux.Vars(r)["code"])
+
+	if render.CurrencyByCode(code).Code == code {
+		repo.App.Session.Put(r.Context(), "currency", code)
+	} else {
+		repo.App.Session.Put(r.Context(), "error", "Unknown currency")
+	}
+
+	http.Redirect(w, r, sameOriginPath(r), http.StatusSeeOther)
+}
+
+// sameOriginPath returns the path of the referring page if it is on this site, or "/" otherwise,
+// so the currency switcher can't be used to send guests to another site
+func sameOriginPath(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Host != r.Host || !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return "/"
+	}
+
+	back := url.URL{Path: u.Path, RawQuery: u.RawQuery}
+	return back.String()
+}
+
+// AdminCurrencies shows the exchange rate table
+func (repo *Repository) AdminCurrencies(w http.ResponseWriter, r *http.Request) {
+	currencies, err := repo.DB.AllCurrencies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["currencies"] = currencies
+
+	render.Template(w, r, "admin-currencies.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminPostCurrencies saves the exchange rates and adds a new currency when one is filled in
+func (repo *Repository) AdminPostCurrencies(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	currencies, err := repo.DB.AllCurrencies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for _, c := range currencies {
+		before := c
+
+		c.Symbol = r.Form.Get(fmt.Sprintf("symbol_%d", c.ID))
+		c.Decimals, _ = strconv.Atoi(r.Form.Get(fmt.Sprintf("decimals_%d", c.ID)))
+		c.Active = r.Form.Get(fmt.Sprintf("active_%d", c.ID)) != ""
+
+		// the base currency always converts at 1 and cannot be switched off
+		if c.Code == repo.App.BaseCurrency {
+			c.Rate = 1
+			c.Active = true
+		} else {
+			c.Rate, err = strconv.ParseFloat(r.Form.Get(fmt.Sprintf("rate_%d", c.ID)), 64)
+			if err != nil || c.Rate <= 0 {
+				repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Invalid rate for %s", c.Code))
+				http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+				return
+			}
+		}
+
+		if c == before {
+			continue
+		}
+
+		db, err := repo.audited(r, models.AuditUpdate, models.AuditCurrency, c.ID, auditCurrency(before), auditCurrency(c))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		err = db.UpdateCurrency(c)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if code := strings.TrimSpace(r.Form.Get("new_code")); code != "" {
+		c := models.Currency{
+			Code:   code,
+			Symbol: r.Form.Get("new_symbol"),
+			Active: true,
+		}
+		c.Decimals, _ = strconv.Atoi(r.Form.Get("new_decimals"))
+		c.Rate, err = strconv.ParseFloat(r.Form.Get("new_rate"), 64)
+		if err != nil || c.Rate <= 0 || len(code) != 3 {
+			repo.App.Session.Put(r.Context(), "error", "A new currency needs a three letter code and a rate")
+			http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+			return
+		}
+
+		db, err := repo.audited(r, models.AuditCreate, models.AuditCurrency, 0, nil, auditCurrency(c))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		_, err = db.InsertCurrency(c)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	err = repo.LoadCurrencies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+}
+
+// LoadCurrencies refreshes the currency table used when rendering pages. The base currency
+// has to be in the table so that its symbol and decimals are known.
+func (repo *Repository) LoadCurrencies() error {
+	currencies, err := repo.DB.AllCurrencies()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range currencies {
+		if c.Code == repo.App.BaseCurrency {
+			render.SetCurrencies(currencies)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("base currency %s is missing from the currencies table", repo.App.BaseCurrency)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSameOriginPath(t *testing.T) {
+	tests := []struct {
+		referer string
+		want    string
+	}{
+		{"", "/"},
+		{"http://example.com/rooms/generals-quarters?x=1", "/rooms/generals-quarters?x=1"},
+		{"http://example.com", "/"},
+		{"https://evil.test/phish", "/"},
+		{"//evil.test/phish", "/"},
+		{"http://example.com//evil.test", "/"},
+		{"/relative", "/"},
+		{"javascript:alert(1)", "/"},
+		{"http://example.com.evil.test/", "/"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://example.com/currency/EUR", nil)
+		if tt.referer != "" {
+			r.Header.Set("Referer", tt.referer)
+		}
+
+		if got := sameOriginPath(r); got != tt.want {
+			t.Errorf("referer %q: got %q, want %q", tt.referer, got, tt.want)
+		}
+	}
+}
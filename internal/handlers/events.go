@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/webhooks"
+)
+
+// eventBatchSize is the most events published from the outbox in one go
+const eventBatchSize = 100
+
+// eventMaxAttempts is how many times an event is published before the subscribers still failing are given up on
+const eventMaxAttempts = 8
+
+// mailTimeout is how long an email subscriber waits for its message to be sent
+const mailTimeout = 30 * time.Second
+
+var eventBackoff = []time.Duration{30 * time.Second, time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 3 * time.Hour, 6 * time.Hour}
+
+// eventRetryAfter returns how long to wait before publishing an event again after attempts have failed
+func eventRetryAfter(attempts int) time.Duration {
+	if attempts > len(eventBackoff) {
+		return eventBackoff[len(eventBackoff)-1]
+	}
+	return eventBackoff[attempts-1]
+}
+
+// Subscribe registers what happens when each kind of event is published
+func (repo *Repository) Subscribe(bus *events.Bus) {
+	bus.Subscribe(events.ReservationCreated{}, "confirm", repo.confirmReservation)
+	bus.Subscribe(events.ReservationCreated{}, "webhooks", func(e events.Event) error {
+		return repo.queueReservationEvent(webhooks.EventReservationCreated, e.(events.ReservationCreated).ReservationID)
+	})
+	bus.Subscribe(events.ReservationConfirmed{}, "email", repo.emailConfirmation)
+	bus.Subscribe(events.ReservationConfirmed{}, "webhooks", func(e events.Event) error {
+		return repo.queueReservationEvent(webhooks.EventReservationModified, e.(events.ReservationConfirmed).ReservationID)
+	})
+	bus.Subscribe(events.ReservationCancelled{}, "email", repo.emailCancellation)
+	bus.Subscribe(events.ReservationCancelled{}, "webhooks", func(e events.Event) error {
+		return repo.queueReservationEvent(webhooks.EventReservationCancelled, e.(events.ReservationCancelled).ReservationID)
+	})
+	bus.Subscribe(events.ReservationModified{}, "webhooks", func(e events.Event) error {
+		return repo.queueReservationEvent(webhooks.EventReservationModified, e.(events.ReservationModified).ReservationID)
+	})
+	bus.Subscribe(events.DatesChanged{}, "email", repo.emailDateChange)
+	bus.Subscribe(events.GroupBooked{}, "email", repo.emailGroupConfirmation)
+	bus.Subscribe(events.WaitlistJoined{}, "email", repo.emailWaitlistJoined)
+	bus.Subscribe(events.WaitlistOffered{}, "email", repo.emailWaitlistOffer)
+	bus.Subscribe(events.BlockAdded{}, "channels", repo.pushChannelAvailability)
+	bus.Subscribe(events.BlockChanged{}, "channels", repo.pushChannelAvailability)
+	bus.Subscribe(events.UserLoggedIn{}, "audit", repo.auditLogin)
+}
+
+// eventsSaved wakes the event publisher after a change that saved events has been committed,
+// unless it has already been woken
+func (repo *Repository) eventsSaved() {
+	select {
+	case repo.App.Events <- struct{}{}:
+	default:
+	}
+}
+
+// sendMail hands the message to the mail sender and waits until it has been sent, so that an email
+// subscriber fails, and the event is published to it again later, when the message can't be delivered
+func (repo *Repository) sendMail(m models.MailData) error {
+	sent := make(chan error, 1)
+	m.Sent = sent
+
+	timeout := time.NewTimer(mailTimeout)
+	defer timeout.Stop()
+
+	select {
+	case repo.App.MailChan <- m:
+	case <-timeout.C:
+		return errors.New("timed out waiting for the mail sender")
+	}
+
+	select {
+	case err := <-sent:
+		return err
+	case <-timeout.C:
+		return errors.New("timed out sending mail")
+	}
+}
+
+// PublishEvents publishes the events in the outbox that are due, oldest first. Each subscriber that handles
+// an event is recorded, and an event any subscriber failed is published again later, backing off each time,
+// to just the subscribers that haven't handled it yet. After eventMaxAttempts it is left unpublished, with
+// the last error, for someone to look into.
+func (repo *Repository) PublishEvents() error {
+	pending, err := repo.DB.DueEvents(time.Now(), eventBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range pending {
+		done := make(map[string]bool)
+		for _, name := range o.Delivered {
+			done[name] = true
+		}
+
+		var handled []string
+		e, err := events.Decode(o.Event, o.Payload)
+		if err == nil {
+			handled, err = repo.App.Bus.Publish(e, done)
+		}
+
+		for _, name := range handled {
+			saveErr := repo.DB.MarkEventDelivered(o.ID, name)
+			if saveErr != nil {
+				return saveErr
+			}
+		}
+
+		if err == nil {
+			err = repo.DB.MarkEventPublished(o.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		o.Attempts++
+		o.LastError = helpers.Truncate(err.Error(), 255)
+		if o.Attempts >= eventMaxAttempts {
+			o.NextAttemptAt = time.Time{}
+			repo.App.ErrorLog.Printf("event %d given up on after %d attempts: %v", o.ID, o.Attempts, err)
+		} else {
+			o.NextAttemptAt = time.Now().Add(eventRetryAfter(o.Attempts))
+			repo.App.ErrorLog.Println(err)
+		}
+
+		err = repo.DB.UpdateOutboxEvent(o)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// confirmReservation confirms a reservation made on the website, on its own or as part of a group, with no
+// deposit to pay. One with a deposit is confirmed once it has been paid. Either way the guest is emailed
+// once the reservation is confirmed.
+func (repo *Repository) confirmReservation(e events.Event) error {
+	created := e.(events.ReservationCreated)
+	if created.Source != events.SourceWebsite && created.Source != events.SourceGroup {
+		return nil
+	}
+
+	res, err := repo.DB.GetReservationByID(created.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	if res.Policy.Deposit(res.Total) > 0 {
+		return nil
+	}
+
+	return repo.confirmPaid(res)
+}
+
+// emailConfirmation sends the guest the confirmation of their reservation. The rooms of a group get one
+// confirmation for the group instead, once they are all confirmed.
+func (repo *Repository) emailConfirmation(e events.Event) error {
+	res, err := repo.DB.GetReservationByID(e.(events.ReservationConfirmed).ReservationID)
+	if err != nil {
+		return err
+	}
+
+	if res.GroupID > 0 {
+		return nil
+	}
+
+	return repo.sendConfirmation(res)
+}
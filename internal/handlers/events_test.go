@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/NganJason/hotel-booking/internal/tokens"
+)
+
+// outboxDB keeps the outbox in memory
+type outboxDB struct {
+	repository.DatabaseRepo
+	events []models.OutboxEvent
+}
+
+func (db *outboxDB) DueEvents(now time.Time, limit int) ([]models.OutboxEvent, error) {
+	var due []models.OutboxEvent
+	for _, o := range db.events {
+		if o.PublishedAt.IsZero() && !o.NextAttemptAt.IsZero() && !o.NextAttemptAt.After(now) {
+			due = append(due, o)
+		}
+	}
+	return due, nil
+}
+
+func (db *outboxDB) MarkEventDelivered(id int, subscriber string) error {
+	db.events[id-1].Delivered = append(db.events[id-1].Delivered, subscriber)
+	return nil
+}
+
+func (db *outboxDB) MarkEventPublished(id int) error {
+	db.events[id-1].PublishedAt = time.Now()
+	db.events[id-1].NextAttemptAt = time.Time{}
+	return nil
+}
+
+func (db *outboxDB) UpdateOutboxEvent(o models.OutboxEvent) error {
+	db.events[o.ID-1].Attempts = o.Attempts
+	db.events[o.ID-1].LastError = o.LastError
+	db.events[o.ID-1].NextAttemptAt = o.NextAttemptAt
+	return nil
+}
+
+// TestPublishEvents publishes an event one of whose subscribers fails a few times, running the publisher
+// as if each retry were due
+func TestPublishEvents(t *testing.T) {
+	payload, err := events.Encode(events.ReservationCancelled{ReservationID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &outboxDB{events: []models.OutboxEvent{{ID: 1, Event: events.ReservationCancelled{}.Name(), Payload: payload, NextAttemptAt: time.Now()}}}
+	bus := events.NewBus()
+	repo := &Repository{App: &config.AppConfig{Bus: bus, ErrorLog: log.New(ioutil.Discard, "", 0)}, DB: db}
+
+	calls := make(map[string]int)
+	emailFailures := 2
+	bus.Subscribe(events.ReservationCancelled{}, "webhooks", func(e events.Event) error {
+		calls["webhooks"]++
+		return nil
+	})
+	bus.Subscribe(events.ReservationCancelled{}, "email", func(e events.Event) error {
+		calls["email"]++
+		if calls["email"] <= emailFailures {
+			return errors.New("mail server down")
+		}
+		return nil
+	})
+
+	steps := []struct {
+		name          string
+		wantWebhooks  int
+		wantEmail     int
+		wantAttempts  int
+		wantPublished bool
+	}{
+		{"first try, email fails", 1, 1, 1, false},
+		{"retry, only email again, fails", 1, 2, 2, false},
+		{"retry, email succeeds", 1, 3, 2, true},
+		{"published, nothing more", 1, 3, 2, true},
+	}
+
+	for _, step := range steps {
+		err = repo.PublishEvents()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		o := db.events[0]
+		if calls["webhooks"] != step.wantWebhooks || calls["email"] != step.wantEmail {
+			t.Errorf("%s: webhooks called %d times and email %d, want %d and %d", step.name, calls["webhooks"], calls["email"], step.wantWebhooks, step.wantEmail)
+		}
+		if o.Attempts != step.wantAttempts {
+			t.Errorf("%s: %d failed attempts, want %d", step.name, o.Attempts, step.wantAttempts)
+		}
+		if !o.PublishedAt.IsZero() != step.wantPublished {
+			t.Errorf("%s: published %v, want %v", step.name, !o.PublishedAt.IsZero(), step.wantPublished)
+		}
+		if !step.wantPublished && o.LastError == "" {
+			t.Errorf("%s: no error saved", step.name)
+		}
+
+		// the retry is due
+		if !o.NextAttemptAt.IsZero() {
+			db.events[0].NextAttemptAt = time.Now()
+		}
+	}
+}
+
+func TestPublishEventsGivesUp(t *testing.T) {
+	db := &outboxDB{events: []models.OutboxEvent{{ID: 1, Event: "no.such.event", Payload: "{}", NextAttemptAt: time.Now()}}}
+	repo := &Repository{App: &config.AppConfig{Bus: events.NewBus(), ErrorLog: log.New(ioutil.Discard, "", 0)}, DB: db}
+
+	for i := 0; i < eventMaxAttempts+2; i++ {
+		err := repo.PublishEvents()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !db.events[0].NextAttemptAt.IsZero() {
+			db.events[0].NextAttemptAt = time.Now()
+		}
+	}
+
+	o := db.events[0]
+	if o.Attempts != eventMaxAttempts || !o.NextAttemptAt.IsZero() || !o.PublishedAt.IsZero() {
+		t.Errorf("after giving up: %d attempts, next at %v, published at %v; want %d attempts, never again, unpublished",
+			o.Attempts, o.NextAttemptAt, o.PublishedAt, eventMaxAttempts)
+	}
+}
+
+// mailDB keeps the reservations, groups and waitlist entries the email subscribers look up
+type mailDB struct {
+	repository.DatabaseRepo
+	reservations map[int]models.Reservation
+	groups       map[int]models.BookingGroup
+	entries      map[int]models.WaitlistEntry
+}
+
+func (db *mailDB) GetReservationByID(id int) (models.Reservation, error) {
+	return db.reservations[id], nil
+}
+
+func (db *mailDB) GetBookingGroupByID(id int) (models.BookingGroup, error) {
+	return db.groups[id], nil
+}
+
+func (db *mailDB) GetWaitlistEntryByID(id int) (models.WaitlistEntry, error) {
+	return db.entries[id], nil
+}
+
+// TestEmailSubscribers checks which events email the guest, and what about
+func TestEmailSubscribers(t *testing.T) {
+	start := dayOf(time.Now()).AddDate(0, 0, 30)
+	stay := func(id, groupID int, status string) models.Reservation {
+		return models.Reservation{ID: id, FirstName: "Jane", Email: "jane@example.com", StartDate: start, EndDate: start.AddDate(0, 0, 2),
+			Status: status, Total: 20000, GroupID: groupID, Room: models.Room{RoomName: "Double"}}
+	}
+
+	db := &mailDB{
+		reservations: map[int]models.Reservation{
+			1: stay(1, 0, models.StatusConfirmed),
+			2: stay(2, 1, models.StatusConfirmed),
+			3: stay(3, 0, models.StatusCancelled),
+		},
+		groups: map[int]models.BookingGroup{
+			1: {ID: 1, FirstName: "Jane", Email: "jane@example.com", Reservations: []models.Reservation{
+				stay(2, 1, models.StatusConfirmed), stay(4, 1, models.StatusConfirmed), stay(5, 1, models.StatusCancelled),
+			}},
+		},
+		entries: map[int]models.WaitlistEntry{
+			1: {ID: 1, FirstName: "Jane", Email: "jane@example.com", StartDate: start, EndDate: start.AddDate(0, 0, 2), Status: models.WaitlistWaiting},
+			2: {ID: 2, FirstName: "Jane", Email: "jane@example.com", StartDate: start, EndDate: start.AddDate(0, 0, 2), Status: models.WaitlistOffered, ExpiresAt: time.Now().Add(time.Hour)},
+			3: {ID: 3, FirstName: "Jane", Email: "jane@example.com", StartDate: start, EndDate: start.AddDate(0, 0, 2), Status: models.WaitlistExpired, ExpiresAt: time.Now().Add(-time.Hour)},
+		},
+	}
+
+	app := &config.AppConfig{
+		BaseURL:      "https://hotel.example.com",
+		BaseCurrency: "USD",
+		Links:        tokens.NewSigner([]byte("secret")),
+		MailChan:     make(chan models.MailData),
+	}
+	render.NewRenderer(app)
+
+	// the mail sender reports mailErr back for each message it is handed
+	var mailErr error
+	mailed := make(chan models.MailData, 10)
+	go func() {
+		for m := range app.MailChan {
+			mailed <- m
+			m.Sent <- mailErr
+		}
+	}()
+	defer close(app.MailChan)
+
+	bus := events.NewBus()
+	repo := &Repository{App: app, DB: db}
+	repo.Subscribe(bus)
+
+	tests := []struct {
+		name        string
+		event       events.Event
+		wantSubject string
+		wantContent string
+		mailErr     error
+	}{
+		{"confirmed", events.ReservationConfirmed{ReservationID: 1}, "Reservation Confirmation", "/manage/", nil},
+		{"room of a group confirmed", events.ReservationConfirmed{ReservationID: 2}, "", "", nil},
+		{"group booked", events.GroupBooked{GroupID: 1}, "Reservation Confirmation", "reservation of 2 rooms", nil},
+		{"cancelled by the guest", events.ReservationCancelled{ReservationID: 3, Actor: models.ActorGuest, Refunded: 5000}, "Reservation Cancelled", "Refund: $50.00", nil},
+		{"cancelled by staff", events.ReservationCancelled{ReservationID: 3, Actor: models.ActorStaff}, "Reservation Cancelled", "Refund: $0.00", nil},
+		{"not paid in time", events.ReservationCancelled{ReservationID: 3, Actor: models.ActorSystem}, "", "", nil},
+		{"cancelled on a channel", events.ReservationCancelled{ReservationID: 3}, "", "", nil},
+		{"dates changed", events.DatesChanged{ReservationID: 1, StartDate: start.AddDate(0, 0, -7), EndDate: start.AddDate(0, 0, -5), Total: 18000, Refunded: 1000},
+			"Reservation Changed", start.AddDate(0, 0, -7).Format("2006-01-02"), nil},
+		{"joined the waitlist", events.WaitlistJoined{EntryID: 1}, "You're on the waitlist", "/waitlist/leave/", nil},
+		{"offered a room", events.WaitlistOffered{EntryID: 2}, "A room is available for your dates", "/waitlist/", nil},
+		{"offer already expired", events.WaitlistOffered{EntryID: 3}, "", "", nil},
+		{"mail server down", events.ReservationConfirmed{ReservationID: 1}, "Reservation Confirmation", "/manage/", errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		mailErr = tt.mailErr
+		handled, err := bus.Publish(tt.event, map[string]bool{"webhooks": true})
+		if (err != nil) != (tt.mailErr != nil) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.mailErr)
+			continue
+		}
+		if tt.mailErr != nil && len(handled) > 0 {
+			t.Errorf("%s: %v handled the event, want it published to them again", tt.name, handled)
+		}
+
+		var sent []models.MailData
+		for len(mailed) > 0 {
+			sent = append(sent, <-mailed)
+		}
+
+		if tt.wantSubject == "" {
+			if len(sent) > 0 {
+				t.Errorf("%s: emailed %q, want no email", tt.name, sent[0].Subject)
+			}
+			continue
+		}
+
+		if len(sent) != 1 {
+			t.Errorf("%s: sent %d emails, want 1", tt.name, len(sent))
+			continue
+		}
+		if sent[0].Subject != tt.wantSubject || sent[0].To != "jane@example.com" {
+			t.Errorf("%s: emailed %q to %s, want %q to jane@example.com", tt.name, sent[0].Subject, sent[0].To, tt.wantSubject)
+		}
+		if !strings.Contains(sent[0].Content, tt.wantContent) {
+			t.Errorf("%s: email doesn't mention %q:\n%s", tt.name, tt.wantContent, sent[0].Content)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/pricing"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/gorilla/mux"
+)
+
+// AdminExtras lists the catalogue of extras
+func (repo *Repository) AdminExtras(w http.ResponseWriter, r *http.Request) {
+	extras, err := repo.DB.AllExtras()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["extras"] = extras
+
+	render.Template(w, r, "admin-extras.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowExtra shows the form to create or edit an extra
+func (repo *Repository) AdminShowExtra(w http.ResponseWriter, r *http.Request) {
+	extra := models.Extra{
+		PricingUnit: models.PerStay,
+		Active:      true,
+	}
+
+	if mux.Vars(r)["id"] != "" {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		extra, err = repo.DB.GetExtraByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.renderExtraForm(w, r, extra, forms.New(nil))
+}
+
+// AdminPostExtra creates or updates an extra
+func (repo *Repository) AdminPostExtra(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var extra models.Extra
+
+	if mux.Vars(r)["id"] != "" {
+		extra.ID, err = strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "price", "pricing_unit")
+
+	extra.Name = r.Form.Get("name")
+	extra.Description = r.Form.Get("description")
+	extra.PricingUnit = r.Form.Get("pricing_unit")
+	extra.Active = r.Form.Get("active") != ""
+
+	extra.Price, err = pricing.ParseAmount(r.Form.Get("price"))
+	if err != nil {
+		form.Errors.Add("price", "Invalid price")
+	}
+
+	switch extra.PricingUnit {
+	case models.PerStay, models.PerNight, models.PerGuest:
+	default:
+		form.Errors.Add("pricing_unit", "Unknown pricing unit")
+	}
+
+	if !form.Valid() {
+		repo.renderExtraForm(w, r, extra, form)
+		return
+	}
+
+	var before models.Extra
+	if extra.ID > 0 {
+		before, err = repo.DB.GetExtraByID(extra.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	db, err := repo.auditedSave(r, models.AuditExtra, extra.ID, auditExtra(before), auditExtra(extra))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if extra.ID > 0 {
+		err = db.UpdateExtra(extra)
+	} else {
+		_, err = db.InsertExtra(extra)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Extra saved")
+	http.Redirect(w, r, "/admin/extras", http.StatusSeeOther)
+}
+
+func (repo *Repository) renderExtraForm(w http.ResponseWriter, r *http.Request, extra models.Extra, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["extra"] = extra
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = "/admin/extras/new"
+	if extra.ID > 0 {
+		stringMap["action"] = fmt.Sprintf("/admin/extras/%d", extra.ID)
+	}
+
+	render.Template(w, r, "admin-extra-show.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// activeExtras returns the extras guests can currently book
+func (repo *Repository) activeExtras() ([]models.Extra, error) {
+	all, err := repo.DB.AllExtras()
+	if err != nil {
+		return nil, err
+	}
+
+	var extras []models.Extra
+	for _, e := range all {
+		if e.Active {
+			extras = append(extras, e)
+		}
+	}
+
+	return extras, nil
+}
+
+func selectedExtras(lines []models.ReservationExtra) map[int]bool {
+	selected := make(map[int]bool)
+	for _, l := range lines {
+		selected[l.ExtraID] = true
+	}
+	return selected
+}
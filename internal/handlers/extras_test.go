@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/NganJason/hotel-booking/internal/tokens"
+)
+
+// extrasDB holds the extras catalogue
+type extrasDB struct {
+	repository.DatabaseRepo
+	extras []models.Extra
+}
+
+func (db *extrasDB) AllExtras() ([]models.Extra, error) {
+	return db.extras, nil
+}
+
+func TestActiveExtras(t *testing.T) {
+	repo := &Repository{DB: &extrasDB{extras: []models.Extra{
+		{ID: 1, Name: "Breakfast", Active: true},
+		{ID: 2, Name: "Parking", Active: false},
+		{ID: 3, Name: "Late checkout", Active: true},
+	}}}
+
+	extras, err := repo.activeExtras()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(extras) != 2 || extras[0].ID != 1 || extras[1].ID != 3 {
+		t.Errorf("got extras %v, want breakfast and late checkout", extras)
+	}
+}
+
+func TestSelectedExtras(t *testing.T) {
+	selected := selectedExtras([]models.ReservationExtra{{ExtraID: 1}, {ExtraID: 3}})
+
+	for id, want := range map[int]bool{1: true, 2: false, 3: true} {
+		if selected[id] != want {
+			t.Errorf("extra %d selected %v, want %v", id, selected[id], want)
+		}
+	}
+}
+
+// TestConfirmationListsExtras checks that the confirmation email itemises the extras booked
+func TestConfirmationListsExtras(t *testing.T) {
+	app := &config.AppConfig{
+		BaseURL:      "https://hotel.example.com",
+		BaseCurrency: "USD",
+		Links:        tokens.NewSigner([]byte("secret")),
+		MailChan:     make(chan models.MailData),
+	}
+	render.NewRenderer(app)
+	repo := &Repository{App: app}
+
+	mailed := make(chan models.MailData, 1)
+	go func() {
+		m := <-app.MailChan
+		mailed <- m
+		m.Sent <- nil
+	}()
+
+	start := dayOf(time.Now()).AddDate(0, 0, 30)
+	err := repo.sendConfirmation(models.Reservation{
+		ID: 1, FirstName: "Jane", Email: "jane@example.com", StartDate: start, EndDate: start.AddDate(0, 0, 2), Total: 26000,
+		Extras: []models.ReservationExtra{
+			{Name: "Breakfast", PricingUnit: models.PerGuest, Quantity: 2, UnitPrice: 1500, Amount: 3000},
+			{Name: "Parking", PricingUnit: models.PerNight, Quantity: 2, UnitPrice: 1000, Amount: 2000},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-mailed
+	for _, want := range []string{"Breakfast x 2: $30.00", "Parking x 2: $20.00"} {
+		if !strings.Contains(m.Content, want) {
+			t.Errorf("confirmation doesn't mention %q:\n%s", want, m.Content)
+		}
+	}
+}
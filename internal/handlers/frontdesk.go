@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// AdminArrivals lists the reservations arriving on the chosen date, by room
+func (repo *Repository) AdminArrivals(w http.ResponseWriter, r *http.Request) {
+	repo.frontDeskList(w, r, "admin-arrivals.page.html", repo.DB.ReservationsArrivingOn)
+}
+
+// AdminDepartures lists the reservations departing on the chosen date, by room, with what each still owes
+func (repo *Repository) AdminDepartures(w http.ResponseWriter, r *http.Request) {
+	repo.frontDeskList(w, r, "admin-departures.page.html", repo.DB.ReservationsDepartingOn)
+}
+
+func (repo *Repository) frontDeskList(w http.ResponseWriter, r *http.Request, page string, list func(time.Time) ([]models.Reservation, error)) {
+	date := dayOf(time.Now())
+	if r.URL.Query().Get("date") != "" {
+		var err error
+		date, err = time.Parse("2006-01-02", r.URL.Query().Get("date"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	reservations, err := list(date)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	ids := make([]int, 0, len(reservations))
+	for _, res := range reservations {
+		ids = append(ids, res.ID)
+	}
+
+	paid, err := repo.DB.AmountsPaid(ids)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the folio's charges add up to the reservation's total, so its balance is the total less what was paid
+	balances := make(map[int]int)
+	for _, res := range reservations {
+		balances[res.ID] = res.Total - paid[res.ID]
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	data["balances"] = balances
+	data["paid"] = paid
+
+	stringMap := make(map[string]string)
+	stringMap["date"] = date.Format("2006-01-02")
+	stringMap["prev"] = date.AddDate(0, 0, -1).Format("2006-01-02")
+	stringMap["next"] = date.AddDate(0, 0, 1).Format("2006-01-02")
+
+	render.Template(w, r, page, &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminCheckIn checks the guest in and records the key and identification handed over
+func (repo *Repository) AdminCheckIn(w http.ResponseWriter, r *http.Request) {
+	repo.frontDeskAction(w, r, "arrivals", models.StatusCheckedIn, func(res models.Reservation) error {
+		after := res
+		after.RoomKey = strings.TrimSpace(r.Form.Get("room_key"))
+		after.IDDocument = strings.TrimSpace(r.Form.Get("id_document"))
+		if after.RoomKey == res.RoomKey && after.IDDocument == res.IDDocument {
+			return nil
+		}
+
+		db, err := repo.audited(r, models.AuditUpdate, models.AuditReservation, res.ID, auditFrontDesk(res), auditFrontDesk(after))
+		if err != nil {
+			return err
+		}
+
+		return db.UpdateFrontDeskDetails(res.ID, after.RoomKey, after.IDDocument)
+	})
+}
+
+// AdminCheckOut checks the guest out once the folio is settled
+func (repo *Repository) AdminCheckOut(w http.ResponseWriter, r *http.Request) {
+	repo.frontDeskAction(w, r, "departures", models.StatusCheckedOut, nil)
+}
+
+// frontDeskAction moves the reservation to status and sends the clerk back to the list for the date they were on.
+// after runs once the status has been changed, so nothing it saves is left behind by a change that failed.
+func (repo *Repository) frontDeskAction(w http.ResponseWriter, r *http.Request, list, status string, after func(models.Reservation) error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/%s?date=%s", list, r.Form.Get("date"))
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !res.CanTransitionTo(status) {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s %s: a %s reservation can't be marked %s", res.FirstName, res.LastName, res.StatusLabel(), models.StatusLabel(status)))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	_, err = repo.changeStatus(r, res, status, r.Form.Get("note"))
+	if err == repository.ErrStatusChanged || err == errFolioUnsettled || err == errNotArrived {
+		msg := "The reservation was changed by someone else, please try again"
+		if err != repository.ErrStatusChanged {
+			msg = err.Error()
+		}
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s %s: %s", res.FirstName, res.LastName, msg))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if after != nil {
+		err = after(res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s %s: %s", res.FirstName, res.LastName, models.StatusLabel(status)))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
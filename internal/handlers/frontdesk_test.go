@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/alexedwards/scs/v2"
+	"github.com/gorilla/mux"
+)
+
+// frontDeskDB is one reservation, with its payments, seen by a clerk
+type frontDeskDB struct {
+	paymentDB
+	res models.Reservation
+}
+
+func (db *frontDeskDB) GetReservationByID(id int) (models.Reservation, error) {
+	res := db.res
+	res.Status = db.status
+	return res, nil
+}
+
+func (db *frontDeskDB) GetUserByID(id int) (models.User, error) {
+	return models.User{ID: id, FirstName: "Sam", LastName: "Clerk"}, nil
+}
+
+func (db *frontDeskDB) Audited(entries ...models.AuditEntry) repository.DatabaseRepo {
+	return db
+}
+
+func TestFrontDesk(t *testing.T) {
+	session := scs.New()
+	app := &config.AppConfig{
+		Session:      session,
+		BaseCurrency: "USD",
+		InfoLog:      log.New(ioutil.Discard, "", 0),
+		ErrorLog:     log.New(ioutil.Discard, "", 0),
+	}
+	helpers.NewHelpers(app)
+	render.NewRenderer(app)
+
+	today := dayOf(time.Now())
+	stay := func(start time.Time) models.Reservation {
+		return models.Reservation{ID: 1, FirstName: "Jane", LastName: "Doe", StartDate: start, EndDate: start.AddDate(0, 0, 2),
+			Subtotal: 20000, Total: 20000}
+	}
+	paid := []models.Payment{{ID: 1, Amount: 20000, Status: models.PaymentCaptured}}
+	deposit := []models.Payment{{ID: 1, Amount: 6000, Status: models.PaymentCaptured}}
+
+	checkIn, checkOut := (*Repository).AdminCheckIn, (*Repository).AdminCheckOut
+
+	tests := []struct {
+		name       string
+		handler    func(*Repository, http.ResponseWriter, *http.Request)
+		res        models.Reservation
+		status     string
+		payments   []models.Payment
+		wantStatus string
+		wantError  string
+	}{
+		{"check in on the arrival date", checkIn, stay(today), models.StatusConfirmed, deposit, models.StatusCheckedIn, ""},
+		{"check in a cancelled booking", checkIn, stay(today), models.StatusCancelled, nil, models.StatusCancelled, "can't be marked Checked in"},
+		{"check in before arrival", checkIn, stay(today.AddDate(0, 0, 1)), models.StatusConfirmed, deposit, models.StatusConfirmed, errNotArrived.Error()},
+		{"check in on the departure date", checkIn, stay(today.AddDate(0, 0, -2)), models.StatusConfirmed, deposit, models.StatusConfirmed, errNotArrived.Error()},
+		{"check out with the folio settled", checkOut, stay(today.AddDate(0, 0, -2)), models.StatusCheckedIn, paid, models.StatusCheckedOut, ""},
+		{"check out owing the balance", checkOut, stay(today.AddDate(0, 0, -2)), models.StatusCheckedIn, deposit, models.StatusCheckedIn, errFolioUnsettled.Error()},
+		{"check out before checking in", checkOut, stay(today.AddDate(0, 0, -2)), models.StatusConfirmed, paid, models.StatusConfirmed, "can't be marked Checked out"},
+	}
+
+	for _, tt := range tests {
+		db := &frontDeskDB{paymentDB: paymentDB{status: tt.status, payments: tt.payments}, res: tt.res}
+		repo := &Repository{App: app, DB: db}
+
+		ctx, err := session.Load(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.Put(ctx, "user_id", 3)
+
+		form := url.Values{"date": {today.Format("2006-01-02")}}
+		r := httptest.NewRequest("POST", "/admin/reservations/1", strings.NewReader(form.Encode())).WithContext(ctx)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		tt.handler(repo, w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, http.StatusSeeOther)
+		}
+		if db.status != tt.wantStatus {
+			t.Errorf("%s: reservation %s, want %s", tt.name, db.status, tt.wantStatus)
+		}
+
+		msg := session.GetString(ctx, "error")
+		if tt.wantError == "" && msg != "" {
+			t.Errorf("%s: got error %q", tt.name, msg)
+		}
+		if !strings.Contains(msg, tt.wantError) {
+			t.Errorf("%s: got error %q, want one with %q", tt.name, msg, tt.wantError)
+		}
+		if tt.wantStatus == models.StatusCheckedIn && len(db.changes) == 1 && db.changes[0].Actor != models.ActorStaff {
+			t.Errorf("%s: change made by %s, want staff", tt.name, db.changes[0].Actor)
+		}
+	}
+}
@@ -0,0 +1,713 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// PostChooseRooms starts a group booking for the rooms ticked on the choose-room page
+func (repo *Repository) PostChooseRooms(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		repo.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomIDs := r.Form["room_id"]
+	if len(roomIDs) == 0 {
+		repo.App.Session.Put(r.Context(), "error", "Choose at least one room")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if len(roomIDs) == 1 {
+		// a temporary redirect keeps the POST, as choosing a room holds it
+		http.Redirect(w, r, "/choose-room/"+roomIDs[0], http.StatusTemporaryRedirect)
+		return
+	}
+
+	var group models.BookingGroup
+	for _, value := range roomIDs {
+		roomID, err := strconv.Atoi(value)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		room, err := repo.DB.GetRoomByID(roomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		policy, err := repo.policyForRoom(room)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		group.Reservations = append(group.Reservations, models.Reservation{
+			RoomID:    room.ID,
+			Room:      room,
+			StartDate: res.StartDate,
+			EndDate:   res.EndDate,
+			Guests:    1,
+			Policy:    policy,
+		})
+	}
+
+	_, err = repo.holdRooms(r, group.Reservations)
+	if err == repository.ErrRoomUnavailable {
+		repo.groupRoomTaken(w, r)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "group", group)
+	http.Redirect(w, r, "/make-group-reservation", http.StatusSeeOther)
+}
+
+// MakeGroupReservation shows the lead guest form and the price of each room in the group
+func (repo *Repository) MakeGroupReservation(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.App.Session.Get(r.Context(), "group").(models.BookingGroup)
+	if !ok || len(group.Reservations) == 0 {
+		repo.App.Session.Put(r.Context(), "error", "Can't get group booking from session")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	group, err := repo.priceGroup(group)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.renderGroupForm(w, r, group, forms.New(nil))
+}
+
+// PostGroupReservation books every room of the group at once, or none of them if one has been taken
+func (repo *Repository) PostGroupReservation(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.App.Session.Get(r.Context(), "group").(models.BookingGroup)
+	if !ok || len(group.Reservations) == 0 || group.ID > 0 {
+		repo.App.Session.Put(r.Context(), "error", "Can't get group booking from session")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	group.FirstName = r.Form.Get("first_name")
+	group.LastName = r.Form.Get("last_name")
+	group.Email = r.Form.Get("email")
+	group.Phone = r.Form.Get("phone")
+
+	form := forms.New(r.PostForm)
+
+	// the "Update Total" button only reprices the rooms without booking them
+	quoteOnly := r.Form.Get("quote_only") != ""
+
+	if !quoteOnly {
+		form.Required("first_name", "last_name", "email")
+		form.MinLength("first_name", 3, r)
+		form.IsEmail("email")
+	}
+
+	for i := range group.Reservations {
+		res := &group.Reservations[i]
+		field := fmt.Sprintf("guests_%d", res.RoomID)
+
+		res.Guests = parseGuests(form, field, res.Room)
+
+		res.FirstName = group.FirstName
+		res.LastName = group.LastName
+		res.Email = group.Email
+		res.Phone = group.Phone
+	}
+
+	group, err = repo.priceGroup(group)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "group", group)
+
+	if !form.Valid() || quoteOnly {
+		_, err = repo.holdRooms(r, group.Reservations)
+		if err == repository.ErrRoomUnavailable {
+			repo.groupRoomTaken(w, r)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		repo.renderGroupForm(w, r, group, form)
+		return
+	}
+
+	// rooms with a deposit are released by the sweep if it isn't paid in time, as a single booking is
+	for i := range group.Reservations {
+		if group.Reservations[i].Policy.Deposit(group.Reservations[i].Total) > 0 {
+			group.Reservations[i].PaymentDueBy = time.Now().Add(paymentWindow)
+		}
+	}
+
+	holdIDs, _ := repo.App.Session.Get(r.Context(), "group_hold_ids").([]int)
+	group, err = repo.DB.InsertBookingGroup(group, holdIDs)
+	if err == repository.ErrRoomUnavailable {
+		repo.App.Session.Remove(r.Context(), "group")
+		repo.App.Session.Remove(r.Context(), "group_hold_ids")
+		repo.App.Session.Put(r.Context(), "error", "Sorry, one of the rooms has just been booked. Please search again.")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.eventsSaved()
+
+	repo.App.Session.Put(r.Context(), "group", group)
+	repo.App.Session.Remove(r.Context(), "group_hold_ids")
+
+	if group.Deposit() > 0 {
+		http.Redirect(w, r, "/group-payment", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/group-summary", http.StatusSeeOther)
+}
+
+// GroupPayment shows the card form for the deposits of the group waiting in the session
+func (repo *Repository) GroupPayment(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.App.Session.Get(r.Context(), "group").(models.BookingGroup)
+	if !ok || group.ID == 0 {
+		repo.App.Session.Put(r.Context(), "error", "Can't get group booking from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	repo.renderGroupPaymentForm(w, r, group, forms.New(nil))
+}
+
+// PostGroupPayment charges the deposit of each room in the group to the card, one payment per room, all or
+// none: every deposit is authorized before any is captured, and should one fail those already taken are
+// voided or refunded. Rooms already paid for are skipped.
+func (repo *Repository) PostGroupPayment(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.App.Session.Get(r.Context(), "group").(models.BookingGroup)
+	if !ok || group.ID == 0 {
+		repo.App.Session.Put(r.Context(), "error", "Can't get group booking from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	card := parseCard(r, form)
+
+	if !form.Valid() {
+		repo.renderGroupPaymentForm(w, r, group, form)
+		return
+	}
+
+	var charged []models.Reservation
+	var authorized []models.Payment
+	for _, res := range group.Reservations {
+		due, err := repo.depositDue(res)
+		if err != nil {
+			repo.releasePayments(authorized)
+			helpers.ServerError(w, err)
+			return
+		}
+		if due == 0 {
+			continue
+		}
+
+		payment, err := repo.authorizeDeposit(res, due, card)
+		if err == repository.ErrStatusChanged {
+			repo.releasePayments(authorized)
+			repo.paymentExpired(w, r)
+			return
+		} else if err != nil {
+			repo.releasePayments(authorized)
+			helpers.ServerError(w, err)
+			return
+		} else if payment.Status == models.PaymentFailed {
+			repo.releasePayments(authorized)
+			form.Errors.Add("card_number", fmt.Sprintf("Your card could not be charged for %s: %s", res.Room.RoomName, payment.Message))
+			repo.renderGroupPaymentForm(w, r, group, form)
+			return
+		}
+
+		charged = append(charged, res)
+		authorized = append(authorized, payment)
+	}
+
+	for i := range authorized {
+		err = repo.captureDeposit(&authorized[i])
+		if err != nil || authorized[i].Status == models.PaymentFailed {
+			repo.releasePayments(authorized)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			form.Errors.Add("card_number", fmt.Sprintf("Your card could not be charged for %s: %s", charged[i].Room.RoomName, authorized[i].Message))
+			repo.renderGroupPaymentForm(w, r, group, form)
+			return
+		}
+	}
+
+	for _, res := range charged {
+		err = repo.confirmPaid(res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/group-summary", http.StatusSeeOther)
+}
+
+// GroupSummary shows the booked group with a manage link for each room
+func (repo *Repository) GroupSummary(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.App.Session.Get(r.Context(), "group").(models.BookingGroup)
+	if !ok || group.ID == 0 {
+		repo.App.Session.Put(r.Context(), "error", "Can't get group booking from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	repo.App.Session.Remove(r.Context(), "group")
+	repo.App.Session.Remove(r.Context(), "reservation")
+
+	links := make(map[int]string)
+	for _, res := range group.Reservations {
+		links[res.ID] = repo.manageLink(res)
+	}
+
+	data := make(map[string]interface{})
+	data["group"] = group
+	data["manage_links"] = links
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = group.Arrival().Format("2006-01-02")
+	stringMap["end_date"] = group.Departure().Format("2006-01-02")
+
+	render.Template(w, r, "group-summary.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// priceGroup quotes each room of the group at current rates
+func (repo *Repository) priceGroup(group models.BookingGroup) (models.BookingGroup, error) {
+	reservations := make([]models.Reservation, len(group.Reservations))
+	for i, res := range group.Reservations {
+		priced, err := repo.repriceReservation(res)
+		if err != nil {
+			return group, err
+		}
+		reservations[i] = priced
+	}
+	group.Reservations = reservations
+
+	return group, nil
+}
+
+func (repo *Repository) renderGroupForm(w http.ResponseWriter, r *http.Request, group models.BookingGroup, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["group"] = group
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = group.Arrival().Format("2006-01-02")
+	stringMap["end_date"] = group.Departure().Format("2006-01-02")
+	if until := repo.groupHeldUntil(r); !until.IsZero() {
+		stringMap["hold_until"] = until.Format("15:04")
+	}
+
+	render.Template(w, r, "make-group-reservation.page.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+func (repo *Repository) renderGroupPaymentForm(w http.ResponseWriter, r *http.Request, group models.BookingGroup, form *forms.Form) {
+	due := 0
+	for _, res := range group.Reservations {
+		owed, err := repo.depositDue(res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		due += owed
+	}
+
+	data := make(map[string]interface{})
+	data["group"] = group
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = group.Arrival().Format("2006-01-02")
+	stringMap["end_date"] = group.Departure().Format("2006-01-02")
+	stringMap["action"] = "/group-payment"
+
+	intMap := make(map[string]int)
+	intMap["due"] = due
+
+	render.Template(w, r, "payment.page.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
+
+// emailGroupConfirmation sends the lead guest one confirmation for the rooms of a group once they are all
+// confirmed. It is called from the event bus.
+func (repo *Repository) emailGroupConfirmation(e events.Event) error {
+	group, err := repo.DB.GetBookingGroupByID(e.(events.GroupBooked).GroupID)
+	if err != nil {
+		return err
+	}
+
+	// rooms cancelled before the rest were confirmed aren't part of the booking any more
+	confirmed := group.Reservations[:0]
+	for _, res := range group.Reservations {
+		if res.Status == models.StatusConfirmed {
+			confirmed = append(confirmed, res)
+		}
+	}
+	group.Reservations = confirmed
+
+	if len(group.Reservations) == 0 {
+		return nil
+	}
+
+	return repo.sendGroupConfirmation(group)
+}
+
+// sendGroupConfirmation emails the lead guest one confirmation covering every room of the group
+func (repo *Repository) sendGroupConfirmation(group models.BookingGroup) error {
+	var rooms string
+	for _, res := range group.Reservations {
+		name := res.Room.RoomName
+		if group.SplitStay() {
+			name = fmt.Sprintf("%s from %s to %s", name, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"))
+		}
+		rooms += fmt.Sprintf(`%s, %d guest(s): %s (%s policy: %s)<br>Manage this room: <a href="%s">%s</a><br><br>`,
+			name, res.Guests, render.FormatMoney(res.Total), res.Policy.Name, res.Policy.Summary(),
+			repo.manageLink(res), repo.manageLink(res))
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Group Reservation Confirmation</strong><br>
+		Dear %s: <br>
+		This is to confirm your reservation of %d rooms from %s to %s.<br>
+		<br>
+		%s
+		Total: %s<br>
+		Paid now: %s<br>
+	`, group.FirstName, len(group.Reservations),
+		group.Arrival().Format("2006-01-02"), group.Departure().Format("2006-01-02"),
+		rooms, render.FormatMoney(group.Total()), render.FormatMoney(group.Deposit()))
+
+	return repo.sendMail(models.MailData{
+		To:      group.Email,
+		From:    "me@here.com",
+		Subject: "Reservation Confirmation",
+		Content: htmlMessage,
+	})
+}
+
+// AdminShowGroup shows a booking group with all its rooms
+func (repo *Repository) AdminShowGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.adminGroup(w, r)
+	if !ok {
+		return
+	}
+
+	repo.renderAdminGroup(w, r, group, forms.New(nil))
+}
+
+// AdminPostGroup saves the lead guest's details on the group and all its reservations
+func (repo *Repository) AdminPostGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.adminGroup(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	before := group
+
+	group.FirstName = r.Form.Get("first_name")
+	group.LastName = r.Form.Get("last_name")
+	group.Email = r.Form.Get("email")
+	group.Phone = r.Form.Get("phone")
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		repo.renderAdminGroup(w, r, group, form)
+		return
+	}
+
+	db, err := repo.audited(r, models.AuditUpdate, models.AuditGroup, group.ID, auditGroup(before), auditGroup(group))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = db.UpdateBookingGroup(group)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.eventsSaved()
+
+	repo.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/groups/%d", group.ID), http.StatusSeeOther)
+}
+
+// AdminGroupDates moves every room of the group that is still booked to new dates, all or none
+func (repo *Repository) AdminGroupDates(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.adminGroup(w, r)
+	if !ok {
+		return
+	}
+
+	back := fmt.Sprintf("/admin/groups/%d", group.ID)
+
+	if group.SplitStay() {
+		repo.App.Session.Put(r.Context(), "error", "The rooms of a split stay have different dates, change each one from its reservation")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	start, end, err := parseStayDates(r)
+	if err != nil {
+		repo.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	var old, updated []models.Reservation
+	var entries []models.AuditEntry
+	for _, res := range group.Reservations {
+		if !res.Active() {
+			continue
+		}
+		if res.Status == models.StatusCheckedIn || res.Status == models.StatusCheckedOut {
+			repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s is %s, change its dates on its own", res.Room.RoomName, res.StatusLabel()))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+
+		before := res
+
+		res.StartDate = start
+		res.EndDate = end
+		res, err = repo.repriceReservation(res)
+		if lost, ok := err.(*promotionLost); ok {
+			repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s: %s, nothing was changed", res.Room.RoomName, lost))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		e, err := repo.auditEntry(r, models.AuditDates, models.AuditReservation, res.ID, auditReservation(before), auditReservation(res))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		old = append(old, before)
+		updated = append(updated, res)
+		entries = append(entries, e)
+	}
+
+	err = repo.DB.Audited(entries...).ChangeGroupDates(updated)
+	if err == repository.ErrRoomUnavailable {
+		repo.App.Session.Put(r.Context(), "error", "Not every room is available for those dates, nothing was changed")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.eventsSaved()
+
+	var refunded, due int
+	var unsettled []string
+	for i := range updated {
+		repo.datesFreed(old[i], updated[i])
+
+		roomRefunded, roomDue, err := repo.settleDateChange(updated[i])
+		repo.datesChanged(old[i], updated[i], roomRefunded, roomDue)
+		if err != nil {
+			repo.App.ErrorLog.Println(err)
+			unsettled = append(unsettled, updated[i].Room.RoomName)
+		}
+		refunded += roomRefunded
+		due += roomDue
+	}
+
+	msg := fmt.Sprintf("Dates changed for %d room(s)", len(updated))
+	if refunded > 0 {
+		msg += fmt.Sprintf(", %s refunded", render.FormatMoney(refunded))
+	}
+	if due > 0 {
+		msg += fmt.Sprintf(", a further deposit of %s is due", render.FormatMoney(due))
+	}
+
+	if len(unsettled) > 0 {
+		repo.App.Session.Put(r.Context(), "error", msg+", but the difference could not be refunded for "+strings.Join(unsettled, ", "))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", msg)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminCancelGroup cancels every room of the group that can still be cancelled, refunding each under its policy.
+// Every refund is made before any room is cancelled, and the rooms are then cancelled together, so a failure
+// part way leaves the whole group booked and the cancellation can simply be tried again.
+func (repo *Repository) AdminCancelGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := repo.adminGroup(w, r)
+	if !ok {
+		return
+	}
+
+	back := fmt.Sprintf("/admin/groups/%d", group.ID)
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var cancelled []models.Reservation
+	var changes []models.ReservationStatusChange
+	refunded := 0
+	for _, res := range group.Reservations {
+		if !res.CanTransitionTo(models.StatusCancelled) {
+			continue
+		}
+
+		amount, err := repo.refundCancellation(res)
+		refunded += amount
+		if err != nil {
+			repo.App.ErrorLog.Println(err)
+			repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Nothing was cancelled: %s could not be refunded (%s). %s was refunded and won't be again when you retry.", res.Room.RoomName, err, render.FormatMoney(refunded)))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+
+		change := repo.statusChange(r, res, models.StatusCancelled, r.Form.Get("note"))
+		change.Refunded = amount
+
+		cancelled = append(cancelled, res)
+		changes = append(changes, change)
+	}
+
+	db, err := repo.statusChangesDB(r, cancelled, changes)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = db.UpdateReservationStatuses(changes)
+	if err == repository.ErrStatusChanged {
+		repo.App.Session.Put(r.Context(), "error", "A room of the group was changed by someone else, nothing was cancelled, please try again")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for i, res := range cancelled {
+		repo.statusChanged(res, changes[i])
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%d room(s) cancelled, %s refunded", len(cancelled), render.FormatMoney(refunded)))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+func (repo *Repository) adminGroup(w http.ResponseWriter, r *http.Request) (models.BookingGroup, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.BookingGroup{}, false
+	}
+
+	group, err := repo.DB.GetBookingGroupByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return group, false
+	}
+
+	return group, true
+}
+
+func (repo *Repository) renderAdminGroup(w http.ResponseWriter, r *http.Request, group models.BookingGroup, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["group"] = group
+
+	stringMap := make(map[string]string)
+	if len(group.Reservations) > 0 {
+		stringMap["start_date"] = group.Arrival().Format("2006-01-02")
+		stringMap["end_date"] = group.Departure().Format("2006-01-02")
+	}
+
+	render.Template(w, r, "admin-group-show.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      form,
+	})
+}
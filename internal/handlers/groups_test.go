@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/payments"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/alexedwards/scs/v2"
+)
+
+// groupPaymentDB keeps the payments and statuses of the rooms of a group in memory
+type groupPaymentDB struct {
+	repository.DatabaseRepo
+	statuses map[int]string
+	payments []models.Payment
+}
+
+func (db *groupPaymentDB) InsertDepositPayment(p models.Payment) (int, error) {
+	if db.statuses[p.ReservationID] == models.StatusCancelled {
+		return 0, repository.ErrStatusChanged
+	}
+	p.ID = len(db.payments) + 1
+	db.payments = append(db.payments, p)
+	return p.ID, nil
+}
+
+func (db *groupPaymentDB) UpdatePayment(p models.Payment) error {
+	db.payments[p.ID-1] = p
+	return nil
+}
+
+func (db *groupPaymentDB) GetPaymentsForReservation(reservationID int) ([]models.Payment, error) {
+	var found []models.Payment
+	for _, p := range db.payments {
+		if p.ReservationID == reservationID {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+func (db *groupPaymentDB) UpdateReservationStatus(c models.ReservationStatusChange) error {
+	if db.statuses[c.ReservationID] != c.FromStatus {
+		return repository.ErrStatusChanged
+	}
+	db.statuses[c.ReservationID] = c.ToStatus
+	return nil
+}
+
+// flakyGateway is the fake gateway, except that the call numbered failAuthorize or failCapture is refused
+type flakyGateway struct {
+	*payments.FakeGateway
+	failAuthorize, authorizations int
+	failCapture, captures         int
+}
+
+func (g *flakyGateway) Authorize(amount int, currency string, card payments.Card) (payments.Result, error) {
+	g.authorizations++
+	if g.authorizations == g.failAuthorize {
+		return payments.Result{}, payments.ErrDeclined
+	}
+	return g.FakeGateway.Authorize(amount, currency, card)
+}
+
+func (g *flakyGateway) Capture(reference string, amount int) (payments.Result, error) {
+	g.captures++
+	if g.captures == g.failCapture {
+		return payments.Result{}, payments.ErrDeclined
+	}
+	return g.FakeGateway.Capture(reference, amount)
+}
+
+// TestPostGroupPayment takes the deposits of every room of a group or of none
+func TestPostGroupPayment(t *testing.T) {
+	session := scs.New()
+	app := &config.AppConfig{
+		Session:      session,
+		BaseCurrency: "USD",
+		InfoLog:      log.New(ioutil.Discard, "", 0),
+		ErrorLog:     log.New(ioutil.Discard, "", 0),
+		TemplateCache: map[string]*template.Template{
+			"payment.page.html": template.Must(template.New("payment.page.html").Parse(`{{.Form.Errors.Get "card_number"}}`)),
+		},
+	}
+	helpers.NewHelpers(app)
+	render.NewRenderer(app)
+
+	start := dayOf(time.Now()).AddDate(0, 0, 30)
+	room := func(id int, name string, total int) models.Reservation {
+		return models.Reservation{ID: id, GroupID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 2), Status: models.StatusPending,
+			Total: total, Policy: models.CancellationPolicy{DepositPercent: 30}, Room: models.Room{RoomName: name}}
+	}
+	group := models.BookingGroup{ID: 1, Reservations: []models.Reservation{room(1, "Double", 10000), room(2, "Suite", 20000)}}
+
+	tests := []struct {
+		name          string
+		paid          []models.Payment
+		failAuthorize int
+		failCapture   int
+		wantCode      int
+		wantError     string
+		wantPayments  []string
+		wantConfirmed bool
+	}{
+		{
+			name:          "every deposit taken",
+			wantCode:      http.StatusSeeOther,
+			wantPayments:  []string{models.PaymentCaptured, models.PaymentCaptured},
+			wantConfirmed: true,
+		},
+		{
+			// the first room's authorization is given back
+			name:          "second card authorization declined",
+			failAuthorize: 2,
+			wantCode:      http.StatusOK,
+			wantError:     "could not be charged for Suite",
+			wantPayments:  []string{models.PaymentVoided, models.PaymentFailed},
+		},
+		{
+			// the first room's deposit had already been captured, so it is refunded
+			name:         "second capture refused",
+			failCapture:  2,
+			wantCode:     http.StatusOK,
+			wantError:    "could not be charged for Suite",
+			wantPayments: []string{models.PaymentRefunded, models.PaymentFailed},
+		},
+		{
+			name:          "a room already paid for",
+			paid:          []models.Payment{{ID: 1, ReservationID: 1, Amount: 3000, Status: models.PaymentCaptured}},
+			wantCode:      http.StatusSeeOther,
+			wantPayments:  []string{models.PaymentCaptured, models.PaymentCaptured},
+			wantConfirmed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		db := &groupPaymentDB{statuses: map[int]string{1: models.StatusPending, 2: models.StatusPending}, payments: tt.paid}
+		for _, p := range tt.paid {
+			// a room whose deposit has been paid was confirmed then
+			db.statuses[p.ReservationID] = models.StatusConfirmed
+		}
+		app.Payments = &flakyGateway{FakeGateway: payments.NewFakeGateway(), failAuthorize: tt.failAuthorize, failCapture: tt.failCapture}
+		repo := &Repository{App: app, DB: db}
+
+		ctx, err := session.Load(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.Put(ctx, "group", group)
+
+		form := url.Values{
+			"card_name":   {"Jane Doe"},
+			"card_number": {"4242424242424242"},
+			"exp_month":   {"12"},
+			"exp_year":    {strconv.Itoa(time.Now().Year() + 1)},
+			"cvc":         {"123"},
+		}
+		r := httptest.NewRequest("POST", "/group-payment", strings.NewReader(form.Encode())).WithContext(ctx)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		repo.PostGroupPayment(w, r)
+
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.wantCode)
+		}
+		if !strings.Contains(w.Body.String(), tt.wantError) {
+			t.Errorf("%s: got page %q, want one with %q", tt.name, w.Body.String(), tt.wantError)
+		}
+
+		if len(db.payments) != len(tt.wantPayments) {
+			t.Errorf("%s: %d payments, want %d", tt.name, len(db.payments), len(tt.wantPayments))
+			continue
+		}
+		for i, want := range tt.wantPayments {
+			if db.payments[i].Status != want {
+				t.Errorf("%s: payment for room %d %s, want %s", tt.name, db.payments[i].ReservationID, db.payments[i].Status, want)
+			}
+		}
+
+		for id, status := range db.statuses {
+			if (status == models.StatusConfirmed) != tt.wantConfirmed {
+				t.Errorf("%s: reservation %d %s, want confirmed %v", tt.name, id, status, tt.wantConfirmed)
+			}
+		}
+	}
+}
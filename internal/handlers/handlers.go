@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,12 +13,16 @@ import (
 
 	"github.com/NganJason/hotel-booking/internal/config"
 	"github.com/NganJason/hotel-booking/internal/driver"
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/folio"
 	"github.com/NganJason/hotel-booking/internal/forms"
 	"github.com/NganJason/hotel-booking/internal/helpers"
 	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/pricing"
 	"github.com/NganJason/hotel-booking/internal/render"
 	"github.com/NganJason/hotel-booking/internal/repository"
 	"github.com/NganJason/hotel-booking/internal/repository/dbrepo"
+	"github.com/NganJason/hotel-booking/internal/tokens"
 	"github.com/gorilla/mux"
 )
 
@@ -90,21 +95,51 @@ func (repo *Repository) PostAvailability(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// the party size is optional, a search without it shows every free room
+	guests, err := strconv.Atoi(r.Form.Get("guests"))
+	if err != nil || guests < 1 {
+		guests = 1
+	}
+
 	rooms, err := repo.DB.SearchAvailabilityForAllRooms(startDate, endDate)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
+	rooms = roomsFor(rooms, guests)
 
 	if len(rooms) == 0 {
-		repo.App.Session.Put(r.Context(), "error", "No availability")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		alternatives, err := repo.suggestAlternatives(startDate, endDate, guests, 0)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if len(alternatives) == 0 {
+			repo.App.Session.Put(r.Context(), "error", "No availability. Join the waitlist and we'll email you if a room comes free.")
+			http.Redirect(w, r, fmt.Sprintf("/waitlist?s=%s&e=%s", start, end), http.StatusSeeOther)
+			return
+		}
+
+		data := make(map[string]interface{})
+		data["alternatives"] = alternatives
+
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = start
+		stringMap["end_date"] = end
+		stringMap["guests"] = strconv.Itoa(guests)
+
+		render.Template(w, r, "search-availability.page.html", &models.TemplateData{
+			Data:      data,
+			StringMap: stringMap,
+		})
 		return
 	}
 
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate: endDate,
+		Guests: guests,
 	}
 	repo.App.Session.Put(r.Context(), "reservation", res)
 
@@ -119,6 +154,7 @@ type jsonResponse struct {
 	RoomID string `json:"room_id"`
 	StartDate string `json:"start_date"`
 	EndDate string `json:"end_date"`
+	Alternatives []alternativeJSON `json:"alternatives,omitempty"`
 }
 
 type AvailabilityReq struct {
@@ -141,8 +177,7 @@ func (repo *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request)
 	startDate, _ := time.Parse(layout, req.StartDate)
 	endDate, _ := time.Parse(layout, req.EndDate)
 
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
-	available, _ := repo.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	available, _ := repo.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, req.RoomID)
 	resp := jsonResponse{
 		OK: available,
 		Message: "",
@@ -151,6 +186,16 @@ func (repo *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request)
 		RoomID: strconv.Itoa(req.RoomID),
 	}
 
+	// suggest another room, other dates or a split stay when the room is taken
+	if !available && endDate.After(startDate) {
+		alternatives, err := repo.suggestAlternatives(startDate, endDate, 1, req.RoomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		resp.Alternatives = alternativesJSON(alternatives)
+	}
+
 	out, err := json.MarshalIndent(resp, "", "     ")
 	if err != nil {
 		log.Println(err)
@@ -172,19 +217,68 @@ func (repo *Repository) HandlerMakeReservation(w http.ResponseWriter, r *http.Re
 		helpers.ServerError(w, err)
 		return
 	}
-	res.Room.RoomName = room.RoomName
+	res.Room = room
+	if res.Guests == 0 {
+		res.Guests = 1
+	}
+
+	res.Policy, err = repo.policyForRoom(room)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
 	repo.App.Session.Put(r.Context(), "reservation", res)
 
+	extras, err := repo.activeExtras()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	taxRules, err := repo.activeTaxRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	selected := selectedExtras(res.Extras)
+	var chosen []models.Extra
+	for _, e := range extras {
+		if selected[e.ID] {
+			chosen = append(chosen, e)
+		}
+	}
+
 	sd := res.StartDate.Format("2006-01-02")
 	ed := res.EndDate.Format("2006-01-02")
 
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
+	if until := repo.heldUntil(r); !until.IsZero() {
+		stringMap["hold_until"] = until.Format("15:04")
+	}
+
+	// each form gets its own key so submitting it twice books once
+	stringMap["idempotency_key"], err = tokens.Random()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["extras"] = extras
+	data["selected_extras"] = selected
+	data["quote"] = pricing.NewQuote(pricing.Stay{
+		Room: room,
+		StartDate: res.StartDate,
+		EndDate: res.EndDate,
+		Guests: res.Guests,
+		Extras: chosen,
+		TaxRules: taxRules,
+	})
 
 	render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
 		Form: forms.New(nil),
@@ -193,80 +287,249 @@ func (repo *Repository) HandlerMakeReservation(w http.ResponseWriter, r *http.Re
 	})
 }
 
+// parseGuests reads the party size for room from field, adding a form error when it is missing
+// or more than the room sleeps
+func parseGuests(form *forms.Form, field string, room models.Room) int {
+	guests, err := strconv.Atoi(form.Get(field))
+	if err != nil || guests < 1 {
+		form.Errors.Add(field, "At least one guest is required")
+		return 1
+	}
+
+	if guests > room.MaxGuests {
+		form.Errors.Add(field, fmt.Sprintf("%s sleeps at most %d guests", room.RoomName, room.MaxGuests))
+	}
+
+	return guests
+}
+
 func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
-	reservation, ok := repo.App.Session.Get(r.Context(), "reservation").(models.Reservation)
-	if !ok {
-		helpers.ServerError(w, errors.New("cannot get reservation from session"))
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
 		return
 	}
 
-	err := r.ParseForm()
+	// a double-clicked or retried submission gets the booking the first one made
+	key, err := repo.idempotencyKey(r)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
+	if len(key.Key) > maxIdempotencyKeyLength {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if key.Key != "" && r.Form.Get("quote_only") == "" {
+		replayed, err := repo.replayReservation(w, r, key)
+		if err == repository.ErrIdempotencyMismatch {
+			helpers.ClientError(w, http.StatusUnprocessableEntity)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if replayed {
+			return
+		}
+	}
+
+	reservation, ok := repo.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		helpers.ServerError(w, errors.New("cannot get reservation from session"))
+		return
+	}
 
 	reservation.FirstName = r.Form.Get("first_name")
 	reservation.LastName = r.Form.Get("last_name")
 	reservation.Email = r.Form.Get("email")
 	reservation.Phone = r.Form.Get("phone")
+	reservation.PromoCode = strings.ToUpper(strings.TrimSpace(r.Form.Get("promo_code")))
+	reservation.PromotionID = 0
 
 	form := forms.New(r.PostForm)
 
-	form.Required("first_name", "last_name", "email")
-	form.MinLength("first_name", 3, r)
-	form.IsEmail("email")
+	// the "Update Total" button only reprices the stay without booking it
+	quoteOnly := r.Form.Get("quote_only") != ""
+
+	if !quoteOnly {
+		form.Required("first_name", "last_name", "email")
+		form.MinLength("first_name", 3, r)
+		form.IsEmail("email")
+	}
+
+	reservation.Guests = parseGuests(form, "guests", reservation.Room)
+
+	extras, err := repo.activeExtras()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	taxRules, err := repo.activeTaxRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var chosen []models.Extra
+	for _, e := range extras {
+		if r.Form.Get(fmt.Sprintf("extra_%d", e.ID)) != "" {
+			chosen = append(chosen, e)
+		}
+	}
+
+	stay := pricing.Stay{
+		Room: reservation.Room,
+		StartDate: reservation.StartDate,
+		EndDate: reservation.EndDate,
+		Guests: reservation.Guests,
+		Extras: chosen,
+		TaxRules: taxRules,
+	}
+
+	if reservation.PromoCode != "" {
+		promo, err := repo.DB.GetPromotionByCode(reservation.PromoCode)
+		if err == sql.ErrNoRows {
+			form.Errors.Add("promo_code", "Unknown promo code")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		} else if err := pricing.CheckPromotion(promo, stay); err != nil {
+			form.Errors.Add("promo_code", err.Error())
+		} else {
+			stay.Promotion = &promo
+			reservation.PromotionID = promo.ID
+		}
+	}
+
+	quote := pricing.NewQuote(stay)
+	reservation.Subtotal = quote.Subtotal
+	reservation.Discount = quote.Discount
+	reservation.Extras = quote.Extras
+	reservation.ExtrasTotal = quote.ExtrasTotal
+	reservation.Taxes = quote.Taxes
+	reservation.TaxTotal = quote.TaxTotal
+	reservation.Total = quote.Total
+
+	if form.Valid() && !quoteOnly {
+		if reservation.Policy.Deposit(reservation.Total) > 0 {
+			reservation.PaymentDueBy = time.Now().Add(paymentWindow)
+		}
+
+		newReservationID, err := repo.DB.BookHeldRoom(reservation, repo.App.Session.GetInt(r.Context(), "hold_id"), key)
+		if err == repository.ErrIdempotencyMismatch {
+			helpers.ClientError(w, http.StatusUnprocessableEntity)
+			return
+		} else if err == repository.ErrDuplicateRequest {
+			replayed, err := repo.replayReservation(w, r, key)
+			if err != nil {
+				helpers.ServerError(w, err)
+			} else if !replayed {
+				helpers.ServerError(w, errors.New("idempotency key was claimed without a reservation"))
+			}
+			return
+		} else if err == repository.ErrPromotionUnavailable {
+			form.Errors.Add("promo_code", "This promo code has been fully redeemed")
+		} else if err == repository.ErrRoomUnavailable {
+			repo.App.Session.Remove(r.Context(), "hold_id")
+			repo.roomTaken(w, r)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		reservation.ID = newReservationID
+		repo.eventsSaved()
+
+		if entryID := repo.App.Session.PopInt(r.Context(), "waitlist_entry"); entryID > 0 {
+			err = repo.DB.BookWaitlistEntry(entryID, reservation)
+			if err != nil {
+				repo.App.ErrorLog.Println(err)
+			}
+		}
+	}
+
+	if !form.Valid() || quoteOnly {
+		holdUntil, err := repo.holdRoom(r, reservation)
+		if err == repository.ErrRoomUnavailable {
+			repo.roomTaken(w, r)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		repo.App.Session.Put(r.Context(), "reservation", reservation)
 
-	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+		data["quote"] = quote
+		data["extras"] = extras
+		data["selected_extras"] = selectedExtras(reservation.Extras)
+
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = reservation.StartDate.Format("2006-01-02")
+		stringMap["end_date"] = reservation.EndDate.Format("2006-01-02")
+		stringMap["hold_until"] = holdUntil.Format("15:04")
+		stringMap["idempotency_key"] = r.Form.Get("idempotency_key")
 
 		render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
 			Form: form,
 			Data: data,
+			StringMap: stringMap,
 		})
 		return 
 		
 	}else {
-		newReservationID, err := repo.DB.InsertReservation(reservation)
-		if err != nil {
-			helpers.ServerError(w, err)
-		}
-		
 		repo.App.Session.Put(r.Context(), "reservation", reservation)
-		
-		restriction := models.RoomRestriction{
-			StartDate: 		reservation.StartDate,
-			EndDate: 		reservation.EndDate,
-			RoomID: 		reservation.RoomID,
-			ReservationID: 	newReservationID,
-			RestrictionID: 	1,
-		}
+		repo.App.Session.Remove(r.Context(), "hold_id")
 
-		err = repo.DB.InsertRoomRestriction(restriction)
-		if err != nil {
-			helpers.ServerError(w, err)
-		}
-
-		htmlMessage := fmt.Sprintf(`
-			<strong>Reservation Confirmation</strong><br>
-			Dear %s: <br>
-			This is to confirm your reservation from %s to %s.
-		`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
-
-		msg := models.MailData {
-			To: reservation.Email,
-			From: "me@here.com",
-			Subject: "Reservation Confirmation",
-			Content: htmlMessage,
+		if reservation.Policy.Deposit(reservation.Total) > 0 {
+			http.Redirect(w, r, "/payment", http.StatusSeeOther)
+			return
 		}
-		repo.App.MailChan <- msg
 
-		repo.App.Session.Put(r.Context(), "reservation", reservation)
 		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 	}
 }
 
+// sendConfirmation emails the guest a confirmation of the reservation
+func (repo *Repository) sendConfirmation(reservation models.Reservation) error {
+	var extrasMessage string
+	for _, e := range reservation.Extras {
+		extrasMessage += fmt.Sprintf("%s x %d: %s<br>", e.Name, e.Quantity, render.FormatMoney(e.Amount))
+	}
+	for _, t := range reservation.Taxes {
+		extrasMessage += fmt.Sprintf("%s: %s<br>", t.Name, render.FormatMoney(t.Amount))
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Reservation Confirmation</strong><br>
+		Dear %s: <br>
+		This is to confirm your reservation from %s to %s.<br>
+		%s
+		Total: %s<br>
+		Paid now: %s<br>
+		<br>
+		<strong>%s policy</strong><br>
+		%s<br>
+		<br>
+		You can view, update or cancel your booking at any time here: <a href="%s">%s</a>
+	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"), extrasMessage,
+		render.FormatMoney(reservation.Total), render.FormatMoney(reservation.Policy.Deposit(reservation.Total)), reservation.Policy.Name, reservation.Policy.Summary(),
+		repo.manageLink(reservation), repo.manageLink(reservation))
+
+	msg := models.MailData {
+		To: reservation.Email,
+		From: "me@here.com",
+		Subject: "Reservation Confirmation",
+		Content: htmlMessage,
+	}
+	return repo.sendMail(msg)
+}
+
 func (repo *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
 	reservation, ok := repo.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 
@@ -286,6 +549,7 @@ func (repo *Repository) ReservationSummary(w http.ResponseWriter, r *http.Reques
 	stringMap := make(map[string]string) 
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
+	stringMap["manage_url"] = repo.manageLink(reservation)
 
 	render.Template(w, r, "reservation-summary.page.html", &models.TemplateData{
 		Data: data,
@@ -307,15 +571,31 @@ func (repo *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res.RoomID = roomID
+
+	_, err = repo.holdRoom(r, res)
+	if err == repository.ErrRoomUnavailable {
+		repo.roomTaken(w, r)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	repo.App.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
 
 func (repo *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
-	ID, _ := strconv.Atoi(r.URL.Query().Get("id"))
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	ID, _ := strconv.Atoi(r.Form.Get("id"))
+	sd := r.Form.Get("s")
+	ed := r.Form.Get("e")
 
 	layout := "2006-01-02"
 	startDate, _ := time.Parse(layout, sd)
@@ -336,6 +616,15 @@ func (repo *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		EndDate: endDate,
 	}
 
+	_, err = repo.holdRoom(r, res)
+	if err == repository.ErrRoomUnavailable {
+		repo.roomTaken(w, r)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	repo.App.Session.Put(r.Context(), "reservation", res)
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 	
@@ -375,6 +664,13 @@ func (repo *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
 	}
+
+	err = repo.DB.InsertOutboxEvent(events.UserLoggedIn{UserID: id, IPAddress: helpers.ClientIP(r)})
+	if err != nil {
+		repo.App.ErrorLog.Println(err)
+	}
+	repo.eventsSaved()
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 	repo.App.Session.Put(r.Context(), "user_id", id)
 	repo.App.Session.Put(r.Context(), "flash", "Logged in successfully")
@@ -469,10 +765,14 @@ func (repo *Repository)  AdminReservationsCalendar(w http.ResponseWriter, r *htt
 	for _, x := range rooms {
 		reservationMap := make(map[string]int)
 		blockMap := make(map[string]int)
+		unitBlockMap := make(map[string]int)
+		externalMap := make(map[string]int)
 
 		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
 			reservationMap[d.Format("2006-01-2")] = 0
 			blockMap[d.Format("2006-01-2")] = 0
+			unitBlockMap[d.Format("2006-01-2")] = 0
+			externalMap[d.Format("2006-01-2")] = 0
 		}
 
 		restrictions, err := repo.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
@@ -486,13 +786,28 @@ func (repo *Repository)  AdminReservationsCalendar(w http.ResponseWriter, r *htt
 				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
 					reservationMap[d.Format("2006-01-02")] = y.ReservationID
 				}
+			} else if y.BlockID > 0 {
+				// blocks managed as a unit are edited from the blocks page, not toggled per day
+				for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+					unitBlockMap[d.Format("2006-01-2")] = y.BlockID
+				}
+			} else if y.RestrictionID == 4 {
+				// external bookings come and go with the calendars they're imported from
+				for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+					externalMap[d.Format("2006-01-2")] = y.ID
+				}
+			} else if y.RestrictionID == 3 {
+				// a hold only lasts while the guest fills in the booking form
+				continue
 			} else {
-				blockMap[y.StartDate.Format("2006-01-02")] = y.RestrictionID
+				blockMap[y.StartDate.Format("2006-01-2")] = y.ID
 			}
 		}
 
 		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
 		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+		data[fmt.Sprintf("unit_block_map_%d", x.ID)] = unitBlockMap
+		data[fmt.Sprintf("external_map_%d", x.ID)] = externalMap
 
 		repo.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
 	}
@@ -522,12 +837,59 @@ func (repo *Repository) AdminShowReservations(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	payments, err := repo.DB.GetPaymentsForReservation(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var paid int
+	for _, p := range payments {
+		paid += p.Refundable()
+	}
+
+	history, err := repo.DB.GetStatusHistory(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	moves, err := repo.DB.GetRoomMoves(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	invoice, err := repo.DB.GetInvoiceForReservation(id)
+	if err != nil && err != sql.ErrNoRows {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	audit, err := repo.DB.AuditEntries(models.AuditFilter{Entity: models.AuditReservation, EntityID: id}, auditHistorySize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["payments"] = payments
+	data["folio"] = folio.New(res, payments)
+	data["invoice"] = invoice
+	data["history"] = history
+	data["moves"] = moves
+	data["audit"] = audit
+
+	intMap := make(map[string]int)
+	intMap["paid"] = paid
+	intMap["cancellation_fee"] = res.Policy.CancellationFee(res.Total, res.StartDate, time.Now())
+	intMap["refundable"] = res.Policy.Refundable(paid, res.Total, res.StartDate, time.Now())
 	
 	render.Template(w, r, "admin-reservations-show.page.html", &models.TemplateData{
 		StringMap: stringMap,
 		Data: data,
+		IntMap: intMap,
 		Form: forms.New(nil),
 	})
 }
@@ -556,35 +918,26 @@ func (repo *Repository) AdminShowPostReservation(w http.ResponseWriter, r *http.
 		return
 	}
 
+	before := res
+
 	res.FirstName = r.Form.Get("first_name")
 	res.LastName = r.Form.Get("last_name")
 	res.Email=r.Form.Get("email")      
 	res.Phone = r.Form.Get("phone")
 	
-	err = repo.DB.UpdateReservation(res)
+	db, err := repo.audited(r, models.AuditUpdate, models.AuditReservation, res.ID, auditReservation(before), auditReservation(res))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
-	repo.App.Session.Put(r.Context(), "flash", "Changes saved")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-}
 
-func (repo *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	src := mux.Vars(r)["src"]
-
-	_ = repo.DB.UpdateProcessedForReservation(id, 1)
-	repo.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-}
-
-func (repo *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request){
-	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	src := mux.Vars(r)["src"]
-
-	_ = repo.DB.DeleteReservation(id)
-	repo.App.Session.Put(r.Context(), "flash", "Reservation is deleted")
+	err = db.UpdateReservation(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	repo.eventsSaved()
+	repo.App.Session.Put(r.Context(), "flash", "Changes saved")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 }
 
@@ -611,11 +964,17 @@ func (repo *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *
 		curMap := repo.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", room.ID)).(map[string]int)
 
 		for name, value := range curMap {
-			if !form.Has(fmt.Sprintf("remove_block_%d_%s", room.ID, name), r) {
-				err := repo.DB.DeleteBlockByID(value)
+			if value > 0 && !form.Has(fmt.Sprintf("remove_block_%d_%s", room.ID, name), r) {
+				db, err := repo.audited(r, models.AuditDelete, models.AuditRestriction, value, map[string]interface{}{"room_id": room.ID, "night": name}, nil)
+				if err == nil {
+					err = db.DeleteBlockByID(value)
+				}
 				if err != nil {
-					helpers.ServerError(w, err)
+					log.Println(err)
+					continue
 				}
+				repo.eventsSaved()
+				repo.inventoryFreed(time.Time{}, time.Time{})
 			}
 		}
 	}
@@ -627,10 +986,15 @@ func (repo *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *
 
 			t, _ := time.Parse("2006-01-2", exploded[3])
 
-			err := repo.DB.InsertBlockForRoom(roomID, t)
+			db, err := repo.audited(r, models.AuditCreate, models.AuditRestriction, 0, nil, map[string]interface{}{"room_id": roomID, "night": t.Format("2006-01-02")})
+			if err == nil {
+				_, err = db.InsertBlockForRoom(roomID, t)
+			}
 			if err != nil {
 				log.Println(err)
+				continue
 			}
+			repo.eventsSaved()
 
 		}
 	}
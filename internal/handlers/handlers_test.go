@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+func TestParseGuests(t *testing.T) {
+	double := models.Room{RoomName: "Double", MaxGuests: 2}
+
+	tests := []struct {
+		name      string
+		value     string
+		want      int
+		wantError string
+	}{
+		{"one guest", "1", 1, ""},
+		{"as many as the room sleeps", "2", 2, ""},
+		{"more than the room sleeps", "3", 3, "Double sleeps at most 2 guests"},
+		{"no guests", "0", 1, "At least one guest is required"},
+		{"missing", "", 1, "At least one guest is required"},
+		{"not a number", "two", 1, "At least one guest is required"},
+	}
+
+	for _, tt := range tests {
+		form := forms.New(url.Values{"guests_4": {tt.value}})
+
+		got := parseGuests(form, "guests_4", double)
+		if got != tt.want {
+			t.Errorf("%s: got %d guests, want %d", tt.name, got, tt.want)
+		}
+		if err := form.Errors.Get("guests_4"); err != tt.wantError {
+			t.Errorf("%s: got error %q, want %q", tt.name, err, tt.wantError)
+		}
+	}
+}
+
+func TestRoomsFor(t *testing.T) {
+	rooms := []models.Room{
+		{ID: 1, MaxGuests: 2},
+		{ID: 2, MaxGuests: 4},
+		{ID: 3, MaxGuests: 1},
+	}
+
+	tests := []struct {
+		guests int
+		want   []int
+	}{
+		{1, []int{1, 2, 3}},
+		{2, []int{1, 2}},
+		{4, []int{2}},
+		{5, nil},
+	}
+
+	for _, tt := range tests {
+		var got []int
+		for _, room := range roomsFor(rooms, tt.guests) {
+			got = append(got, room.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%d guests: got rooms %v, want %v", tt.guests, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%d guests: got rooms %v, want %v", tt.guests, got, tt.want)
+				break
+			}
+		}
+	}
+}
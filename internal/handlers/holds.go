@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// holdWindow is how long a chosen room stays held after the guest's last activity on the booking form
+const holdWindow = 15 * time.Minute
+
+// holdRoom holds the reservation's room for the guest, or extends the hold they already have on it.
+// A hold on another room or other dates is released first. It returns when the hold expires,
+// or repository.ErrRoomUnavailable if someone else has the room. Holds are only taken by POST
+// requests, so a link followed by a crawler or a prefetch never ties up a room.
+func (repo *Repository) holdRoom(r *http.Request, res models.Reservation) (time.Time, error) {
+	expiresAt := time.Now().Add(holdWindow)
+
+	id, err := repo.renewHold(repo.App.Session.GetInt(r.Context(), "hold_id"), res, expiresAt)
+	if err != nil {
+		repo.App.Session.Remove(r.Context(), "hold_id")
+		return time.Time{}, err
+	}
+	repo.App.Session.Put(r.Context(), "hold_id", id)
+	repo.App.Session.Put(r.Context(), "hold_until", expiresAt)
+
+	return expiresAt, nil
+}
+
+// holdRooms holds the room of each reservation of a group or split stay, as holdRoom does for one room.
+// The guest holds every room or none: if one is taken, the holds on the others are released too.
+func (repo *Repository) holdRooms(r *http.Request, reservations []models.Reservation) (time.Time, error) {
+	expiresAt := time.Now().Add(holdWindow)
+	ids, _ := repo.App.Session.Get(r.Context(), "group_hold_ids").([]int)
+
+	held := make([]int, len(reservations))
+	for i, res := range reservations {
+		var id int
+		if i < len(ids) {
+			id = ids[i]
+		}
+
+		var err error
+		held[i], err = repo.renewHold(id, res, expiresAt)
+		if err != nil {
+			// the holds not yet renewed are released along with those that were
+			repo.releaseHolds(held[:i])
+			if i < len(ids) {
+				repo.releaseHolds(ids[i:])
+			}
+			repo.App.Session.Remove(r.Context(), "group_hold_ids")
+			return time.Time{}, err
+		}
+	}
+
+	if len(ids) > len(reservations) {
+		repo.releaseHolds(ids[len(reservations):])
+	}
+
+	repo.App.Session.Put(r.Context(), "group_hold_ids", held)
+	repo.App.Session.Put(r.Context(), "group_hold_until", expiresAt)
+
+	return expiresAt, nil
+}
+
+// renewHold extends the hold with id to expiresAt if it is still on the reservation's room and dates.
+// Otherwise it releases it and takes a new hold, returning its id.
+func (repo *Repository) renewHold(id int, res models.Reservation, expiresAt time.Time) (int, error) {
+	hold := models.RoomRestriction{
+		ID:            id,
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		RestrictionID: 3,
+		ExpiresAt:     expiresAt,
+	}
+
+	if hold.ID > 0 {
+		extended, err := repo.DB.ExtendHold(hold)
+		if err != nil {
+			return 0, err
+		}
+		if extended {
+			return hold.ID, nil
+		}
+
+		err = repo.DB.DeleteHold(hold.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return repo.DB.InsertHold(hold)
+}
+
+// releaseHolds releases the holds, logging any that can't be; they expire soon enough on their own
+func (repo *Repository) releaseHolds(ids []int) {
+	for _, id := range ids {
+		if id == 0 {
+			continue
+		}
+		if err := repo.DB.DeleteHold(id); err != nil {
+			repo.App.ErrorLog.Println(err)
+		}
+	}
+}
+
+// heldUntil returns when the guest's hold expires, or the zero time if they don't have one
+func (repo *Repository) heldUntil(r *http.Request) time.Time {
+	until := repo.App.Session.GetTime(r.Context(), "hold_until")
+	if repo.App.Session.GetInt(r.Context(), "hold_id") == 0 || !until.After(time.Now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// groupHeldUntil returns when the guest's holds on the rooms of their group expire, or the zero time if they have none
+func (repo *Repository) groupHeldUntil(r *http.Request) time.Time {
+	until := repo.App.Session.GetTime(r.Context(), "group_hold_until")
+	if ids, _ := repo.App.Session.Get(r.Context(), "group_hold_ids").([]int); len(ids) == 0 || !until.After(time.Now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// roomTaken sends a guest whose room was taken by someone else back to search for another
+func (repo *Repository) roomTaken(w http.ResponseWriter, r *http.Request) {
+	repo.App.Session.Put(r.Context(), "error", "Sorry, that room has just been taken. Please choose another.")
+	http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+}
+
+// groupRoomTaken sends a guest one of whose rooms was taken by someone else back to search again
+func (repo *Repository) groupRoomTaken(w http.ResponseWriter, r *http.Request) {
+	repo.App.Session.Remove(r.Context(), "group")
+	repo.App.Session.Put(r.Context(), "error", "Sorry, one of those rooms has just been taken. Please search again.")
+	http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+}
+
+// ReleaseExpiredHolds frees the rooms whose holds have expired, and those of bookings whose deposit
+// wasn't paid in time, and lets the waitlist know
+func (repo *Repository) ReleaseExpiredHolds() error {
+	released, err := repo.DB.DeleteExpiredHolds(time.Now())
+	if err != nil {
+		return err
+	}
+
+	unpaid, err := repo.DB.CancelUnpaidReservations(time.Now())
+	if err != nil {
+		return err
+	}
+	if unpaid > 0 {
+		repo.eventsSaved()
+	}
+
+	if released+unpaid > 0 {
+		repo.inventoryFreed(time.Time{}, time.Time{})
+	}
+
+	return nil
+}
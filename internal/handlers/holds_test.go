@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/alexedwards/scs/v2"
+)
+
+// holdDB keeps the holds in memory. A room in taken can't be held.
+type holdDB struct {
+	repository.DatabaseRepo
+	nextID int
+	holds  map[int]models.RoomRestriction
+	taken  map[int]bool
+}
+
+func (db *holdDB) InsertHold(hold models.RoomRestriction) (int, error) {
+	if db.taken[hold.RoomID] {
+		return 0, repository.ErrRoomUnavailable
+	}
+	db.nextID++
+	hold.ID = db.nextID
+	db.holds[hold.ID] = hold
+	return hold.ID, nil
+}
+
+func (db *holdDB) ExtendHold(hold models.RoomRestriction) (bool, error) {
+	held, ok := db.holds[hold.ID]
+	if !ok || held.RoomID != hold.RoomID || !held.StartDate.Equal(hold.StartDate) || !held.EndDate.Equal(hold.EndDate) {
+		return false, nil
+	}
+	db.holds[hold.ID] = hold
+	return true, nil
+}
+
+func (db *holdDB) DeleteHold(id int) error {
+	delete(db.holds, id)
+	return nil
+}
+
+// TestHoldRooms holds every room of a group or none of them
+func TestHoldRooms(t *testing.T) {
+	session := scs.New()
+	db := &holdDB{holds: make(map[int]models.RoomRestriction), taken: make(map[int]bool)}
+	repo := &Repository{App: &config.AppConfig{Session: session}, DB: db}
+
+	ctx, err := session.Load(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/choose-rooms", nil).WithContext(ctx)
+
+	start := dayOf(time.Now()).AddDate(0, 0, 10)
+	stay := func(roomIDs ...int) []models.Reservation {
+		var reservations []models.Reservation
+		for _, id := range roomIDs {
+			reservations = append(reservations, models.Reservation{RoomID: id, StartDate: start, EndDate: start.AddDate(0, 0, 2)})
+		}
+		return reservations
+	}
+	heldRooms := func() map[int]bool {
+		rooms := make(map[int]bool)
+		for _, hold := range db.holds {
+			rooms[hold.RoomID] = true
+		}
+		return rooms
+	}
+
+	tests := []struct {
+		name      string
+		rooms     []int
+		taken     int
+		wantErr   error
+		wantRooms []int
+	}{
+		{"both rooms free", []int{1, 3}, 0, nil, []int{1, 3}},
+		{"held again while filling in the form", []int{1, 3}, 0, nil, []int{1, 3}},
+		{"a room swapped for another", []int{1, 4}, 0, nil, []int{1, 4}},
+		{"one room taken", []int{1, 2}, 2, repository.ErrRoomUnavailable, nil},
+	}
+
+	for _, tt := range tests {
+		db.taken[tt.taken] = true
+
+		until, err := repo.holdRooms(r, stay(tt.rooms...))
+		if err != tt.wantErr {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+
+		rooms := heldRooms()
+		if len(rooms) != len(tt.wantRooms) {
+			t.Errorf("%s: holding rooms %v, want %v", tt.name, rooms, tt.wantRooms)
+		}
+		for _, id := range tt.wantRooms {
+			if !rooms[id] {
+				t.Errorf("%s: room %d isn't held", tt.name, id)
+			}
+		}
+
+		if tt.wantErr == nil && !repo.groupHeldUntil(r).Equal(until) {
+			t.Errorf("%s: group held until %s, want %s", tt.name, repo.groupHeldUntil(r), until)
+		}
+		if tt.wantErr != nil && !repo.groupHeldUntil(r).IsZero() {
+			t.Errorf("%s: group still held after its holds were released", tt.name)
+		}
+	}
+
+	if db.nextID != 3 {
+		t.Errorf("took %d holds, want 3: renewing a hold shouldn't take a new one", db.nextID)
+	}
+}
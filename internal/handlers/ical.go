@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/ical"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/tokens"
+	"github.com/gorilla/mux"
+)
+
+// calendarFeedPastDays is how far back feeds go, so recent stays stay visible in calendars
+const calendarFeedPastDays = 30
+
+// CalendarFeed serves the iCalendar feed with the token in the link
+func (repo *Repository) CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	feed, err := repo.DB.GetCalendarFeedByToken(mux.Vars(r)["token"])
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomID, private := feed.RoomID, feed.Private
+
+	name := "All rooms"
+	if roomID > 0 {
+		room, err := repo.DB.GetRoomByID(roomID)
+		if err == sql.ErrNoRows {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		name = room.RoomName
+	}
+
+	today := dayOf(time.Now())
+	entries, err := repo.DB.GetCalendarEntries(roomID, today.AddDate(0, 0, -calendarFeedPastDays), today.AddDate(1, 0, 0))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	host := "localhost"
+	if u, err := url.Parse(repo.App.BaseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	cal := ical.Calendar{Name: name}
+	for _, entry := range entries {
+		cal.Events = append(cal.Events, calendarEvent(entry, roomID == 0, private, host))
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="room-%d.ics"`, roomID))
+
+	err = cal.Write(w)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// calendarEvent describes a reservation or owner block. Unless the feed is private it says only
+// that the room is reserved or blocked, leaving out who is staying and why the room is blocked.
+func calendarEvent(entry models.RoomRestriction, allRooms, private bool, host string) ical.Event {
+	event := ical.Event{
+		UID:     fmt.Sprintf("restriction-%d@%s", entry.ID, host),
+		Start:   entry.StartDate,
+		End:     entry.EndDate,
+		Updated: entry.UpdatedAt,
+	}
+
+	if entry.ReservationID > 0 {
+		event.Summary = "Reserved"
+		if private {
+			res := entry.Reservation
+			event.Summary = fmt.Sprintf("%s %s (%d guest(s))", res.FirstName, res.LastName, res.Guests)
+			event.Description = fmt.Sprintf("Reservation %d, %s\nEmail: %s\nPhone: %s", res.ID, res.StatusLabel(), res.Email, res.Phone)
+		}
+	} else {
+		event.Summary = "Blocked"
+		if private && entry.Block.Reason != "" {
+			event.Description = entry.Block.Reason
+		}
+	}
+
+	if allRooms {
+		event.Summary = entry.Room.RoomName + ": " + event.Summary
+	}
+
+	return event
+}
+
+// AdminCalendarSync shows the calendar feed links for each room and for all rooms, and the calendars imported from elsewhere
+func (repo *Repository) AdminCalendarSync(w http.ResponseWriter, r *http.Request) {
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	all, err := repo.calendarFeeds(append([]int{0}, roomIDs(rooms)...))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	feeds := make(map[int]models.CalendarFeed)
+	privateFeeds := make(map[int]models.CalendarFeed)
+	for _, feed := range all {
+		if feed.Private {
+			privateFeeds[feed.RoomID] = feed
+		} else {
+			feeds[feed.RoomID] = feed
+		}
+	}
+
+	sources, err := repo.DB.AllCalendarSources()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	logs, err := repo.DB.RecentCalendarSyncLogs(calendarSyncLogSize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["feeds"] = feeds
+	data["private_feeds"] = privateFeeds
+	data["feed_base"] = repo.App.BaseURL + "/ical/"
+	data["sources"] = sources
+	data["logs"] = logs
+
+	render.Template(w, r, "admin-calendar-sync.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// calendarFeeds returns the redacted and private feeds of each of the rooms, giving those without them new ones
+func (repo *Repository) calendarFeeds(roomIDs []int) ([]models.CalendarFeed, error) {
+	feeds, err := repo.DB.AllCalendarFeeds()
+	if err != nil {
+		return feeds, err
+	}
+
+	type kind struct {
+		roomID  int
+		private bool
+	}
+	found := make(map[kind]bool)
+	for _, feed := range feeds {
+		found[kind{feed.RoomID, feed.Private}] = true
+	}
+
+	added := false
+	for _, id := range roomIDs {
+		for _, private := range []bool{false, true} {
+			if found[kind{id, private}] {
+				continue
+			}
+
+			token, err := tokens.Random()
+			if err != nil {
+				return feeds, err
+			}
+
+			err = repo.DB.InsertCalendarFeed(models.CalendarFeed{RoomID: id, Private: private, Token: token})
+			if err != nil {
+				return feeds, err
+			}
+			added = true
+		}
+	}
+
+	if !added {
+		return feeds, nil
+	}
+
+	return repo.DB.AllCalendarFeeds()
+}
+
+// AdminResetCalendarFeed gives a feed a new link, for when the old one has got out. Whatever subscribed
+// to the old link stops getting updates and has to be given the new one.
+func (repo *Repository) AdminResetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = repo.DB.GetCalendarFeedByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token, err := tokens.Random()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = repo.DB.UpdateCalendarFeedToken(id, token)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Feed link changed, the old link no longer works")
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
+
+func roomIDs(rooms []models.Room) []int {
+	var ids []int
+	for _, room := range rooms {
+		ids = append(ids, room.ID)
+	}
+	return ids
+}
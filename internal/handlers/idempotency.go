@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/tokens"
+)
+
+// maxIdempotencyKeyLength is the longest idempotency key accepted from a client
+const maxIdempotencyKeyLength = 255
+
+// idempotencyKeyLifetime is how long a key is remembered; a request repeated after that is treated as new
+const idempotencyKeyLifetime = 24 * time.Hour
+
+// idempotencyKey returns the key the client sent so that repeating the request is safe, from the
+// Idempotency-Key header or the booking form's hidden idempotency_key field. The key is scoped to
+// the client's session, so one client can't replay or block another's request by guessing its key.
+func (repo *Repository) idempotencyKey(r *http.Request) (models.IdempotencyKey, error) {
+	key := models.IdempotencyKey{Key: strings.TrimSpace(r.Header.Get("Idempotency-Key"))}
+	if key.Key == "" {
+		key.Key = r.Form.Get("idempotency_key")
+	}
+	if key.Key == "" {
+		return key, nil
+	}
+
+	key.Scope = repo.App.Session.GetString(r.Context(), "idempotency_scope")
+	if key.Scope == "" {
+		var err error
+		key.Scope, err = tokens.Random()
+		if err != nil {
+			return key, err
+		}
+		repo.App.Session.Put(r.Context(), "idempotency_scope", key.Scope)
+	}
+
+	key.RequestHash = requestHash(r.PostForm)
+
+	return key, nil
+}
+
+// requestHash fingerprints the fields of a posted form, other than the idempotency key itself,
+// to tell a repeated request from a different one sent with the same key
+func requestHash(form url.Values) string {
+	fields := url.Values{}
+	for name, values := range form {
+		if name != "idempotency_key" {
+			fields[name] = values
+		}
+	}
+
+	// Encode sorts by field name, so the hash doesn't depend on the order the fields were sent in
+	sum := sha256.Sum256([]byte(fields.Encode()))
+	return hex.EncodeToString(sum[:])
+}
+
+// ExpireIdempotencyKeys forgets the idempotency keys that have outlived idempotencyKeyLifetime
+func (repo *Repository) ExpireIdempotencyKeys() error {
+	_, err := repo.DB.DeleteIdempotencyKeys(time.Now().Add(-idempotencyKeyLifetime))
+	return err
+}
+
+// replayReservation answers a repeated booking request the way the first one was answered, without booking
+// or emailing again: the guest goes on to pay the deposit, or to the summary once nothing is due.
+// It reports false if nothing has been booked with the key.
+func (repo *Repository) replayReservation(w http.ResponseWriter, r *http.Request, key models.IdempotencyKey) (bool, error) {
+	id, err := repo.DB.GetIdempotentReservationID(key)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		return false, err
+	}
+
+	repo.App.Session.Put(r.Context(), "reservation", res)
+	repo.App.Session.Remove(r.Context(), "hold_id")
+
+	due, err := repo.depositDue(res)
+	if err != nil {
+		return false, err
+	}
+	if due > 0 {
+		http.Redirect(w, r, "/payment", http.StatusSeeOther)
+		return true, nil
+	}
+
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+	return true, nil
+}
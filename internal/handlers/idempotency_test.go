@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRequestHash(t *testing.T) {
+	base := url.Values{"first_name": {"Ann"}, "email": {"ann@example.com"}, "extra_id": {"1", "2"}, "idempotency_key": {"k1"}}
+
+	tests := []struct {
+		name string
+		form url.Values
+		same bool
+	}{
+		{"same fields", url.Values{"first_name": {"Ann"}, "email": {"ann@example.com"}, "extra_id": {"1", "2"}, "idempotency_key": {"k1"}}, true},
+		{"another key", url.Values{"first_name": {"Ann"}, "email": {"ann@example.com"}, "extra_id": {"1", "2"}, "idempotency_key": {"k2"}}, true},
+		{"no key", url.Values{"first_name": {"Ann"}, "email": {"ann@example.com"}, "extra_id": {"1", "2"}}, true},
+		{"changed field", url.Values{"first_name": {"Bob"}, "email": {"ann@example.com"}, "extra_id": {"1", "2"}, "idempotency_key": {"k1"}}, false},
+		{"fewer values", url.Values{"first_name": {"Ann"}, "email": {"ann@example.com"}, "extra_id": {"1"}, "idempotency_key": {"k1"}}, false},
+		{"added field", url.Values{"first_name": {"Ann"}, "email": {"ann@example.com"}, "extra_id": {"1", "2"}, "promo_code": {"X"}, "idempotency_key": {"k1"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same := requestHash(tt.form) == requestHash(base)
+			if same != tt.same {
+				t.Errorf("got same hash %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NganJason/hotel-booking/internal/folio"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/gorilla/mux"
+)
+
+// AdminReservationInvoice shows the printable invoice of a reservation
+func (repo *Repository) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	inv, res, ok := repo.invoiceFor(w, r)
+	if !ok {
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["invoice"] = inv
+	data["reservation"] = res
+	data["folio"] = inv.Folio
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = mux.Vars(r)["src"]
+
+	render.Template(w, r, "invoice.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// AdminReservationInvoicePDF downloads the invoice of a reservation as a PDF
+func (repo *Repository) AdminReservationInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	inv, res, ok := repo.invoiceFor(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, inv.Label()))
+
+	err := folio.WritePDF(w, inv, res, inv.Folio, render.FormatMoney)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+}
+
+// AdminIssueInvoice numbers the invoice of a checked-out reservation, freezing its folio as it stands
+func (repo *Repository) AdminIssueInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	src := mux.Vars(r)["src"]
+	back := fmt.Sprintf("/admin/reservations/%s/%d", src, id)
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if res.Status != models.StatusCheckedOut {
+		repo.App.Session.Put(r.Context(), "error", "An invoice can only be issued once the guest has checked out")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	payments, err := repo.DB.GetPaymentsForReservation(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = repo.DB.IssueInvoice(id, folio.New(res, payments))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, back+"/invoice", http.StatusSeeOther)
+}
+
+// invoiceFor loads the reservation in the URL with its invoice. If no invoice has been issued yet
+// it sends staff back to the reservation and reports false.
+func (repo *Repository) invoiceFor(w http.ResponseWriter, r *http.Request) (models.Invoice, models.Reservation, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.Invoice{}, models.Reservation{}, false
+	}
+
+	inv, err := repo.DB.GetInvoiceForReservation(id)
+	if err == sql.ErrNoRows {
+		repo.App.Session.Put(r.Context(), "error", "No invoice has been issued for this reservation")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", mux.Vars(r)["src"], id), http.StatusSeeOther)
+		return inv, models.Reservation{}, false
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return inv, models.Reservation{}, false
+	}
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return inv, res, false
+	}
+
+	return inv, res, true
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/NganJason/hotel-booking/internal/tokens"
+	"github.com/gorilla/mux"
+)
+
+// manageBookingPurpose scopes manage-booking tokens so they can't be reused for other signed links
+const manageBookingPurpose = "manage-booking"
+
+// manageLinkDays is how long after departure a manage link keeps working
+const manageLinkDays = 30
+
+// managePurpose includes the reservation's link version, so that bumping it revokes every link sent so far
+func managePurpose(res models.Reservation) string {
+	return fmt.Sprintf("%s:%d", manageBookingPurpose, res.ManageLinkVersion)
+}
+
+// manageLink returns the link a guest uses to manage their reservation
+func (repo *Repository) manageLink(res models.Reservation) string {
+	expires := res.EndDate.AddDate(0, 0, manageLinkDays)
+	return fmt.Sprintf("%s/manage/%s", repo.App.BaseURL, repo.App.Links.Sign(managePurpose(res), res.ID, expires))
+}
+
+// manageReservation loads the reservation the token in the URL was signed for.
+// It sends the guest home with an error and returns false when the link is no good.
+func (repo *Repository) manageReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	token := mux.Vars(r)["token"]
+
+	// the id can only be trusted once the token has been verified against the reservation's link version
+	res, err := repo.DB.GetReservationByID(tokens.ID(token))
+	if err == nil {
+		_, err = repo.App.Links.Verify(managePurpose(res), token)
+	}
+	if err != nil {
+		repo.App.Session.Put(r.Context(), "error", "This link is invalid or has expired")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	return res, true
+}
+
+// ManageBooking shows the guest their reservation with options to change contact details or cancel
+func (repo *Repository) ManageBooking(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.manageReservation(w, r)
+	if !ok {
+		return
+	}
+
+	repo.renderManageBooking(w, r, res, forms.New(nil))
+}
+
+// PostManageBooking updates the guest's contact details
+func (repo *Repository) PostManageBooking(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.manageReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if !canEditDetails(res) {
+		repo.App.Session.Put(r.Context(), "error", "This booking can no longer be changed online")
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res.FirstName = r.Form.Get("first_name")
+	res.LastName = r.Form.Get("last_name")
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email")
+	form.MinLength("first_name", 3, r)
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		repo.renderManageBooking(w, r, res, form)
+		return
+	}
+
+	err = repo.DB.UpdateReservation(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.eventsSaved()
+
+	repo.App.Session.Put(r.Context(), "flash", "Your details have been updated")
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+// PostManageCancel cancels the reservation and refunds what its policy allows
+func (repo *Repository) PostManageCancel(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.manageReservation(w, r)
+	if !ok {
+		return
+	}
+
+	back := fmt.Sprintf("/manage/%s", mux.Vars(r)["token"])
+
+	if !canCancel(res, time.Now()) {
+		repo.App.Session.Put(r.Context(), "error", "This booking can no longer be cancelled online")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	// a cancel submitted twice, or staff checking the guest in at the same moment, finds the status changed
+	refunded, err := repo.changeStatus(r, res, models.StatusCancelled, "Cancelled online by the guest")
+	if err == repository.ErrStatusChanged {
+		repo.App.Session.Put(r.Context(), "error", "This booking can no longer be cancelled online")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Your booking has been cancelled. %s will be refunded.", render.FormatMoney(refunded)))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+func (repo *Repository) renderManageBooking(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form) {
+	paid, _, err := repo.amountPaid(res.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	due := res.Policy.Deposit(res.Total) - paid
+	if due < 0 || !canEditDetails(res) {
+		due = 0
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["can_cancel"] = canCancel(res, time.Now())
+	data["can_edit"] = canEditDetails(res)
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = mux.Vars(r)["token"]
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+
+	intMap := make(map[string]int)
+	intMap["paid"] = paid
+	intMap["deposit_due"] = due
+	intMap["cancellation_fee"] = res.Policy.CancellationFee(res.Total, res.StartDate, time.Now())
+	intMap["refundable"] = res.Policy.Refundable(paid, res.Total, res.StartDate, time.Now())
+
+	render.Template(w, r, "manage-booking.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// canCancel reports whether the guest may still change or cancel online, which they can up to the day of arrival
+func canCancel(res models.Reservation, now time.Time) bool {
+	if !res.CanTransitionTo(models.StatusCancelled) {
+		return false
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, res.StartDate.Location())
+	return !today.After(res.StartDate)
+}
+
+// ManagePayment shows the card form for a deposit that became due when the guest changed their booking
+func (repo *Repository) ManagePayment(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.manageReservation(w, r)
+	if !ok {
+		return
+	}
+
+	due, err := repo.depositDue(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if due == 0 || !canEditDetails(res) {
+		http.Redirect(w, r, fmt.Sprintf("/manage/%s", mux.Vars(r)["token"]), http.StatusSeeOther)
+		return
+	}
+
+	repo.renderPaymentForm(w, r, res, due, r.URL.Path, forms.New(nil))
+}
+
+// PostManagePayment charges the guest's card for the deposit still due on their booking
+func (repo *Repository) PostManagePayment(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.manageReservation(w, r)
+	if !ok {
+		return
+	}
+
+	back := fmt.Sprintf("/manage/%s", mux.Vars(r)["token"])
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	due, err := repo.depositDue(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if due == 0 || !canEditDetails(res) {
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	card := parseCard(r, form)
+
+	if !form.Valid() {
+		repo.renderPaymentForm(w, r, res, due, r.URL.Path, form)
+		return
+	}
+
+	payment, err := repo.chargeDeposit(res, due, card)
+	if err == repository.ErrStatusChanged {
+		repo.App.Session.Put(r.Context(), "error", "This booking can no longer be paid online")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else if payment.Status == models.PaymentFailed {
+		form.Errors.Add("card_number", "Your card could not be charged: "+payment.Message)
+		repo.renderPaymentForm(w, r, res, due, r.URL.Path, form)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Thank you, %s has been paid", render.FormatMoney(due)))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// canEditDetails reports whether the guest may still change their contact details, which they can until the stay is over
+func canEditDetails(res models.Reservation) bool {
+	switch res.Status {
+	case models.StatusCancelled, models.StatusCheckedOut, models.StatusNoShow:
+		return false
+	}
+	return true
+}
+
+// AdminRevokeManageLink stops every manage link sent for the reservation from working.
+// Links sent after this, with the next confirmation or change email, work as usual.
+func (repo *Repository) AdminRevokeManageLink(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	db, err := repo.audited(r, models.AuditRevokeLinks, models.AuditReservation, id, auditedLinks{res.ManageLinkVersion}, auditedLinks{res.ManageLinkVersion + 1})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = db.RevokeManageLinks(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "The guest's manage links have been revoked")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", mux.Vars(r)["src"], id), http.StatusSeeOther)
+}
+
+// emailCancellation tells the guest their reservation has been cancelled, when it was cancelled by them or by staff.
+// It is called from the event bus.
+func (repo *Repository) emailCancellation(e events.Event) error {
+	cancelled := e.(events.ReservationCancelled)
+	if cancelled.Actor != models.ActorGuest && cancelled.Actor != models.ActorStaff {
+		return nil
+	}
+
+	res, err := repo.DB.GetReservationByID(cancelled.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	return repo.sendCancellation(res, cancelled.Refunded)
+}
+
+// sendCancellation emails the guest that their reservation has been cancelled
+func (repo *Repository) sendCancellation(res models.Reservation, refunded int) error {
+	htmlMessage := fmt.Sprintf(`
+		<strong>Reservation Cancelled</strong><br>
+		Dear %s: <br>
+		Your reservation from %s to %s has been cancelled.<br>
+		Refund: %s
+	`, res.FirstName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"), render.FormatMoney(refunded))
+
+	return repo.sendMail(models.MailData{
+		To:      res.Email,
+		From:    "me@here.com",
+		Subject: "Reservation Cancelled",
+		Content: htmlMessage,
+	})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/tokens"
+	"github.com/alexedwards/scs/v2"
+	"github.com/gorilla/mux"
+)
+
+func TestCanCancel(t *testing.T) {
+	arrival := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status string
+		now    time.Time
+		want   bool
+	}{
+		{"before arrival", models.StatusConfirmed, arrival.AddDate(0, 0, -1), true},
+		{"late on the arrival date", models.StatusConfirmed, arrival.Add(23 * time.Hour), true},
+		{"after arrival", models.StatusConfirmed, arrival.AddDate(0, 0, 1), false},
+		{"not yet paid", models.StatusPending, arrival.AddDate(0, 0, -1), true},
+		{"already cancelled", models.StatusCancelled, arrival.AddDate(0, 0, -1), false},
+		{"checked in", models.StatusCheckedIn, arrival, false},
+	}
+
+	for _, tt := range tests {
+		res := models.Reservation{Status: tt.status, StartDate: arrival, EndDate: arrival.AddDate(0, 0, 2)}
+		if got := canCancel(res, tt.now); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanEditDetails(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{models.StatusPending, true},
+		{models.StatusConfirmed, true},
+		{models.StatusCheckedIn, true},
+		{models.StatusCheckedOut, false},
+		{models.StatusCancelled, false},
+		{models.StatusNoShow, false},
+	}
+
+	for _, tt := range tests {
+		if got := canEditDetails(models.Reservation{Status: tt.status}); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+// TestManageReservation only lets a link through that was signed for the reservation's current link version
+// and hasn't expired
+func TestManageReservation(t *testing.T) {
+	session := scs.New()
+	app := &config.AppConfig{
+		BaseURL: "https://hotel.example.com",
+		Links:   tokens.NewSigner([]byte("secret")),
+		Session: session,
+	}
+
+	start := dayOf(time.Now()).AddDate(0, 0, 10)
+	current := models.Reservation{ID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 2), ManageLinkVersion: 2}
+	past := models.Reservation{ID: 2, StartDate: start.AddDate(0, 0, -60), EndDate: start.AddDate(0, 0, -58)}
+
+	db := &mailDB{reservations: map[int]models.Reservation{1: current, 2: past}}
+	repo := &Repository{App: app, DB: db}
+
+	token := func(res models.Reservation) string {
+		return strings.TrimPrefix(repo.manageLink(res), app.BaseURL+"/manage/")
+	}
+	revoked := current
+	revoked.ManageLinkVersion = 1
+
+	tests := []struct {
+		name   string
+		token  string
+		wantID int
+	}{
+		{"valid link", token(current), 1},
+		{"revoked link", token(revoked), 0},
+		{"expired link", token(past), 0},
+		{"tampered link", token(current) + "x", 0},
+		{"not a link", "nonsense", 0},
+	}
+
+	for _, tt := range tests {
+		ctx, err := session.Load(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/manage/"+tt.token, nil).WithContext(ctx)
+		r = mux.SetURLVars(r, map[string]string{"token": tt.token})
+		w := httptest.NewRecorder()
+
+		res, ok := repo.manageReservation(w, r)
+		if ok != (tt.wantID > 0) || res.ID != tt.wantID {
+			t.Errorf("%s: got reservation %d, ok %v, want %d", tt.name, res.ID, ok, tt.wantID)
+		}
+		if !ok && (w.Code != http.StatusSeeOther || session.GetString(ctx, "error") == "") {
+			t.Errorf("%s: got status %d, error %q, want the guest sent home with an error", tt.name, w.Code, session.GetString(ctx, "error"))
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// AdminShowMoveRoom lists the rooms free for the rest of the stay from the chosen move date
+func (repo *Repository) AdminShowMoveRoom(w http.ResponseWriter, r *http.Request) {
+	res, back, ok := repo.movableReservation(w, r)
+	if !ok {
+		return
+	}
+
+	from := defaultMoveDate(res, time.Now())
+	if r.URL.Query().Get("from") != "" {
+		var err error
+		from, err = time.Parse("2006-01-02", r.URL.Query().Get("from"))
+		if err != nil || from.Before(res.StartDate) || !from.Before(res.EndDate) {
+			repo.App.Session.Put(r.Context(), "error", "The move date has to be a night of the stay")
+			http.Redirect(w, r, back+"/move", http.StatusSeeOther)
+			return
+		}
+	}
+
+	available, err := repo.DB.SearchAvailabilityForAllRooms(from, res.EndDate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var rooms []models.Room
+	for _, room := range available {
+		if room.ID != res.RoomID {
+			rooms = append(rooms, room)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["rooms"] = rooms
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = mux.Vars(r)["src"]
+	stringMap["from"] = from.Format("2006-01-02")
+
+	render.Template(w, r, "admin-reservation-move.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminPostMoveRoom moves the reservation to another room from the chosen date to departure.
+// The price of the stay is left as booked.
+func (repo *Repository) AdminPostMoveRoom(w http.ResponseWriter, r *http.Request) {
+	res, back, ok := repo.movableReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	from, err := time.Parse("2006-01-02", r.Form.Get("from"))
+	if err != nil || from.Before(res.StartDate) || !from.Before(res.EndDate) {
+		repo.App.Session.Put(r.Context(), "error", "The move date has to be a night of the stay")
+		http.Redirect(w, r, back+"/move", http.StatusSeeOther)
+		return
+	}
+
+	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
+	if err != nil || roomID == res.RoomID {
+		repo.App.Session.Put(r.Context(), "error", "Choose the room to move to")
+		http.Redirect(w, r, fmt.Sprintf("%s/move?from=%s", back, from.Format("2006-01-02")), http.StatusSeeOther)
+		return
+	}
+
+	room, err := repo.DB.GetRoomByID(roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	move := models.RoomMove{
+		ReservationID: res.ID,
+		ToRoomID:      room.ID,
+		MoveDate:      from,
+		UserID:        repo.App.Session.GetInt(r.Context(), "user_id"),
+		Reason:        strings.TrimSpace(r.Form.Get("reason")),
+	}
+
+	db, err := repo.audited(r, models.AuditMove, models.AuditReservation, res.ID,
+		map[string]interface{}{"room_id": res.RoomID},
+		map[string]interface{}{"room_id": room.ID, "from": from.Format("2006-01-02"), "reason": move.Reason})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = db.MoveReservationRoom(move)
+	if err == repository.ErrRoomUnavailable {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s was taken in the meantime, choose another room", room.RoomName))
+		http.Redirect(w, r, fmt.Sprintf("%s/move?from=%s", back, from.Format("2006-01-02")), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.eventsSaved()
+
+	// the room moved out of is free from the move date to departure
+	repo.inventoryFreed(from, res.EndDate)
+
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Moved to %s from %s", room.RoomName, from.Format("2006-01-02")))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// movableReservation loads the reservation in the URL and checks it still has nights to move.
+// It returns the admin reservation page to go back to.
+func (repo *Repository) movableReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, string, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.Reservation{}, "", false
+	}
+
+	back := fmt.Sprintf("/admin/reservations/%s/%d", mux.Vars(r)["src"], id)
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return res, back, false
+	}
+
+	if !res.Active() || res.Status == models.StatusCheckedOut {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("A %s reservation can't change rooms", res.StatusLabel()))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return res, back, false
+	}
+
+	return res, back, true
+}
+
+// defaultMoveDate is today for a guest in the middle of their stay, otherwise the whole stay is moved
+func defaultMoveDate(res models.Reservation, now time.Time) time.Time {
+	today := dayOf(now)
+	if today.After(res.StartDate) && today.Before(res.EndDate) {
+		return today
+	}
+
+	return res.StartDate
+}
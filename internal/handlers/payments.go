@@ -0,0 +1,552 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/payments"
+	"github.com/NganJason/hotel-booking/internal/pricing"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// paymentWindow is how long a guest has to pay the deposit before an unpaid booking is released
+const paymentWindow = 30 * time.Minute
+
+// Payment shows the card form for the reservation waiting in the session
+func (repo *Repository) Payment(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := repo.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || reservation.ID == 0 {
+		repo.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	due, err := repo.depositDue(reservation)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.renderPaymentForm(w, r, reservation, due, "/payment", forms.New(nil))
+}
+
+// PostPayment authorizes and captures the deposit due at booking, then confirms the booking
+func (repo *Repository) PostPayment(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := repo.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || reservation.ID == 0 {
+		repo.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	due, err := repo.depositDue(reservation)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if due == 0 {
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	card := parseCard(r, form)
+
+	if !form.Valid() {
+		repo.renderPaymentForm(w, r, reservation, due, "/payment", form)
+		return
+	}
+
+	payment, err := repo.chargeDeposit(reservation, due, card)
+	if err == repository.ErrStatusChanged {
+		repo.paymentExpired(w, r)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else if payment.Status == models.PaymentFailed {
+		form.Errors.Add("card_number", "Your card could not be charged: "+payment.Message)
+		repo.renderPaymentForm(w, r, reservation, due, "/payment", form)
+		return
+	}
+
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
+
+// parseCard reads the card fields of a payment form, adding any errors to form
+func parseCard(r *http.Request, form *forms.Form) payments.Card {
+	form.Required("card_name", "card_number", "exp_month", "exp_year", "cvc")
+
+	expMonth, err := strconv.Atoi(r.Form.Get("exp_month"))
+	if err != nil || expMonth < 1 || expMonth > 12 {
+		form.Errors.Add("exp_month", "Enter a month between 1 and 12")
+	}
+	expYear, err := strconv.Atoi(r.Form.Get("exp_year"))
+	if err != nil {
+		form.Errors.Add("exp_year", "Enter a valid year")
+	} else if now := time.Now(); expYear < now.Year() || expYear == now.Year() && expMonth < int(now.Month()) {
+		form.Errors.Add("exp_year", "This card has expired")
+	}
+
+	return payments.Card{
+		Name:     r.Form.Get("card_name"),
+		Number:   r.Form.Get("card_number"),
+		ExpMonth: expMonth,
+		ExpYear:  expYear,
+		CVC:      r.Form.Get("cvc"),
+	}
+}
+
+// paymentExpired sends a guest whose unpaid booking has been released back to search again
+func (repo *Repository) paymentExpired(w http.ResponseWriter, r *http.Request) {
+	repo.App.Session.Remove(r.Context(), "reservation")
+	repo.App.Session.Remove(r.Context(), "group")
+	repo.App.Session.Put(r.Context(), "error", "Sorry, the deposit wasn't paid in time and the booking has been released. Please search again.")
+	http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+}
+
+// amountPaid returns what has been taken for the reservation and not refunded, with its payments
+func (repo *Repository) amountPaid(reservationID int) (int, []models.Payment, error) {
+	payments, err := repo.DB.GetPaymentsForReservation(reservationID)
+	if err != nil {
+		return 0, payments, err
+	}
+
+	var paid int
+	for _, p := range payments {
+		paid += p.Refundable()
+	}
+
+	return paid, payments, nil
+}
+
+// depositDue returns how much of the reservation's deposit is still to be paid
+func (repo *Repository) depositDue(res models.Reservation) (int, error) {
+	paid, _, err := repo.amountPaid(res.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	due := res.Policy.Deposit(res.Total) - paid
+	if due < 0 {
+		return 0, nil
+	}
+	return due, nil
+}
+
+// refundOverpayment refunds whatever has been paid for the reservation beyond its total, newest payment
+// first, and returns how much that was. It is used when a change makes the stay cheaper.
+func (repo *Repository) refundOverpayment(res models.Reservation) (int, error) {
+	paid, payments, err := repo.amountPaid(res.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	excess := paid - res.Total
+	refunded := 0
+	for i := len(payments) - 1; i >= 0 && refunded < excess; i-- {
+		p := payments[i]
+		amount := p.Refundable()
+		if amount == 0 {
+			continue
+		}
+		if amount > excess-refunded {
+			amount = excess - refunded
+		}
+
+		err = repo.refundPayment(&p, amount)
+		if err != nil {
+			return refunded, err
+		}
+		if p.Refundable() == 0 {
+			p.Status = models.PaymentRefunded
+		}
+
+		err = repo.DB.UpdatePayment(p)
+		if err != nil {
+			return refunded, err
+		}
+		refunded += amount
+	}
+
+	return refunded, nil
+}
+
+// chargeDeposit authorizes and captures amount towards the reservation's deposit, recording each step.
+// A card the gateway refuses comes back as a failed payment whose Message says why, and so does one
+// whose capture fails, after its authorization has been voided. It returns repository.ErrStatusChanged
+// if the reservation was released for not being paid in time, or has since been cancelled. A pending
+// reservation is confirmed once its deposit has been paid in full.
+func (repo *Repository) chargeDeposit(reservation models.Reservation, amount int, card payments.Card) (models.Payment, error) {
+	payment, err := repo.authorizeDeposit(reservation, amount, card)
+	if err != nil || payment.Status == models.PaymentFailed {
+		return payment, err
+	}
+
+	err = repo.captureDeposit(&payment)
+	if err != nil || payment.Status == models.PaymentFailed {
+		return payment, err
+	}
+
+	return payment, repo.confirmPaid(reservation)
+}
+
+// authorizeDeposit records a payment of amount towards the reservation's deposit and authorizes it on the card.
+// A card the gateway refuses comes back as a failed payment whose Message says why.
+func (repo *Repository) authorizeDeposit(reservation models.Reservation, amount int, card payments.Card) (models.Payment, error) {
+	payment := models.Payment{
+		ReservationID: reservation.ID,
+		Amount:        amount,
+		Currency:      repo.App.BaseCurrency,
+		Status:        models.PaymentPending,
+		CardLast4:     card.Last4(),
+	}
+
+	var err error
+	payment.ID, err = repo.DB.InsertDepositPayment(payment)
+	if err != nil {
+		return payment, err
+	}
+
+	result, err := repo.App.Payments.Authorize(payment.Amount, payment.Currency, card)
+	if err != nil {
+		payment.Status = models.PaymentFailed
+		payment.Message = err.Error()
+		return payment, repo.DB.UpdatePayment(payment)
+	}
+
+	payment.Status = models.PaymentAuthorized
+	payment.GatewayRef = result.Reference
+	payment.Message = result.Message
+	return payment, repo.DB.UpdatePayment(payment)
+}
+
+// captureDeposit captures an authorized deposit payment. One whose capture fails is marked failed,
+// after its authorization has been voided.
+func (repo *Repository) captureDeposit(payment *models.Payment) error {
+	result, err := repo.App.Payments.Capture(payment.GatewayRef, payment.Amount)
+	if err != nil {
+		payment.Status = models.PaymentFailed
+		payment.Message = err.Error()
+
+		_, voidErr := repo.App.Payments.Void(payment.GatewayRef)
+		if voidErr != nil {
+			log.Println(voidErr)
+			payment.Message += "; the authorization could not be voided: " + voidErr.Error()
+		}
+		return repo.DB.UpdatePayment(*payment)
+	}
+
+	payment.Status = models.PaymentCaptured
+	payment.Message = result.Message
+	return repo.DB.UpdatePayment(*payment)
+}
+
+// releasePayments gives back what was taken by payments that have to be undone: an authorization is
+// voided and a captured payment refunded in full. It carries on past a failure, returning the first.
+func (repo *Repository) releasePayments(payments []models.Payment) error {
+	var first error
+	for _, p := range payments {
+		var err error
+		switch p.Status {
+		case models.PaymentAuthorized:
+			_, err = repo.App.Payments.Void(p.GatewayRef)
+			if err == nil {
+				p.Status = models.PaymentVoided
+			}
+		case models.PaymentCaptured:
+			err = repo.refundPayment(&p, p.Refundable())
+			if err == nil {
+				p.Status = models.PaymentRefunded
+			}
+		default:
+			continue
+		}
+
+		if err == nil {
+			err = repo.DB.UpdatePayment(p)
+		}
+		if err != nil {
+			log.Println(err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
+
+// confirmPaid confirms a pending reservation once nothing more of its deposit is due, which
+// also takes it out of reach of the sweep that releases unpaid bookings
+func (repo *Repository) confirmPaid(res models.Reservation) error {
+	due, err := repo.depositDue(res)
+	if err != nil || due > 0 {
+		return err
+	}
+
+	err = repo.DB.UpdateReservationStatus(models.ReservationStatusChange{
+		ReservationID: res.ID,
+		FromStatus:    models.StatusPending,
+		ToStatus:      models.StatusConfirmed,
+		Actor:         models.ActorSystem,
+		Note:          "Deposit paid",
+	})
+	if err == repository.ErrStatusChanged {
+		// already confirmed, or moved on by staff
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	repo.eventsSaved()
+
+	return nil
+}
+
+func (repo *Repository) renderPaymentForm(w http.ResponseWriter, r *http.Request, reservation models.Reservation, due int, action string, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["reservation"] = reservation
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = reservation.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = reservation.EndDate.Format("2006-01-02")
+	stringMap["action"] = action
+
+	if !reservation.PaymentDueBy.IsZero() {
+		stringMap["pay_by"] = reservation.PaymentDueBy.Format("15:04")
+	}
+
+	intMap := make(map[string]int)
+	intMap["due"] = due
+
+	render.Template(w, r, "payment.page.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
+
+// AdminCapturePayment captures an authorized payment in full
+func (repo *Repository) AdminCapturePayment(w http.ResponseWriter, r *http.Request) {
+	repo.adminPaymentAction(w, r, models.PaymentCaptured, func(p *models.Payment) error {
+		result, err := repo.App.Payments.Capture(p.GatewayRef, p.Amount)
+		if err != nil {
+			return err
+		}
+		p.Message = result.Message
+		return nil
+	})
+}
+
+// AdminVoidPayment releases an authorization that has not been captured
+func (repo *Repository) AdminVoidPayment(w http.ResponseWriter, r *http.Request) {
+	repo.adminPaymentAction(w, r, models.PaymentVoided, func(p *models.Payment) error {
+		result, err := repo.App.Payments.Void(p.GatewayRef)
+		if err != nil {
+			return err
+		}
+		p.Message = result.Message
+		return nil
+	})
+}
+
+// AdminRefundPayment refunds part or all of a captured payment
+func (repo *Repository) AdminRefundPayment(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.adminPaymentAction(w, r, models.PaymentRefunded, func(p *models.Payment) error {
+		amount := p.Refundable()
+		if r.Form.Get("amount") != "" {
+			amount, err = pricing.ParseAmount(r.Form.Get("amount"))
+			if err != nil {
+				return err
+			}
+		}
+		if amount <= 0 || amount > p.Refundable() {
+			return fmt.Errorf("refund must be between 0 and %s", render.FormatMoney(p.Refundable()))
+		}
+
+		return repo.refundPayment(p, amount)
+	})
+}
+
+// refundPayment refunds part of a captured payment, through the gateway unless it was taken at the front desk
+func (repo *Repository) refundPayment(p *models.Payment, amount int) error {
+	p.Message = "Refunded at the front desk"
+
+	if p.GatewayRef != "" {
+		result, err := repo.App.Payments.Refund(p.GatewayRef, amount)
+		if err != nil {
+			return err
+		}
+		p.Message = result.Message
+	}
+
+	p.RefundedAmount += amount
+	return nil
+}
+
+// adminPaymentAction loads the payment, checks the transition, runs the gateway call and saves the result.
+// A partial refund leaves the payment captured.
+func (repo *Repository) adminPaymentAction(w http.ResponseWriter, r *http.Request, status string, action func(p *models.Payment) error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	payment, err := repo.DB.GetPaymentByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	src := r.FormValue("src")
+	if src == "" {
+		src = "all"
+	}
+	back := fmt.Sprintf("/admin/reservations/%s/%d", src, payment.ReservationID)
+
+	if !payment.CanTransitionTo(status) {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("A %s payment can't be %s", payment.Status, status))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	before := payment
+
+	err = action(&payment)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Payment gateway: "+err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	if status != models.PaymentRefunded || payment.Refundable() == 0 {
+		payment.Status = status
+	}
+
+	db, err := repo.audited(r, models.AuditPayment, models.AuditReservation, payment.ReservationID, auditPayment(before), auditPayment(payment))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = db.UpdatePayment(payment)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Payment "+status)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminRecordPayment records money taken at the front desk, by cash or card terminal, against the reservation
+func (repo *Repository) AdminRecordPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/reservations/%s/%d", mux.Vars(r)["src"], id)
+	if strings.HasPrefix(r.Form.Get("back"), "/admin/") {
+		back = r.Form.Get("back")
+	}
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !res.Active() {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("A payment can't be taken for a %s reservation", res.StatusLabel()))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	// paid is what had been paid when the form was shown, to tell a second submission of the same payment
+	paid, err := strconv.Atoi(r.Form.Get("paid"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	amount, err := pricing.ParseAmount(r.Form.Get("amount"))
+	if err != nil || amount <= 0 {
+		repo.App.Session.Put(r.Context(), "error", "Enter the amount received")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if amount > res.Total-paid {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("That's more than the balance of %s", render.FormatMoney(res.Total-paid)))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	method := "cash"
+	if r.Form.Get("method") == "card" {
+		method = "card terminal"
+	}
+
+	payment := models.Payment{
+		ReservationID: id,
+		Amount:        amount,
+		Currency:      repo.App.BaseCurrency,
+		Status:        models.PaymentCaptured,
+		Message:       "Paid at the front desk by " + method,
+	}
+
+	db, err := repo.audited(r, models.AuditPayment, models.AuditReservation, id, nil, auditPayment(payment))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	payment.ID, err = db.InsertDeskPayment(payment, paid)
+	if err == repository.ErrDuplicateRequest {
+		repo.App.Session.Put(r.Context(), "error", "A payment has been recorded since the page was loaded, so this one wasn't. Check the balance before taking it again.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err == repository.ErrStatusChanged {
+		repo.App.Session.Put(r.Context(), "error", "The reservation has been cancelled, so the payment wasn't recorded")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s received", render.FormatMoney(amount)))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/payments"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// paymentDB keeps the payments of one reservation in memory, and the status changes made to it
+type paymentDB struct {
+	repository.DatabaseRepo
+	status   string
+	payments []models.Payment
+	changes  []models.ReservationStatusChange
+}
+
+func (db *paymentDB) InsertDepositPayment(p models.Payment) (int, error) {
+	if db.status == models.StatusCancelled {
+		return 0, repository.ErrStatusChanged
+	}
+	p.ID = len(db.payments) + 1
+	db.payments = append(db.payments, p)
+	return p.ID, nil
+}
+
+func (db *paymentDB) UpdatePayment(p models.Payment) error {
+	db.payments[p.ID-1] = p
+	return nil
+}
+
+func (db *paymentDB) GetPaymentsForReservation(reservationID int) ([]models.Payment, error) {
+	return db.payments, nil
+}
+
+func (db *paymentDB) UpdateReservationStatus(c models.ReservationStatusChange) error {
+	if db.status != c.FromStatus {
+		return repository.ErrStatusChanged
+	}
+	db.status = c.ToStatus
+	db.changes = append(db.changes, c)
+	return nil
+}
+
+func TestChargeDeposit(t *testing.T) {
+	res := models.Reservation{ID: 1, Total: 20000, Policy: models.CancellationPolicy{DepositPercent: 30}}
+
+	tests := []struct {
+		name        string
+		status      string
+		amount      int
+		card        string
+		wantErr     error
+		wantPayment string
+		wantStatus  string
+	}{
+		{"deposit paid in full", models.StatusPending, 6000, "4242424242424242", nil, models.PaymentCaptured, models.StatusConfirmed},
+		{"part of the deposit", models.StatusPending, 2000, "4242424242424242", nil, models.PaymentCaptured, models.StatusPending},
+		{"card declined", models.StatusPending, 6000, payments.FakeCardDeclined, nil, models.PaymentFailed, models.StatusPending},
+		{"processor unavailable", models.StatusPending, 6000, payments.FakeCardUnavailable, nil, models.PaymentFailed, models.StatusPending},
+		{"released as unpaid meanwhile", models.StatusCancelled, 6000, "4242424242424242", repository.ErrStatusChanged, "", models.StatusCancelled},
+	}
+
+	for _, tt := range tests {
+		db := &paymentDB{status: tt.status}
+		repo := &Repository{App: &config.AppConfig{Payments: payments.NewFakeGateway(), BaseCurrency: "USD"}, DB: db}
+
+		payment, err := repo.chargeDeposit(res, tt.amount, payments.Card{Number: tt.card})
+		if err != tt.wantErr {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+
+		if tt.wantPayment != "" {
+			if payment.Status != tt.wantPayment || db.payments[0].Status != tt.wantPayment {
+				t.Errorf("%s: payment %s, saved as %s, want %s", tt.name, payment.Status, db.payments[0].Status, tt.wantPayment)
+			}
+			if payment.Status == models.PaymentFailed && payment.Message == "" {
+				t.Errorf("%s: failed payment doesn't say why", tt.name)
+			}
+		} else if len(db.payments) > 0 {
+			t.Errorf("%s: recorded a payment", tt.name)
+		}
+
+		if db.status != tt.wantStatus {
+			t.Errorf("%s: reservation %s, want %s", tt.name, db.status, tt.wantStatus)
+		}
+	}
+}
+
+// TestReleasePayments gives back an authorization and a captured payment, and leaves a failed one alone
+func TestReleasePayments(t *testing.T) {
+	gateway := payments.NewFakeGateway()
+	card := payments.Card{Number: "4242424242424242"}
+
+	held, err := gateway.Authorize(3000, "USD", card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken, err := gateway.Authorize(5000, "USD", card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gateway.Capture(taken.Reference, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &paymentDB{payments: []models.Payment{
+		{ID: 1, Amount: 3000, Status: models.PaymentAuthorized, GatewayRef: held.Reference},
+		{ID: 2, Amount: 5000, RefundedAmount: 1000, Status: models.PaymentCaptured, GatewayRef: taken.Reference},
+		{ID: 3, Amount: 5000, Status: models.PaymentFailed},
+	}}
+	repo := &Repository{App: &config.AppConfig{Payments: gateway}, DB: db}
+
+	err = repo.releasePayments(db.payments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		status   string
+		refunded int
+	}{
+		{models.PaymentVoided, 0},
+		{models.PaymentRefunded, 5000},
+		{models.PaymentFailed, 0},
+	}
+	for i, w := range want {
+		p := db.payments[i]
+		if p.Status != w.status || p.RefundedAmount != w.refunded {
+			t.Errorf("payment %d: %s with %d refunded, want %s with %d", p.ID, p.Status, p.RefundedAmount, w.status, w.refunded)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/gorilla/mux"
+)
+
+// AdminPolicies lists the cancellation policies
+func (repo *Repository) AdminPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := repo.DB.AllPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["policies"] = policies
+
+	render.Template(w, r, "admin-policies.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowPolicy shows the form to create or edit a cancellation policy
+func (repo *Repository) AdminShowPolicy(w http.ResponseWriter, r *http.Request) {
+	policy := models.DefaultPolicy
+
+	if mux.Vars(r)["id"] != "" {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		policy, err = repo.DB.GetPolicyByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.renderPolicyForm(w, r, policy, forms.New(nil))
+}
+
+// AdminPostPolicy creates or updates a cancellation policy
+func (repo *Repository) AdminPostPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var policy models.CancellationPolicy
+
+	if mux.Vars(r)["id"] != "" {
+		policy.ID, err = strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "deposit_percent")
+
+	policy.Name = r.Form.Get("name")
+	policy.NonRefundable = r.Form.Get("non_refundable") != ""
+
+	number := func(field string, max int) int {
+		if r.Form.Get(field) == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(r.Form.Get(field))
+		if err != nil || n < 0 || n > max {
+			form.Errors.Add(field, fmt.Sprintf("Enter a whole number between 0 and %d", max))
+		}
+		return n
+	}
+
+	policy.FreeCancellationDays = number("free_cancellation_days", 365)
+	policy.PenaltyPercent = number("penalty_percent", 100)
+	policy.DepositPercent = number("deposit_percent", 100)
+	policy.BalanceDueDays = number("balance_due_days", 365)
+
+	if !form.Valid() {
+		repo.renderPolicyForm(w, r, policy, form)
+		return
+	}
+
+	var before models.CancellationPolicy
+	if policy.ID > 0 {
+		before, err = repo.DB.GetPolicyByID(policy.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	db, err := repo.auditedSave(r, models.AuditPolicy, policy.ID, auditPolicy(before), auditPolicy(policy))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if policy.ID > 0 {
+		err = db.UpdatePolicy(policy)
+	} else {
+		_, err = db.InsertPolicy(policy)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Policy saved")
+	http.Redirect(w, r, "/admin/policies", http.StatusSeeOther)
+}
+
+func (repo *Repository) renderPolicyForm(w http.ResponseWriter, r *http.Request, policy models.CancellationPolicy, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["policy"] = policy
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = "/admin/policies/new"
+	if policy.ID > 0 {
+		stringMap["action"] = fmt.Sprintf("/admin/policies/%d", policy.ID)
+	}
+
+	render.Template(w, r, "admin-policy-show.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// policyForRoom returns the policy a new booking of the room is made under
+func (repo *Repository) policyForRoom(room models.Room) (models.CancellationPolicy, error) {
+	if room.PolicyID == 0 {
+		return models.DefaultPolicy, nil
+	}
+
+	return repo.DB.GetPolicyByID(room.PolicyID)
+}
+
+// refundCancellation refunds what the reservation's policy allows back onto its captured payments
+// and returns the amount refunded
+func (repo *Repository) refundCancellation(res models.Reservation) (int, error) {
+	payments, err := repo.DB.GetPaymentsForReservation(res.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var paid int
+	for _, p := range payments {
+		paid += p.Refundable()
+	}
+
+	remaining := res.Policy.Refundable(paid, res.Total, res.StartDate, time.Now())
+	refunded := 0
+
+	for _, p := range payments {
+		if remaining == 0 {
+			break
+		}
+
+		amount := p.Refundable()
+		if amount == 0 {
+			continue
+		}
+		if amount > remaining {
+			amount = remaining
+		}
+
+		err := repo.refundPayment(&p, amount)
+		if err != nil {
+			return refunded, err
+		}
+
+		if p.Refundable() == 0 {
+			p.Status = models.PaymentRefunded
+		}
+
+		err = repo.DB.UpdatePayment(p)
+		if err != nil {
+			return refunded, err
+		}
+
+		remaining -= amount
+		refunded += amount
+	}
+
+	return refunded, nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/pricing"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/gorilla/mux"
+)
+
+// AdminPromotions lists all promotions
+func (repo *Repository) AdminPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := repo.DB.AllPromotions()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["promotions"] = promotions
+
+	render.Template(w, r, "admin-promotions.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowPromotion shows the form to create or edit a promotion
+func (repo *Repository) AdminShowPromotion(w http.ResponseWriter, r *http.Request) {
+	promo := models.Promotion{
+		DiscountType: models.DiscountPercent,
+		Active:       true,
+	}
+
+	if mux.Vars(r)["id"] != "" {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		promo, err = repo.DB.GetPromotionByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.renderPromotionForm(w, r, promo, forms.New(nil))
+}
+
+// AdminPostPromotion creates or updates a promotion
+func (repo *Repository) AdminPostPromotion(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var promo, before models.Promotion
+
+	if mux.Vars(r)["id"] != "" {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		promo, err = repo.DB.GetPromotionByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		before = promo
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "discount_type", "amount", "valid_from", "valid_to")
+
+	promo.Code = r.Form.Get("code")
+	promo.Description = r.Form.Get("description")
+	promo.DiscountType = r.Form.Get("discount_type")
+	promo.Active = r.Form.Get("active") != ""
+	promo.MinNights, _ = strconv.Atoi(r.Form.Get("min_nights"))
+	promo.MaxUses, _ = strconv.Atoi(r.Form.Get("max_uses"))
+
+	promo.RoomIDs = nil
+	for _, v := range r.Form["room_ids"] {
+		id, err := strconv.Atoi(v)
+		if err == nil {
+			promo.RoomIDs = append(promo.RoomIDs, id)
+		}
+	}
+
+	switch promo.DiscountType {
+	case models.DiscountPercent:
+		promo.Amount, err = strconv.Atoi(r.Form.Get("amount"))
+		if err != nil || promo.Amount <= 0 || promo.Amount > 100 {
+			form.Errors.Add("amount", "Enter a percentage between 1 and 100")
+		}
+	case models.DiscountFixed:
+		promo.Amount, err = pricing.ParseAmount(r.Form.Get("amount"))
+		if err != nil || promo.Amount == 0 {
+			form.Errors.Add("amount", "Enter an amount greater than zero")
+		}
+	default:
+		form.Errors.Add("discount_type", "Unknown discount type")
+	}
+
+	layout := "2006-01-02"
+	promo.ValidFrom, err = time.Parse(layout, r.Form.Get("valid_from"))
+	if err != nil {
+		form.Errors.Add("valid_from", "Invalid date")
+	}
+
+	promo.ValidTo, err = time.Parse(layout, r.Form.Get("valid_to"))
+	if err != nil {
+		form.Errors.Add("valid_to", "Invalid date")
+	} else if promo.ValidTo.Before(promo.ValidFrom) {
+		form.Errors.Add("valid_to", "Valid to must not be before valid from")
+	}
+
+	if !form.Valid() {
+		repo.renderPromotionForm(w, r, promo, form)
+		return
+	}
+
+	db, err := repo.auditedSave(r, models.AuditPromotion, promo.ID, auditPromotion(before), auditPromotion(promo))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if promo.ID > 0 {
+		err = db.UpdatePromotion(promo)
+	} else {
+		_, err = db.InsertPromotion(promo)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Promotion saved")
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+}
+
+func (repo *Repository) renderPromotionForm(w http.ResponseWriter, r *http.Request, promo models.Promotion, form *forms.Form) {
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	selected := make(map[int]bool)
+	for _, id := range promo.RoomIDs {
+		selected[id] = true
+	}
+
+	data := make(map[string]interface{})
+	data["promotion"] = promo
+	data["rooms"] = rooms
+	data["selected_rooms"] = selected
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = "/admin/promotions/new"
+	if promo.ID > 0 {
+		stringMap["action"] = fmt.Sprintf("/admin/promotions/%d", promo.ID)
+	}
+
+	if promo.DiscountType == models.DiscountFixed {
+		stringMap["amount"] = render.FormatAmount(promo.Amount)
+	} else if promo.Amount > 0 {
+		stringMap["amount"] = strconv.Itoa(promo.Amount)
+	}
+
+	render.Template(w, r, "admin-promotion-show.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/pricing"
+	"github.com/NganJason/hotel-booking/internal/render"
+)
+
+// AdminRooms shows the nightly rate, the most guests and the cancellation policy of every room
+func (repo *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	policies, err := repo.DB.AllPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["policies"] = policies
+
+	render.Template(w, r, "admin-rooms.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostRooms saves the nightly rates, most guests and policies of the rooms
+func (repo *Repository) AdminPostRooms(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for _, room := range rooms {
+		field := fmt.Sprintf("price_%d", room.ID)
+		if r.Form.Get(field) == "" {
+			continue
+		}
+
+		price, err := pricing.ParseAmount(r.Form.Get(field))
+		if err != nil {
+			repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Invalid rate for %s", room.RoomName))
+			http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+			return
+		}
+
+		if price != room.Price {
+			db, err := repo.audited(r, models.AuditUpdate, models.AuditRoom, room.ID,
+				map[string]interface{}{"price": render.FormatMoney(room.Price)}, map[string]interface{}{"price": render.FormatMoney(price)})
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			err = db.UpdateRoomPrice(room.ID, price)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+		}
+	}
+
+	for _, room := range rooms {
+		field := fmt.Sprintf("max_guests_%d", room.ID)
+		if r.Form.Get(field) == "" {
+			continue
+		}
+
+		maxGuests, err := strconv.Atoi(r.Form.Get(field))
+		if err != nil || maxGuests < 1 {
+			repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s has to sleep at least one guest", room.RoomName))
+			http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+			return
+		}
+
+		if maxGuests != room.MaxGuests {
+			db, err := repo.audited(r, models.AuditUpdate, models.AuditRoom, room.ID,
+				map[string]interface{}{"max_guests": room.MaxGuests}, map[string]interface{}{"max_guests": maxGuests})
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			err = db.UpdateRoomMaxGuests(room.ID, maxGuests)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+		}
+	}
+
+	for _, room := range rooms {
+		policyID, err := strconv.Atoi(r.Form.Get(fmt.Sprintf("policy_%d", room.ID)))
+		if err != nil || policyID == room.PolicyID {
+			continue
+		}
+
+		db, err := repo.audited(r, models.AuditUpdate, models.AuditRoom, room.ID,
+			map[string]interface{}{"policy_id": room.PolicyID}, map[string]interface{}{"policy_id": policyID})
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		err = db.UpdateRoomPolicy(room.ID, policyID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/folio"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// errFolioUnsettled is returned when checking out a guest who still owes money
+var errFolioUnsettled = errors.New("The folio has to be settled before check-out")
+
+// errNotArrived is returned when checking in a guest outside the dates of their stay
+var errNotArrived = errors.New("A guest can only be checked in from their arrival date until their departure")
+
+// AdminReservationStatus moves a reservation to the status posted from the admin reservation page
+func (repo *Repository) AdminReservationStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/reservations/%s/%d", mux.Vars(r)["src"], id)
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res, err := repo.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	status := r.Form.Get("status")
+	if !res.CanTransitionTo(status) {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("A %s reservation can't be marked %s", res.StatusLabel(), models.StatusLabel(status)))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	refunded, err := repo.changeStatus(r, res, status, r.Form.Get("note"))
+	if err == repository.ErrStatusChanged {
+		repo.App.Session.Put(r.Context(), "error", "The reservation was changed by someone else, please try again")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err == errFolioUnsettled || err == errNotArrived {
+		repo.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if refunded > 0 {
+		repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation %s, %s refunded", models.StatusLabel(status), render.FormatMoney(refunded)))
+	} else {
+		repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation %s", models.StatusLabel(status)))
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// changeStatus moves the reservation to the new status on behalf of whoever is making the request:
+// the logged in staff user, or otherwise the guest. A cancellation refunds what the policy allows,
+// emails the guest and returns the amount refunded. A change made by staff is recorded in the audit log.
+func (repo *Repository) changeStatus(r *http.Request, res models.Reservation, status, note string) (int, error) {
+	if status == models.StatusCheckedIn {
+		today := dayOf(time.Now())
+		if today.Before(res.StartDate) || !today.Before(res.EndDate) {
+			return 0, errNotArrived
+		}
+	}
+
+	if status == models.StatusCheckedOut {
+		payments, err := repo.DB.GetPaymentsForReservation(res.ID)
+		if err != nil {
+			return 0, err
+		}
+		if folio.New(res, payments).Balance > 0 {
+			return 0, errFolioUnsettled
+		}
+	}
+
+	// the refund is made before the booking is cancelled, so that one that fails leaves the booking
+	// as it was to be cancelled again, rather than cancelled with nothing refunded. A retry refunds
+	// only what is still owed, as the policy's fee is taken from what remains paid.
+	refunded := 0
+	if status == models.StatusCancelled {
+		var err error
+		refunded, err = repo.refundCancellation(res)
+		if err != nil {
+			return refunded, err
+		}
+	}
+
+	change := repo.statusChange(r, res, status, note)
+	change.Refunded = refunded
+
+	db, err := repo.statusChangesDB(r, []models.Reservation{res}, []models.ReservationStatusChange{change})
+	if err != nil {
+		return refunded, err
+	}
+
+	err = db.UpdateReservationStatus(change)
+	if err != nil {
+		return refunded, err
+	}
+
+	repo.statusChanged(res, change)
+
+	return refunded, nil
+}
+
+// statusChange describes a move of the reservation to status made by whoever is making the request
+func (repo *Repository) statusChange(r *http.Request, res models.Reservation, status, note string) models.ReservationStatusChange {
+	change := models.ReservationStatusChange{
+		ReservationID: res.ID,
+		FromStatus:    res.Status,
+		ToStatus:      status,
+		Actor:         models.ActorGuest,
+		Note:          note,
+	}
+
+	if helpers.IsAuthenticated(r) {
+		change.UserID = repo.App.Session.GetInt(r.Context(), "user_id")
+		change.Actor = models.ActorStaff
+	}
+
+	return change
+}
+
+// statusChangesDB returns the repository to save the changes to the reservations through, which records
+// those made by staff in the audit log along with them
+func (repo *Repository) statusChangesDB(r *http.Request, reservations []models.Reservation, changes []models.ReservationStatusChange) (repository.DatabaseRepo, error) {
+	var entries []models.AuditEntry
+	for i, change := range changes {
+		if change.Actor != models.ActorStaff {
+			continue
+		}
+
+		after := reservations[i]
+		after.Status = change.ToStatus
+		e, err := repo.auditEntry(r, models.AuditStatus, models.AuditReservation, reservations[i].ID, auditReservation(reservations[i]), auditReservation(after))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return repo.DB.Audited(entries...), nil
+}
+
+// statusChanged follows up a status change once it has been saved: offering freed rooms to the waitlist
+// and publishing its events, which tell the guest of a cancellation
+func (repo *Repository) statusChanged(res models.Reservation, change models.ReservationStatusChange) {
+	if change.ToStatus == models.StatusCancelled || change.ToStatus == models.StatusNoShow {
+		repo.inventoryFreed(res.StartDate, res.EndDate)
+	}
+
+	repo.eventsSaved()
+}
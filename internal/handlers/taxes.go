@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/pricing"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/gorilla/mux"
+)
+
+// AdminTaxRules lists the tax and fee rules
+func (repo *Repository) AdminTaxRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := repo.DB.AllTaxRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rules"] = rules
+
+	render.Template(w, r, "admin-taxes.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowTaxRule shows the form to create or edit a tax or fee rule
+func (repo *Repository) AdminShowTaxRule(w http.ResponseWriter, r *http.Request) {
+	rule := models.TaxRule{
+		Kind:   "tax",
+		Basis:  models.TaxPercentage,
+		Active: true,
+	}
+
+	if mux.Vars(r)["id"] != "" {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		rule, err = repo.DB.GetTaxRuleByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.renderTaxRuleForm(w, r, rule, forms.New(nil))
+}
+
+// AdminPostTaxRule creates or updates a tax or fee rule
+func (repo *Repository) AdminPostTaxRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var rule models.TaxRule
+
+	if mux.Vars(r)["id"] != "" {
+		rule.ID, err = strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "kind", "basis", "amount")
+
+	rule.Name = r.Form.Get("name")
+	rule.Kind = r.Form.Get("kind")
+	rule.Basis = r.Form.Get("basis")
+	rule.Active = r.Form.Get("active") != ""
+
+	// percentages are entered as e.g. 7.5 and stored in hundredths of a percent, the same way amounts are stored in cents
+	rule.Amount, err = pricing.ParseAmount(r.Form.Get("amount"))
+	if err != nil {
+		form.Errors.Add("amount", "Invalid amount")
+	}
+
+	if rule.Kind != "tax" && rule.Kind != "fee" {
+		form.Errors.Add("kind", "Unknown kind")
+	}
+
+	switch rule.Basis {
+	case models.TaxPerNight, models.TaxPerPersonNight, models.TaxPerStay, models.TaxPercentage:
+	default:
+		form.Errors.Add("basis", "Unknown basis")
+	}
+
+	if !form.Valid() {
+		repo.renderTaxRuleForm(w, r, rule, form)
+		return
+	}
+
+	var before models.TaxRule
+	if rule.ID > 0 {
+		before, err = repo.DB.GetTaxRuleByID(rule.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	db, err := repo.auditedSave(r, models.AuditTaxRule, rule.ID, auditTaxRule(before), auditTaxRule(rule))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if rule.ID > 0 {
+		err = db.UpdateTaxRule(rule)
+	} else {
+		_, err = db.InsertTaxRule(rule)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Rule saved")
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
+}
+
+func (repo *Repository) renderTaxRuleForm(w http.ResponseWriter, r *http.Request, rule models.TaxRule, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["rule"] = rule
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = "/admin/taxes/new"
+	if rule.ID > 0 {
+		stringMap["action"] = fmt.Sprintf("/admin/taxes/%d", rule.ID)
+	}
+
+	render.Template(w, r, "admin-tax-show.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// activeTaxRules returns the tax and fee rules applied to new quotes
+func (repo *Repository) activeTaxRules() ([]models.TaxRule, error) {
+	all, err := repo.DB.AllTaxRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []models.TaxRule
+	for _, t := range all {
+		if t.Active {
+			rules = append(rules, t)
+		}
+	}
+
+	return rules, nil
+}
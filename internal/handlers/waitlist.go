@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/gorilla/mux"
+)
+
+// waitlistOfferPurpose scopes waitlist booking links so they can't be reused for other signed links
+const waitlistOfferPurpose = "waitlist-offer"
+
+// waitlistLeavePurpose scopes the links guests use to take themselves off the waitlist
+const waitlistLeavePurpose = "waitlist-leave"
+
+// waitlistOfferWindow is how long a waitlisted guest has to book before the room is offered to the next guest
+const waitlistOfferWindow = 24 * time.Hour
+
+// Waitlist shows the form to join the waitlist, filled in with the dates that were searched
+func (repo *Repository) Waitlist(w http.ResponseWriter, r *http.Request) {
+	entry := models.WaitlistEntry{Guests: 1}
+	entry.StartDate, _ = time.Parse("2006-01-02", r.URL.Query().Get("s"))
+	entry.EndDate, _ = time.Parse("2006-01-02", r.URL.Query().Get("e"))
+
+	repo.renderWaitlistForm(w, r, entry, forms.New(nil))
+}
+
+// PostWaitlist adds the guest to the waitlist for their dates
+func (repo *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "start_date", "end_date")
+	form.IsEmail("email")
+
+	entry := models.WaitlistEntry{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+	}
+
+	entry.Guests, err = strconv.Atoi(r.Form.Get("guests"))
+	if err != nil || entry.Guests < 1 {
+		form.Errors.Add("guests", "At least one guest is required")
+		entry.Guests = 1
+	}
+
+	start, end, err := parseStayDates(r)
+	entry.StartDate, entry.EndDate = start, end
+	if err == nil && start.Before(dayOf(time.Now())) {
+		form.Errors.Add("start_date", "Arrival can't be in the past")
+	} else if err != nil {
+		form.Errors.Add("end_date", err.Error())
+	}
+
+	if !form.Valid() {
+		repo.renderWaitlistForm(w, r, entry, form)
+		return
+	}
+
+	entry.ID, err = repo.DB.InsertWaitlistEntry(entry)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.eventsSaved()
+
+	repo.App.Session.Put(r.Context(), "flash", "You're on the waitlist. We'll email you as soon as a room comes free.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (repo *Repository) renderWaitlistForm(w http.ResponseWriter, r *http.Request, entry models.WaitlistEntry, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["entry"] = entry
+
+	stringMap := make(map[string]string)
+	if !entry.StartDate.IsZero() {
+		stringMap["start_date"] = entry.StartDate.Format("2006-01-02")
+	}
+	if !entry.EndDate.IsZero() {
+		stringMap["end_date"] = entry.EndDate.Format("2006-01-02")
+	}
+
+	render.Template(w, r, "waitlist.page.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// WaitlistOffer takes a guest who followed their waitlist link to the rooms free for their dates
+func (repo *Repository) WaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	id, err := repo.App.Links.Verify(waitlistOfferPurpose, mux.Vars(r)["token"])
+	if err != nil {
+		repo.App.Session.Put(r.Context(), "error", "This offer is invalid or has expired")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	entry, err := repo.DB.GetWaitlistEntryByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if (entry.Status != models.WaitlistOffered && entry.Status != models.WaitlistAccepted) || !entry.ExpiresAt.After(time.Now()) {
+		repo.App.Session.Put(r.Context(), "error", "This offer is invalid or has expired")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	rooms, err := repo.DB.SearchAvailabilityForAllRooms(entry.StartDate, entry.EndDate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms = roomsFor(rooms, entry.Guests)
+	if len(rooms) == 0 {
+		repo.App.Session.Put(r.Context(), "error", "Sorry, the room has already been booked")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if entry.Status == models.WaitlistOffered {
+		entry.Status = models.WaitlistAccepted
+		err = repo.DB.UpdateWaitlistEntry(entry)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	// the booking made from here closes the entry, see PostReservation
+	repo.App.Session.Put(r.Context(), "waitlist_entry", entry.ID)
+	repo.App.Session.Put(r.Context(), "reservation", models.Reservation{
+		FirstName: entry.FirstName,
+		LastName:  entry.LastName,
+		Email:     entry.Email,
+		StartDate: entry.StartDate,
+		EndDate:   entry.EndDate,
+		Guests:    entry.Guests,
+	})
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	render.Template(w, r, "choose-room.page.html", &models.TemplateData{Data: data})
+}
+
+// OfferWaitlist expires offers that weren't taken up, then offers a room to waiting guests, in the order they joined,
+// whose dates overlap the freed nights and can now be booked. The offer is emailed from the event bus. A room already offered to someone else
+// isn't offered again until that offer expires.
+func (repo *Repository) OfferWaitlist(freed models.FreedInventory) error {
+	now := time.Now()
+	today := dayOf(now)
+
+	err := repo.DB.ExpireWaitlistOffers(now)
+	if err != nil {
+		return err
+	}
+
+	entries, err := repo.DB.WaitingWaitlistEntries()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.StartDate.Before(today) {
+			entry.Status = models.WaitlistExpired
+			err = repo.DB.UpdateWaitlistEntry(entry)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !freed.StartDate.IsZero() && !(entry.StartDate.Before(freed.EndDate) && entry.EndDate.After(freed.StartDate)) {
+			continue
+		}
+
+		rooms, err := repo.DB.SearchAvailabilityForAllRooms(entry.StartDate, entry.EndDate)
+		if err != nil {
+			return err
+		}
+		rooms = roomsFor(rooms, entry.Guests)
+
+		offered, err := repo.DB.CountOpenWaitlistOffers(entry.StartDate, entry.EndDate, now)
+		if err != nil {
+			return err
+		}
+
+		if len(rooms) <= offered {
+			continue
+		}
+
+		entry.NotifiedAt = now
+		entry.ExpiresAt = now.Add(waitlistOfferWindow)
+		err = repo.DB.OfferWaitlistEntry(entry)
+		if err != nil {
+			return err
+		}
+
+		repo.eventsSaved()
+	}
+
+	return nil
+}
+
+// roomsFor returns the rooms that sleep at least guests
+func roomsFor(rooms []models.Room, guests int) []models.Room {
+	var fit []models.Room
+	for _, room := range rooms {
+		if room.MaxGuests >= guests {
+			fit = append(fit, room)
+		}
+	}
+	return fit
+}
+
+// inventoryFreed tells the waitlist process that rooms may have come free. It never blocks the request:
+// if the process is busy the next periodic pass picks the change up.
+func (repo *Repository) inventoryFreed(start, end time.Time) {
+	select {
+	case repo.App.Waitlist <- models.FreedInventory{StartDate: start, EndDate: end}:
+	default:
+	}
+}
+
+// waitlistLeaveLink returns the link the guest can follow to leave the waitlist, which works until their stay would end
+func (repo *Repository) waitlistLeaveLink(entry models.WaitlistEntry) string {
+	return fmt.Sprintf("%s/waitlist/leave/%s", repo.App.BaseURL, repo.App.Links.Sign(waitlistLeavePurpose, entry.ID, entry.EndDate))
+}
+
+// emailWaitlistJoined tells a guest who has joined the waitlist that they are on it. It is called from the event bus.
+func (repo *Repository) emailWaitlistJoined(e events.Event) error {
+	entry, err := repo.DB.GetWaitlistEntryByID(e.(events.WaitlistJoined).EntryID)
+	if err != nil {
+		return err
+	}
+
+	return repo.sendWaitlistJoined(entry)
+}
+
+// emailWaitlistOffer sends a guest the room offered to them, unless the offer is no longer open.
+// It is called from the event bus.
+func (repo *Repository) emailWaitlistOffer(e events.Event) error {
+	entry, err := repo.DB.GetWaitlistEntryByID(e.(events.WaitlistOffered).EntryID)
+	if err != nil {
+		return err
+	}
+
+	if entry.Status != models.WaitlistOffered || !entry.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+
+	return repo.sendWaitlistOffer(entry)
+}
+
+// sendWaitlistJoined emails the guest that they are on the waitlist, with the link to leave it
+func (repo *Repository) sendWaitlistJoined(entry models.WaitlistEntry) error {
+	leave := repo.waitlistLeaveLink(entry)
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>You're On The Waitlist</strong><br>
+		Dear %s: <br>
+		You're on the waitlist for %s to %s, %d guest(s).<br>
+		We'll email you a booking link as soon as a room comes free.<br>
+		<br>
+		If your plans change, you can leave the waitlist here: <a href="%s">%s</a>
+	`, entry.FirstName, entry.StartDate.Format("2006-01-02"), entry.EndDate.Format("2006-01-02"), entry.Guests, leave, leave)
+
+	return repo.sendMail(models.MailData{
+		To:      entry.Email,
+		From:    "me@here.com",
+		Subject: "You're on the waitlist",
+		Content: htmlMessage,
+	})
+}
+
+// sendWaitlistOffer emails the guest a link to book that works until the offer expires
+func (repo *Repository) sendWaitlistOffer(entry models.WaitlistEntry) error {
+	link := fmt.Sprintf("%s/waitlist/%s", repo.App.BaseURL, repo.App.Links.Sign(waitlistOfferPurpose, entry.ID, entry.ExpiresAt))
+	leave := repo.waitlistLeaveLink(entry)
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>A Room Is Available</strong><br>
+		Dear %s: <br>
+		Good news, a room has come free for %s to %s.<br>
+		The offer is yours until %s. Book here: <a href="%s">%s</a><br>
+		After that the room will be offered to the next guest on the waitlist.<br>
+		<br>
+		No longer need a room? Leave the waitlist here: <a href="%s">%s</a>
+	`, entry.FirstName, entry.StartDate.Format("2006-01-02"), entry.EndDate.Format("2006-01-02"),
+		entry.ExpiresAt.Format("2006-01-02 15:04"), link, link, leave, leave)
+
+	return repo.sendMail(models.MailData{
+		To:      entry.Email,
+		From:    "me@here.com",
+		Subject: "A room is available for your dates",
+		Content: htmlMessage,
+	})
+}
+
+// LeaveWaitlist asks a guest who followed their leave link to confirm they want to leave the waitlist
+func (repo *Repository) LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	entry, ok := repo.leavingEntry(w, r)
+	if !ok {
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["entry"] = entry
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = mux.Vars(r)["token"]
+
+	render.Template(w, r, "waitlist-leave.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// PostLeaveWaitlist takes the guest off the waitlist, giving up any offer they have been sent
+func (repo *Repository) PostLeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	entry, ok := repo.leavingEntry(w, r)
+	if !ok {
+		return
+	}
+
+	offered := entry.Status != models.WaitlistWaiting
+
+	entry.Status = models.WaitlistLeft
+	err := repo.DB.UpdateWaitlistEntry(entry)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// an offer given up frees its room for the next guest
+	if offered {
+		repo.inventoryFreed(entry.StartDate, entry.EndDate)
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "You've left the waitlist")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// leavingEntry returns the waitlist entry of the leave link in the request, if the guest is still on the waitlist
+func (repo *Repository) leavingEntry(w http.ResponseWriter, r *http.Request) (models.WaitlistEntry, bool) {
+	id, err := repo.App.Links.Verify(waitlistLeavePurpose, mux.Vars(r)["token"])
+	if err != nil {
+		repo.App.Session.Put(r.Context(), "error", "This link is invalid or has expired")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.WaitlistEntry{}, false
+	}
+
+	entry, err := repo.DB.GetWaitlistEntryByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return entry, false
+	}
+
+	if entry.Status != models.WaitlistWaiting && entry.Status != models.WaitlistOffered && entry.Status != models.WaitlistAccepted {
+		repo.App.Session.Put(r.Context(), "error", "You're no longer on the waitlist")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// AdminWaitlist lists the waitlist
+func (repo *Repository) AdminWaitlist(w http.ResponseWriter, r *http.Request) {
+	entries, err := repo.DB.AllWaitlistEntries()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["entries"] = entries
+
+	render.Template(w, r, "admin-waitlist.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
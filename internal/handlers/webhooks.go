@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/forms"
+	"github.com/NganJason/hotel-booking/internal/helpers"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/render"
+	"github.com/NganJason/hotel-booking/internal/repository"
+	"github.com/NganJason/hotel-booking/internal/tokens"
+	"github.com/NganJason/hotel-booking/internal/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// webhookBatchSize is the most deliveries sent in one go by the webhook worker
+const webhookBatchSize = 100
+
+// webhookClaimTime is how long a delivery is set aside for whoever is sending it, well over the time
+// an endpoint has to answer, so that the worker and the admin screens never send it twice at once
+const webhookClaimTime = time.Minute
+
+// webhookLogSize is how many deliveries are shown in the delivery log
+const webhookLogSize = 100
+
+// queueReservationEvent queues deliveries of the event to the webhooks subscribed to it, describing
+// the reservation as it is now saved. It is called from the event bus, so that deliveries are only
+// queued for changes that were committed, and queued again if this fails.
+func (repo *Repository) queueReservationEvent(event string, reservationID int) error {
+	res, err := repo.DB.GetReservationByID(reservationID)
+	if err != nil {
+		return err
+	}
+
+	payload, err := webhookPayload(event, webhooks.NewReservation(res, repo.App.BaseCurrency))
+	if err != nil {
+		return err
+	}
+
+	n, err := repo.DB.QueueWebhookEvent(event, payload)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		repo.webhooksQueued()
+	}
+
+	return nil
+}
+
+// webhooksQueued wakes the webhook worker, unless it has already been woken
+func (repo *Repository) webhooksQueued() {
+	select {
+	case repo.App.Webhooks <- struct{}{}:
+	default:
+	}
+}
+
+func webhookPayload(event string, data interface{}) (string, error) {
+	id, err := tokens.Random()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(webhooks.Envelope{
+		ID:        id,
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// deliverWebhook makes one attempt at the delivery and saves how it went. A delivery that fails is tried
+// again later, backing off each time, until it has been tried webhooks.MaxAttempts times.
+func (repo *Repository) deliverWebhook(d models.WebhookDelivery) (models.WebhookDelivery, error) {
+	code, err := webhooks.Send(d)
+
+	d.Attempts++
+	d.ResponseCode = code
+	if err == nil {
+		d.Status = models.DeliveryDelivered
+		d.DeliveredAt = time.Now()
+		d.NextAttemptAt = time.Time{}
+		d.LastError = ""
+	} else {
+		d.LastError = helpers.Truncate(err.Error(), 255)
+		if d.Attempts >= webhooks.MaxAttempts {
+			d.Status = models.DeliveryFailed
+			d.NextAttemptAt = time.Time{}
+		} else {
+			d.Status = models.DeliveryPending
+			d.NextAttemptAt = time.Now().Add(webhooks.Backoff(d.Attempts))
+		}
+	}
+
+	return d, repo.DB.UpdateWebhookDelivery(d)
+}
+
+// DeliverWebhooks sends the webhook deliveries that are due, claiming each one before sending it
+func (repo *Repository) DeliverWebhooks() error {
+	for i := 0; i < webhookBatchSize; i++ {
+		d, err := repo.DB.ClaimDueWebhookDelivery(webhookClaimTime)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = repo.deliverWebhook(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AdminWebhooks lists the webhooks and the latest deliveries
+func (repo *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := repo.DB.AllWebhooks()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	deliveries, err := repo.DB.RecentWebhookDeliveries(webhookLogSize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhooks"] = hooks
+	data["deliveries"] = deliveries
+
+	render.Template(w, r, "admin-webhooks.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowWebhook shows the form to create or edit a webhook
+func (repo *Repository) AdminShowWebhook(w http.ResponseWriter, r *http.Request) {
+	hook := models.Webhook{Active: true}
+
+	if mux.Vars(r)["id"] != "" {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		hook, err = repo.DB.GetWebhookByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repo.renderWebhookForm(w, r, hook, forms.New(nil))
+}
+
+// AdminPostWebhook creates or updates a webhook. A new webhook left without a secret is given a random one.
+func (repo *Repository) AdminPostWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var hook models.Webhook
+
+	if mux.Vars(r)["id"] != "" {
+		hook.ID, err = strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "url")
+
+	hook.Name = strings.TrimSpace(r.Form.Get("name"))
+	hook.URL = strings.TrimSpace(r.Form.Get("url"))
+	hook.Secret = strings.TrimSpace(r.Form.Get("secret"))
+	hook.Active = r.Form.Get("active") != ""
+
+	// subscribing to none of the events sends them all
+	for _, event := range webhooks.Events {
+		if r.Form.Get("event_"+event) != "" {
+			hook.Events = append(hook.Events, event)
+		}
+	}
+
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(hook.URL) > 255 {
+		form.Errors.Add("url", "Enter the endpoint's address, starting with http:// or https://")
+	}
+
+	if hook.Secret == "" {
+		if hook.ID > 0 {
+			form.Errors.Add("secret", "The endpoint needs the secret to check signatures")
+		} else {
+			hook.Secret, err = tokens.Random()
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+		}
+	}
+
+	if !form.Valid() {
+		repo.renderWebhookForm(w, r, hook, form)
+		return
+	}
+
+	var before models.Webhook
+	if hook.ID > 0 {
+		before, err = repo.DB.GetWebhookByID(hook.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	db, err := repo.auditedSave(r, models.AuditWebhook, hook.ID, auditWebhook(before), auditWebhook(hook))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if hook.ID > 0 {
+		err = db.UpdateWebhook(hook)
+	} else {
+		hook.ID, err = db.InsertWebhook(hook)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Webhook saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
+
+func (repo *Repository) renderWebhookForm(w http.ResponseWriter, r *http.Request, hook models.Webhook, form *forms.Form) {
+	subscribed := make(map[string]bool)
+	for _, event := range hook.Events {
+		subscribed[event] = true
+	}
+
+	data := make(map[string]interface{})
+	data["webhook"] = hook
+	data["events"] = webhooks.Events
+	data["subscribed"] = subscribed
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = "/admin/webhooks/new"
+	if hook.ID > 0 {
+		stringMap["action"] = fmt.Sprintf("/admin/webhooks/%d", hook.ID)
+	}
+
+	render.Template(w, r, "admin-webhook-show.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// AdminDeleteWebhook deletes a webhook and its delivery log
+func (repo *Repository) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	hook, err := repo.DB.GetWebhookByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	db, err := repo.audited(r, models.AuditDelete, models.AuditWebhook, id, auditWebhook(hook), nil)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = db.DeleteWebhook(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Webhook deleted")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminTestWebhook sends the webhook a test event straight away and reports how it went.
+// A test that fails is retried like any other delivery.
+func (repo *Repository) AdminTestWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	hook, err := repo.DB.GetWebhookByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	payload, err := webhookPayload(webhooks.EventTest, map[string]string{"message": "This is a test event"})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	d := models.WebhookDelivery{
+		WebhookID: hook.ID,
+		Event:     webhooks.EventTest,
+		Payload:   payload,
+		Webhook:   hook,
+		// claimed from the start, so the worker leaves it to us
+		ClaimedUntil: time.Now().Add(webhookClaimTime),
+	}
+
+	d.ID, err = repo.DB.InsertWebhookDelivery(d)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	d, err = repo.deliverWebhook(d)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if d.Status == models.DeliveryDelivered {
+		repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Test event delivered, the endpoint answered %d", d.ResponseCode))
+	} else {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Test event failed: %s", d.LastError))
+	}
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminRetryWebhookDelivery sends a delivery again straight away, even one that was given up on
+func (repo *Repository) AdminRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	d, err := repo.DB.ClaimWebhookDelivery(id, webhookClaimTime)
+	if errors.Is(err, repository.ErrDeliveryInProgress) {
+		repo.App.Session.Put(r.Context(), "error", "This delivery is being sent right now, check the log again in a moment")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// a retried delivery gets a fresh set of attempts if this one fails too
+	if d.Status == models.DeliveryFailed {
+		d.Attempts = 0
+	}
+
+	d, err = repo.deliverWebhook(d)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if d.Status == models.DeliveryDelivered {
+		repo.App.Session.Put(r.Context(), "flash", "Delivered")
+	} else {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Delivery failed: %s", d.LastError))
+	}
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
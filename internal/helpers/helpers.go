@@ -2,8 +2,10 @@ package helpers
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"unicode/utf8"
 
 	"github.com/NganJason/hotel-booking/internal/config"
 )
@@ -28,4 +30,22 @@ func ServerError(w http.ResponseWriter, err error) {
 func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
-}
\ No newline at end of file
+}
+
+// Truncate shortens s to at most n characters, for saving to a column of that size.
+// It counts characters rather than bytes, as Postgres does, so a character is never cut in half.
+func Truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// ClientIP returns the address the request came from, without the port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
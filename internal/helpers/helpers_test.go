@@ -0,0 +1,47 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"too long", 3, "too"},
+		{"Zoë Åström", 3, "Zoë"},
+		{"日本語のエラー", 3, "日本語"},
+		{"", 3, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"192.0.2.1:54321", "192.0.2.1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("ClientIP with RemoteAddr %q = %q, want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
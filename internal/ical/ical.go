@@ -0,0 +1,98 @@
+// Package ical reads and writes calendars in the iCalendar format (RFC 5545), the feeds booking platforms
+// and calendar apps exchange bookings through
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const dateLayout = "20060102"
+const stampLayout = "20060102T150405Z"
+
+// maxLineLength is the longest content line allowed before it has to be folded onto the next
+const maxLineLength = 75
+
+// Event is an all-day event covering the nights from Start up to End
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Updated     time.Time
+}
+
+// Calendar is a named list of events
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Write writes the calendar to w
+func (c Calendar) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//hotel-booking//Reservations//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escape(c.Name))
+
+	now := time.Now().UTC().Format(stampLayout)
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", now)
+		line("DTSTART;VALUE=DATE", e.Start.Format(dateLayout))
+		line("DTEND;VALUE=DATE", e.End.Format(dateLayout))
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if !e.Updated.IsZero() {
+			line("LAST-MODIFIED", e.Updated.UTC().Format(stampLayout))
+		}
+		line("TRANSP", "OPAQUE")
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	return b.Flush()
+}
+
+// escape escapes the characters that have a meaning in text values
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`;`, `\;`,
+		`,`, `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// writeLine writes a content line ending in CRLF, folding it so no line is longer than maxLineLength octets
+func writeLine(w *bufio.Writer, s string) {
+	limit := maxLineLength
+	for len(s) > limit {
+		// don't cut a multi-byte character in half
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		fmt.Fprintf(w, "%s\r\n ", s[:cut])
+		s = s[cut:]
+		// continuation lines start with a space, which counts towards their length
+		limit = maxLineLength - 1
+	}
+	fmt.Fprintf(w, "%s\r\n", s)
+}
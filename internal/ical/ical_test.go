@@ -0,0 +1,218 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// calendar wraps content lines in a calendar, ending each line in CRLF as feeds do
+func calendar(lines ...string) string {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...)
+	all = append(all, "END:VCALENDAR")
+	return strings.Join(all, "\r\n") + "\r\n"
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Event
+		wantErr bool
+	}{
+		{
+			name: "all-day event",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"UID:a@example.com",
+				"DTSTART;VALUE=DATE:20260610",
+				"DTEND;VALUE=DATE:20260613",
+				"SUMMARY:Reserved",
+				"LAST-MODIFIED:20260601T120000Z",
+				"END:VEVENT",
+			),
+			want: []Event{{
+				UID:     "a@example.com",
+				Start:   date("2026-06-10"),
+				End:     date("2026-06-13"),
+				Summary: "Reserved",
+				Updated: time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "times of day dropped",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"UID:b",
+				"DTSTART;TZID=Europe/Paris:20260610T150000",
+				"DTEND;TZID=Europe/Paris:20260612T110000",
+				"END:VEVENT",
+			),
+			want: []Event{{UID: "b", Start: date("2026-06-10"), End: date("2026-06-12")}},
+		},
+		{
+			name: "no end lasts a night",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"UID:c",
+				"DTSTART:20260610",
+				"END:VEVENT",
+			),
+			want: []Event{{UID: "c", Start: date("2026-06-10"), End: date("2026-06-11")}},
+		},
+		{
+			name: "cancelled left out",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"UID:d",
+				"DTSTART:20260610",
+				"DTEND:20260611",
+				"STATUS:CANCELLED",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:e",
+				"DTSTART:20260611",
+				"DTEND:20260612",
+				"STATUS:CONFIRMED",
+				"END:VEVENT",
+			),
+			want: []Event{{UID: "e", Start: date("2026-06-11"), End: date("2026-06-12")}},
+		},
+		{
+			name: "folded and escaped text",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"UID:f",
+				"DTSTART:20260610",
+				"DTEND:20260611",
+				`SUMMARY:Smith\, Jane\; two`,
+				" guests",
+				`DESCRIPTION:Late arrival\nby car`,
+				"END:VEVENT",
+			),
+			want: []Event{{
+				UID:         "f",
+				Start:       date("2026-06-10"),
+				End:         date("2026-06-11"),
+				Summary:     "Smith, Jane; twoguests",
+				Description: "Late arrival\nby car",
+			}},
+		},
+		{
+			name:    "not a calendar",
+			input:   "<html></html>",
+			wantErr: true,
+		},
+		{
+			name: "event without a start",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"UID:g",
+				"END:VEVENT",
+			),
+			wantErr: true,
+		},
+		{
+			name: "invalid date",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"UID:h",
+				"DTSTART:2026",
+				"END:VEVENT",
+			),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !sameEvent(got[i], tt.want[i]) {
+					t.Errorf("event %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func sameEvent(a, b Event) bool {
+	return a.UID == b.UID && a.Start.Equal(b.Start) && a.End.Equal(b.End) && a.Summary == b.Summary &&
+		a.Description == b.Description && a.Updated.Equal(b.Updated)
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+	}{
+		{
+			name:  "plain",
+			event: Event{UID: "restriction-1@example.com", Start: date("2026-06-10"), End: date("2026-06-13"), Summary: "Reserved"},
+		},
+		{
+			name: "escaped",
+			event: Event{UID: "restriction-2@example.com", Start: date("2026-06-10"), End: date("2026-06-11"),
+				Summary: `Room 1: Smith, Jane; \ two`, Description: "Email: jane@example.com\nPhone: 555"},
+		},
+		{
+			name: "folded",
+			event: Event{UID: "restriction-3@example.com", Start: date("2026-06-10"), End: date("2026-06-11"),
+				Summary: strings.Repeat("Zoë Åström ", 20), Updated: time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Calendar{Name: "Room 1", Events: []Event{tt.event}}.Write(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := buf.String()
+			if !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+				t.Errorf("calendar doesn't end in END:VCALENDAR and CRLF")
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+				if len(line) > maxLineLength {
+					t.Errorf("line of %d octets: %q", len(line), line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line cuts a character in half: %q", line)
+				}
+			}
+
+			got, err := Parse(strings.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || !sameEvent(got[0], tt.event) {
+				t.Errorf("read back %+v, want %+v", got, tt.event)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar is returned for input that isn't an iCalendar file
+var ErrNotCalendar = errors.New("not an iCalendar file")
+
+// Parse reads the events of a calendar. Start and End are dates: a time of day is dropped, so an event
+// from the afternoon of one day to the morning of another covers the nights in between. An event
+// without an end lasts one night, and cancelled events are left out.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, ErrNotCalendar
+	}
+
+	var events []Event
+	var event *Event
+	var cancelled bool
+
+	for n, line := range lines {
+		name, value := split(line)
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = &Event{}
+			cancelled = false
+
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN:VEVENT", n+1)
+			}
+			if event.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", n+1, event.UID)
+			}
+			if event.End.IsZero() || !event.End.After(event.Start) {
+				event.End = event.Start.AddDate(0, 0, 1)
+			}
+			if !cancelled {
+				events = append(events, *event)
+			}
+			event = nil
+
+		case event == nil:
+			// calendar properties and other components aren't needed
+
+		case name == "UID":
+			event.UID = value
+
+		case name == "SUMMARY":
+			event.Summary = unescape(value)
+
+		case name == "DESCRIPTION":
+			event.Description = unescape(value)
+
+		case name == "STATUS":
+			cancelled = strings.EqualFold(value, "CANCELLED")
+
+		case name == "DTSTART", name == "DTEND":
+			date, err := parseDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %v", n+1, name, err)
+			}
+			if name == "DTSTART" {
+				event.Start = date
+			} else {
+				event.End = date
+			}
+
+		case name == "LAST-MODIFIED":
+			if t, err := time.Parse(stampLayout, value); err == nil {
+				event.Updated = t
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// unfold reads the content lines, joining the lines folded onto the next
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// split splits a content line into its upper-cased name, without parameters, and its value
+func split(line string) (string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), ""
+	}
+
+	name, value := line[:colon], line[colon+1:]
+	if semi := strings.Index(name, ";"); semi >= 0 {
+		name = name[:semi]
+	}
+
+	return strings.ToUpper(name), value
+}
+
+// parseDate returns the date of a DATE or DATE-TIME value. A time of day is dropped, as written
+// in whatever time zone the feed uses, since bookings are by the night.
+func parseDate(value string) (time.Time, error) {
+	if len(value) < len(dateLayout) {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+
+	return time.Parse(dateLayout, value[:len(dateLayout)])
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(
+		`\\`, `\`,
+		`\;`, `;`,
+		`\,`, `,`,
+		`\n`, "\n",
+		`\N`, "\n",
+	).Replace(s)
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -18,6 +22,9 @@ type User struct {
 type Room struct {
 	ID 			int
 	RoomName 	string
+	Price 		int
+	PolicyID 	int
+	MaxGuests 	int
 	CreatedAt 	time.Time
 	UpdatedAt 	time.Time
 }
@@ -38,10 +45,188 @@ type Reservation struct {
 	StartDate 	time.Time
 	EndDate 	time.Time
 	RoomID 		int
-	Processed 	int
+	Status 		string
+	PromotionID int
+	PromoCode 	string
+	Guests 		int
+	Subtotal 	int
+	Discount 	int
+	ExtrasTotal int
+	TaxTotal 	int
+	Total 		int
 	CreatedAt 	time.Time
 	UpdatedAt 	time.Time
 	Room 		Room
+	Extras 		[]ReservationExtra
+	Taxes 		[]ReservationTax
+	Policy 		CancellationPolicy
+	RoomKey 	string
+	IDDocument 	string
+	GroupID 	int
+	PaymentDueBy time.Time
+	ManageLinkVersion int
+}
+
+// BookingGroup holds the reservations of several rooms booked together under one lead guest
+type BookingGroup struct {
+	ID 				int
+	FirstName 		string
+	LastName 		string
+	Email 			string
+	Phone 			string
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+	Reservations 	[]Reservation
+}
+
+// Total returns the price of all the group's rooms
+func (g BookingGroup) Total() int {
+	total := 0
+	for _, res := range g.Reservations {
+		total += res.Total
+	}
+	return total
+}
+
+// Deposit returns what is due at booking across all the group's rooms
+func (g BookingGroup) Deposit() int {
+	deposit := 0
+	for _, res := range g.Reservations {
+		deposit += res.Policy.Deposit(res.Total)
+	}
+	return deposit
+}
+
+// Arrival returns the earliest arrival of the group's rooms
+func (g BookingGroup) Arrival() time.Time {
+	var arrival time.Time
+	for _, res := range g.Reservations {
+		if arrival.IsZero() || res.StartDate.Before(arrival) {
+			arrival = res.StartDate
+		}
+	}
+	return arrival
+}
+
+// Departure returns the latest departure of the group's rooms
+func (g BookingGroup) Departure() time.Time {
+	var departure time.Time
+	for _, res := range g.Reservations {
+		if res.EndDate.After(departure) {
+			departure = res.EndDate
+		}
+	}
+	return departure
+}
+
+// SplitStay reports whether the group's rooms are booked for different dates,
+// as when a stay is split across rooms one after the other
+func (g BookingGroup) SplitStay() bool {
+	for _, res := range g.Reservations {
+		if !res.StartDate.Equal(g.Reservations[0].StartDate) || !res.EndDate.Equal(g.Reservations[0].EndDate) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reservation statuses
+const (
+	StatusPending = "pending"
+	StatusConfirmed = "confirmed"
+	StatusCheckedIn = "checked_in"
+	StatusCheckedOut = "checked_out"
+	StatusCancelled = "cancelled"
+	StatusNoShow = "no_show"
+)
+
+// reservationTransitions lists the statuses a reservation may move to from each status
+var reservationTransitions = map[string][]string{
+	StatusPending: {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn: {StatusCheckedOut},
+}
+
+// StatusLabel returns the display name of a reservation status
+func StatusLabel(status string) string {
+	switch status {
+	case StatusPending:
+		return "Pending"
+	case StatusConfirmed:
+		return "Confirmed"
+	case StatusCheckedIn:
+		return "Checked in"
+	case StatusCheckedOut:
+		return "Checked out"
+	case StatusCancelled:
+		return "Cancelled"
+	case StatusNoShow:
+		return "No-show"
+	}
+	return status
+}
+
+// CanTransitionTo reports whether the reservation may move to the given status
+func (r Reservation) CanTransitionTo(status string) bool {
+	for _, s := range reservationTransitions[r.Status] {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// NextStatuses returns the statuses the reservation may move to
+func (r Reservation) NextStatuses() []string {
+	return reservationTransitions[r.Status]
+}
+
+// StatusLabel returns the display name of the reservation's status
+func (r Reservation) StatusLabel() string {
+	return StatusLabel(r.Status)
+}
+
+// Active reports whether the reservation still holds its room
+func (r Reservation) Active() bool {
+	return r.Status != StatusCancelled && r.Status != StatusNoShow
+}
+
+// ReservationStatusChange records a move of a reservation from one status to another and who made it.
+// UserID is 0 when the change was made by the guest or by the system.
+type ReservationStatusChange struct {
+	ID 				int
+	ReservationID 	int
+	FromStatus 		string
+	ToStatus 		string
+	UserID 			int
+	Actor 			string
+	Note 			string
+	CreatedAt 		time.Time
+	// Refunded is what was refunded with a cancellation, for telling the guest. It isn't kept in the history.
+	Refunded 		int
+}
+
+// Status change actors other than staff users
+const (
+	ActorGuest = "guest"
+	ActorSystem = "system"
+	ActorStaff = "staff"
+)
+
+// RoomMove records a reservation being moved to another room from MoveDate to the end of the stay.
+// A MoveDate after the arrival splits the stay, leaving the earlier nights in the old room.
+type RoomMove struct {
+	ID 				int
+	ReservationID 	int
+	FromRoomID 		int
+	ToRoomID 		int
+	MoveDate 		time.Time
+	UserID 			int
+	Actor 			string
+	Reason 			string
+	CreatedAt 		time.Time
+	FromRoom 		Room
+	ToRoom 			Room
 }
 
 type RoomRestriction struct {
@@ -51,11 +236,410 @@ type RoomRestriction struct {
 	RoomID 			int
 	ReservationID 	int
 	RestrictionID 	int
+	BlockID 		int
+	ExpiresAt 		time.Time
 	CreatedAt 		time.Time
 	UpdatedAt 		time.Time
 	Room 			Room
 	Reservation 	Reservation
 	Restriction 	Restriction
+	Block 			Block
+}
+
+// Block is an owner block spanning one or more nights, optionally repeating
+type Block struct {
+	ID 				int
+	RoomID 			int
+	StartDate 		time.Time
+	EndDate 		time.Time
+	Reason 			string
+	Recurrence 		string
+	RepeatUntil 	time.Time
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+	Room 			Room
+}
+
+// Recurrence options for a block
+const (
+	RecurrenceNone = ""
+	RecurrenceWeekly = "weekly"
+)
+
+// MaxBlockOccurrences caps how many rows a single recurring block can expand to, ten years of weeks
+const MaxBlockOccurrences = 520
+
+// OccurrenceCount returns how many times the block occurs, without the cap on Occurrences
+func (b Block) OccurrenceCount() int {
+	if b.Recurrence != RecurrenceWeekly || b.RepeatUntil.Before(b.StartDate) {
+		return 1
+	}
+	return int(b.RepeatUntil.Sub(b.StartDate).Hours()/24)/7 + 1
+}
+
+// Occurrences expands the block into the room restrictions it occupies.
+// Blocks occurring more than MaxBlockOccurrences times are rejected before they get here.
+func (b Block) Occurrences() []RoomRestriction {
+	var occurrences []RoomRestriction
+
+	start := b.StartDate
+	end := b.EndDate
+
+	for i := 0; i < MaxBlockOccurrences; i++ {
+		occurrences = append(occurrences, RoomRestriction{
+			StartDate: 		start,
+			EndDate: 		end,
+			RoomID: 		b.RoomID,
+			RestrictionID: 	2,
+			BlockID: 		b.ID,
+		})
+
+		if b.Recurrence != RecurrenceWeekly {
+			break
+		}
+
+		start = start.AddDate(0, 0, 7)
+		end = end.AddDate(0, 0, 7)
+		if start.After(b.RepeatUntil) {
+			break
+		}
+	}
+
+	return occurrences
+}
+
+// Discount types for a promotion
+const (
+	DiscountPercent = "percent"
+	DiscountFixed = "fixed"
+)
+
+// Promotion is a discount code guests can apply at checkout.
+// Amount is a percentage for percent discounts and cents for fixed ones.
+type Promotion struct {
+	ID 				int
+	Code 			string
+	Description 	string
+	DiscountType 	string
+	Amount 			int
+	ValidFrom 		time.Time
+	ValidTo 		time.Time
+	MinNights 		int
+	MaxUses 		int
+	TimesUsed 		int
+	Active 			bool
+	RoomIDs 		[]int
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+}
+
+// Pricing units for an extra
+const (
+	PerStay = "stay"
+	PerNight = "night"
+	PerGuest = "guest"
+)
+
+// Extra is an add-on from the catalogue, such as breakfast or parking
+type Extra struct {
+	ID 				int
+	Name 			string
+	Description 	string
+	Price 			int
+	PricingUnit 	string
+	Active 			bool
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+}
+
+// ReservationExtra is an extra booked on a reservation, priced at the time of booking
+type ReservationExtra struct {
+	ID 				int
+	ReservationID 	int
+	ExtraID 		int
+	Name 			string
+	PricingUnit 	string
+	Quantity 		int
+	UnitPrice 		int
+	Amount 			int
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+}
+
+// Bases a tax or fee rule can be charged on
+const (
+	TaxPerNight = "per_night"
+	TaxPerPersonNight = "per_person" // charged for every guest on every night
+	TaxPerStay = "per_stay"
+	TaxPercentage = "percentage"
+)
+
+// TaxRule is a configurable tax or fee. Amount is in cents, except for
+// percentage rules where it is in hundredths of a percent (750 is 7.5%).
+type TaxRule struct {
+	ID 			int
+	Name 		string
+	Kind 		string
+	Basis 		string
+	Amount 		int
+	Active 		bool
+	CreatedAt 	time.Time
+	UpdatedAt 	time.Time
+}
+
+// ReservationTax is a tax or fee charged on a reservation, kept as it was sold
+type ReservationTax struct {
+	ID 				int
+	ReservationID 	int
+	TaxRuleID 		int
+	Name 			string
+	Kind 			string
+	Basis 			string
+	Rate 			int
+	Quantity 		int
+	Amount 			int
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+}
+
+// Quote is the price breakdown of a stay. All amounts are in cents.
+type Quote struct {
+	Nights 		int
+	NightlyRate int
+	Subtotal 	int
+	Discount 	int
+	Extras 		[]ReservationExtra
+	ExtrasTotal int
+	Taxes 		[]ReservationTax
+	TaxTotal 	int
+	Total 		int
+}
+
+// Currency is a display currency. Rate is how many units of it buy one unit of the base currency.
+type Currency struct {
+	ID 			int
+	Code 		string
+	Symbol 		string
+	Decimals 	int
+	Rate 		float64
+	Active 		bool
+	CreatedAt 	time.Time
+	UpdatedAt 	time.Time
+}
+
+// CancellationPolicy is the cancellation and deposit terms of a rate. A copy is kept on every
+// reservation so later edits to the policy don't change what the guest agreed to.
+type CancellationPolicy struct {
+	ID 						int
+	Name 					string
+	FreeCancellationDays 	int
+	PenaltyPercent 			int
+	NonRefundable 			bool
+	DepositPercent 			int
+	BalanceDueDays 			int
+	CreatedAt 				time.Time
+	UpdatedAt 				time.Time
+}
+
+// DefaultPolicy applies to rooms without a policy: full prepayment, free cancellation until arrival
+var DefaultPolicy = CancellationPolicy{
+	Name: "Standard",
+	PenaltyPercent: 100,
+	DepositPercent: 100,
+}
+
+// Deposit returns the part of the total charged at booking
+func (p CancellationPolicy) Deposit(total int) int {
+	return total * p.DepositPercent / 100
+}
+
+// Balance returns the part of the total left to pay after the deposit
+func (p CancellationPolicy) Balance(total int) int {
+	return total - p.Deposit(total)
+}
+
+// BalanceDueDate returns when the rest of the total has to be paid
+func (p CancellationPolicy) BalanceDueDate(arrival time.Time) time.Time {
+	return arrival.AddDate(0, 0, -p.BalanceDueDays)
+}
+
+// CancellationFee returns how much of the total is kept when the guest cancels at the given time
+func (p CancellationPolicy) CancellationFee(total int, arrival, now time.Time) int {
+	if p.NonRefundable {
+		return total
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, arrival.Location())
+	daysBefore := int(arrival.Sub(today).Hours() / 24)
+	if daysBefore >= p.FreeCancellationDays && !today.After(arrival) {
+		return 0
+	}
+
+	return total * p.PenaltyPercent / 100
+}
+
+// Refundable returns how much of what the guest has paid goes back to them when cancelling at the given time
+func (p CancellationPolicy) Refundable(paid, total int, arrival, now time.Time) int {
+	refund := paid - p.CancellationFee(total, arrival, now)
+	if refund < 0 {
+		return 0
+	}
+	return refund
+}
+
+// Summary describes the policy in a sentence or two for guests
+func (p CancellationPolicy) Summary() string {
+	var cancel string
+	switch {
+	case p.NonRefundable:
+		cancel = "Non-refundable."
+	case p.PenaltyPercent == 0:
+		cancel = "Free cancellation at any time."
+	case p.FreeCancellationDays == 0:
+		cancel = fmt.Sprintf("Free cancellation until the day of arrival, then %d%% of the total is charged.", p.PenaltyPercent)
+	default:
+		cancel = fmt.Sprintf("Free cancellation until %d day(s) before arrival, then %d%% of the total is charged.", p.FreeCancellationDays, p.PenaltyPercent)
+	}
+
+	var deposit string
+	switch {
+	case p.DepositPercent >= 100:
+		deposit = "The full amount is charged at booking."
+	case p.DepositPercent == 0:
+		deposit = fmt.Sprintf("Nothing is charged at booking; the total is due %d day(s) before arrival.", p.BalanceDueDays)
+	default:
+		deposit = fmt.Sprintf("A %d%% deposit is charged at booking; the balance is due %d day(s) before arrival.", p.DepositPercent, p.BalanceDueDays)
+	}
+
+	return cancel + " " + deposit
+}
+
+// Payment statuses
+const (
+	PaymentPending = "pending"
+	PaymentAuthorized = "authorized"
+	PaymentCaptured = "captured"
+	PaymentRefunded = "refunded"
+	PaymentVoided = "voided"
+	PaymentFailed = "failed"
+)
+
+// paymentTransitions lists the statuses a payment may move to from each status
+var paymentTransitions = map[string][]string{
+	PaymentPending: {PaymentAuthorized, PaymentFailed},
+	PaymentAuthorized: {PaymentCaptured, PaymentVoided, PaymentFailed},
+	PaymentCaptured: {PaymentRefunded},
+}
+
+// Payment is money taken from the guest against a reservation. Amounts are in cents of the base currency.
+type Payment struct {
+	ID 				int
+	ReservationID 	int
+	Amount 			int
+	RefundedAmount 	int
+	Currency 		string
+	Status 			string
+	GatewayRef 		string
+	CardLast4 		string
+	Message 		string
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+}
+
+// CanTransitionTo reports whether the payment may move to the given status
+func (p Payment) CanTransitionTo(status string) bool {
+	for _, s := range paymentTransitions[p.Status] {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Refundable returns how much of the payment can still be refunded
+func (p Payment) Refundable() int {
+	if p.Status != PaymentCaptured {
+		return 0
+	}
+	return p.Amount - p.RefundedAmount
+}
+
+// FolioLine is a single charge or payment on a guest's folio. Payments and refunds are credits.
+type FolioLine struct {
+	Date 			time.Time
+	Description 	string
+	Quantity 		int
+	Amount 			int
+	Credit 			bool
+}
+
+// Signed returns the line amount as it affects the balance: credits count against it
+func (l FolioLine) Signed() int {
+	if l.Credit {
+		return -l.Amount
+	}
+	return l.Amount
+}
+
+// Folio is the running account of a reservation
+type Folio struct {
+	Lines 		[]FolioLine
+	Charges 	int
+	Paid 		int
+	Balance 	int
+}
+
+// Invoice is a numbered invoice issued for a reservation's folio. Folio is kept as it was when the
+// invoice was issued, so later changes to the reservation or its payments don't rewrite it.
+type Invoice struct {
+	ID 				int
+	ReservationID 	int
+	Number 			int
+	IssuedAt 		time.Time
+	Folio 			Folio
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+}
+
+// Label returns the invoice number as printed on the invoice
+func (i Invoice) Label() string {
+	return fmt.Sprintf("INV-%06d", i.Number)
+}
+
+// WaitlistEntry is a guest waiting for a room to come free for their dates.
+// When one does they are sent an offer that is good until ExpiresAt, and ReservationID
+// is the booking they made with it.
+type WaitlistEntry struct {
+	ID 			int
+	FirstName 	string
+	LastName 	string
+	Email 		string
+	StartDate 	time.Time
+	EndDate 	time.Time
+	Guests 		int
+	Status 		string
+	NotifiedAt 	time.Time
+	ExpiresAt 	time.Time
+	ReservationID 	int
+	CreatedAt 	time.Time
+	UpdatedAt 	time.Time
+}
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered"
+	WaitlistAccepted = "accepted"
+	WaitlistExpired = "expired"
+	WaitlistBooked = "booked"
+	WaitlistLeft = "left"
+)
+
+// FreedInventory tells the waitlist that rooms may have come free between StartDate and EndDate.
+// Zero dates mean the freed nights aren't known and every waiting guest should be checked.
+type FreedInventory struct {
+	StartDate 	time.Time
+	EndDate 	time.Time
 }
 
 type MailData struct {
@@ -63,4 +647,389 @@ type MailData struct {
 	From 		string
 	Subject 	string
 	Content 	string
-}
\ No newline at end of file
+	// Sent, when set, is told whether the message was delivered
+	Sent 		chan<- error
+}
+
+// Kinds of alternative stay
+const (
+	AlternativeRoom = "room"
+	AlternativeShifted = "shifted"
+	AlternativeSplit = "split"
+)
+
+// Alternative is a stay suggested when the room or rooms searched aren't free for all of the dates:
+// other rooms free for the same dates, the same number of nights moved a few days, with the rooms free then,
+// or the searched dates split across two rooms one after the other
+type Alternative struct {
+	Kind 		string
+	StartDate 	time.Time
+	EndDate 	time.Time
+	ShiftDays 	int
+	Rooms 		[]Room
+	Legs 		[]AlternativeLeg
+}
+
+// AlternativeLeg is the part of a split stay spent in one room
+type AlternativeLeg struct {
+	Room 		Room
+	StartDate 	time.Time
+	EndDate 	time.Time
+}
+
+// CalendarFeed is an iCalendar feed of the reservations and blocks of a room, or of every room when
+// RoomID is 0. Its link is made from Token, so changing the token revokes the link given out before.
+type CalendarFeed struct {
+	ID 			int
+	RoomID 		int
+	Private 	bool
+	Token 		string
+	CreatedAt 	time.Time
+	UpdatedAt 	time.Time
+}
+
+// CalendarSource is an external booking platform's iCalendar feed for one of our rooms.
+// Its events are imported as external bookings that keep the room from being booked here.
+type CalendarSource struct {
+	ID 				int
+	RoomID 			int
+	Name 			string
+	URL 			string
+	LastSyncedAt 	time.Time
+	LastStatus 		string
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+	Room 			Room
+}
+
+// ExternalBooking is a booking read from a calendar source, identified within it by UID
+type ExternalBooking struct {
+	UID 		string
+	StartDate 	time.Time
+	EndDate 	time.Time
+}
+
+// Calendar and channel sync outcomes
+const (
+	SyncOK = "ok"
+	SyncFailed = "failed"
+)
+
+// CalendarSyncLog records one import from a calendar source. Conflicts counts the external bookings
+// that overlap one of our reservations, which staff have to sort out.
+type CalendarSyncLog struct {
+	ID 			int
+	SourceID 	int
+	Status 		string
+	Created 	int
+	Updated 	int
+	Removed 	int
+	Conflicts 	int
+	Message 	string
+	CreatedAt 	time.Time
+	Source 		CalendarSource
+}
+
+// Channel is an online travel agency the rooms are sold through. Rooms is the mapping of our rooms
+// to the codes the channel knows them by, and only mapped rooms are sold there.
+type Channel struct {
+	ID 				int
+	Name 			string
+	URL 			string
+	APIKey 			string
+	Active 			bool
+	PulledUntil 	time.Time
+	LastSyncedAt 	time.Time
+	LastStatus 		string
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+	Rooms 			[]ChannelRoom
+}
+
+// RoomCode returns the code the channel knows the room by, or "" if the room isn't sold there
+func (c Channel) RoomCode(roomID int) string {
+	for _, cr := range c.Rooms {
+		if cr.RoomID == roomID {
+			return cr.RoomCode
+		}
+	}
+	return ""
+}
+
+// ChannelRoom maps one of our rooms to a channel's room code
+type ChannelRoom struct {
+	ID 			int
+	ChannelID 	int
+	RoomID 		int
+	RoomCode 	string
+}
+
+// Channel reservation statuses
+const (
+	ChannelBooked = "booked"
+	ChannelCancelled = "cancelled"
+	ChannelConflict = "conflict"
+	ChannelResolved = "resolved"
+)
+
+// Changes made importing a channel booking, besides it being cancelled or in conflict
+const (
+	ChannelAdded = "added"
+	ChannelMoved = "moved"
+)
+
+// ChannelReservation is a booking pulled from a channel, identified within it by Reference.
+// A booking for a room that was no longer free is kept as a conflict, without a reservation,
+// until staff resolve it with the guest.
+type ChannelReservation struct {
+	ID 				int
+	ChannelID 		int
+	Reference 		string
+	ReservationID 	int
+	RoomID 			int
+	StartDate 		time.Time
+	EndDate 		time.Time
+	GuestName 		string
+	Status 			string
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+	Channel 		Channel
+	Room 			Room
+}
+
+// ChannelSyncLog records one sync with a channel: the bookings pulled from it, cancelled on it
+// and in conflict with ours, and the nights of availability pushed to it. Attempts counts the
+// calls made to the channel, including retries.
+type ChannelSyncLog struct {
+	ID 			int
+	ChannelID 	int
+	Status 		string
+	Pulled 		int
+	Cancelled 	int
+	Conflicts 	int
+	Pushed 		int
+	Attempts 	int
+	Message 	string
+	CreatedAt 	time.Time
+	Channel 	Channel
+}
+
+// Webhook is an endpoint told about reservation events. Events lists the events it is sent,
+// every event when empty, and Secret signs what is sent so the endpoint can tell it came from us.
+type Webhook struct {
+	ID 			int
+	Name 		string
+	URL 		string
+	Secret 		string
+	Events 		[]string
+	Active 		bool
+	CreatedAt 	time.Time
+	UpdatedAt 	time.Time
+}
+
+// Subscribed reports whether the webhook is sent the event
+func (w Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed = "failed"
+)
+
+// WebhookDelivery is one event sent to one webhook. A pending delivery is due again at NextAttemptAt,
+// and one that keeps failing is given up on as failed.
+type WebhookDelivery struct {
+	ID 				int
+	WebhookID 		int
+	Event 			string
+	Payload 		string
+	Status 			string
+	Attempts 		int
+	ResponseCode 	int
+	LastError 		string
+	NextAttemptAt 	time.Time
+	DeliveredAt 	time.Time
+	ClaimedUntil 	time.Time
+	CreatedAt 		time.Time
+	Webhook 		Webhook
+}
+
+// IdempotencyKey identifies a request that is safe to repeat. Key is the client's, unique only within
+// Scope, the client's session, and RequestHash tells a repeat of the request from another one reusing the key.
+type IdempotencyKey struct {
+	Scope 			string
+	Key 			string
+	RequestHash 	string
+}
+
+// OutboxEvent is an event saved with the change it describes, waiting to be published.
+// Delivered names the subscribers that have already handled it, so a retry leaves them out.
+type OutboxEvent struct {
+	ID 				int
+	Event 			string
+	Payload 		string
+	Attempts 		int
+	LastError 		string
+	NextAttemptAt 	time.Time
+	PublishedAt 	time.Time
+	CreatedAt 		time.Time
+	Delivered 		[]string
+}
+
+// Audited entities
+const (
+	AuditReservation = "reservation"
+	AuditGroup = "group"
+	AuditBlock = "block"
+	AuditRestriction = "restriction"
+	AuditUser = "user"
+	AuditRoom = "room"
+	AuditPromotion = "promotion"
+	AuditTaxRule = "tax_rule"
+	AuditPolicy = "policy"
+	AuditExtra = "extra"
+	AuditCurrency = "currency"
+	AuditWebhook = "webhook"
+	AuditChannel = "channel"
+	AuditCalendarSource = "calendar_source"
+)
+
+// Audited actions
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	AuditStatus = "status"
+	AuditDates = "dates"
+	AuditMove = "move"
+	AuditPayment = "payment"
+	AuditRevokeLinks = "revoke_links"
+	AuditLogin = "login"
+)
+
+// AuditEntry records a change made by a staff user. Before and After are JSON objects of the fields
+// involved, either of which is empty when there was nothing before or nothing is left after.
+// UserName is kept as it was at the time, so entries outlive the users who made them.
+type AuditEntry struct {
+	ID 			int
+	UserID 		int
+	UserName 	string
+	IPAddress 	string
+	Action 		string
+	Entity 		string
+	EntityID 	int
+	Before 		string
+	After 		string
+	CreatedAt 	time.Time
+}
+
+// AuditChange is one field changed by an audited action
+type AuditChange struct {
+	Field 	string
+	Before 	string
+	After 	string
+}
+
+// Changes returns the fields that differ between Before and After, in order of name
+func (e AuditEntry) Changes() []AuditChange {
+	before := auditFields(e.Before)
+	after := auditFields(e.After)
+
+	fields := make(map[string]bool)
+	for f := range before {
+		fields[f] = true
+	}
+	for f := range after {
+		fields[f] = true
+	}
+
+	var changes []AuditChange
+	for f := range fields {
+		b, a := auditValue(before[f]), auditValue(after[f])
+		if b != a {
+			changes = append(changes, AuditChange{Field: f, Before: b, After: a})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes
+}
+
+// Link returns the admin page of the audited entity, or "" if it has none
+func (e AuditEntry) Link() string {
+	if e.EntityID == 0 {
+		return ""
+	}
+
+	switch e.Entity {
+	case AuditReservation:
+		return fmt.Sprintf("/admin/reservations/all/%d", e.EntityID)
+	case AuditGroup:
+		return fmt.Sprintf("/admin/groups/%d", e.EntityID)
+	case AuditBlock:
+		return fmt.Sprintf("/admin/blocks/%d", e.EntityID)
+	case AuditRoom:
+		return "/admin/rooms"
+	case AuditPromotion:
+		return fmt.Sprintf("/admin/promotions/%d", e.EntityID)
+	case AuditTaxRule:
+		return fmt.Sprintf("/admin/taxes/%d", e.EntityID)
+	case AuditPolicy:
+		return fmt.Sprintf("/admin/policies/%d", e.EntityID)
+	case AuditExtra:
+		return fmt.Sprintf("/admin/extras/%d", e.EntityID)
+	case AuditCurrency:
+		return "/admin/currencies"
+	case AuditWebhook:
+		return fmt.Sprintf("/admin/webhooks/%d", e.EntityID)
+	case AuditChannel:
+		return fmt.Sprintf("/admin/channels/%d", e.EntityID)
+	case AuditCalendarSource:
+		return "/admin/calendar-sync"
+	}
+
+	return ""
+}
+
+// auditFields decodes a JSON object, keeping numbers as they were written
+func auditFields(s string) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if s == "" {
+		return fields
+	}
+
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	_ = d.Decode(&fields)
+
+	return fields
+}
+
+func auditValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// AuditFilter narrows the audit log down. Zero fields match everything.
+type AuditFilter struct {
+	UserID 		int
+	Action 		string
+	Entity 		string
+	EntityID 	int
+	From 		time.Time
+	To 			time.Time
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCancellationPolicyDeposit(t *testing.T) {
+	tests := []struct {
+		name    string
+		percent int
+		total   int
+		deposit int
+		balance int
+	}{
+		{"nothing up front", 0, 10000, 0, 10000},
+		{"part deposit", 30, 10000, 3000, 7000},
+		{"rounds down to the cent", 30, 10001, 3000, 7001},
+		{"full prepayment", 100, 12345, 12345, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := CancellationPolicy{DepositPercent: tt.percent}
+			if got := p.Deposit(tt.total); got != tt.deposit {
+				t.Errorf("Deposit: got %d, want %d", got, tt.deposit)
+			}
+			if got := p.Balance(tt.total); got != tt.balance {
+				t.Errorf("Balance: got %d, want %d", got, tt.balance)
+			}
+		})
+	}
+}
+
+func TestCancellationPolicyRefundable(t *testing.T) {
+	arrival := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	flexible := CancellationPolicy{FreeCancellationDays: 3, PenaltyPercent: 50}
+
+	tests := []struct {
+		name   string
+		policy CancellationPolicy
+		now    time.Time
+		paid   int
+		fee    int
+		refund int
+	}{
+		{"well before the deadline", flexible, time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC), 3000, 0, 3000},
+		{"on the last free day", flexible, time.Date(2026, 6, 7, 23, 0, 0, 0, time.UTC), 3000, 0, 3000},
+		{"inside the penalty window", flexible, time.Date(2026, 6, 8, 9, 0, 0, 0, time.UTC), 8000, 5000, 3000},
+		{"penalty larger than what was paid", flexible, time.Date(2026, 6, 9, 9, 0, 0, 0, time.UTC), 3000, 5000, 0},
+		{"after arrival", flexible, time.Date(2026, 6, 11, 9, 0, 0, 0, time.UTC), 10000, 5000, 5000},
+		{"free until arrival, on arrival day", CancellationPolicy{PenaltyPercent: 100}, time.Date(2026, 6, 10, 15, 0, 0, 0, time.UTC), 10000, 0, 10000},
+		{"free until arrival, the day after", CancellationPolicy{PenaltyPercent: 100}, time.Date(2026, 6, 11, 9, 0, 0, 0, time.UTC), 10000, 10000, 0},
+		{"non-refundable", CancellationPolicy{NonRefundable: true, FreeCancellationDays: 30}, time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC), 10000, 10000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.CancellationFee(10000, arrival, tt.now); got != tt.fee {
+				t.Errorf("CancellationFee: got %d, want %d", got, tt.fee)
+			}
+			if got := tt.policy.Refundable(tt.paid, 10000, arrival, tt.now); got != tt.refund {
+				t.Errorf("Refundable: got %d, want %d", got, tt.refund)
+			}
+		})
+	}
+}
+
+func TestCancellationPolicyBalanceDueDate(t *testing.T) {
+	p := CancellationPolicy{BalanceDueDays: 14}
+	arrival := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	want := time.Date(2026, 2, 24, 0, 0, 0, 0, time.UTC)
+	if got := p.BalanceDueDate(arrival); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestAuditEntryChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   []AuditChange
+	}{
+		{"nothing changed", `{"email":"a@example.com"}`, `{"email":"a@example.com"}`, nil},
+		{"one field changed", `{"email":"a@example.com","phone":"1"}`, `{"email":"b@example.com","phone":"1"}`,
+			[]AuditChange{{Field: "email", Before: "a@example.com", After: "b@example.com"}}},
+		{"sorted by field", `{"status":"pending","room_id":1}`, `{"status":"confirmed","room_id":2}`,
+			[]AuditChange{{Field: "room_id", Before: "1", After: "2"}, {Field: "status", Before: "pending", After: "confirmed"}}},
+		{"created", "", `{"reason":"repairs"}`, []AuditChange{{Field: "reason", After: "repairs"}}},
+		{"deleted", `{"reason":"repairs"}`, "", []AuditChange{{Field: "reason", Before: "repairs"}}},
+		{"field added", `{}`, `{"reason":"repairs"}`, []AuditChange{{Field: "reason", After: "repairs"}}},
+		{"numbers kept as written", `{"rate":1.10}`, `{"rate":1.25}`, []AuditChange{{Field: "rate", Before: "1.10", After: "1.25"}}},
+		{"large ids aren't rounded", `{"id":12345678901234567}`, `{"id":12345678901234568}`,
+			[]AuditChange{{Field: "id", Before: "12345678901234567", After: "12345678901234568"}}},
+		{"booleans", `{"active":true}`, `{"active":false}`, []AuditChange{{Field: "active", Before: "true", After: "false"}}},
+		{"lists", `{"room_ids":[1,2]}`, `{"room_ids":[1,3]}`, []AuditChange{{Field: "room_ids", Before: "[1 2]", After: "[1 3]"}}},
+		{"not JSON", "oops", `{"reason":"repairs"}`, []AuditChange{{Field: "reason", After: "repairs"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := AuditEntry{Before: tt.before, After: tt.after}
+			if got := e.Changes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditEntryLink(t *testing.T) {
+	tests := []struct {
+		entity string
+		id     int
+		want   string
+	}{
+		{AuditReservation, 7, "/admin/reservations/all/7"},
+		{AuditGroup, 7, "/admin/groups/7"},
+		{AuditBlock, 7, "/admin/blocks/7"},
+		{AuditPromotion, 7, "/admin/promotions/7"},
+		{AuditTaxRule, 7, "/admin/taxes/7"},
+		{AuditWebhook, 7, "/admin/webhooks/7"},
+		{AuditRoom, 7, "/admin/rooms"},
+		{AuditRestriction, 7, ""},
+		{AuditUser, 7, ""},
+		{AuditReservation, 0, ""},
+	}
+
+	for _, tt := range tests {
+		e := AuditEntry{Entity: tt.entity, EntityID: tt.id}
+		if got := e.Link(); got != tt.want {
+			t.Errorf("Link of %s %d = %q, want %q", tt.entity, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{PaymentPending, PaymentAuthorized, true},
+		{PaymentPending, PaymentFailed, true},
+		{PaymentPending, PaymentCaptured, false},
+		{PaymentAuthorized, PaymentCaptured, true},
+		{PaymentAuthorized, PaymentVoided, true},
+		{PaymentAuthorized, PaymentRefunded, false},
+		{PaymentCaptured, PaymentRefunded, true},
+		{PaymentCaptured, PaymentVoided, false},
+		{PaymentVoided, PaymentCaptured, false},
+		{PaymentFailed, PaymentAuthorized, false},
+	}
+
+	for _, tt := range tests {
+		p := Payment{Status: tt.from}
+		if got := p.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%s to %s: got %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestReservationCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{StatusPending, StatusConfirmed, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusPending, StatusCheckedIn, false},
+		{StatusConfirmed, StatusCheckedIn, true},
+		{StatusConfirmed, StatusNoShow, true},
+		{StatusConfirmed, StatusCheckedOut, false},
+		{StatusCheckedIn, StatusCheckedOut, true},
+		{StatusCheckedIn, StatusCancelled, false},
+		{StatusCancelled, StatusConfirmed, false},
+		{StatusCancelled, StatusCheckedIn, false},
+		{StatusNoShow, StatusCheckedIn, false},
+		{StatusCheckedOut, StatusCheckedIn, false},
+	}
+
+	for _, tt := range tests {
+		r := Reservation{Status: tt.from}
+		if got := r.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%s to %s: got %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -14,4 +14,7 @@ type TemplateData struct {
 	Error 		string
 	Form 		*forms.Form
 	IsAuthenticated int
+	Currency 	Currency
+	Currencies 	[]Currency
+	BaseCurrency string
 }
\ No newline at end of file
@@ -0,0 +1,113 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Test card numbers understood by the fake gateway. Any other number is approved.
+const (
+	FakeCardDeclined    = "4000000000000002"
+	FakeCardUnavailable = "4000000000000119"
+)
+
+type fakeAuthorization struct {
+	amount   int
+	captured int
+	refunded int
+	voided   bool
+}
+
+// FakeGateway is a deterministic in-memory gateway for development and tests
+type FakeGateway struct {
+	mu             sync.Mutex
+	next           int
+	authorizations map[string]*fakeAuthorization
+}
+
+// NewFakeGateway creates a fake gateway with no payments
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		authorizations: make(map[string]*fakeAuthorization),
+	}
+}
+
+func (g *FakeGateway) Authorize(amount int, currency string, card Card) (Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	number := strings.ReplaceAll(card.Number, " ", "")
+
+	switch {
+	case amount <= 0:
+		return Result{}, errors.New("amount must be positive")
+	case number == FakeCardDeclined:
+		return Result{Message: "Your card was declined"}, ErrDeclined
+	case number == FakeCardUnavailable:
+		return Result{}, errors.New("payment processor unavailable")
+	}
+
+	g.next++
+	ref := fmt.Sprintf("fake_auth_%06d", g.next)
+	g.authorizations[ref] = &fakeAuthorization{amount: amount}
+
+	return Result{Reference: ref, Message: fmt.Sprintf("Authorized %d %s", amount, currency)}, nil
+}
+
+func (g *FakeGateway) Capture(reference string, amount int) (Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.authorizations[reference]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown authorization %s", reference)
+	}
+
+	if a.voided {
+		return Result{}, errors.New("authorization has been voided")
+	}
+
+	if a.captured+amount > a.amount {
+		return Result{}, errors.New("capture exceeds the authorized amount")
+	}
+
+	a.captured += amount
+	return Result{Reference: reference, Message: fmt.Sprintf("Captured %d", amount)}, nil
+}
+
+func (g *FakeGateway) Refund(reference string, amount int) (Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.authorizations[reference]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown authorization %s", reference)
+	}
+
+	if a.refunded+amount > a.captured {
+		return Result{}, errors.New("refund exceeds the captured amount")
+	}
+
+	a.refunded += amount
+	g.next++
+	return Result{Reference: fmt.Sprintf("fake_refund_%06d", g.next), Message: fmt.Sprintf("Refunded %d", amount)}, nil
+}
+
+func (g *FakeGateway) Void(reference string) (Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.authorizations[reference]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown authorization %s", reference)
+	}
+
+	if a.captured > 0 {
+		return Result{}, errors.New("a captured payment must be refunded, not voided")
+	}
+
+	a.voided = true
+	return Result{Reference: reference, Message: "Voided"}, nil
+}
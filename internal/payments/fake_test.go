@@ -0,0 +1,86 @@
+package payments
+
+import "testing"
+
+func TestFakeGatewayAuthorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int
+		number  string
+		wantErr bool
+	}{
+		{"approved", 5000, "4242 4242 4242 4242", false},
+		{"declined", 5000, FakeCardDeclined, true},
+		{"processor unavailable", 5000, FakeCardUnavailable, true},
+		{"nothing to charge", 0, "4242424242424242", true},
+	}
+
+	for _, tt := range tests {
+		g := NewFakeGateway()
+
+		result, err := g.Authorize(tt.amount, "USD", Card{Number: tt.number})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if !tt.wantErr && result.Reference == "" {
+			t.Errorf("%s: no reference for the authorization", tt.name)
+		}
+	}
+
+	_, err := NewFakeGateway().Authorize(5000, "USD", Card{Number: FakeCardDeclined})
+	if err != ErrDeclined {
+		t.Errorf("declined card: got error %v, want ErrDeclined", err)
+	}
+}
+
+// TestFakeGatewayLifecycle runs an authorization through the operations the gateway allows on it, in order
+func TestFakeGatewayLifecycle(t *testing.T) {
+	g := NewFakeGateway()
+
+	auth, err := g.Authorize(5000, "USD", Card{Number: "4242424242424242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := auth.Reference
+
+	steps := []struct {
+		name    string
+		op      func() (Result, error)
+		wantErr bool
+	}{
+		{"capture more than authorized", func() (Result, error) { return g.Capture(ref, 6000) }, true},
+		{"refund before capturing", func() (Result, error) { return g.Refund(ref, 1000) }, true},
+		{"capture part", func() (Result, error) { return g.Capture(ref, 3000) }, false},
+		{"capture the rest", func() (Result, error) { return g.Capture(ref, 2000) }, false},
+		{"void once captured", func() (Result, error) { return g.Void(ref) }, true},
+		{"refund part", func() (Result, error) { return g.Refund(ref, 4000) }, false},
+		{"refund more than is left", func() (Result, error) { return g.Refund(ref, 2000) }, true},
+		{"capture an unknown authorization", func() (Result, error) { return g.Capture("fake_auth_999999", 100) }, true},
+	}
+
+	for _, s := range steps {
+		_, err := s.op()
+		if (err != nil) != s.wantErr {
+			t.Errorf("%s: got error %v, want error %v", s.name, err, s.wantErr)
+		}
+	}
+}
+
+func TestFakeGatewayVoid(t *testing.T) {
+	g := NewFakeGateway()
+
+	auth, err := g.Authorize(5000, "USD", Card{Number: "4242424242424242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = g.Void(auth.Reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = g.Capture(auth.Reference, 5000)
+	if err == nil {
+		t.Error("captured a voided authorization")
+	}
+}
@@ -0,0 +1,44 @@
+package payments
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeclined is returned when the card issuer refuses a payment
+var ErrDeclined = errors.New("card declined")
+
+// Timeout is the longest a gateway takes to answer. A payment still waiting on its answer after this
+// never got one.
+const Timeout = 2 * time.Minute
+
+// Gateway is a payment provider. Amounts are in cents.
+type Gateway interface {
+	Authorize(amount int, currency string, card Card) (Result, error)
+	Capture(reference string, amount int) (Result, error)
+	Refund(reference string, amount int) (Result, error)
+	Void(reference string) (Result, error)
+}
+
+// Card holds the card details entered by the guest. It is never stored.
+type Card struct {
+	Name     string
+	Number   string
+	ExpMonth int
+	ExpYear  int
+	CVC      string
+}
+
+// Last4 returns the last four digits of the card number
+func (c Card) Last4() string {
+	if len(c.Number) < 4 {
+		return c.Number
+	}
+	return c.Number[len(c.Number)-4:]
+}
+
+// Result is the outcome of a gateway operation
+type Result struct {
+	Reference string
+	Message   string
+}
@@ -0,0 +1,188 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// Stay describes what is being priced
+type Stay struct {
+	Room      models.Room
+	StartDate time.Time
+	EndDate   time.Time
+	Guests    int
+	Promotion *models.Promotion
+	Extras    []models.Extra
+	TaxRules  []models.TaxRule
+}
+
+// Nights returns the number of nights between two dates
+func Nights(start, end time.Time) int {
+	return int(end.Sub(start).Hours()+12) / 24
+}
+
+// NewQuote prices a stay. The promotion, if any, is expected to have been checked with CheckPromotion.
+func NewQuote(s Stay) models.Quote {
+	q := models.Quote{
+		Nights:      Nights(s.StartDate, s.EndDate),
+		NightlyRate: s.Room.Price,
+	}
+	q.Subtotal = q.Nights * q.NightlyRate
+
+	if s.Promotion != nil {
+		q.Discount = discount(*s.Promotion, q.Subtotal)
+	}
+
+	for _, e := range s.Extras {
+		line := extraLine(e, q.Nights, s.Guests)
+		q.Extras = append(q.Extras, line)
+		q.ExtrasTotal += line.Amount
+	}
+
+	q.Taxes = taxLines(s.TaxRules, q.Subtotal-q.Discount+q.ExtrasTotal, q.Nights, s.Guests)
+	for _, t := range q.Taxes {
+		q.TaxTotal += t.Amount
+	}
+
+	q.Total = q.Subtotal - q.Discount + q.ExtrasTotal + q.TaxTotal
+
+	return q
+}
+
+// taxLines evaluates the tax and fee rules. Percentage rules apply to base, the stay
+// after discounts plus extras, and never to other taxes or fees, so nothing compounds.
+func taxLines(rules []models.TaxRule, base, nights, guests int) []models.ReservationTax {
+	var lines []models.ReservationTax
+
+	for _, rule := range rules {
+		switch rule.Basis {
+		case models.TaxPercentage:
+			lines = append(lines, taxLine(rule, 1, (base*rule.Amount+5000)/10000))
+		case models.TaxPerNight:
+			lines = append(lines, taxLine(rule, nights, nights*rule.Amount))
+		case models.TaxPerPersonNight:
+			lines = append(lines, taxLine(rule, nights*guests, nights*guests*rule.Amount))
+		default:
+			lines = append(lines, taxLine(rule, 1, rule.Amount))
+		}
+	}
+
+	return lines
+}
+
+func taxLine(rule models.TaxRule, quantity, amount int) models.ReservationTax {
+	return models.ReservationTax{
+		TaxRuleID: rule.ID,
+		Name:      rule.Name,
+		Kind:      rule.Kind,
+		Basis:     rule.Basis,
+		Rate:      rule.Amount,
+		Quantity:  quantity,
+		Amount:    amount,
+	}
+}
+
+func extraLine(e models.Extra, nights, guests int) models.ReservationExtra {
+	quantity := 1
+
+	switch e.PricingUnit {
+	case models.PerNight:
+		quantity = nights
+	case models.PerGuest:
+		quantity = guests
+	}
+
+	return models.ReservationExtra{
+		ExtraID:     e.ID,
+		Name:        e.Name,
+		PricingUnit: e.PricingUnit,
+		Quantity:    quantity,
+		UnitPrice:   e.Price,
+		Amount:      quantity * e.Price,
+	}
+}
+
+func discount(p models.Promotion, subtotal int) int {
+	var d int
+
+	switch p.DiscountType {
+	case models.DiscountPercent:
+		d = (subtotal*p.Amount + 50) / 100
+	case models.DiscountFixed:
+		d = p.Amount
+	}
+
+	if d > subtotal {
+		d = subtotal
+	}
+	return d
+}
+
+// CheckPromotion returns an error describing why the promotion cannot be applied to the stay, or nil if it can
+func CheckPromotion(p models.Promotion, s Stay) error {
+	if !p.Active {
+		return errors.New("This promo code is not active")
+	}
+
+	// every night of the stay has to fall inside the promotion's validity
+	lastNight := s.EndDate.AddDate(0, 0, -1)
+	if s.StartDate.Before(p.ValidFrom) || lastNight.After(p.ValidTo) {
+		return errors.New("This promo code is not valid for your dates")
+	}
+
+	if p.MaxUses > 0 && p.TimesUsed >= p.MaxUses {
+		return errors.New("This promo code has been fully redeemed")
+	}
+
+	if Nights(s.StartDate, s.EndDate) < p.MinNights {
+		return errors.New("Your stay is too short for this promo code")
+	}
+
+	if len(p.RoomIDs) > 0 {
+		for _, id := range p.RoomIDs {
+			if id == s.Room.ID {
+				return nil
+			}
+		}
+		return errors.New("This promo code is not valid for the selected room")
+	}
+
+	return nil
+}
+
+// MaxAmount is the largest amount ParseAmount accepts, in whole units: far above any price or fee,
+// and small enough that its cents fit in an int everywhere
+const MaxAmount = 10000000
+
+// ParseAmount parses a decimal amount such as "120" or "120.50" into cents
+func ParseAmount(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("amount is empty")
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errors.New("amount must be a number")
+	}
+
+	if f < 0 {
+		return 0, errors.New("amount must not be negative")
+	}
+
+	if f > MaxAmount {
+		return 0, fmt.Errorf("amount must not be more than %d", MaxAmount)
+	}
+
+	return int(math.Round(f * 100)), nil
+}
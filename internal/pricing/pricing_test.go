@@ -0,0 +1,221 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestCheckPromotion(t *testing.T) {
+	promo := models.Promotion{
+		Active:    true,
+		ValidFrom: date("2026-06-01"),
+		ValidTo:   date("2026-06-30"),
+		MinNights: 2,
+		RoomIDs:   []int{1},
+	}
+
+	tests := []struct {
+		name  string
+		promo func(p *models.Promotion)
+		start string
+		end   string
+		room  int
+		ok    bool
+	}{
+		{"inside the dates", nil, "2026-06-10", "2026-06-12", 1, true},
+		{"last night on valid to", nil, "2026-06-28", "2026-07-01", 1, true},
+		{"first night on valid from", nil, "2026-06-01", "2026-06-03", 1, true},
+		{"starts before valid from", nil, "2026-05-30", "2026-06-02", 1, false},
+		{"runs past valid to", nil, "2026-06-29", "2026-07-02", 1, false},
+		{"entirely after", nil, "2026-08-01", "2026-08-03", 1, false},
+		{"too short", nil, "2026-06-10", "2026-06-11", 1, false},
+		{"other room", nil, "2026-06-10", "2026-06-12", 2, false},
+		{"any room", func(p *models.Promotion) { p.RoomIDs = nil }, "2026-06-10", "2026-06-12", 2, true},
+		{"inactive", func(p *models.Promotion) { p.Active = false }, "2026-06-10", "2026-06-12", 1, false},
+		{"used up", func(p *models.Promotion) { p.MaxUses, p.TimesUsed = 5, 5 }, "2026-06-10", "2026-06-12", 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := promo
+			if tt.promo != nil {
+				tt.promo(&p)
+			}
+			stay := Stay{
+				Room:      models.Room{ID: tt.room},
+				StartDate: date(tt.start),
+				EndDate:   date(tt.end),
+			}
+
+			err := CheckPromotion(p, stay)
+			if tt.ok && err != nil {
+				t.Errorf("expected the promotion to apply, got %q", err)
+			} else if !tt.ok && err == nil {
+				t.Error("expected the promotion to be rejected")
+			}
+		})
+	}
+}
+
+func TestNewQuote(t *testing.T) {
+	room := models.Room{ID: 1, Price: 10000}
+	breakfast := models.Extra{ID: 1, Name: "Breakfast", PricingUnit: models.PerGuest, Price: 1500}
+	parking := models.Extra{ID: 2, Name: "Parking", PricingUnit: models.PerNight, Price: 1000}
+	cleaning := models.Extra{ID: 3, Name: "Cleaning", PricingUnit: models.PerStay, Price: 2500}
+	vat := models.TaxRule{ID: 1, Name: "VAT", Basis: models.TaxPercentage, Amount: 1000}
+	cityTax := models.TaxRule{ID: 2, Name: "City tax", Basis: models.TaxPerPersonNight, Amount: 200}
+	resortFee := models.TaxRule{ID: 3, Name: "Resort fee", Basis: models.TaxPerNight, Amount: 500}
+	bookingFee := models.TaxRule{ID: 4, Name: "Booking fee", Basis: models.TaxPerStay, Amount: 300}
+
+	tests := []struct {
+		name      string
+		nights    int
+		guests    int
+		promotion *models.Promotion
+		extras    []models.Extra
+		taxes     []models.TaxRule
+		want      models.Quote
+	}{
+		{
+			name:   "room only",
+			nights: 3, guests: 2,
+			want: models.Quote{Nights: 3, NightlyRate: 10000, Subtotal: 30000, Total: 30000},
+		},
+		{
+			name:   "percent discount",
+			nights: 2, guests: 1,
+			promotion: &models.Promotion{DiscountType: models.DiscountPercent, Amount: 15},
+			want:      models.Quote{Nights: 2, NightlyRate: 10000, Subtotal: 20000, Discount: 3000, Total: 17000},
+		},
+		{
+			name:   "fixed discount larger than the stay",
+			nights: 1, guests: 1,
+			promotion: &models.Promotion{DiscountType: models.DiscountFixed, Amount: 50000},
+			want:      models.Quote{Nights: 1, NightlyRate: 10000, Subtotal: 10000, Discount: 10000, Total: 0},
+		},
+		{
+			name:   "extras by guest, night and stay",
+			nights: 2, guests: 3,
+			extras: []models.Extra{breakfast, parking, cleaning},
+			want: models.Quote{
+				Nights: 2, NightlyRate: 10000, Subtotal: 20000,
+				ExtrasTotal: 3*1500 + 2*1000 + 2500,
+				Total:       20000 + 3*1500 + 2*1000 + 2500,
+			},
+		},
+		{
+			name:   "percentage tax on the discounted stay and extras",
+			nights: 2, guests: 1,
+			promotion: &models.Promotion{DiscountType: models.DiscountFixed, Amount: 5000},
+			extras:    []models.Extra{cleaning},
+			taxes:     []models.TaxRule{vat},
+			want: models.Quote{
+				Nights: 2, NightlyRate: 10000, Subtotal: 20000, Discount: 5000,
+				ExtrasTotal: 2500, TaxTotal: 1750, Total: 19250,
+			},
+		},
+		{
+			name:   "fixed fees are not taxed by percentage rules",
+			nights: 2, guests: 2,
+			taxes: []models.TaxRule{vat, cityTax, resortFee, bookingFee},
+			want: models.Quote{
+				Nights: 2, NightlyRate: 10000, Subtotal: 20000,
+				TaxTotal: 2000 + 2*2*200 + 2*500 + 300,
+				Total:    20000 + 2000 + 2*2*200 + 2*500 + 300,
+			},
+		},
+		{
+			name:   "percentage tax rounds to the nearest cent",
+			nights: 1, guests: 1,
+			taxes: []models.TaxRule{{Basis: models.TaxPercentage, Amount: 725}},
+			want:  models.Quote{Nights: 1, NightlyRate: 10000, Subtotal: 10000, TaxTotal: 725, Total: 10725},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := date("2026-06-10")
+			q := NewQuote(Stay{
+				Room:      room,
+				StartDate: start,
+				EndDate:   start.AddDate(0, 0, tt.nights),
+				Guests:    tt.guests,
+				Promotion: tt.promotion,
+				Extras:    tt.extras,
+				TaxRules:  tt.taxes,
+			})
+
+			if q.Nights != tt.want.Nights || q.NightlyRate != tt.want.NightlyRate || q.Subtotal != tt.want.Subtotal ||
+				q.Discount != tt.want.Discount || q.ExtrasTotal != tt.want.ExtrasTotal ||
+				q.TaxTotal != tt.want.TaxTotal || q.Total != tt.want.Total {
+				t.Errorf("got %+v, want %+v", q, tt.want)
+			}
+			if len(q.Extras) != len(tt.extras) {
+				t.Errorf("got %d extra lines, want %d", len(q.Extras), len(tt.extras))
+			}
+			if len(q.Taxes) != len(tt.taxes) {
+				t.Errorf("got %d tax lines, want %d", len(q.Taxes), len(tt.taxes))
+			}
+		})
+	}
+}
+
+func TestCityTaxQuantity(t *testing.T) {
+	start := date("2026-06-10")
+	q := NewQuote(Stay{
+		Room:      models.Room{Price: 10000},
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 3),
+		Guests:    2,
+		TaxRules:  []models.TaxRule{{Basis: models.TaxPerPersonNight, Amount: 200}},
+	})
+
+	if q.Taxes[0].Quantity != 6 || q.Taxes[0].Amount != 1200 {
+		t.Errorf("expected 2 guests for 3 nights to be charged 6 times, got %+v", q.Taxes[0])
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+		ok   bool
+	}{
+		{"120", 12000, true},
+		{"120.50", 12050, true},
+		{" 0.1 ", 10, true},
+		{"0", 0, true},
+		{"10000000", 1000000000, true},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"-5", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"-Inf", 0, false},
+		{"1e400", 0, false},
+		{"10000000.01", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseAmount(tt.s)
+			if tt.ok && err != nil {
+				t.Errorf("expected %q to parse, got %q", tt.s, err)
+			} else if !tt.ok && err == nil {
+				t.Errorf("expected %q to be rejected, got %d", tt.s, got)
+			} else if got != tt.want {
+				t.Errorf("expected %d cents, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"math"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/NganJason/hotel-booking/internal/config"
@@ -16,10 +19,18 @@ var functions = template.FuncMap{
 	"humanDate": HumanDate,
 	"formatDate": FormatDate,
 	"iterate": Iterate,
+	"formatMoney": FormatMoney,
+	"formatAmount": FormatAmount,
+	"convertMoney": ConvertMoney,
+	"statusLabel": models.StatusLabel,
 }
 
 var app *config.AppConfig
 
+// currencies is the table of display currencies, kept here so every page can offer the currency selector
+var currencies []models.Currency
+var currencyMutex sync.RWMutex
+
 // NewTemplates sets the config for the template package
 func NewRenderer(a *config.AppConfig) {
 	app = a
@@ -36,9 +47,55 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 	}
+
+	td.BaseCurrency = app.BaseCurrency
+	td.Currencies = ActiveCurrencies()
+	td.Currency = CurrencyByCode(app.Session.GetString(r.Context(), "currency"))
 	return td
 }
 
+// SetCurrencies replaces the table of display currencies
+func SetCurrencies(c []models.Currency) {
+	currencyMutex.Lock()
+	defer currencyMutex.Unlock()
+	currencies = c
+}
+
+// ActiveCurrencies returns the currencies guests can choose from
+func ActiveCurrencies() []models.Currency {
+	currencyMutex.RLock()
+	defer currencyMutex.RUnlock()
+
+	var active []models.Currency
+	for _, c := range currencies {
+		if c.Active {
+			active = append(active, c)
+		}
+	}
+	return active
+}
+
+// CurrencyByCode returns the active currency with the given code, falling back to the base currency
+func CurrencyByCode(code string) models.Currency {
+	currencyMutex.RLock()
+	defer currencyMutex.RUnlock()
+
+	var base models.Currency
+	for _, c := range currencies {
+		if c.Code == code && c.Active {
+			return c
+		}
+		if c.Code == app.BaseCurrency {
+			base = c
+		}
+	}
+
+	if base.Code == "" {
+		base = models.Currency{Code: app.BaseCurrency, Symbol: "$", Decimals: 2, Rate: 1}
+	}
+	return base
+}
+
 // RenderTemplate renders templates using html/template
 func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.TemplateData) {
 	tc := app.TemplateCache
@@ -112,4 +169,43 @@ func Iterate(count int) []int {
 	}
 
 	return items
-}
\ No newline at end of file
+}
+// FormatMoney formats an amount in cents of the base currency for display
+func FormatMoney(cents int) string {
+	symbol := CurrencyByCode(app.BaseCurrency).Symbol
+	if cents < 0 {
+		return "-" + symbol + FormatAmount(-cents)
+	}
+	return symbol + FormatAmount(cents)
+}
+
+// ConvertMoney formats an amount in cents of the base currency in another currency,
+// rounded to the number of decimals that currency uses. Prices are only ever settled in the base currency.
+func ConvertMoney(c models.Currency, cents int) string {
+	if c.Code == "" || c.Code == app.BaseCurrency {
+		return FormatMoney(cents)
+	}
+
+	converted := float64(cents) / 100 * c.Rate
+
+	sign := ""
+	if converted < 0 {
+		sign = "-"
+		converted = -converted
+	}
+
+	scale := math.Pow(10, float64(c.Decimals))
+	converted = math.Round(converted*scale) / scale
+
+	return sign + c.Symbol + strconv.FormatFloat(converted, 'f', c.Decimals, 64)
+}
+
+// FormatAmount formats an amount in cents as a plain decimal, as used in form inputs
+func FormatAmount(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
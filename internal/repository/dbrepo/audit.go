@@ -0,0 +1,175 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// InsertAuditEntry appends an entry to the audit log. The log can't be changed or deleted from afterwards.
+func (m *postgresDBRepo) InsertAuditEntry(e models.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertAuditEntry(ctx, tx, e)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Audited returns the repository with entries to record in the audit log in the same transaction as the
+// change next saved through it, so that the change is saved only if they are too
+func (m *postgresDBRepo) Audited(entries ...models.AuditEntry) repository.DatabaseRepo {
+	audited := *m
+	audited.audit = entries
+	return &audited
+}
+
+// commit records the repository's audit entries, if any, inside tx and commits it. An entry made before
+// its entity was created, with no entity id, is recorded against createdID.
+func (m *postgresDBRepo) commit(ctx context.Context, tx *sql.Tx, createdID int) error {
+	for _, e := range m.audit {
+		if e.EntityID == 0 {
+			e.EntityID = createdID
+		}
+		err := insertAuditEntry(ctx, tx, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// exec runs a statement making a change in a transaction, with the repository's audit entries if any
+func (m *postgresDBRepo) exec(ctx context.Context, stmt string, args ...interface{}) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+// insert runs an insert returning the new row's id as exec runs a statement, and returns the id
+func (m *postgresDBRepo) insert(ctx context.Context, stmt string, args ...interface{}) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	err = tx.QueryRowContext(ctx, stmt, args...).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.commit(ctx, tx, newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, e models.AuditEntry) error {
+	stmt := `insert into audit_logs (user_id, user_name, ip_address, action, entity, entity_id, before, after, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)`
+
+	_, err := tx.ExecContext(ctx, stmt, e.UserID, e.UserName, e.IPAddress, e.Action, e.Entity, e.EntityID, e.Before, e.After, time.Now())
+
+	return err
+}
+
+// AuditEntries returns the entries matching the filter, newest first
+func (m *postgresDBRepo) AuditEntries(f models.AuditFilter, limit int) ([]models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.AuditEntry
+
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.UserID > 0 {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.Entity != "" {
+		add("entity = $%d", f.Entity)
+	}
+	if f.EntityID > 0 {
+		add("entity_id = $%d", f.EntityID)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+
+	query := `select id, user_id, user_name, ip_address, action, entity, entity_id, before, after, created_at from audit_logs`
+	if len(where) > 0 {
+		query += ` where ` + strings.Join(where, " and ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` order by created_at desc, id desc limit $%d`, len(args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AuditEntry
+		err = rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.UserName,
+			&e.IPAddress,
+			&e.Action,
+			&e.Entity,
+			&e.EntityID,
+			&e.Before,
+			&e.After,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
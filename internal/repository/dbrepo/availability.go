@@ -0,0 +1,53 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// GetRestrictionsForAllRoomsByDate returns every room's restrictions overlapping start to end,
+// leaving out holds that have expired
+func (m *postgresDBRepo) GetRestrictionsForAllRoomsByDate(start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `
+		select id, coalesce(reservation_id, 0), restriction_id, coalesce(block_id, 0), room_id, start_date, end_date
+		from room_restrictions
+		where $1 < end_date and $2 > start_date and (expires_at is null or expires_at > $3)
+		order by room_id, start_date
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, time.Now())
+	if err != nil {
+		return restrictions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rr models.RoomRestriction
+		err := rows.Scan(
+			&rr.ID,
+			&rr.ReservationID,
+			&rr.RestrictionID,
+			&rr.BlockID,
+			&rr.RoomID,
+			&rr.StartDate,
+			&rr.EndDate,
+		)
+		if err != nil {
+			return restrictions, err
+		}
+		restrictions = append(restrictions, rr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
@@ -0,0 +1,286 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+const calendarSourceColumns = `cs.id, cs.room_id, cs.name, cs.url, cs.last_synced_at, cs.last_status, cs.created_at, cs.updated_at, rm.room_name`
+
+func scanCalendarSource(row interface{ Scan(...interface{}) error }) (models.CalendarSource, error) {
+	var s models.CalendarSource
+	var lastSynced sql.NullTime
+
+	err := row.Scan(
+		&s.ID,
+		&s.RoomID,
+		&s.Name,
+		&s.URL,
+		&lastSynced,
+		&s.LastStatus,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+		&s.Room.RoomName,
+	)
+
+	s.LastSyncedAt = lastSynced.Time
+	s.Room.ID = s.RoomID
+
+	return s, err
+}
+
+// AllCalendarSources returns the calendar sources of every room, by room
+func (m *postgresDBRepo) AllCalendarSources() ([]models.CalendarSource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var sources []models.CalendarSource
+
+	query := `select ` + calendarSourceColumns + ` from calendar_sources cs join rooms rm on rm.id = cs.room_id order by rm.room_name, cs.id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return sources, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanCalendarSource(rows)
+		if err != nil {
+			return sources, err
+		}
+		sources = append(sources, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return sources, err
+	}
+
+	return sources, nil
+}
+
+func (m *postgresDBRepo) GetCalendarSourceByID(id int) (models.CalendarSource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + calendarSourceColumns + ` from calendar_sources cs join rooms rm on rm.id = cs.room_id where cs.id = $1`
+
+	return scanCalendarSource(m.DB.QueryRowContext(ctx, query, id))
+}
+
+func (m *postgresDBRepo) InsertCalendarSource(s models.CalendarSource) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into calendar_sources (room_id, name, url, created_at, updated_at) values ($1, $2, $3, $4, $5) returning id`
+
+	newID, err := m.insert(ctx, stmt, s.RoomID, s.Name, s.URL, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateCalendarSource saves the source's name and URL. Moving it to another room moves
+// the external bookings already imported from it too.
+func (m *postgresDBRepo) UpdateCalendarSource(s models.CalendarSource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update calendar_sources set room_id = $1, name = $2, url = $3, updated_at = $4 where id = $5`
+
+	_, err = tx.ExecContext(ctx, stmt, s.RoomID, s.Name, s.URL, time.Now(), s.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update room_restrictions set room_id = $1, updated_at = $2 where source_id = $3`, s.RoomID, time.Now(), s.ID)
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+// DeleteCalendarSource deletes the source along with the external bookings imported from it and its sync log
+func (m *postgresDBRepo) DeleteCalendarSource(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.exec(ctx, `delete from calendar_sources where id = $1`, id)
+
+	return err
+}
+
+// ReconcileExternalBookings makes the source's external bookings match the bookings now in its feed:
+// new bookings are added, ones whose dates changed are moved and ones no longer in the feed are removed.
+// It returns the counts of each, and of bookings overlapping one of our reservations.
+func (m *postgresDBRepo) ReconcileExternalBookings(source models.CalendarSource, bookings []models.ExternalBooking) (models.CalendarSyncLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result := models.CalendarSyncLog{SourceID: source.ID, Status: models.SyncOK}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	type existing struct {
+		id         int
+		start, end time.Time
+	}
+	current := make(map[string]existing)
+
+	rows, err := tx.QueryContext(ctx, `select id, external_uid, start_date, end_date from room_restrictions where source_id = $1 for update`, source.ID)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var e existing
+		var uid string
+		err := rows.Scan(&e.id, &uid, &e.start, &e.end)
+		if err != nil {
+			rows.Close()
+			return result, err
+		}
+		current[uid] = e
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+
+	for _, b := range bookings {
+		e, found := current[b.UID]
+		delete(current, b.UID)
+
+		if !found {
+			stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, source_id, external_uid, created_at, updated_at)
+				values ($1, $2, $3, 4, $4, $5, $6, $7)`
+
+			_, err = tx.ExecContext(ctx, stmt, b.StartDate, b.EndDate, source.RoomID, source.ID, b.UID, time.Now(), time.Now())
+			if err != nil {
+				return result, err
+			}
+			result.Created++
+		} else if !e.start.Equal(b.StartDate) || !e.end.Equal(b.EndDate) {
+			_, err = tx.ExecContext(ctx, `update room_restrictions set start_date = $1, end_date = $2, updated_at = $3 where id = $4`,
+				b.StartDate, b.EndDate, time.Now(), e.id)
+			if err != nil {
+				return result, err
+			}
+			result.Updated++
+		}
+
+		var overlapping int
+		err = tx.QueryRowContext(ctx, `select count(id) from room_restrictions where room_id = $1 and restriction_id = 1 and $2 < end_date and $3 > start_date`,
+			source.RoomID, b.StartDate, b.EndDate).Scan(&overlapping)
+		if err != nil {
+			return result, err
+		}
+		if overlapping > 0 {
+			result.Conflicts++
+		}
+	}
+
+	for _, e := range current {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where id = $1`, e.id)
+		if err != nil {
+			return result, err
+		}
+		result.Removed++
+	}
+
+	return result, tx.Commit()
+}
+
+// InsertCalendarSyncLog records an import and updates its source's last sync
+func (m *postgresDBRepo) InsertCalendarSyncLog(l models.CalendarSyncLog) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `insert into calendar_sync_logs (source_id, status, created_count, updated_count, removed_count, conflict_count, message, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = tx.ExecContext(ctx, stmt, l.SourceID, l.Status, l.Created, l.Updated, l.Removed, l.Conflicts, l.Message, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update calendar_sources set last_synced_at = $1, last_status = $2, updated_at = $1 where id = $3`, time.Now(), l.Status, l.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecentCalendarSyncLogs returns the latest imports from every source, newest first
+func (m *postgresDBRepo) RecentCalendarSyncLogs(limit int) ([]models.CalendarSyncLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var logs []models.CalendarSyncLog
+
+	query := `
+		select l.id, l.source_id, l.status, l.created_count, l.updated_count, l.removed_count, l.conflict_count, l.message, l.created_at,
+			cs.name, rm.room_name
+		from calendar_sync_logs l
+		join calendar_sources cs on cs.id = l.source_id
+		join rooms rm on rm.id = cs.room_id
+		order by l.created_at desc, l.id desc
+		limit $1
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return logs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.CalendarSyncLog
+		err := rows.Scan(
+			&l.ID,
+			&l.SourceID,
+			&l.Status,
+			&l.Created,
+			&l.Updated,
+			&l.Removed,
+			&l.Conflicts,
+			&l.Message,
+			&l.CreatedAt,
+			&l.Source.Name,
+			&l.Source.Room.RoomName,
+		)
+		if err != nil {
+			return logs, err
+		}
+		l.Source.ID = l.SourceID
+		logs = append(logs, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return logs, err
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,124 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// ChangeReservationDates moves the reservation and its room restriction to new dates and stores its new price.
+// It returns repository.ErrRoomUnavailable if another booking or block overlaps the new dates.
+func (m *postgresDBRepo) ChangeReservationDates(res models.Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = changeReservationDates(ctx, tx, res)
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+// changeReservationDates moves one reservation inside the caller's transaction, saving the event for it
+func changeReservationDates(ctx context.Context, tx *sql.Tx, res models.Reservation) error {
+	// lock the room so two changes can't both pass the availability check
+	_, err := tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	free, err := roomFreeExcluding(ctx, tx, res.StartDate, res.EndDate, res.RoomID, res.ID)
+	if err != nil {
+		return err
+	}
+	if !free {
+		return repository.ErrRoomUnavailable
+	}
+
+	stmt := `update reservations set start_date = $1, end_date = $2, subtotal = $3, discount = $4, extras_total = $5, tax_total = $6, total = $7, updated_at = $8
+		where id = $9`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		res.StartDate,
+		res.EndDate,
+		res.Subtotal,
+		res.Discount,
+		res.ExtrasTotal,
+		res.TaxTotal,
+		res.Total,
+		time.Now(),
+		res.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	// a stay split across rooms by a room move is put back together in the reservation's current room
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1 and restriction_id = 1`, res.ID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id)
+		values ($1, $2, $3, $4, $5, $6, 1)`
+
+	_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, res.ID, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from reservation_extras where reservation_id = $1`, res.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertReservationExtras(ctx, tx, res.ID, res.Extras)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from reservation_taxes where reservation_id = $1`, res.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertReservationTaxes(ctx, tx, res.ID, res.Taxes)
+	if err != nil {
+		return err
+	}
+
+	return insertOutboxEvent(ctx, tx, events.ReservationModified{ReservationID: res.ID})
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func roomFreeExcluding(ctx context.Context, q querier, start, end time.Time, roomID, reservationID int) (bool, error) {
+	query := `
+		select count(id) from room_restrictions
+		where room_id = $1 and $2 < end_date and $3 > start_date
+		and (reservation_id is null or reservation_id <> $4)
+		and (expires_at is null or expires_at > $5)
+	`
+
+	var numRows int
+	err := q.QueryRowContext(ctx, query, roomID, start, end, reservationID, time.Now()).Scan(&numRows)
+	if err != nil {
+		return false, err
+	}
+
+	return numRows == 0, nil
+}
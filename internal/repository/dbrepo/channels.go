@@ -0,0 +1,545 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+const channelColumns = `id, name, url, api_key, active, pulled_until, last_synced_at, last_status, created_at, updated_at`
+
+func scanChannel(row interface{ Scan(...interface{}) error }) (models.Channel, error) {
+	var c models.Channel
+	var pulledUntil, lastSynced sql.NullTime
+
+	err := row.Scan(
+		&c.ID,
+		&c.Name,
+		&c.URL,
+		&c.APIKey,
+		&c.Active,
+		&pulledUntil,
+		&lastSynced,
+		&c.LastStatus,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+
+	c.PulledUntil = pulledUntil.Time
+	c.LastSyncedAt = lastSynced.Time
+
+	return c, err
+}
+
+// AllChannels returns every channel with its room mapping, by name
+func (m *postgresDBRepo) AllChannels() ([]models.Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var channels []models.Channel
+
+	rows, err := m.DB.QueryContext(ctx, `select `+channelColumns+` from channels order by name, id`)
+	if err != nil {
+		return channels, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return channels, err
+		}
+		channels = append(channels, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return channels, err
+	}
+
+	for i := range channels {
+		channels[i].Rooms, err = m.channelRooms(ctx, channels[i].ID)
+		if err != nil {
+			return channels, err
+		}
+	}
+
+	return channels, nil
+}
+
+func (m *postgresDBRepo) GetChannelByID(id int) (models.Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	c, err := scanChannel(m.DB.QueryRowContext(ctx, `select `+channelColumns+` from channels where id = $1`, id))
+	if err != nil {
+		return c, err
+	}
+
+	c.Rooms, err = m.channelRooms(ctx, c.ID)
+
+	return c, err
+}
+
+func (m *postgresDBRepo) channelRooms(ctx context.Context, channelID int) ([]models.ChannelRoom, error) {
+	var rooms []models.ChannelRoom
+
+	rows, err := m.DB.QueryContext(ctx, `select id, channel_id, room_id, room_code from channel_rooms where channel_id = $1 order by room_id`, channelID)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cr models.ChannelRoom
+		err := rows.Scan(&cr.ID, &cr.ChannelID, &cr.RoomID, &cr.RoomCode)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, cr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// setChannelRooms replaces the channel's room mapping inside the caller's transaction
+func setChannelRooms(ctx context.Context, tx *sql.Tx, c models.Channel) error {
+	_, err := tx.ExecContext(ctx, `delete from channel_rooms where channel_id = $1`, c.ID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into channel_rooms (channel_id, room_id, room_code, created_at, updated_at) values ($1, $2, $3, $4, $5)`
+
+	for _, cr := range c.Rooms {
+		_, err = tx.ExecContext(ctx, stmt, c.ID, cr.RoomID, cr.RoomCode, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) InsertChannel(c models.Channel) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `insert into channels (name, url, api_key, active, created_at, updated_at) values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt, c.Name, c.URL, c.APIKey, c.Active, time.Now(), time.Now()).Scan(&c.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = setChannelRooms(ctx, tx, c)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.commit(ctx, tx, c.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.ID, nil
+}
+
+func (m *postgresDBRepo) UpdateChannel(c models.Channel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update channels set name = $1, url = $2, api_key = $3, active = $4, updated_at = $5 where id = $6`
+
+	_, err = tx.ExecContext(ctx, stmt, c.Name, c.URL, c.APIKey, c.Active, time.Now(), c.ID)
+	if err != nil {
+		return err
+	}
+
+	err = setChannelRooms(ctx, tx, c)
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+// DeleteChannel deletes the channel with its room mapping and sync log. Reservations imported
+// from it are kept.
+func (m *postgresDBRepo) DeleteChannel(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.exec(ctx, `delete from channels where id = $1`, id)
+
+	return err
+}
+
+// ImportChannelReservation brings a booking pulled from a channel in line with the channel:
+// a new booking becomes a reservation, changed dates move it and a cancellation cancels it.
+// A booking for a room that isn't free, whether new or moved, is kept as a conflict for staff
+// to resolve. It returns the booking as saved and what changed: ChannelAdded, ChannelMoved,
+// ChannelCancelled or ChannelConflict, or "" if nothing did.
+func (m *postgresDBRepo) ImportChannelReservation(cr models.ChannelReservation, res models.Reservation) (models.ChannelReservation, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return cr, "", err
+	}
+	defer tx.Rollback()
+
+	var existing models.ChannelReservation
+	found := true
+
+	query := `select id, coalesce(reservation_id, 0), room_id, start_date, end_date, status
+		from channel_reservations where channel_id = $1 and reference = $2 for update`
+
+	err = tx.QueryRowContext(ctx, query, cr.ChannelID, cr.Reference).Scan(
+		&existing.ID,
+		&existing.ReservationID,
+		&existing.RoomID,
+		&existing.StartDate,
+		&existing.EndDate,
+		&existing.Status,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		found = false
+	} else if err != nil {
+		return cr, "", err
+	}
+
+	cr.ID = existing.ID
+	cr.ReservationID = existing.ReservationID
+
+	sameStay := found && existing.RoomID == cr.RoomID &&
+		existing.StartDate.Equal(cr.StartDate) && existing.EndDate.Equal(cr.EndDate)
+
+	switch {
+	case cr.Status == models.ChannelCancelled:
+		if found && existing.Status == models.ChannelCancelled {
+			return existing, "", nil
+		}
+		if cr.ReservationID > 0 {
+			err = cancelChannelReservation(ctx, tx, cr)
+			if err != nil {
+				return cr, "", err
+			}
+		}
+
+	case found && (existing.Status == models.ChannelCancelled || existing.Status == models.ChannelResolved):
+		// a cancelled booking can't come back, and a resolved conflict has been settled with the guest
+		return existing, "", nil
+
+	case sameStay && existing.Status != models.ChannelConflict:
+		return existing, "", nil
+
+	case cr.ReservationID > 0:
+		if cr.RoomID != existing.RoomID {
+			cr.Status = models.ChannelConflict
+			break
+		}
+
+		res.ID = cr.ReservationID
+		err = changeReservationDates(ctx, tx, res)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			cr.Status = models.ChannelConflict
+		} else if err != nil {
+			return cr, "", err
+		} else {
+			cr.Status = models.ChannelBooked
+		}
+
+	default:
+		// lock the room so a guest booking here can't take it at the same time
+		_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, cr.RoomID)
+		if err != nil {
+			return cr, "", err
+		}
+
+		free, err := roomFreeExcluding(ctx, tx, cr.StartDate, cr.EndDate, cr.RoomID, 0)
+		if err != nil {
+			return cr, "", err
+		}
+
+		if !free {
+			if sameStay {
+				return existing, "", nil
+			}
+			cr.Status = models.ChannelConflict
+			break
+		}
+
+		cr.ReservationID, err = insertReservation(ctx, tx, res)
+		if err != nil {
+			return cr, "", err
+		}
+
+		stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id)
+			values ($1, $2, $3, $4, $5, $6, 1)`
+
+		_, err = tx.ExecContext(ctx, stmt, cr.StartDate, cr.EndDate, cr.RoomID, cr.ReservationID, time.Now(), time.Now())
+		if err != nil {
+			return cr, "", err
+		}
+
+		// the channel has already confirmed the booking with the guest
+		_, err = tx.ExecContext(ctx, `update reservations set status = $1 where id = $2`, models.StatusConfirmed, cr.ReservationID)
+		if err != nil {
+			return cr, "", err
+		}
+
+		err = insertStatusChange(ctx, tx, models.ReservationStatusChange{
+			ReservationID: cr.ReservationID,
+			FromStatus:    models.StatusPending,
+			ToStatus:      models.StatusConfirmed,
+			Actor:         models.ActorSystem,
+			Note:          fmt.Sprintf("Booked on %s as %s", cr.Channel.Name, cr.Reference),
+		})
+		if err != nil {
+			return cr, "", err
+		}
+
+		err = insertOutboxEvent(ctx, tx, events.ReservationCreated{ReservationID: cr.ReservationID, Source: events.SourceChannel})
+		if err != nil {
+			return cr, "", err
+		}
+		cr.Status = models.ChannelBooked
+	}
+
+	if found {
+		stmt := `update channel_reservations set reservation_id = $1, room_id = $2, start_date = $3, end_date = $4, guest_name = $5, status = $6, updated_at = $7
+			where id = $8`
+
+		_, err = tx.ExecContext(ctx, stmt, nullableID(cr.ReservationID), cr.RoomID, cr.StartDate, cr.EndDate, cr.GuestName, cr.Status, time.Now(), cr.ID)
+	} else {
+		stmt := `insert into channel_reservations (channel_id, reference, reservation_id, room_id, start_date, end_date, guest_name, status, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+		err = tx.QueryRowContext(ctx, stmt, cr.ChannelID, cr.Reference, nullableID(cr.ReservationID), cr.RoomID, cr.StartDate, cr.EndDate,
+			cr.GuestName, cr.Status, time.Now(), time.Now()).Scan(&cr.ID)
+	}
+	if err != nil {
+		return cr, "", err
+	}
+
+	var change string
+	switch {
+	case !found && cr.Status == models.ChannelCancelled, found && sameStay && cr.Status == existing.Status:
+		// a booking cancelled before it was ever pulled is only recorded, and a conflict still unresolved isn't news
+	case cr.Status == models.ChannelBooked && existing.ReservationID == 0:
+		change = models.ChannelAdded
+	case cr.Status == models.ChannelBooked:
+		change = models.ChannelMoved
+	default:
+		change = cr.Status
+	}
+
+	return cr, change, tx.Commit()
+}
+
+// cancelChannelReservation cancels the reservation made for a channel booking, unless the guest has
+// already arrived or it has been cancelled here
+func cancelChannelReservation(ctx context.Context, tx *sql.Tx, cr models.ChannelReservation) error {
+	var status string
+	err := tx.QueryRowContext(ctx, `select status from reservations where id = $1 for update`, cr.ReservationID).Scan(&status)
+	if err != nil {
+		return err
+	}
+
+	if status != models.StatusPending && status != models.StatusConfirmed {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set status = $1, updated_at = $2 where id = $3`, models.StatusCancelled, time.Now(), cr.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, cr.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	err = insertStatusChange(ctx, tx, models.ReservationStatusChange{
+		ReservationID: cr.ReservationID,
+		FromStatus:    status,
+		ToStatus:      models.StatusCancelled,
+		Actor:         models.ActorSystem,
+		Note:          fmt.Sprintf("Cancelled on %s", cr.Channel.Name),
+	})
+	if err != nil {
+		return err
+	}
+
+	return insertOutboxEvent(ctx, tx, events.ReservationCancelled{ReservationID: cr.ReservationID})
+}
+
+// ChannelConflicts returns the bookings pulled from channels that clash with our own, oldest first
+func (m *postgresDBRepo) ChannelConflicts() ([]models.ChannelReservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var conflicts []models.ChannelReservation
+
+	query := `
+		select cr.id, cr.channel_id, cr.reference, coalesce(cr.reservation_id, 0), cr.room_id, cr.start_date, cr.end_date,
+			cr.guest_name, cr.status, cr.created_at, cr.updated_at, c.name, rm.room_name
+		from channel_reservations cr
+		join channels c on c.id = cr.channel_id
+		join rooms rm on rm.id = cr.room_id
+		where cr.status = $1
+		order by cr.created_at, cr.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.ChannelConflict)
+	if err != nil {
+		return conflicts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cr models.ChannelReservation
+		err := rows.Scan(
+			&cr.ID,
+			&cr.ChannelID,
+			&cr.Reference,
+			&cr.ReservationID,
+			&cr.RoomID,
+			&cr.StartDate,
+			&cr.EndDate,
+			&cr.GuestName,
+			&cr.Status,
+			&cr.CreatedAt,
+			&cr.UpdatedAt,
+			&cr.Channel.Name,
+			&cr.Room.RoomName,
+		)
+		if err != nil {
+			return conflicts, err
+		}
+		cr.Channel.ID = cr.ChannelID
+		cr.Room.ID = cr.RoomID
+		conflicts = append(conflicts, cr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return conflicts, err
+	}
+
+	return conflicts, nil
+}
+
+// ResolveChannelConflict marks a conflict as settled, so later pulls of the booking leave it alone
+func (m *postgresDBRepo) ResolveChannelConflict(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update channel_reservations set status = $1, updated_at = $2 where id = $3 and status = $4`
+
+	_, err := m.DB.ExecContext(ctx, stmt, models.ChannelResolved, time.Now(), id, models.ChannelConflict)
+
+	return err
+}
+
+// InsertChannelSyncLog records a sync and updates its channel's last sync. A non-zero pulledUntil
+// is where the next pull of reservations carries on from.
+func (m *postgresDBRepo) InsertChannelSyncLog(l models.ChannelSyncLog, pulledUntil time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `insert into channel_sync_logs (channel_id, status, pulled_count, cancelled_count, conflict_count, pushed_count, attempts, message, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err = tx.ExecContext(ctx, stmt, l.ChannelID, l.Status, l.Pulled, l.Cancelled, l.Conflicts, l.Pushed, l.Attempts, l.Message, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	stmt = `update channels set last_synced_at = $1, last_status = $2, pulled_until = coalesce($3, pulled_until), updated_at = $1 where id = $4`
+
+	_, err = tx.ExecContext(ctx, stmt, time.Now(), l.Status, nullableDate(pulledUntil), l.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecentChannelSyncLogs returns the latest syncs with every channel, newest first
+func (m *postgresDBRepo) RecentChannelSyncLogs(limit int) ([]models.ChannelSyncLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var logs []models.ChannelSyncLog
+
+	query := `
+		select l.id, l.channel_id, l.status, l.pulled_count, l.cancelled_count, l.conflict_count, l.pushed_count, l.attempts, l.message, l.created_at, c.name
+		from channel_sync_logs l
+		join channels c on c.id = l.channel_id
+		order by l.created_at desc, l.id desc
+		limit $1
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return logs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.ChannelSyncLog
+		err := rows.Scan(
+			&l.ID,
+			&l.ChannelID,
+			&l.Status,
+			&l.Pulled,
+			&l.Cancelled,
+			&l.Conflicts,
+			&l.Pushed,
+			&l.Attempts,
+			&l.Message,
+			&l.CreatedAt,
+			&l.Channel.Name,
+		)
+		if err != nil {
+			return logs, err
+		}
+		l.Channel.ID = l.ChannelID
+		logs = append(logs, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return logs, err
+	}
+
+	return logs, nil
+}
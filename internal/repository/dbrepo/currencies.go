@@ -0,0 +1,76 @@
+package dbrepo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+func (m *postgresDBRepo) AllCurrencies() ([]models.Currency, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var currencies []models.Currency
+
+	query := `select id, code, symbol, decimals, rate, active, created_at, updated_at from currencies order by code`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return currencies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.Currency
+		err := rows.Scan(
+			&c.ID,
+			&c.Code,
+			&c.Symbol,
+			&c.Decimals,
+			&c.Rate,
+			&c.Active,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			return currencies, err
+		}
+		currencies = append(currencies, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return currencies, err
+	}
+
+	return currencies, nil
+}
+
+func (m *postgresDBRepo) InsertCurrency(c models.Currency) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into currencies (code, symbol, decimals, rate, active, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	newID, err := m.insert(ctx, stmt, strings.ToUpper(c.Code), c.Symbol, c.Decimals, c.Rate, c.Active, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) UpdateCurrency(c models.Currency) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update currencies set symbol = $1, decimals = $2, rate = $3, active = $4, updated_at = $5 where id = $6`
+
+	err := m.exec(ctx, stmt, c.Symbol, c.Decimals, c.Rate, c.Active, time.Now(), c.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -4,12 +4,14 @@ import (
 	"database/sql"
 
 	"github.com/NganJason/hotel-booking/internal/config"
+	"github.com/NganJason/hotel-booking/internal/models"
 	"github.com/NganJason/hotel-booking/internal/repository"
 )
 
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB *sql.DB
+	audit []models.AuditEntry
 }
 
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
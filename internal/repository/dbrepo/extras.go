@@ -0,0 +1,152 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+func (m *postgresDBRepo) AllExtras() ([]models.Extra, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var extras []models.Extra
+
+	query := `select id, name, description, price, pricing_unit, active, created_at, updated_at from extras order by name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return extras, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.Extra
+		err := rows.Scan(
+			&e.ID,
+			&e.Name,
+			&e.Description,
+			&e.Price,
+			&e.PricingUnit,
+			&e.Active,
+			&e.CreatedAt,
+			&e.UpdatedAt,
+		)
+		if err != nil {
+			return extras, err
+		}
+		extras = append(extras, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return extras, err
+	}
+
+	return extras, nil
+}
+
+func (m *postgresDBRepo) GetExtraByID(id int) (models.Extra, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var e models.Extra
+
+	query := `select id, name, description, price, pricing_unit, active, created_at, updated_at from extras where id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&e.ID,
+		&e.Name,
+		&e.Description,
+		&e.Price,
+		&e.PricingUnit,
+		&e.Active,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func (m *postgresDBRepo) InsertExtra(e models.Extra) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into extras (name, description, price, pricing_unit, active, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	newID, err := m.insert(ctx, stmt, e.Name, e.Description, e.Price, e.PricingUnit, e.Active, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) UpdateExtra(e models.Extra) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update extras set name = $1, description = $2, price = $3, pricing_unit = $4, active = $5, updated_at = $6 where id = $7`
+
+	err := m.exec(ctx, stmt, e.Name, e.Description, e.Price, e.PricingUnit, e.Active, time.Now(), e.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) reservationExtras(ctx context.Context, reservationID int) ([]models.ReservationExtra, error) {
+	var extras []models.ReservationExtra
+
+	query := `
+		select id, reservation_id, extra_id, name, pricing_unit, quantity, unit_price, amount, created_at, updated_at
+		from reservation_extras where reservation_id = $1 order by id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return extras, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.ReservationExtra
+		err := rows.Scan(
+			&e.ID,
+			&e.ReservationID,
+			&e.ExtraID,
+			&e.Name,
+			&e.PricingUnit,
+			&e.Quantity,
+			&e.UnitPrice,
+			&e.Amount,
+			&e.CreatedAt,
+			&e.UpdatedAt,
+		)
+		if err != nil {
+			return extras, err
+		}
+		extras = append(extras, e)
+	}
+
+	return extras, rows.Err()
+}
+
+func insertReservationExtras(ctx context.Context, tx *sql.Tx, reservationID int, extras []models.ReservationExtra) error {
+	stmt := `insert into reservation_extras (reservation_id, extra_id, name, pricing_unit, quantity, unit_price, amount, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	for _, e := range extras {
+		_, err := tx.ExecContext(ctx, stmt, reservationID, e.ExtraID, e.Name, e.PricingUnit, e.Quantity, e.UnitPrice, e.Amount, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
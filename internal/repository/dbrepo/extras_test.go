@@ -0,0 +1,42 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// TestInsertReservationExtras stores one line per extra, priced as it was booked
+func TestInsertReservationExtras(t *testing.T) {
+	anything := anyArg{}
+
+	m, db := newScript(t,
+		step{query: "insert into reservation_extras",
+			args: []driver.Value{int64(7), int64(1), "Breakfast", models.PerGuest, int64(2), int64(1500), int64(3000), anything, anything}},
+		step{query: "insert into reservation_extras",
+			args: []driver.Value{int64(7), int64(2), "Parking", models.PerNight, int64(3), int64(1000), int64(3000), anything, anything}},
+	)
+
+	ctx := context.Background()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = insertReservationExtras(ctx, tx, 7, []models.ReservationExtra{
+		{ExtraID: 1, Name: "Breakfast", PricingUnit: models.PerGuest, Quantity: 2, UnitPrice: 1500, Amount: 3000},
+		{ExtraID: 2, Name: "Parking", PricingUnit: models.PerNight, Quantity: 3, UnitPrice: 1000, Amount: 3000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.done(true)
+}
@@ -0,0 +1,88 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// ReservationsArrivingOn returns the reservations starting on the date, ordered by room
+func (m *postgresDBRepo) ReservationsArrivingOn(date time.Time) ([]models.Reservation, error) {
+	return m.reservationsOnDay("r.start_date", date)
+}
+
+// ReservationsDepartingOn returns the reservations ending on the date, ordered by room
+func (m *postgresDBRepo) ReservationsDepartingOn(date time.Time) ([]models.Reservation, error) {
+	return m.reservationsOnDay("r.end_date", date)
+}
+
+func (m *postgresDBRepo) reservationsOnDay(column string, date time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	// column is one of the two callers' constants, never user input
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.status, r.guests, r.total,
+		r.room_key, r.id_document, r.created_at, r.updated_at, rm.id, rm.room_name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where ` + column + ` = $1
+		order by rm.room_name, r.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, date)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.Status,
+			&i.Guests,
+			&i.Total,
+			&i.RoomKey,
+			&i.IDDocument,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+func (m *postgresDBRepo) UpdateFrontDeskDetails(id int, roomKey, idDocument string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update reservations set room_key = $1, id_document = $2, updated_at = $3 where id = $4`
+
+	err := m.exec(ctx, stmt, roomKey, idDocument, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
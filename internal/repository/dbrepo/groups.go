@@ -0,0 +1,226 @@
+package dbrepo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// InsertBookingGroup books all of the group's rooms in one transaction and returns the group with its new IDs.
+// The guest's holds on the rooms are used up, as in BookHeldRoom.
+// It returns repository.ErrRoomUnavailable, booking nothing, if any of the rooms has been taken.
+func (m *postgresDBRepo) InsertBookingGroup(g models.BookingGroup, holdIDs []int) (models.BookingGroup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return g, err
+	}
+	defer tx.Rollback()
+
+	stmt := `insert into booking_groups (first_name, last_name, email, phone, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt, g.FirstName, g.LastName, g.Email, g.Phone, time.Now(), time.Now()).Scan(&g.ID)
+	if err != nil {
+		return g, err
+	}
+
+	for _, id := range holdIDs {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where id = $1 and restriction_id = 3`, id)
+		if err != nil {
+			return g, err
+		}
+	}
+
+	// rooms are locked in id order so two group bookings can't deadlock each other
+	g.Reservations = append([]models.Reservation(nil), g.Reservations...)
+	sort.Slice(g.Reservations, func(i, j int) bool {
+		return g.Reservations[i].RoomID < g.Reservations[j].RoomID
+	})
+
+	for i, res := range g.Reservations {
+		_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, res.RoomID)
+		if err != nil {
+			return g, err
+		}
+
+		free, err := roomFreeExcluding(ctx, tx, res.StartDate, res.EndDate, res.RoomID, 0)
+		if err != nil {
+			return g, err
+		}
+		if !free {
+			return g, repository.ErrRoomUnavailable
+		}
+
+		res.GroupID = g.ID
+		res.ID, err = insertReservation(ctx, tx, res)
+		if err != nil {
+			return g, err
+		}
+
+		stmt = `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id)
+			values ($1, $2, $3, $4, $5, $6, 1)`
+
+		_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, res.ID, time.Now(), time.Now())
+		if err != nil {
+			return g, err
+		}
+
+		err = insertOutboxEvent(ctx, tx, events.ReservationCreated{ReservationID: res.ID, Source: events.SourceGroup})
+		if err != nil {
+			return g, err
+		}
+
+		g.Reservations[i] = res
+	}
+
+	return g, tx.Commit()
+}
+
+// GetBookingGroupByID returns the group with its reservations in full, ordered by room
+func (m *postgresDBRepo) GetBookingGroupByID(id int) (models.BookingGroup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var g models.BookingGroup
+
+	query := `select id, first_name, last_name, email, phone, created_at, updated_at from booking_groups where id = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+	)
+	if err != nil {
+		return g, err
+	}
+
+	ids, err := m.groupReservationIDs(ctx, id)
+	if err != nil {
+		return g, err
+	}
+
+	for _, resID := range ids {
+		res, err := m.GetReservationByID(resID)
+		if err != nil {
+			return g, err
+		}
+		g.Reservations = append(g.Reservations, res)
+	}
+
+	return g, nil
+}
+
+func (m *postgresDBRepo) groupReservationIDs(ctx context.Context, groupID int) ([]int, error) {
+	var ids []int
+
+	rows, err := m.DB.QueryContext(ctx, `select id from reservations where group_id = $1 order by room_id, id`, groupID)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return ids, err
+	}
+
+	return ids, nil
+}
+
+// UpdateBookingGroup saves the lead guest's details on the group and on each of its reservations,
+// with an event for each reservation
+func (m *postgresDBRepo) UpdateBookingGroup(g models.BookingGroup) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update booking_groups set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 where id = $6`
+
+	_, err = tx.ExecContext(ctx, stmt, g.FirstName, g.LastName, g.Email, g.Phone, time.Now(), g.ID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 where group_id = $6 returning id`
+
+	rows, err := tx.QueryContext(ctx, stmt, g.FirstName, g.LastName, g.Email, g.Phone, time.Now(), g.ID)
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err = insertOutboxEvent(ctx, tx, events.ReservationModified{ReservationID: id})
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+// ChangeGroupDates moves all the reservations to their new dates and prices together.
+// It returns repository.ErrRoomUnavailable, changing nothing, if any room is taken on the new dates.
+func (m *postgresDBRepo) ChangeGroupDates(reservations []models.Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sorted := make([]models.Reservation, len(reservations))
+	copy(sorted, reservations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].RoomID < sorted[j].RoomID
+	})
+
+	for _, res := range sorted {
+		err = changeReservationDates(ctx, tx, res)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.commit(ctx, tx, 0)
+}
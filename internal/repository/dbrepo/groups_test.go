@@ -0,0 +1,81 @@
+package dbrepo
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+func TestInsertBookingGroup(t *testing.T) {
+	start := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+	anything := anyArg{}
+
+	// the statements that book the room for the group, finding it already has taken nights if taken is 1
+	booked := func(roomID, resID, taken int64) []step {
+		steps := []step{
+			{query: "select id from rooms where id = $1 for update", args: []driver.Value{roomID}},
+			{query: "select count(id) from room_restrictions", args: []driver.Value{roomID, start, end, int64(0), anything},
+				rows: [][]driver.Value{{taken}}},
+		}
+		if taken > 0 {
+			return steps
+		}
+		return append(steps,
+			step{query: "insert into reservations", rows: [][]driver.Value{{resID}}},
+			step{query: "insert into reservation_status_changes", args: []driver.Value{resID, "", models.StatusPending, nil, models.ActorGuest, "", anything, anything}},
+			step{query: "insert into room_restrictions", args: []driver.Value{start, end, roomID, resID, anything, anything}},
+			step{query: "insert into outbox_events", args: []driver.Value{"reservation.created", anything, anything}},
+		)
+	}
+
+	// the rooms are booked in id order once the group is saved and its holds released
+	steps := func(rooms ...[]step) []step {
+		all := []step{
+			{query: "insert into booking_groups", rows: [][]driver.Value{{int64(5)}}},
+			{query: "delete from room_restrictions where id = $1 and restriction_id = 3", args: []driver.Value{int64(11)}},
+			{query: "delete from room_restrictions where id = $1 and restriction_id = 3", args: []driver.Value{int64(12)}},
+		}
+		for _, r := range rooms {
+			all = append(all, r...)
+		}
+		return all
+	}
+
+	tests := []struct {
+		name    string
+		steps   []step
+		wantErr error
+	}{
+		{"every room free", steps(booked(1, 20, 0), booked(3, 21, 0)), nil},
+		{"a room taken", steps(booked(1, 20, 0), booked(3, 0, 1)), repository.ErrRoomUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, db := newScript(t, tt.steps...)
+
+			g, err := m.InsertBookingGroup(models.BookingGroup{FirstName: "Jane", Reservations: []models.Reservation{
+				{RoomID: 3, StartDate: start, EndDate: end},
+				{RoomID: 1, StartDate: start, EndDate: end},
+			}}, []int{11, 12})
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			// nothing is booked unless every room is
+			db.done(tt.wantErr == nil)
+
+			if tt.wantErr == nil {
+				for i, wantID := range []int{20, 21} {
+					if res := g.Reservations[i]; res.ID != wantID || res.GroupID != 5 {
+						t.Errorf("room %d: got reservation %d in group %d, want %d in group 5", res.RoomID, res.ID, res.GroupID, wantID)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// InsertHold holds a room for a guest who is filling in the booking form, until the hold's ExpiresAt.
+// It returns repository.ErrRoomUnavailable if the room is booked, blocked or held by someone else.
+func (m *postgresDBRepo) InsertHold(hold models.RoomRestriction) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// lock the room so two guests can't both hold it
+	_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, hold.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	free, err := roomFreeExcluding(ctx, tx, hold.StartDate, hold.EndDate, hold.RoomID, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !free {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	var newID int
+
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, expires_at, created_at, updated_at)
+		values ($1, $2, $3, 3, $4, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt, hold.StartDate, hold.EndDate, hold.RoomID, hold.ExpiresAt, time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, tx.Commit()
+}
+
+// ExtendHold moves the hold's expiry to hold.ExpiresAt. It reports false, changing nothing,
+// if the hold has already expired or is for another room or other dates.
+func (m *postgresDBRepo) ExtendHold(hold models.RoomRestriction) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update room_restrictions set expires_at = $1, updated_at = $2
+		where id = $3 and restriction_id = 3 and expires_at > $2 and room_id = $4 and start_date = $5 and end_date = $6`
+
+	result, err := m.DB.ExecContext(ctx, stmt, hold.ExpiresAt, time.Now(), hold.ID, hold.RoomID, hold.StartDate, hold.EndDate)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteHold releases a hold, whether or not it has expired
+func (m *postgresDBRepo) DeleteHold(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from room_restrictions where id = $1 and restriction_id = 3`, id)
+
+	return err
+}
+
+// DeleteExpiredHolds removes the holds that expired by now and returns how many there were
+func (m *postgresDBRepo) DeleteExpiredHolds(now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from room_restrictions where restriction_id = 3 and expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// BookHeldRoom inserts the reservation and turns the guest's hold into its room restriction. Only a hold
+// on the reservation's room and dates is used up; any other is left to expire.
+// A hold that has lapsed doesn't matter as long as nobody else took the room in the meantime;
+// if someone did, it returns repository.ErrRoomUnavailable and books nothing.
+// A key with a non-empty Key is recorded against the reservation, and if a reservation was already made with it
+// repository.ErrDuplicateRequest is returned instead, or repository.ErrIdempotencyMismatch if that was a
+// different request.
+func (m *postgresDBRepo) BookHeldRoom(res models.Reservation, holdID int, key models.IdempotencyKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// claiming the key first makes a concurrent request with the same key wait here until this one is done
+	if key.Key != "" {
+		err = claimIdempotencyKey(ctx, tx, key)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	if holdID > 0 {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where id = $1 and restriction_id = 3
+			and room_id = $2 and start_date = $3 and end_date = $4`, holdID, res.RoomID, res.StartDate, res.EndDate)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	free, err := roomFreeExcluding(ctx, tx, res.StartDate, res.EndDate, res.RoomID, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !free {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	newID, err := insertReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id)
+		values ($1, $2, $3, $4, $5, $6, 1)`
+
+	_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, newID, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	if key.Key != "" {
+		_, err = tx.ExecContext(ctx, `update idempotency_keys set reservation_id = $1, updated_at = $2
+			where scope = $3 and idempotency_key = $4`, newID, time.Now(), key.Scope, key.Key)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = insertOutboxEvent(ctx, tx, events.ReservationCreated{ReservationID: newID, Source: events.SourceWebsite})
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, tx.Commit()
+}
@@ -0,0 +1,102 @@
+package dbrepo
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// bookingSteps are the statements with which BookHeldRoom books the reservation as newID once its hold is used up
+func bookingSteps(res models.Reservation, newID int64) []step {
+	anything := anyArg{}
+	return []step{
+		{query: "select count(id) from room_restrictions",
+			args: []driver.Value{int64(res.RoomID), res.StartDate, res.EndDate, int64(0), anything}, rows: [][]driver.Value{{int64(0)}}},
+		{query: "insert into reservations", rows: [][]driver.Value{{newID}}},
+		{query: "insert into reservation_status_changes"},
+		{query: "insert into room_restrictions", args: []driver.Value{res.StartDate, res.EndDate, int64(res.RoomID), newID, anything, anything}},
+	}
+}
+
+func TestBookHeldRoom(t *testing.T) {
+	start := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	res := models.Reservation{FirstName: "Jane", RoomID: 2, StartDate: start, EndDate: start.AddDate(0, 0, 2)}
+	anything := anyArg{}
+
+	lock := step{query: "select id from rooms where id = $1 for update", args: []driver.Value{int64(2)}}
+	useHold := func(found int64) step {
+		return step{query: "delete from room_restrictions where id = $1 and restriction_id = 3",
+			args: []driver.Value{int64(9), int64(2), start, res.EndDate}, affected: found}
+	}
+	created := step{query: "insert into outbox_events", args: []driver.Value{"reservation.created", anything, anything}}
+
+	booked := func(hold step) []step {
+		steps := append([]step{lock, hold}, bookingSteps(res, 30)...)
+		return append(steps, created)
+	}
+
+	tests := []struct {
+		name    string
+		steps   []step
+		wantErr error
+	}{
+		{"hold still held", booked(useHold(1)), nil},
+		// the sweep has deleted the lapsed hold, but nobody took the room meanwhile
+		{"hold expired, room still free", booked(useHold(0)), nil},
+		{
+			name: "hold expired and the room taken",
+			steps: []step{lock, useHold(0),
+				{query: "select count(id) from room_restrictions", rows: [][]driver.Value{{int64(1)}}},
+			},
+			wantErr: repository.ErrRoomUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, db := newScript(t, tt.steps...)
+
+			id, err := m.BookHeldRoom(res, 9, models.IdempotencyKey{})
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && id != 30 {
+				t.Errorf("got reservation %d, want 30", id)
+			}
+
+			db.done(tt.wantErr == nil)
+		})
+	}
+}
+
+// TestExtendHold doesn't bring back a hold that has lapsed
+func TestExtendHold(t *testing.T) {
+	start := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	expires := time.Date(2026, 6, 1, 12, 15, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name     string
+		affected int64
+		want     bool
+	}{
+		{"still held", 1, true},
+		{"expired", 0, false},
+	} {
+		m, db := newScript(t, step{query: "update room_restrictions set expires_at = $1",
+			args:     []driver.Value{expires, anyArg{}, int64(9), int64(2), start, start.AddDate(0, 0, 2)},
+			affected: tt.affected})
+
+		ok, err := m.ExtendHold(models.RoomRestriction{ID: 9, RoomID: 2, StartDate: start, EndDate: start.AddDate(0, 0, 2), ExpiresAt: expires})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s: extended %v, want %v", tt.name, ok, tt.want)
+		}
+
+		db.done(false)
+	}
+}
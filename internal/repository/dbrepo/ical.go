@@ -0,0 +1,163 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// GetCalendarEntries returns the reservations and owner blocks of the room, or of every room when roomID is 0,
+// overlapping start to end, with the guest details of each reservation and the reason for each block
+func (m *postgresDBRepo) GetCalendarEntries(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.RoomRestriction
+
+	query := `
+		select rr.id, rr.restriction_id, coalesce(rr.reservation_id, 0), coalesce(rr.block_id, 0), rr.room_id, rr.start_date, rr.end_date,
+			rr.updated_at, rm.room_name, coalesce(r.first_name, ''), coalesce(r.last_name, ''), coalesce(r.email, ''), coalesce(r.phone, ''),
+			coalesce(r.guests, 0), coalesce(r.status, ''), coalesce(b.reason, '')
+		from room_restrictions rr
+		join rooms rm on rm.id = rr.room_id
+		left join reservations r on r.id = rr.reservation_id
+		left join room_blocks b on b.id = rr.block_id
+		where rr.restriction_id in (1, 2) and $1 < rr.end_date and $2 > rr.start_date and ($3 = 0 or rr.room_id = $3)
+		order by rr.start_date, rm.room_name
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rr models.RoomRestriction
+		err := rows.Scan(
+			&rr.ID,
+			&rr.RestrictionID,
+			&rr.ReservationID,
+			&rr.BlockID,
+			&rr.RoomID,
+			&rr.StartDate,
+			&rr.EndDate,
+			&rr.UpdatedAt,
+			&rr.Room.RoomName,
+			&rr.Reservation.FirstName,
+			&rr.Reservation.LastName,
+			&rr.Reservation.Email,
+			&rr.Reservation.Phone,
+			&rr.Reservation.Guests,
+			&rr.Reservation.Status,
+			&rr.Block.Reason,
+		)
+		if err != nil {
+			return entries, err
+		}
+		rr.Room.ID = rr.RoomID
+		rr.Reservation.ID = rr.ReservationID
+		entries = append(entries, rr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+const calendarFeedColumns = `id, room_id, private, token, created_at, updated_at`
+
+func scanCalendarFeed(row interface{ Scan(...interface{}) error }) (models.CalendarFeed, error) {
+	var f models.CalendarFeed
+
+	err := row.Scan(
+		&f.ID,
+		&f.RoomID,
+		&f.Private,
+		&f.Token,
+		&f.CreatedAt,
+		&f.UpdatedAt,
+	)
+
+	return f, err
+}
+
+// AllCalendarFeeds returns every calendar feed, the feeds for all rooms first
+func (m *postgresDBRepo) AllCalendarFeeds() ([]models.CalendarFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var feeds []models.CalendarFeed
+
+	query := `select ` + calendarFeedColumns + ` from calendar_feeds order by room_id, private`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return feeds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f, err := scanCalendarFeed(rows)
+		if err != nil {
+			return feeds, err
+		}
+		feeds = append(feeds, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return feeds, err
+	}
+
+	return feeds, nil
+}
+
+func (m *postgresDBRepo) GetCalendarFeedByID(id int) (models.CalendarFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + calendarFeedColumns + ` from calendar_feeds where id = $1`
+
+	return scanCalendarFeed(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetCalendarFeedByToken returns the feed whose link has the token, or sql.ErrNoRows once the token has been changed
+func (m *postgresDBRepo) GetCalendarFeedByToken(token string) (models.CalendarFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + calendarFeedColumns + ` from calendar_feeds where token = $1`
+
+	return scanCalendarFeed(m.DB.QueryRowContext(ctx, query, token))
+}
+
+// InsertCalendarFeed adds the feed unless the room already has one of the same kind, made in the meantime
+func (m *postgresDBRepo) InsertCalendarFeed(f models.CalendarFeed) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into calendar_feeds (room_id, private, token, created_at, updated_at)
+		values ($1, $2, $3, $4, $5)
+		on conflict (room_id, private) do nothing
+	`
+
+	_, err := m.DB.ExecContext(ctx, stmt, f.RoomID, f.Private, f.Token, time.Now(), time.Now())
+
+	return err
+}
+
+// UpdateCalendarFeedToken gives the feed a new token, so the link made from the old one stops working
+func (m *postgresDBRepo) UpdateCalendarFeedToken(id int, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update calendar_feeds set token = $1, updated_at = $2 where id = $3`
+
+	_, err := m.DB.ExecContext(ctx, stmt, token, time.Now(), id)
+
+	return err
+}
@@ -0,0 +1,87 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// GetIdempotentReservationID returns the reservation made by the request with the key, or sql.ErrNoRows
+// if no request with it has been processed. It returns repository.ErrIdempotencyMismatch if the key
+// was used for a different request.
+func (m *postgresDBRepo) GetIdempotentReservationID(key models.IdempotencyKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	var hash string
+
+	query := `select reservation_id, request_hash from idempotency_keys
+		where scope = $1 and idempotency_key = $2 and reservation_id is not null`
+
+	err := m.DB.QueryRowContext(ctx, query, key.Scope, key.Key).Scan(&id, &hash)
+	if err != nil {
+		return 0, err
+	}
+	if hash != key.RequestHash {
+		return 0, repository.ErrIdempotencyMismatch
+	}
+
+	return id, nil
+}
+
+// DeleteIdempotencyKeys forgets the keys claimed before the time, after which a request with one of them
+// is treated as new. It returns how many were deleted.
+func (m *postgresDBRepo) DeleteIdempotencyKeys(before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from idempotency_keys where created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// claimIdempotencyKey records the key against a request being processed in tx. A concurrent request with the
+// same key waits on the insert until tx is done. It returns repository.ErrDuplicateRequest if the request has
+// already been processed, or repository.ErrIdempotencyMismatch if the key was used for a different one.
+func claimIdempotencyKey(ctx context.Context, tx *sql.Tx, key models.IdempotencyKey) error {
+	stmt := `insert into idempotency_keys (scope, idempotency_key, request_hash, created_at, updated_at)
+		values ($1, $2, $3, $4, $5)
+		on conflict (scope, idempotency_key) do nothing`
+
+	result, err := tx.ExecContext(ctx, stmt, key.Scope, key.Key, key.RequestHash, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	var hash string
+	err = tx.QueryRowContext(ctx, `select request_hash from idempotency_keys where scope = $1 and idempotency_key = $2`,
+		key.Scope, key.Key).Scan(&hash)
+	if err != nil {
+		return err
+	}
+	if hash != key.RequestHash {
+		return repository.ErrIdempotencyMismatch
+	}
+
+	return repository.ErrDuplicateRequest
+}
@@ -0,0 +1,86 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// TestBookHeldRoomIdempotent books once per key: a replay of the request finds it booked, and a different
+// request with the same key is refused
+func TestBookHeldRoomIdempotent(t *testing.T) {
+	start := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	res := models.Reservation{FirstName: "Jane", RoomID: 2, StartDate: start, EndDate: start.AddDate(0, 0, 2)}
+	key := models.IdempotencyKey{Scope: "reservation", Key: "k-1", RequestHash: "abc"}
+	anything := anyArg{}
+
+	claim := func(claimed int64) step {
+		return step{query: "insert into idempotency_keys", args: []driver.Value{"reservation", "k-1", "abc", anything, anything}, affected: claimed}
+	}
+	claimedBy := func(hash string) step {
+		return step{query: "select request_hash from idempotency_keys", args: []driver.Value{"reservation", "k-1"},
+			rows: [][]driver.Value{{hash}}}
+	}
+
+	first := []step{claim(1), {query: "select id from rooms where id = $1 for update"}}
+	first = append(first, bookingSteps(res, 30)...)
+	first = append(first,
+		step{query: "update idempotency_keys set reservation_id = $1", args: []driver.Value{int64(30), anything, "reservation", "k-1"}},
+		step{query: "insert into outbox_events"},
+	)
+
+	tests := []struct {
+		name    string
+		steps   []step
+		wantErr error
+	}{
+		{"first request", first, nil},
+		{"replayed", []step{claim(0), claimedBy("abc")}, repository.ErrDuplicateRequest},
+		{"key reused for a different request", []step{claim(0), claimedBy("xyz")}, repository.ErrIdempotencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, db := newScript(t, tt.steps...)
+
+			_, err := m.BookHeldRoom(res, 0, key)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			// a repeated request books nothing
+			db.done(tt.wantErr == nil)
+		})
+	}
+}
+
+func TestGetIdempotentReservationID(t *testing.T) {
+	key := models.IdempotencyKey{Scope: "reservation", Key: "k-1", RequestHash: "abc"}
+
+	tests := []struct {
+		name    string
+		rows    [][]driver.Value
+		wantID  int
+		wantErr error
+	}{
+		{"made by this request", [][]driver.Value{{int64(30), "abc"}}, 30, nil},
+		{"made by a different request", [][]driver.Value{{int64(30), "xyz"}}, 0, repository.ErrIdempotencyMismatch},
+		{"not made yet", nil, 0, sql.ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		m, db := newScript(t, step{query: "select reservation_id, request_hash from idempotency_keys",
+			args: []driver.Value{"reservation", "k-1"}, rows: tt.rows})
+
+		id, err := m.GetIdempotentReservationID(key)
+		if err != tt.wantErr || id != tt.wantID {
+			t.Errorf("%s: got %d, %v, want %d, %v", tt.name, id, err, tt.wantID, tt.wantErr)
+		}
+
+		db.done(false)
+	}
+}
@@ -0,0 +1,127 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// GetInvoiceForReservation returns the reservation's invoice with the folio it was issued for,
+// or sql.ErrNoRows if none has been issued
+func (m *postgresDBRepo) GetInvoiceForReservation(reservationID int) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var inv models.Invoice
+
+	query := `select id, reservation_id, number, issued_at, charges, paid, balance, created_at, updated_at
+		from invoices where reservation_id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, reservationID)
+	err := row.Scan(
+		&inv.ID,
+		&inv.ReservationID,
+		&inv.Number,
+		&inv.IssuedAt,
+		&inv.Folio.Charges,
+		&inv.Folio.Paid,
+		&inv.Folio.Balance,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+	if err != nil {
+		return inv, err
+	}
+
+	query = `select line_date, description, quantity, amount, credit from invoice_lines where invoice_id = $1 order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query, inv.ID)
+	if err != nil {
+		return inv, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.FolioLine
+		err := rows.Scan(
+			&l.Date,
+			&l.Description,
+			&l.Quantity,
+			&l.Amount,
+			&l.Credit,
+		)
+		if err != nil {
+			return inv, err
+		}
+		inv.Folio.Lines = append(inv.Folio.Lines, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return inv, err
+	}
+
+	return inv, nil
+}
+
+// IssueInvoice gives the reservation the next invoice number and stores the folio as invoiced.
+// If the reservation already has an invoice nothing is issued and the existing one is returned.
+// The table is locked while numbering so numbers stay sequential without gaps.
+func (m *postgresDBRepo) IssueInvoice(reservationID int, f models.Folio) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `lock table invoices in share row exclusive mode`)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+
+	var existing int
+	err = tx.QueryRowContext(ctx, `select id from invoices where reservation_id = $1`, reservationID).Scan(&existing)
+	if err == nil {
+		tx.Rollback()
+		return m.GetInvoiceForReservation(reservationID)
+	} else if err != sql.ErrNoRows {
+		return models.Invoice{}, err
+	}
+
+	inv := models.Invoice{ReservationID: reservationID, Folio: f}
+
+	err = tx.QueryRowContext(ctx, `select coalesce(max(number), 0) + 1 from invoices`).Scan(&inv.Number)
+	if err != nil {
+		return inv, err
+	}
+
+	inv.IssuedAt = time.Now()
+	inv.CreatedAt = inv.IssuedAt
+	inv.UpdatedAt = inv.IssuedAt
+
+	stmt := `insert into invoices (reservation_id, number, issued_at, charges, paid, balance, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+	err = tx.QueryRowContext(ctx, stmt, reservationID, inv.Number, inv.IssuedAt, f.Charges, f.Paid, f.Balance, inv.CreatedAt, inv.UpdatedAt).Scan(&inv.ID)
+	if err != nil {
+		return inv, err
+	}
+
+	stmt = `insert into invoice_lines (invoice_id, line_date, description, quantity, amount, credit, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`
+	for _, l := range f.Lines {
+		_, err = tx.ExecContext(ctx, stmt, inv.ID, l.Date, l.Description, l.Quantity, l.Amount, l.Credit, time.Now(), time.Now())
+		if err != nil {
+			return inv, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return inv, err
+	}
+
+	return inv, nil
+}
@@ -0,0 +1,155 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// MoveReservationRoom moves the reservation's nights from move.MoveDate onwards to move.ToRoomID and logs the move.
+// Nights before MoveDate keep their restriction on the rooms they were in, so a mid-stay move splits the stay.
+// It returns repository.ErrRoomUnavailable if the new room is taken for any of the moved nights.
+func (m *postgresDBRepo) MoveReservationRoom(move models.RoomMove) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var start, end time.Time
+	err = tx.QueryRowContext(ctx, `select start_date, end_date, room_id from reservations where id = $1 for update`, move.ReservationID).
+		Scan(&start, &end, &move.FromRoomID)
+	if err != nil {
+		return err
+	}
+
+	if move.MoveDate.Before(start) || !move.MoveDate.Before(end) {
+		return fmt.Errorf("move date %s is outside the stay", move.MoveDate.Format("2006-01-02"))
+	}
+
+	// lock the room so a booking can't take it between the check and the move
+	_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, move.ToRoomID)
+	if err != nil {
+		return err
+	}
+
+	free, err := roomFreeExcluding(ctx, tx, move.MoveDate, end, move.ToRoomID, move.ReservationID)
+	if err != nil {
+		return err
+	}
+	if !free {
+		return repository.ErrRoomUnavailable
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1 and restriction_id = 1 and start_date >= $2`,
+		move.ReservationID, move.MoveDate)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update room_restrictions set end_date = $1, updated_at = $2
+		where reservation_id = $3 and restriction_id = 1 and start_date < $1 and end_date > $1`,
+		move.MoveDate, time.Now(), move.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id)
+		values ($1, $2, $3, $4, $5, $6, 1)`
+
+	_, err = tx.ExecContext(ctx, stmt, move.MoveDate, end, move.ToRoomID, move.ReservationID, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set room_id = $1, updated_at = $2 where id = $3`,
+		move.ToRoomID, time.Now(), move.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `insert into room_moves (reservation_id, from_room_id, to_room_id, move_date, user_id, reason, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		move.ReservationID,
+		move.FromRoomID,
+		move.ToRoomID,
+		move.MoveDate,
+		nullableID(move.UserID),
+		move.Reason,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = insertOutboxEvent(ctx, tx, events.ReservationModified{ReservationID: move.ReservationID})
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+// GetRoomMoves returns the room moves made for a reservation, oldest first
+func (m *postgresDBRepo) GetRoomMoves(reservationID int) ([]models.RoomMove, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var moves []models.RoomMove
+
+	query := `
+		select mv.id, mv.reservation_id, mv.from_room_id, mv.to_room_id, mv.move_date, coalesce(mv.user_id, 0),
+		coalesce(u.first_name || ' ' || u.last_name, ''), mv.reason, mv.created_at, f.room_name, t.room_name
+		from room_moves mv
+		left join rooms f on (mv.from_room_id = f.id)
+		left join rooms t on (mv.to_room_id = t.id)
+		left join users u on (mv.user_id = u.id)
+		where mv.reservation_id = $1
+		order by mv.created_at, mv.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return moves, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mv models.RoomMove
+		err := rows.Scan(
+			&mv.ID,
+			&mv.ReservationID,
+			&mv.FromRoomID,
+			&mv.ToRoomID,
+			&mv.MoveDate,
+			&mv.UserID,
+			&mv.Actor,
+			&mv.Reason,
+			&mv.CreatedAt,
+			&mv.FromRoom.RoomName,
+			&mv.ToRoom.RoomName,
+		)
+		if err != nil {
+			return moves, err
+		}
+		mv.FromRoom.ID = mv.FromRoomID
+		mv.ToRoom.ID = mv.ToRoomID
+		moves = append(moves, mv)
+	}
+
+	if err = rows.Err(); err != nil {
+		return moves, err
+	}
+
+	return moves, nil
+}
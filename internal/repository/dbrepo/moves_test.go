@@ -0,0 +1,92 @@
+package dbrepo
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+func TestMoveReservationRoom(t *testing.T) {
+	start := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 3)
+	now := anyArg{}
+
+	// the statements of a move from room 1 to room 2 on from, splitting the restriction there if it is mid-stay
+	moved := func(from time.Time, split int64) []step {
+		return []step{
+			{query: "select start_date, end_date, room_id from reservations", args: []driver.Value{int64(7)},
+				rows: [][]driver.Value{{start, end, int64(1)}}},
+			{query: "select id from rooms where id = $1 for update", args: []driver.Value{int64(2)}},
+			{query: "select count(id) from room_restrictions", args: []driver.Value{int64(2), from, end, int64(7), now},
+				rows: [][]driver.Value{{int64(0)}}},
+			{query: "delete from room_restrictions where reservation_id = $1 and restriction_id = 1 and start_date >= $2",
+				args: []driver.Value{int64(7), from}},
+			{query: "update room_restrictions set end_date = $1", args: []driver.Value{from, now, int64(7)}, affected: split},
+			{query: "insert into room_restrictions", args: []driver.Value{from, end, int64(2), int64(7), now, now}},
+			{query: "update reservations set room_id = $1", args: []driver.Value{int64(2), now, int64(7)}},
+			{query: "insert into room_moves", args: []driver.Value{int64(7), int64(1), int64(2), from, int64(3), "Leaking tap", now, now}},
+			{query: "insert into outbox_events", args: []driver.Value{"reservation.modified", now, now}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		from    time.Time
+		steps   []step
+		wantErr error
+	}{
+		{
+			// every night moves, so the old restriction is deleted and none is left to shorten
+			name:  "on the arrival date",
+			from:  start,
+			steps: moved(start, 0),
+		},
+		{
+			// the old restriction is cut short at the move date and the new room takes the rest
+			name:  "mid-stay",
+			from:  start.AddDate(0, 0, 1),
+			steps: moved(start.AddDate(0, 0, 1), 1),
+		},
+		{
+			name: "to an occupied room",
+			from: start.AddDate(0, 0, 1),
+			steps: []step{
+				{query: "select start_date, end_date, room_id from reservations", rows: [][]driver.Value{{start, end, int64(1)}}},
+				{query: "select id from rooms where id = $1 for update"},
+				{query: "select count(id) from room_restrictions", rows: [][]driver.Value{{int64(1)}}},
+			},
+			wantErr: repository.ErrRoomUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, db := newScript(t, tt.steps...)
+
+			err := m.MoveReservationRoom(models.RoomMove{ReservationID: 7, ToRoomID: 2, MoveDate: tt.from, UserID: 3, Reason: "Leaking tap"})
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			db.done(tt.wantErr == nil)
+		})
+	}
+}
+
+func TestMoveReservationRoomOutsideTheStay(t *testing.T) {
+	start := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	m, db := newScript(t, step{query: "select start_date, end_date, room_id from reservations",
+		rows: [][]driver.Value{{start, start.AddDate(0, 0, 3), int64(1)}}})
+
+	// departure day isn't a night of the stay
+	err := m.MoveReservationRoom(models.RoomMove{ReservationID: 7, ToRoomID: 2, MoveDate: start.AddDate(0, 0, 3)})
+	if err == nil {
+		t.Fatal("moved the stay from its departure day")
+	}
+
+	db.done(false)
+}
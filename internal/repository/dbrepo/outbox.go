@@ -0,0 +1,120 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// insertOutboxEvent saves the event to be published once tx is committed
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, e events.Event) error {
+	payload, err := events.Encode(e)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into outbox_events (event, payload, next_attempt_at, created_at, updated_at) values ($1, $2, $3, $3, $3)`
+
+	_, err = tx.ExecContext(ctx, stmt, e.Name(), payload, time.Now())
+
+	return err
+}
+
+// InsertOutboxEvent saves an event that goes with no other change
+func (m *postgresDBRepo) InsertOutboxEvent(e events.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertOutboxEvent(ctx, tx, e)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DueEvents returns the events in the outbox not yet published that are due to be, in the order they were saved
+func (m *postgresDBRepo) DueEvents(now time.Time, limit int) ([]models.OutboxEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var pending []models.OutboxEvent
+
+	query := `
+		select o.id, o.event, o.payload, o.attempts, o.last_error, o.created_at,
+		coalesce((select string_agg(d.subscriber, ',') from outbox_deliveries d where d.outbox_event_id = o.id), '')
+		from outbox_events o
+		where o.published_at is null and o.next_attempt_at <= $1
+		order by o.id
+		limit $2`
+
+	rows, err := m.DB.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return pending, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o models.OutboxEvent
+		var delivered string
+		err = rows.Scan(&o.ID, &o.Event, &o.Payload, &o.Attempts, &o.LastError, &o.CreatedAt, &delivered)
+		if err != nil {
+			return pending, err
+		}
+		if delivered != "" {
+			o.Delivered = strings.Split(delivered, ",")
+		}
+		pending = append(pending, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return pending, err
+	}
+
+	return pending, nil
+}
+
+// MarkEventDelivered records that the subscriber has handled the event
+func (m *postgresDBRepo) MarkEventDelivered(id int, subscriber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into outbox_deliveries (outbox_event_id, subscriber, created_at, updated_at) values ($1, $2, $3, $3)
+		on conflict (outbox_event_id, subscriber) do nothing`
+
+	_, err := m.DB.ExecContext(ctx, stmt, id, subscriber, time.Now())
+
+	return err
+}
+
+func (m *postgresDBRepo) MarkEventPublished(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update outbox_events set published_at = $1, next_attempt_at = null, updated_at = $1 where id = $2`, time.Now(), id)
+
+	return err
+}
+
+// UpdateOutboxEvent saves how the latest attempt at publishing the event went and when to try again,
+// if at all
+func (m *postgresDBRepo) UpdateOutboxEvent(o models.OutboxEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update outbox_events set attempts = $1, last_error = $2, next_attempt_at = $3, updated_at = $4 where id = $5`
+
+	_, err := m.DB.ExecContext(ctx, stmt, o.Attempts, o.LastError, nullableDate(o.NextAttemptAt), time.Now(), o.ID)
+
+	return err
+}
@@ -0,0 +1,323 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/payments"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+func (m *postgresDBRepo) UpdatePayment(p models.Payment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update payments set refunded_amount = $1, status = $2, gateway_ref = $3, message = $4, updated_at = $5 where id = $6`
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, stmt, p.RefundedAmount, p.Status, p.GatewayRef, p.Message, time.Now(), p.ID)
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+func (m *postgresDBRepo) GetPaymentByID(id int) (models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p models.Payment
+
+	query := `select id, reservation_id, amount, refunded_amount, currency, status, gateway_ref, card_last4, message, created_at, updated_at
+		from payments where id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&p.ID,
+		&p.ReservationID,
+		&p.Amount,
+		&p.RefundedAmount,
+		&p.Currency,
+		&p.Status,
+		&p.GatewayRef,
+		&p.CardLast4,
+		&p.Message,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (m *postgresDBRepo) GetPaymentsForReservation(reservationID int) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var payments []models.Payment
+
+	query := `select id, reservation_id, amount, refunded_amount, currency, status, gateway_ref, card_last4, message, created_at, updated_at
+		from payments where reservation_id = $1 order by created_at`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Payment
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.Amount,
+			&p.RefundedAmount,
+			&p.Currency,
+			&p.Status,
+			&p.GatewayRef,
+			&p.CardLast4,
+			&p.Message,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return payments, err
+	}
+
+	return payments, nil
+}
+
+// InsertDepositPayment records a payment about to be taken towards a reservation's deposit.
+// The reservation is locked while the payment is inserted, so it can't be cancelled as unpaid at the same time.
+// It returns repository.ErrStatusChanged if the reservation has been cancelled or its stay is over.
+func (m *postgresDBRepo) InsertDepositPayment(p models.Payment) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, `select status from reservations where id = $1 for update`, p.ReservationID).Scan(&status)
+	if err != nil {
+		return 0, err
+	}
+	if status != models.StatusPending && status != models.StatusConfirmed && status != models.StatusCheckedIn {
+		return 0, repository.ErrStatusChanged
+	}
+
+	newID, err := insertPayment(ctx, tx, p)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, tx.Commit()
+}
+
+// InsertDeskPayment records money taken at the front desk. paidBefore is what the clerk saw had been paid
+// when they took it: if more has been paid since, most likely the same payment submitted twice, nothing is
+// recorded and repository.ErrDuplicateRequest is returned. It returns repository.ErrStatusChanged if the
+// reservation has been cancelled or marked a no-show.
+func (m *postgresDBRepo) InsertDeskPayment(p models.Payment, paidBefore int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, `select status from reservations where id = $1 for update`, p.ReservationID).Scan(&status)
+	if err != nil {
+		return 0, err
+	}
+	if status == models.StatusCancelled || status == models.StatusNoShow {
+		return 0, repository.ErrStatusChanged
+	}
+
+	var paid int
+	query := `select coalesce(sum(amount - refunded_amount), 0) from payments where reservation_id = $1 and status in ($2, $3)`
+	err = tx.QueryRowContext(ctx, query, p.ReservationID, models.PaymentCaptured, models.PaymentRefunded).Scan(&paid)
+	if err != nil {
+		return 0, err
+	}
+	if paid != paidBefore {
+		return 0, repository.ErrDuplicateRequest
+	}
+
+	newID, err := insertPayment(ctx, tx, p)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.commit(ctx, tx, newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// AmountsPaid returns what has been taken and not refunded for each of the reservations, by reservation id
+func (m *postgresDBRepo) AmountsPaid(reservationIDs []int) (map[int]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	paid := make(map[int]int)
+
+	query := `
+		select reservation_id, sum(amount - refunded_amount)
+		from payments
+		where reservation_id = any($1) and status in ($2, $3)
+		group by reservation_id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationIDs, models.PaymentCaptured, models.PaymentRefunded)
+	if err != nil {
+		return paid, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, amount int
+		err := rows.Scan(&id, &amount)
+		if err != nil {
+			return paid, err
+		}
+		paid[id] = amount
+	}
+
+	if err = rows.Err(); err != nil {
+		return paid, err
+	}
+
+	return paid, nil
+}
+
+func insertPayment(ctx context.Context, tx *sql.Tx, p models.Payment) (int, error) {
+	var newID int
+
+	stmt := `insert into payments (reservation_id, amount, refunded_amount, currency, status, gateway_ref, card_last4, message, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err := tx.QueryRowContext(ctx, stmt,
+		p.ReservationID,
+		p.Amount,
+		p.RefundedAmount,
+		p.Currency,
+		p.Status,
+		p.GatewayRef,
+		p.CardLast4,
+		p.Message,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	return newID, err
+}
+
+// CancelUnpaidReservations cancels the pending reservations whose deposit was due by now and has not
+// been paid, releasing their rooms. A reservation with a payment in progress or taken is left alone,
+// but a payment still pending after payments.Timeout never got an answer from the gateway: it is marked
+// failed and the reservation cancelled. It returns how many were cancelled.
+func (m *postgresDBRepo) CancelUnpaidReservations(now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// reservations being paid for right now are locked by InsertDepositPayment and skipped until the next sweep
+	query := `
+		select r.id from reservations r
+		where r.status = $1 and r.payment_due_by <= $2
+		and not exists (
+			select 1 from payments p where p.reservation_id = r.id
+			and (p.status in ($3, $4) or (p.status = $5 and p.created_at > $6))
+		)
+		for update skip locked
+	`
+
+	rows, err := tx.QueryContext(ctx, query, models.StatusPending, now, models.PaymentAuthorized, models.PaymentCaptured,
+		models.PaymentPending, now.Add(-payments.Timeout))
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		// nothing was authorized on a payment without an answer, so there is nothing to void
+		_, err = tx.ExecContext(ctx, `update payments set status = $1, message = $2, updated_at = $3 where reservation_id = $4 and status = $5`,
+			models.PaymentFailed, "No answer from the payment gateway", time.Now(), id, models.PaymentPending)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, `update reservations set status = $1, updated_at = $2 where id = $3`, models.StatusCancelled, time.Now(), id)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+		if err != nil {
+			return 0, err
+		}
+
+		err = insertStatusChange(ctx, tx, models.ReservationStatusChange{
+			ReservationID: id,
+			FromStatus:    models.StatusPending,
+			ToStatus:      models.StatusCancelled,
+			Actor:         models.ActorSystem,
+			Note:          "Deposit was not paid in time",
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		err = insertOutboxEvent(ctx, tx, events.ReservationCancelled{ReservationID: id, Actor: models.ActorSystem})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(ids), tx.Commit()
+}
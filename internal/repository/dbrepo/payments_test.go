@@ -0,0 +1,38 @@
+package dbrepo
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/payments"
+)
+
+func TestCancelUnpaidReservations(t *testing.T) {
+	now := time.Date(2026, 6, 10, 12, 0, 0, 0, time.UTC)
+	anything := anyArg{}
+
+	// reservation 9 has a deposit payment that never got an answer from the gateway
+	m, db := newScript(t,
+		step{query: "select r.id from reservations r",
+			args: []driver.Value{models.StatusPending, now, models.PaymentAuthorized, models.PaymentCaptured, models.PaymentPending, now.Add(-payments.Timeout)},
+			rows: [][]driver.Value{{int64(9)}}},
+		step{query: "update payments set status = $1", args: []driver.Value{models.PaymentFailed, anything, anything, int64(9), models.PaymentPending}, affected: 1},
+		step{query: "update reservations set status = $1", args: []driver.Value{models.StatusCancelled, anything, int64(9)}},
+		step{query: "delete from room_restrictions where reservation_id = $1", args: []driver.Value{int64(9)}},
+		step{query: "insert into reservation_status_changes",
+			args: []driver.Value{int64(9), models.StatusPending, models.StatusCancelled, nil, models.ActorSystem, anything, anything, anything}},
+		step{query: "insert into outbox_events", args: []driver.Value{"reservation.cancelled", anything, anything}},
+	)
+
+	cancelled, err := m.CancelUnpaidReservations(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled != 1 {
+		t.Errorf("cancelled %d reservations, want 1", cancelled)
+	}
+
+	db.done(true)
+}
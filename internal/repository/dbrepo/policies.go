@@ -0,0 +1,139 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+func (m *postgresDBRepo) AllPolicies() ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var policies []models.CancellationPolicy
+
+	query := `select id, name, free_cancellation_days, penalty_percent, non_refundable, deposit_percent, balance_due_days, created_at, updated_at
+		from cancellation_policies order by name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.CancellationPolicy
+		err := rows.Scan(
+			&p.ID,
+			&p.Name,
+			&p.FreeCancellationDays,
+			&p.PenaltyPercent,
+			&p.NonRefundable,
+			&p.DepositPercent,
+			&p.BalanceDueDays,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return policies, err
+		}
+		policies = append(policies, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return policies, err
+	}
+
+	return policies, nil
+}
+
+func (m *postgresDBRepo) GetPolicyByID(id int) (models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p models.CancellationPolicy
+
+	query := `select id, name, free_cancellation_days, penalty_percent, non_refundable, deposit_percent, balance_due_days, created_at, updated_at
+		from cancellation_policies where id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.FreeCancellationDays,
+		&p.PenaltyPercent,
+		&p.NonRefundable,
+		&p.DepositPercent,
+		&p.BalanceDueDays,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (m *postgresDBRepo) InsertPolicy(p models.CancellationPolicy) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into cancellation_policies (name, free_cancellation_days, penalty_percent, non_refundable, deposit_percent, balance_due_days, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	newID, err := m.insert(ctx, stmt,
+		p.Name,
+		p.FreeCancellationDays,
+		p.PenaltyPercent,
+		p.NonRefundable,
+		p.DepositPercent,
+		p.BalanceDueDays,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) UpdatePolicy(p models.CancellationPolicy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update cancellation_policies set name = $1, free_cancellation_days = $2, penalty_percent = $3, non_refundable = $4,
+		deposit_percent = $5, balance_due_days = $6, updated_at = $7 where id = $8`
+
+	err := m.exec(ctx, stmt,
+		p.Name,
+		p.FreeCancellationDays,
+		p.PenaltyPercent,
+		p.NonRefundable,
+		p.DepositPercent,
+		p.BalanceDueDays,
+		time.Now(),
+		p.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) UpdateRoomPolicy(id, policyID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update rooms set policy_id = $1, updated_at = $2 where id = $3`
+
+	err := m.exec(ctx, stmt, nullableID(policyID), time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
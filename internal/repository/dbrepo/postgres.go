@@ -2,11 +2,13 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"fmt"
 	"time"
 
+	"github.com/NganJason/hotel-booking/internal/events"
 	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -14,15 +16,22 @@ func (m *postgresDBRepo) AllUsers() bool {
 	return true
 }
 
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// insertReservation redeems the reservation's promotion and inserts it with its extras, taxes and first status change
+func insertReservation(ctx context.Context, tx *sql.Tx, res models.Reservation) (int, error) {
+	if res.PromotionID > 0 {
+		err := redeemPromotion(ctx, tx, res.PromotionID)
+		if err != nil {
+			return 0, err
+		}
+	}
 
 	var newID int
 	
-	stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+	stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, promotion_id, promo_code, guests, subtotal, discount, extras_total, tax_total, total,
+		policy_id, policy_name, free_cancellation_days, penalty_percent, non_refundable, deposit_percent, balance_due_days, status, group_id, payment_due_by, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27) returning id`
 
-	err := m.DB.QueryRowContext(ctx, stmt,
+	err := tx.QueryRowContext(ctx, stmt,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -30,6 +39,24 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		nullableID(res.PromotionID),
+		res.PromoCode,
+		res.Guests,
+		res.Subtotal,
+		res.Discount,
+		res.ExtrasTotal,
+		res.TaxTotal,
+		res.Total,
+		nullableID(res.Policy.ID),
+		res.Policy.Name,
+		res.Policy.FreeCancellationDays,
+		res.Policy.PenaltyPercent,
+		res.Policy.NonRefundable,
+		res.Policy.DepositPercent,
+		res.Policy.BalanceDueDays,
+		models.StatusPending,
+		nullableID(res.GroupID),
+		nullableDate(res.PaymentDueBy),
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -38,23 +65,26 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		return 0, err
 	}
 
-	return newID, nil
-}
-
-func (m *postgresDBRepo) InsertRoomRestriction(res models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-	defer cancel()
-
-	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id) values ($1, $2, $3, $4, $5, $6, $7)`
+	err = insertStatusChange(ctx, tx, models.ReservationStatusChange{
+		ReservationID: newID,
+		ToStatus: models.StatusPending,
+		Actor: models.ActorGuest,
+	})
+	if err != nil {
+		return 0, err
+	}
 
-	_, err := m.DB.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, res.ReservationID, time.Now(), time.Now(), res.RestrictionID)
+	err = insertReservationExtras(ctx, tx, newID, res.Extras)
+	if err != nil {
+		return 0, err
+	}
 
+	err = insertReservationTaxes(ctx, tx, newID, res.Taxes)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return newID, nil
 }
 
 func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
@@ -69,12 +99,13 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 			room_restrictions
 		where
 			room_id = $1
-			and $2 < end_date and $3 > start_date;
+			and $2 < end_date and $3 > start_date
+			and (expires_at is null or expires_at > $4);
 	`
 
 	var numRows int
 
-	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
+	row := m.DB.QueryRowContext(ctx, query, roomID, start, end, time.Now())
 
 	err:= row.Scan(&numRows)
 	if err != nil {
@@ -94,7 +125,7 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 
 	query := `
 		select
-			r.id, r.room_name
+			r.id, r.room_name, r.price, r.max_guests
 		from
 			rooms r
 		where r.id not in
@@ -105,12 +136,13 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 					room_restrictions rr 
 				where 
 					$1 < rr.end_date and 
-					$2 > rr.start_date
+					$2 > rr.start_date and
+					(rr.expires_at is null or rr.expires_at > $3)
 			)
 	`
 	var rooms []models.Room
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	rows, err := m.DB.QueryContext(ctx, query, start, end, time.Now())
 
 	if err != nil {
 		return rooms, err
@@ -118,7 +150,7 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 
 	for rows.Next(){
 		var room models.Room
-		err := rows.Scan(&room.ID, &room.RoomName)
+		err := rows.Scan(&room.ID, &room.RoomName, &room.Price, &room.MaxGuests)
 		if err != nil {
 			return rooms, err
 		}
@@ -138,11 +170,11 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 
 	var room models.Room
 	query := `
-		select id, room_name, created_at, updated_at from rooms where id = $1
+		select id, room_name, price, coalesce(policy_id, 0), max_guests, created_at, updated_at from rooms where id = $1
 	`
 
 	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt)
+	err := row.Scan(&room.ID, &room.RoomName, &room.Price, &room.PolicyID, &room.MaxGuests, &room.CreatedAt, &room.UpdatedAt)
 
 	if err != nil {
 		return room, err
@@ -178,6 +210,45 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 	return u, nil
 }
 
+// ListUsers returns every staff user, by name, without their password hashes
+func (m *postgresDBRepo) ListUsers() ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var users []models.User
+
+	query := `select id, first_name, last_name, email, access_level, created_at, updated_at from users order by first_name, last_name, id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		err = rows.Scan(
+			&u.ID,
+			&u.FirstName,
+			&u.LastName,
+			&u.Email,
+			&u.AccessLevel,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+		)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
 func (m *postgresDBRepo) UpdateUser(u models.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -225,10 +296,11 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 
 	query := `
 		select 
-		r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, rm.id, rm.room_name
+		r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.status, r.promo_code, r.total, r.created_at, r.updated_at, rm.id, rm.room_name,
+		coalesce(r.group_id, 0)
 		from reservations r 
 		left join rooms rm on (r.room_id = rm.id) 
-		order by r.start_date asc
+		order by r.start_date asc, r.group_id, r.id
 	`
 
 	rows, err := m.DB.QueryContext(ctx, query)
@@ -248,10 +320,14 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
+			&i.Status,
+			&i.PromoCode,
+			&i.Total,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Room.ID,
 			&i.Room.RoomName,
+			&i.GroupID,
 		)
 
 		if err != nil {
@@ -276,11 +352,12 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 
 	query := `
 		select 
-		r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.processed, r.created_at, r.updated_at, rm.id, rm.room_name
+		r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.status, r.created_at, r.updated_at, rm.id, rm.room_name,
+		coalesce(r.group_id, 0)
 		from reservations r 
 		left join rooms rm on (r.room_id = rm.id) 
-		where processed = 0
-		order by r.start_date asc
+		where r.status = 'pending'
+		order by r.start_date asc, r.group_id, r.id
 	`
 
 	rows, err := m.DB.QueryContext(ctx, query)
@@ -300,11 +377,12 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
-			&i.Processed,
+			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Room.ID,
 			&i.Room.RoomName,
+			&i.GroupID,
 		)
 
 		if err != nil {
@@ -328,7 +406,10 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 	var res models.Reservation
 
 	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name 
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.status,
+		coalesce(r.promotion_id, 0), r.promo_code, r.guests, r.subtotal, r.discount, r.extras_total, r.tax_total, r.total, rm.id, rm.room_name,
+		coalesce(r.policy_id, 0), r.policy_name, r.free_cancellation_days, r.penalty_percent, r.non_refundable, r.deposit_percent, r.balance_due_days,
+		r.room_key, r.id_document, coalesce(r.group_id, 0), r.manage_link_version
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
 		where r.id = $1
@@ -346,60 +427,100 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.RoomID,
 		&res.CreatedAt,
 		&res.UpdatedAt,
-		&res.Processed,
+		&res.Status,
+		&res.PromotionID,
+		&res.PromoCode,
+		&res.Guests,
+		&res.Subtotal,
+		&res.Discount,
+		&res.ExtrasTotal,
+		&res.TaxTotal,
+		&res.Total,
 		&res.Room.ID,
 		&res.Room.RoomName,
+		&res.Policy.ID,
+		&res.Policy.Name,
+		&res.Policy.FreeCancellationDays,
+		&res.Policy.PenaltyPercent,
+		&res.Policy.NonRefundable,
+		&res.Policy.DepositPercent,
+		&res.Policy.BalanceDueDays,
+		&res.RoomKey,
+		&res.IDDocument,
+		&res.GroupID,
+		&res.ManageLinkVersion,
 	)
 
 	if err != nil {
 		return res, err
 	}
 
+	res.Extras, err = m.reservationExtras(ctx, res.ID)
+	if err != nil {
+		return res, err
+	}
+
+	res.Taxes, err = m.reservationTaxes(ctx, res.ID)
+	if err != nil {
+		return res, err
+	}
+
 	return res, nil
 }
 
-func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
+// RevokeManageLinks bumps the reservation's manage link version, which invalidates every link signed
+// with the old one, and returns the new version
+func (m *postgresDBRepo) RevokeManageLinks(id int) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 where id = $6`
+	var version int
 
-	_, err := m.DB.ExecContext(ctx, query, r.FirstName, r.LastName, r.Email, r.Phone, time.Now(), r.ID)
+	stmt := `update reservations set manage_link_version = manage_link_version + 1, updated_at = $1 where id = $2 returning manage_link_version`
 
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	return nil
+	err = tx.QueryRowContext(ctx, stmt, time.Now(), id).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.commit(ctx, tx, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
 }
 
-func (m *postgresDBRepo) DeleteReservation(id int) error {
+func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `delete from reservations where id = $1`
-	fmt.Println(query)
-	_, err := m.DB.ExecContext(ctx, query, id)
-	fmt.Println(err)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
-}
+	query := `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 where id = $6`
 
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	_, err = tx.ExecContext(ctx, query, r.FirstName, r.LastName, r.Email, r.Phone, time.Now(), r.ID)
 
-	query := "update reservations set processed = $1 where id = $2"
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	err = insertOutboxEvent(ctx, tx, events.ReservationModified{ReservationID: r.ID})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return m.commit(ctx, tx, 0)
 }
 
 func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
@@ -408,7 +529,7 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 
 	var rooms []models.Room
 
-	query := `select id, room_name, created_at, updated_at from rooms order by room_name`
+	query := `select id, room_name, price, coalesce(policy_id, 0), max_guests, created_at, updated_at from rooms order by room_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
@@ -422,6 +543,9 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 		err := rows.Scan(
 			&rm.ID,
 			&rm.RoomName,
+			&rm.Price,
+			&rm.PolicyID,
+			&rm.MaxGuests,
 			&rm.CreatedAt,
 			&rm.UpdatedAt,
 		)
@@ -448,7 +572,7 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 	var restrictions []models.RoomRestriction
 
 	query := `
-		select id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
+		select id, coalesce(reservation_id, 0), restriction_id, coalesce(block_id, 0), room_id, start_date, end_date
 		from room_restrictions where $1 < end_date and $2 >= start_date
 		and room_id = $3
 	`
@@ -467,6 +591,7 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 			&restriction.ID,
 			&restriction.ReservationID,
 			&restriction.RestrictionID,
+			&restriction.BlockID,
 			&restriction.RoomID,
 			&restriction.StartDate,
 			&restriction.EndDate,
@@ -482,33 +607,341 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 
 }
 
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at) values ($1, $2, $3, $4, $5, $6) returning id`
+
+	var restrictionID int
+	err = tx.QueryRowContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now()).Scan(&restrictionID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertOutboxEvent(ctx, tx, events.BlockAdded{RoomID: id, StartDate: startDate, EndDate: startDate.AddDate(0, 0, 1)})
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.commit(ctx, tx, restrictionID)
+	if err != nil {
+		return 0, err
+	}
+
+	return restrictionID, nil
+}
+
+func (m *postgresDBRepo) DeleteBlockByID(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `delete from room_restrictions where id = $1 returning room_id, start_date, end_date`
+
+	changed := events.BlockChanged{Deleted: true}
+	err = tx.QueryRowContext(ctx, query, id).Scan(&changed.RoomID, &changed.StartDate, &changed.EndDate)
+	if err == sql.ErrNoRows {
+		// already gone, so there is nothing new to tell the channels
+		return m.commit(ctx, tx, 0)
+	} else if err != nil {
+		return err
+	}
+
+	err = insertOutboxEvent(ctx, tx, changed)
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+func (m *postgresDBRepo) AllBlocks() ([]models.Block, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var blocks []models.Block
+
+	query := `
+		select b.id, b.room_id, b.start_date, b.end_date, b.reason, b.recurrence, coalesce(b.repeat_until, b.start_date),
+		b.created_at, b.updated_at, rm.id, rm.room_name
+		from room_blocks b
+		left join rooms rm on (b.room_id = rm.id)
+		order by b.start_date asc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return blocks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b models.Block
+		err := rows.Scan(
+			&b.ID,
+			&b.RoomID,
+			&b.StartDate,
+			&b.EndDate,
+			&b.Reason,
+			&b.Recurrence,
+			&b.RepeatUntil,
+			&b.CreatedAt,
+			&b.UpdatedAt,
+			&b.Room.ID,
+			&b.Room.RoomName,
+		)
+
+		if err != nil {
+			return blocks, err
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return blocks, err
+	}
+
+	return blocks, nil
+}
+
+func (m *postgresDBRepo) GetBlockByID(id int) (models.Block, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var b models.Block
+
+	query := `
+		select b.id, b.room_id, b.start_date, b.end_date, b.reason, b.recurrence, coalesce(b.repeat_until, b.start_date),
+		b.created_at, b.updated_at, rm.id, rm.room_name
+		from room_blocks b
+		left join rooms rm on (b.room_id = rm.id)
+		where b.id = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&b.ID,
+		&b.RoomID,
+		&b.StartDate,
+		&b.EndDate,
+		&b.Reason,
+		&b.Recurrence,
+		&b.RepeatUntil,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+		&b.Room.ID,
+		&b.Room.RoomName,
+	)
+
+	if err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
+
+// InsertBlock inserts a block and the room restrictions for each of its occurrences.
+// It returns repository.ErrRoomUnavailable if any occurrence overlaps a reservation.
+func (m *postgresDBRepo) InsertBlock(b models.Block) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `insert into room_blocks (room_id, start_date, end_date, reason, recurrence, repeat_until, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		b.RoomID,
+		b.StartDate,
+		b.EndDate,
+		b.Reason,
+		b.Recurrence,
+		nullableDate(b.RepeatUntil),
+		time.Now(),
+		time.Now(),
+	).Scan(&b.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertBlockOccurrences(ctx, tx, b)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertOutboxEvent(ctx, tx, events.BlockAdded{BlockID: b.ID, RoomID: b.RoomID, StartDate: b.StartDate, EndDate: b.EndDate})
+	if err != nil {
+		return 0, err
+	}
+
+	if err = m.commit(ctx, tx, b.ID); err != nil {
+		return 0, err
+	}
+
+	return b.ID, nil
+}
+
+// UpdateBlock updates a block and replaces the room restrictions of all its occurrences,
+// saving a BlockChanged event so the channels hear of the nights taken off or put back on sale. It returns repository.ErrRoomUnavailable if any occurrence overlaps a reservation.
+func (m *postgresDBRepo) UpdateBlock(b models.Block) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update room_blocks set room_id = $1, start_date = $2, end_date = $3, reason = $4, recurrence = $5, repeat_until = $6, updated_at = $7 where id = $8`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		b.RoomID,
+		b.StartDate,
+		b.EndDate,
+		b.Reason,
+		b.Recurrence,
+		nullableDate(b.RepeatUntil),
+		time.Now(),
+		b.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where block_id = $1`, b.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertBlockOccurrences(ctx, tx, b)
+	if err != nil {
+		return err
+	}
+
+	err = insertOutboxEvent(ctx, tx, events.BlockChanged{BlockID: b.ID, RoomID: b.RoomID, StartDate: b.StartDate, EndDate: b.EndDate})
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+// DeleteBlock deletes a block together with all of its occurrences, saving a BlockChanged event
+func (m *postgresDBRepo) DeleteBlock(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at) values ($1, $2, $3, $4, $5, $6)`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where block_id = $1`, id)
+	if err != nil {
+		return err
+	}
 
+	changed := events.BlockChanged{BlockID: id, Deleted: true}
+	err = tx.QueryRowContext(ctx, `delete from room_blocks where id = $1 returning room_id, start_date, end_date`, id).
+		Scan(&changed.RoomID, &changed.StartDate, &changed.EndDate)
+	if err == sql.ErrNoRows {
+		// already gone, so there is nothing new to tell the channels
+		return m.commit(ctx, tx, 0)
+	} else if err != nil {
+		return err
+	}
+
+	err = insertOutboxEvent(ctx, tx, changed)
 	if err != nil {
 		return err
 	}
 
+	return m.commit(ctx, tx, 0)
+}
+
+func insertBlockOccurrences(ctx context.Context, tx *sql.Tx, b models.Block) error {
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, block_id, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7)`
+
+	// a block can't take a room away from a guest who has already booked it
+	query := `select count(id) from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date and reservation_id is not null`
+
+	for _, o := range b.Occurrences() {
+		var booked int
+		err := tx.QueryRowContext(ctx, query, o.RoomID, o.StartDate, o.EndDate).Scan(&booked)
+		if err != nil {
+			return err
+		}
+		if booked > 0 {
+			return repository.ErrRoomUnavailable
+		}
+
+		_, err = tx.ExecContext(ctx, stmt, o.StartDate, o.EndDate, o.RoomID, o.RestrictionID, b.ID, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (m *postgresDBRepo) DeleteBlockByID(id int) error {
+func nullableDate(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func (m *postgresDBRepo) UpdateRoomPrice(id, price int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `delete from room_restrictions where id = $1`
+	query := `update rooms set price = $1, updated_at = $2 where id = $3`
 
+	err := m.exec(ctx, query, price, time.Now(), id)
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	return nil
+}
 
+func (m *postgresDBRepo) UpdateRoomMaxGuests(id, maxGuests int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update rooms set max_guests = $1, updated_at = $2 where id = $3`
+
+	err := m.exec(ctx, query, maxGuests, time.Now(), id)
 	if err != nil {
 		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
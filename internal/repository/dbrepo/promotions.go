@@ -0,0 +1,238 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+const promotionColumns = `id, code, description, discount_type, amount, valid_from, valid_to, min_nights, max_uses, times_used, active, created_at, updated_at`
+
+func scanPromotion(row interface{ Scan(...interface{}) error }) (models.Promotion, error) {
+	var p models.Promotion
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.DiscountType,
+		&p.Amount,
+		&p.ValidFrom,
+		&p.ValidTo,
+		&p.MinNights,
+		&p.MaxUses,
+		&p.TimesUsed,
+		&p.Active,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	return p, err
+}
+
+func (m *postgresDBRepo) AllPromotions() ([]models.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var promotions []models.Promotion
+
+	query := `select ` + promotionColumns + ` from promotions order by valid_from desc`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return promotions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return promotions, err
+		}
+		promotions = append(promotions, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return promotions, err
+	}
+
+	for i := range promotions {
+		promotions[i].RoomIDs, err = m.promotionRoomIDs(ctx, promotions[i].ID)
+		if err != nil {
+			return promotions, err
+		}
+	}
+
+	return promotions, nil
+}
+
+func (m *postgresDBRepo) GetPromotionByID(id int) (models.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + promotionColumns + ` from promotions where id = $1`
+
+	p, err := scanPromotion(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return p, err
+	}
+
+	p.RoomIDs, err = m.promotionRoomIDs(ctx, p.ID)
+	return p, err
+}
+
+// GetPromotionByCode looks up a promotion by its code, ignoring case
+func (m *postgresDBRepo) GetPromotionByCode(code string) (models.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + promotionColumns + ` from promotions where code = $1`
+
+	p, err := scanPromotion(m.DB.QueryRowContext(ctx, query, strings.ToUpper(strings.TrimSpace(code))))
+	if err != nil {
+		return p, err
+	}
+
+	p.RoomIDs, err = m.promotionRoomIDs(ctx, p.ID)
+	return p, err
+}
+
+func (m *postgresDBRepo) InsertPromotion(p models.Promotion) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `insert into promotions (code, description, discount_type, amount, valid_from, valid_to, min_nights, max_uses, active, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		strings.ToUpper(strings.TrimSpace(p.Code)),
+		p.Description,
+		p.DiscountType,
+		p.Amount,
+		p.ValidFrom,
+		p.ValidTo,
+		p.MinNights,
+		p.MaxUses,
+		p.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&p.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = setPromotionRooms(ctx, tx, p)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = m.commit(ctx, tx, p.ID); err != nil {
+		return 0, err
+	}
+
+	return p.ID, nil
+}
+
+func (m *postgresDBRepo) UpdatePromotion(p models.Promotion) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update promotions set code = $1, description = $2, discount_type = $3, amount = $4, valid_from = $5, valid_to = $6,
+		min_nights = $7, max_uses = $8, active = $9, updated_at = $10 where id = $11`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		strings.ToUpper(strings.TrimSpace(p.Code)),
+		p.Description,
+		p.DiscountType,
+		p.Amount,
+		p.ValidFrom,
+		p.ValidTo,
+		p.MinNights,
+		p.MaxUses,
+		p.Active,
+		time.Now(),
+		p.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = setPromotionRooms(ctx, tx, p)
+	if err != nil {
+		return err
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+func (m *postgresDBRepo) promotionRoomIDs(ctx context.Context, promotionID int) ([]int, error) {
+	var ids []int
+
+	rows, err := m.DB.QueryContext(ctx, `select room_id from promotion_rooms where promotion_id = $1 order by room_id`, promotionID)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func setPromotionRooms(ctx context.Context, tx *sql.Tx, p models.Promotion) error {
+	_, err := tx.ExecContext(ctx, `delete from promotion_rooms where promotion_id = $1`, p.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, roomID := range p.RoomIDs {
+		_, err = tx.ExecContext(ctx, `insert into promotion_rooms (promotion_id, room_id) values ($1, $2)`, p.ID, roomID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// redeemPromotion counts one use of a promotion, failing if its usage limit has been reached
+func redeemPromotion(ctx context.Context, tx *sql.Tx, id int) error {
+	stmt := `update promotions set times_used = times_used + 1, updated_at = $1
+		where id = $2 and active and (max_uses = 0 or times_used < max_uses)`
+
+	result, err := tx.ExecContext(ctx, stmt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrPromotionUnavailable
+	}
+
+	return nil
+}
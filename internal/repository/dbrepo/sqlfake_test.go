@@ -0,0 +1,158 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// step is a statement a test expects the repository to run next, and what the database answers
+type step struct {
+	query    string         // a part of the statement, enough to tell it apart
+	args     []driver.Value // checked only when set
+	rows     [][]driver.Value
+	affected int64
+	err      error
+}
+
+// anyArg matches whatever argument is passed, such as the time a row is updated
+type anyArg struct{}
+
+func argsMatch(got, want []driver.Value) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range want {
+		if _, ok := want[i].(anyArg); ok {
+			continue
+		}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// script is a database that answers the statements of one repository call in the order the test expects them.
+// Anything else fails the test.
+type script struct {
+	t          *testing.T
+	steps      []step
+	next       int
+	committed  bool
+	rolledBack bool
+}
+
+// newScript returns a repository on a database that expects steps, and the script to check afterwards
+func newScript(t *testing.T, steps ...step) (*postgresDBRepo, *script) {
+	s := &script{t: t, steps: steps}
+	db := sql.OpenDB(s)
+	t.Cleanup(func() { db.Close() })
+	return &postgresDBRepo{DB: db}, s
+}
+
+// done fails the test if any expected statement wasn't run, or the transaction didn't end as wanted
+func (s *script) done(wantCommit bool) {
+	s.t.Helper()
+	if s.next < len(s.steps) {
+		s.t.Errorf("statement not run: %s", s.steps[s.next].query)
+	}
+	if s.committed != wantCommit {
+		s.t.Errorf("committed %v, want %v", s.committed, wantCommit)
+	}
+}
+
+func (s *script) step(query string, args []driver.NamedValue) (step, error) {
+	s.t.Helper()
+	if s.next == len(s.steps) {
+		s.t.Errorf("unexpected statement: %s", query)
+		return step{}, errors.New("unexpected statement")
+	}
+
+	st := s.steps[s.next]
+	s.next++
+
+	if !strings.Contains(strings.Join(strings.Fields(query), " "), st.query) {
+		s.t.Errorf("statement %d: got %s, want one with %q", s.next, query, st.query)
+		return step{}, errors.New("unexpected statement")
+	}
+
+	if st.args != nil {
+		var got []driver.Value
+		for _, a := range args {
+			got = append(got, a.Value)
+		}
+		if !argsMatch(got, st.args) {
+			s.t.Errorf("%q: got args %v, want %v", st.query, got, st.args)
+		}
+	}
+
+	return st, st.err
+}
+
+// Connect and Driver make the script a driver.Connector
+func (s *script) Connect(ctx context.Context) (driver.Conn, error) { return s, nil }
+func (s *script) Driver() driver.Driver                            { return nil }
+
+func (s *script) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare not supported: %s", query)
+}
+
+func (s *script) Close() error { return nil }
+
+func (s *script) Begin() (driver.Tx, error) { return s, nil }
+
+func (s *script) Commit() error {
+	s.committed = true
+	return nil
+}
+
+func (s *script) Rollback() error {
+	s.rolledBack = true
+	return nil
+}
+
+func (s *script) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	st, err := s.step(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(st.affected), nil
+}
+
+func (s *script) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	st, err := s.step(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: st.rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
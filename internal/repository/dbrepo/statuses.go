@@ -0,0 +1,167 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+// UpdateReservationStatus moves the reservation from change.FromStatus to change.ToStatus and records the change.
+// Cancelling or marking a no-show releases the room. It returns repository.ErrStatusChanged if the
+// reservation is no longer in change.FromStatus.
+func (m *postgresDBRepo) UpdateReservationStatus(change models.ReservationStatusChange) error {
+	return m.UpdateReservationStatuses([]models.ReservationStatusChange{change})
+}
+
+// UpdateReservationStatuses makes all the changes in one transaction, as UpdateReservationStatus does each.
+// If any reservation is no longer in its change's FromStatus nothing is changed and
+// repository.ErrStatusChanged is returned.
+func (m *postgresDBRepo) UpdateReservationStatuses(changes []models.ReservationStatusChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, change := range changes {
+		err = updateReservationStatus(ctx, tx, change)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.commit(ctx, tx, 0)
+}
+
+func updateReservationStatus(ctx context.Context, tx *sql.Tx, change models.ReservationStatusChange) error {
+	stmt := `update reservations set status = $1, updated_at = $2 where id = $3 and status = $4`
+
+	result, err := tx.ExecContext(ctx, stmt, change.ToStatus, time.Now(), change.ReservationID, change.FromStatus)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrStatusChanged
+	}
+
+	if change.ToStatus == models.StatusCancelled || change.ToStatus == models.StatusNoShow {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, change.ReservationID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = insertStatusChange(ctx, tx, change)
+	if err != nil {
+		return err
+	}
+
+	switch change.ToStatus {
+	case models.StatusCancelled:
+		return insertOutboxEvent(ctx, tx, events.ReservationCancelled{
+			ReservationID: change.ReservationID,
+			Actor:         change.Actor,
+			Refunded:      change.Refunded,
+		})
+	case models.StatusConfirmed:
+		err = insertOutboxEvent(ctx, tx, events.ReservationConfirmed{ReservationID: change.ReservationID})
+		if err != nil {
+			return err
+		}
+		return groupBooked(ctx, tx, change.ReservationID)
+	}
+
+	return insertOutboxEvent(ctx, tx, events.ReservationModified{ReservationID: change.ReservationID})
+}
+
+// groupBooked saves a GroupBooked event if the reservation just confirmed in tx belongs to a group
+// and was the last of its rooms still pending
+func groupBooked(ctx context.Context, tx *sql.Tx, reservationID int) error {
+	var groupID int
+	err := tx.QueryRowContext(ctx, `select coalesce(group_id, 0) from reservations where id = $1`, reservationID).Scan(&groupID)
+	if err != nil || groupID == 0 {
+		return err
+	}
+
+	// the group is locked so that of two of its rooms confirmed at the same time, the second sees the first
+	_, err = tx.ExecContext(ctx, `select id from booking_groups where id = $1 for update`, groupID)
+	if err != nil {
+		return err
+	}
+
+	var pending int
+	query := `select count(id) from reservations where group_id = $1 and status = $2`
+	err = tx.QueryRowContext(ctx, query, groupID, models.StatusPending).Scan(&pending)
+	if err != nil || pending > 0 {
+		return err
+	}
+
+	return insertOutboxEvent(ctx, tx, events.GroupBooked{GroupID: groupID})
+}
+
+func (m *postgresDBRepo) GetStatusHistory(reservationID int) ([]models.ReservationStatusChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var changes []models.ReservationStatusChange
+
+	query := `
+		select c.id, c.reservation_id, c.from_status, c.to_status, coalesce(c.user_id, 0),
+		coalesce(u.first_name || ' ' || u.last_name, c.actor), c.note, c.created_at
+		from reservation_status_changes c
+		left join users u on (c.user_id = u.id)
+		where c.reservation_id = $1
+		order by c.created_at, c.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return changes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.ReservationStatusChange
+		err := rows.Scan(
+			&c.ID,
+			&c.ReservationID,
+			&c.FromStatus,
+			&c.ToStatus,
+			&c.UserID,
+			&c.Actor,
+			&c.Note,
+			&c.CreatedAt,
+		)
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return changes, err
+	}
+
+	return changes, nil
+}
+
+func insertStatusChange(ctx context.Context, tx *sql.Tx, c models.ReservationStatusChange) error {
+	stmt := `insert into reservation_status_changes (reservation_id, from_status, to_status, user_id, actor, note, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := tx.ExecContext(ctx, stmt, c.ReservationID, c.FromStatus, c.ToStatus, nullableID(c.UserID), c.Actor, c.Note, time.Now(), time.Now())
+
+	return err
+}
@@ -0,0 +1,85 @@
+package dbrepo
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+func TestUpdateReservationStatus(t *testing.T) {
+	anything := anyArg{}
+
+	tests := []struct {
+		name    string
+		change  models.ReservationStatusChange
+		steps   []step
+		wantErr error
+	}{
+		{
+			// the room is freed but the reservation kept for its history
+			name:   "cancelled",
+			change: models.ReservationStatusChange{ReservationID: 7, FromStatus: models.StatusConfirmed, ToStatus: models.StatusCancelled, Actor: models.ActorStaff, UserID: 3},
+			steps: []step{
+				{query: "update reservations set status = $1", args: []driver.Value{models.StatusCancelled, anything, int64(7), models.StatusConfirmed}, affected: 1},
+				{query: "delete from room_restrictions where reservation_id = $1", args: []driver.Value{int64(7)}},
+				{query: "insert into reservation_status_changes",
+					args: []driver.Value{int64(7), models.StatusConfirmed, models.StatusCancelled, int64(3), models.ActorStaff, "", anything, anything}},
+				{query: "insert into outbox_events", args: []driver.Value{"reservation.cancelled", anything, anything}},
+			},
+		},
+		{
+			name:   "checked in",
+			change: models.ReservationStatusChange{ReservationID: 7, FromStatus: models.StatusConfirmed, ToStatus: models.StatusCheckedIn, Actor: models.ActorStaff, UserID: 3},
+			steps: []step{
+				{query: "update reservations set status = $1", args: []driver.Value{models.StatusCheckedIn, anything, int64(7), models.StatusConfirmed}, affected: 1},
+				{query: "insert into reservation_status_changes"},
+				{query: "insert into outbox_events", args: []driver.Value{"reservation.modified", anything, anything}},
+			},
+		},
+		{
+			// someone else moved it on first, so the update matches no row
+			name:   "status changed meanwhile",
+			change: models.ReservationStatusChange{ReservationID: 7, FromStatus: models.StatusConfirmed, ToStatus: models.StatusCancelled, Actor: models.ActorGuest},
+			steps: []step{
+				{query: "update reservations set status = $1", affected: 0},
+			},
+			wantErr: repository.ErrStatusChanged,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, db := newScript(t, tt.steps...)
+
+			err := m.UpdateReservationStatus(tt.change)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			db.done(tt.wantErr == nil)
+		})
+	}
+}
+
+// TestUpdateReservationStatuses changes nothing when one of the reservations has moved on
+func TestUpdateReservationStatuses(t *testing.T) {
+	m, db := newScript(t,
+		step{query: "update reservations set status = $1", args: []driver.Value{models.StatusNoShow, anyArg{}, int64(7), models.StatusConfirmed}, affected: 1},
+		step{query: "delete from room_restrictions where reservation_id = $1"},
+		step{query: "insert into reservation_status_changes"},
+		step{query: "insert into outbox_events"},
+		step{query: "update reservations set status = $1", args: []driver.Value{models.StatusNoShow, anyArg{}, int64(8), models.StatusConfirmed}, affected: 0},
+	)
+
+	err := m.UpdateReservationStatuses([]models.ReservationStatusChange{
+		{ReservationID: 7, FromStatus: models.StatusConfirmed, ToStatus: models.StatusNoShow, Actor: models.ActorSystem},
+		{ReservationID: 8, FromStatus: models.StatusConfirmed, ToStatus: models.StatusNoShow, Actor: models.ActorSystem},
+	})
+	if err != repository.ErrStatusChanged {
+		t.Fatalf("got error %v, want ErrStatusChanged", err)
+	}
+
+	db.done(false)
+}
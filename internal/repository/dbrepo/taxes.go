@@ -0,0 +1,153 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+func (m *postgresDBRepo) AllTaxRules() ([]models.TaxRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []models.TaxRule
+
+	query := `select id, name, kind, basis, amount, active, created_at, updated_at from tax_rules order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.TaxRule
+		err := rows.Scan(
+			&t.ID,
+			&t.Name,
+			&t.Kind,
+			&t.Basis,
+			&t.Amount,
+			&t.Active,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+func (m *postgresDBRepo) GetTaxRuleByID(id int) (models.TaxRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t models.TaxRule
+
+	query := `select id, name, kind, basis, amount, active, created_at, updated_at from tax_rules where id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&t.ID,
+		&t.Name,
+		&t.Kind,
+		&t.Basis,
+		&t.Amount,
+		&t.Active,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+func (m *postgresDBRepo) InsertTaxRule(t models.TaxRule) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into tax_rules (name, kind, basis, amount, active, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	newID, err := m.insert(ctx, stmt, t.Name, t.Kind, t.Basis, t.Amount, t.Active, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) UpdateTaxRule(t models.TaxRule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update tax_rules set name = $1, kind = $2, basis = $3, amount = $4, active = $5, updated_at = $6 where id = $7`
+
+	err := m.exec(ctx, stmt, t.Name, t.Kind, t.Basis, t.Amount, t.Active, time.Now(), t.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) reservationTaxes(ctx context.Context, reservationID int) ([]models.ReservationTax, error) {
+	var taxes []models.ReservationTax
+
+	query := `
+		select id, reservation_id, coalesce(tax_rule_id, 0), name, kind, basis, rate, quantity, amount, created_at, updated_at
+		from reservation_taxes where reservation_id = $1 order by id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return taxes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.ReservationTax
+		err := rows.Scan(
+			&t.ID,
+			&t.ReservationID,
+			&t.TaxRuleID,
+			&t.Name,
+			&t.Kind,
+			&t.Basis,
+			&t.Rate,
+			&t.Quantity,
+			&t.Amount,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return taxes, err
+		}
+		taxes = append(taxes, t)
+	}
+
+	return taxes, rows.Err()
+}
+
+func insertReservationTaxes(ctx context.Context, tx *sql.Tx, reservationID int, taxes []models.ReservationTax) error {
+	stmt := `insert into reservation_taxes (reservation_id, tax_rule_id, name, kind, basis, rate, quantity, amount, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	for _, t := range taxes {
+		_, err := tx.ExecContext(ctx, stmt, reservationID, nullableID(t.TaxRuleID), t.Name, t.Kind, t.Basis, t.Rate, t.Quantity, t.Amount, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/events"
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+const waitlistColumns = `id, first_name, last_name, email, start_date, end_date, guests, status, notified_at, expires_at, coalesce(reservation_id, 0), created_at, updated_at`
+
+func scanWaitlistEntry(row interface{ Scan(...interface{}) error }) (models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+	var notifiedAt, expiresAt sql.NullTime
+
+	err := row.Scan(
+		&e.ID,
+		&e.FirstName,
+		&e.LastName,
+		&e.Email,
+		&e.StartDate,
+		&e.EndDate,
+		&e.Guests,
+		&e.Status,
+		&notifiedAt,
+		&expiresAt,
+		&e.ReservationID,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+
+	e.NotifiedAt = notifiedAt.Time
+	e.ExpiresAt = expiresAt.Time
+
+	return e, err
+}
+
+func (m *postgresDBRepo) waitlistEntries(ctx context.Context, query string, args ...interface{}) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// AllWaitlistEntries returns every waitlist entry, newest stays first
+func (m *postgresDBRepo) AllWaitlistEntries() ([]models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.waitlistEntries(ctx, `select `+waitlistColumns+` from waitlist_entries order by start_date desc, created_at`)
+}
+
+// WaitingWaitlistEntries returns the guests still waiting, in the order they joined
+func (m *postgresDBRepo) WaitingWaitlistEntries() ([]models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.waitlistEntries(ctx, `select `+waitlistColumns+` from waitlist_entries where status = $1 order by created_at, id`, models.WaitlistWaiting)
+}
+
+func (m *postgresDBRepo) GetWaitlistEntryByID(id int) (models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanWaitlistEntry(m.DB.QueryRowContext(ctx, `select `+waitlistColumns+` from waitlist_entries where id = $1`, id))
+}
+
+func (m *postgresDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+
+	stmt := `insert into waitlist_entries (first_name, last_name, email, start_date, end_date, guests, status, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		e.FirstName,
+		e.LastName,
+		e.Email,
+		e.StartDate,
+		e.EndDate,
+		e.Guests,
+		models.WaitlistWaiting,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertOutboxEvent(ctx, tx, events.WaitlistJoined{EntryID: newID})
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, tx.Commit()
+}
+
+// UpdateWaitlistEntry saves the entry's status and offer times
+func (m *postgresDBRepo) UpdateWaitlistEntry(e models.WaitlistEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update waitlist_entries set status = $1, notified_at = $2, expires_at = $3, updated_at = $4 where id = $5`
+
+	_, err := m.DB.ExecContext(ctx, stmt, e.Status, nullableDate(e.NotifiedAt), nullableDate(e.ExpiresAt), time.Now(), e.ID)
+
+	return err
+}
+
+// OfferWaitlistEntry saves the entry as offered until e.ExpiresAt, and the event that emails the guest the offer
+func (m *postgresDBRepo) OfferWaitlistEntry(e models.WaitlistEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update waitlist_entries set status = $1, notified_at = $2, expires_at = $3, updated_at = $4 where id = $5`
+
+	_, err = tx.ExecContext(ctx, stmt, models.WaitlistOffered, e.NotifiedAt, e.ExpiresAt, time.Now(), e.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertOutboxEvent(ctx, tx, events.WaitlistOffered{EntryID: e.ID})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// BookWaitlistEntry closes the entry with the reservation the guest made from its offer, which stops the offer
+// holding a room. It does nothing unless the entry's offer is still open and the reservation is for its dates.
+func (m *postgresDBRepo) BookWaitlistEntry(id int, res models.Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update waitlist_entries set status = $1, reservation_id = $2, updated_at = $3
+		where id = $4 and status in ($5, $6) and start_date = $7 and end_date = $8`
+
+	_, err := m.DB.ExecContext(ctx, stmt, models.WaitlistBooked, res.ID, time.Now(), id,
+		models.WaitlistOffered, models.WaitlistAccepted, res.StartDate, res.EndDate)
+
+	return err
+}
+
+// ExpireWaitlistOffers marks offers not taken up by now as expired, which passes their turn to the next guest
+func (m *postgresDBRepo) ExpireWaitlistOffers(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update waitlist_entries set status = $1, updated_at = $2 where status in ($3, $4) and expires_at <= $2`
+
+	_, err := m.DB.ExecContext(ctx, stmt, models.WaitlistExpired, now, models.WaitlistOffered, models.WaitlistAccepted)
+
+	return err
+}
+
+// CountOpenWaitlistOffers returns how many offers that haven't expired overlap the dates.
+// Each of them may still turn into a booking, so the rooms they were offered are spoken for.
+func (m *postgresDBRepo) CountOpenWaitlistOffers(start, end, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select count(id) from waitlist_entries
+		where status in ($1, $2) and expires_at > $3 and $4 < end_date and $5 > start_date`
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, models.WaitlistOffered, models.WaitlistAccepted, now, start, end).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
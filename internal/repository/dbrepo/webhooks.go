@@ -0,0 +1,306 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+	"github.com/NganJason/hotel-booking/internal/repository"
+)
+
+const webhookColumns = `id, name, url, secret, events, active, created_at, updated_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (models.Webhook, error) {
+	var w models.Webhook
+	var events string
+
+	err := row.Scan(
+		&w.ID,
+		&w.Name,
+		&w.URL,
+		&w.Secret,
+		&events,
+		&w.Active,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+
+	return w, err
+}
+
+func (m *postgresDBRepo) AllWebhooks() ([]models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var hooks []models.Webhook
+
+	rows, err := m.DB.QueryContext(ctx, `select `+webhookColumns+` from webhooks order by name, id`)
+	if err != nil {
+		return hooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return hooks, err
+		}
+		hooks = append(hooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return hooks, err
+	}
+
+	return hooks, nil
+}
+
+func (m *postgresDBRepo) GetWebhookByID(id int) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanWebhook(m.DB.QueryRowContext(ctx, `select `+webhookColumns+` from webhooks where id = $1`, id))
+}
+
+func (m *postgresDBRepo) InsertWebhook(w models.Webhook) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into webhooks (name, url, secret, events, active, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	newID, err := m.insert(ctx, stmt, w.Name, w.URL, w.Secret, strings.Join(w.Events, ","), w.Active, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) UpdateWebhook(w models.Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update webhooks set name = $1, url = $2, secret = $3, events = $4, active = $5, updated_at = $6 where id = $7`
+
+	err := m.exec(ctx, stmt, w.Name, w.URL, w.Secret, strings.Join(w.Events, ","), w.Active, time.Now(), w.ID)
+
+	return err
+}
+
+// DeleteWebhook deletes the webhook and its deliveries
+func (m *postgresDBRepo) DeleteWebhook(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.exec(ctx, `delete from webhooks where id = $1`, id)
+
+	return err
+}
+
+// QueueWebhookEvent adds a pending delivery of the payload to every active webhook subscribed to the event,
+// due straight away. It returns how many were queued.
+func (m *postgresDBRepo) QueueWebhookEvent(event, payload string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+		select id, $1, $2, $3, $4, $4, $4 from webhooks
+		where active and (events = '' or ',' || events || ',' like '%,' || $1 || ',%')
+	`
+
+	result, err := m.DB.ExecContext(ctx, stmt, event, payload, models.DeliveryPending, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+
+	return int(n), err
+}
+
+// InsertWebhookDelivery adds a pending delivery to one webhook, whatever events it is subscribed to,
+// claimed until d.ClaimedUntil for whoever is about to send it
+func (m *postgresDBRepo) InsertWebhookDelivery(d models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, claimed_until, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $5, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, d.WebhookID, d.Event, d.Payload, models.DeliveryPending, time.Now(),
+		nullableDate(d.ClaimedUntil)).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_code, d.last_error,
+	d.next_attempt_at, d.delivered_at, d.created_at, w.name, w.url, w.secret`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var next, delivered sql.NullTime
+
+	err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.ResponseCode,
+		&d.LastError,
+		&next,
+		&delivered,
+		&d.CreatedAt,
+		&d.Webhook.Name,
+		&d.Webhook.URL,
+		&d.Webhook.Secret,
+	)
+
+	d.NextAttemptAt = next.Time
+	d.DeliveredAt = delivered.Time
+	d.Webhook.ID = d.WebhookID
+
+	return d, err
+}
+
+func (m *postgresDBRepo) webhookDeliveries(ctx context.Context, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDueWebhookDelivery claims the oldest pending delivery to an active webhook that is due, for claimFor,
+// so that nobody else sends it in the meantime. It returns sql.ErrNoRows when none is due.
+func (m *postgresDBRepo) ClaimDueWebhookDelivery(claimFor time.Duration) (models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// deliveries being claimed by someone else at the same moment are skipped rather than waited for
+	query := `
+		select d.id from webhook_deliveries d join webhooks w on w.id = d.webhook_id
+		where d.status = $1 and d.next_attempt_at <= $2 and w.active and (d.claimed_until is null or d.claimed_until <= $2)
+		order by d.next_attempt_at, d.id
+		limit 1
+		for update of d skip locked`
+
+	return m.claimWebhookDelivery(ctx, query, claimFor, models.DeliveryPending, time.Now())
+}
+
+// ClaimWebhookDelivery claims the delivery for claimFor, whatever its status, so that nobody else sends it
+// in the meantime. It returns repository.ErrDeliveryInProgress if someone else has already claimed it.
+func (m *postgresDBRepo) ClaimWebhookDelivery(id int, claimFor time.Duration) (models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, `select exists (select 1 from webhook_deliveries where id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	if !exists {
+		return models.WebhookDelivery{}, sql.ErrNoRows
+	}
+
+	query := `
+		select id from webhook_deliveries
+		where id = $1 and (claimed_until is null or claimed_until <= $2)
+		for update skip locked`
+
+	d, err := m.claimWebhookDelivery(ctx, query, claimFor, id, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, repository.ErrDeliveryInProgress
+	}
+
+	return d, err
+}
+
+// claimWebhookDelivery claims the delivery the query selects and locks, returning it
+func (m *postgresDBRepo) claimWebhookDelivery(ctx context.Context, query string, claimFor time.Duration, args ...interface{}) (models.WebhookDelivery, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&id)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	claimedUntil := time.Now().Add(claimFor)
+	_, err = tx.ExecContext(ctx, `update webhook_deliveries set claimed_until = $1 where id = $2`, claimedUntil, id)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	query = `select ` + webhookDeliveryColumns + `
+		from webhook_deliveries d join webhooks w on w.id = d.webhook_id
+		where d.id = $1`
+
+	d, err := scanWebhookDelivery(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return d, err
+	}
+
+	return d, tx.Commit()
+}
+
+// RecentWebhookDeliveries returns the latest deliveries to every webhook, newest first
+func (m *postgresDBRepo) RecentWebhookDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + webhookDeliveryColumns + `
+		from webhook_deliveries d join webhooks w on w.id = d.webhook_id
+		order by d.created_at desc, d.id desc
+		limit $1`
+
+	return m.webhookDeliveries(ctx, query, limit)
+}
+
+// UpdateWebhookDelivery saves the outcome of an attempt at a delivery, releasing the claim on it
+func (m *postgresDBRepo) UpdateWebhookDelivery(d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update webhook_deliveries set status = $1, attempts = $2, response_code = $3, last_error = $4, next_attempt_at = $5,
+		delivered_at = $6, claimed_until = null, updated_at = $7 where id = $8`
+
+	_, err := m.DB.ExecContext(ctx, stmt, d.Status, d.Attempts, d.ResponseCode, d.LastError, nullableDate(d.NextAttemptAt),
+		nullableDate(d.DeliveredAt), time.Now(), d.ID)
+
+	return err
+}
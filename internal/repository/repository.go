@@ -1,28 +1,158 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
+	"github.com/NganJason/hotel-booking/internal/events"
 	"github.com/NganJason/hotel-booking/internal/models"
 )
 
+// ErrPromotionUnavailable is returned when a promotion can no longer be redeemed
+var ErrPromotionUnavailable = errors.New("promotion is no longer available")
+
+// ErrStatusChanged is returned when a reservation's status changed before a transition could be saved
+var ErrStatusChanged = errors.New("reservation status has changed")
+
+// ErrRoomUnavailable is returned when a room is already taken for the requested dates
+var ErrRoomUnavailable = errors.New("room is not available for those dates")
+
+// ErrDuplicateRequest is returned when a request with the same idempotency key has already been processed
+var ErrDuplicateRequest = errors.New("request has already been processed")
+
+// ErrIdempotencyMismatch is returned when an idempotency key is used again for a different request
+var ErrIdempotencyMismatch = errors.New("idempotency key was used for a different request")
+
+// ErrDeliveryInProgress is returned when a webhook delivery is already being sent by someone else
+var ErrDeliveryInProgress = errors.New("webhook delivery is already being sent")
+
 type DatabaseRepo interface {
 	AllUsers() bool
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(res models.RoomRestriction) error
 	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
 	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
 	GetRoomByID(id int) (models.Room, error)
 	GetUserByID(id int) (models.User, error)
+	ListUsers() ([]models.User, error)
 	Authenticate(email, testPassword string) (int, string, error)
 	AllReservations() ([]models.Reservation, error)
 	AllNewReservations() ([]models.Reservation, error)
 	GetReservationByID(id int) (models.Reservation, error)
 	UpdateReservation(r models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
 	AllRooms() ([]models.Room, error)
 	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
 	DeleteBlockByID(id int) error
-	InsertBlockForRoom(id int, startDate time.Time) error
+	InsertBlockForRoom(id int, startDate time.Time) (int, error)
+	AllBlocks() ([]models.Block, error)
+	GetBlockByID(id int) (models.Block, error)
+	InsertBlock(b models.Block) (int, error)
+	UpdateBlock(b models.Block) error
+	DeleteBlock(id int) error
+	UpdateRoomPrice(id, price int) error
+	UpdateRoomMaxGuests(id, maxGuests int) error
+	AllPromotions() ([]models.Promotion, error)
+	GetPromotionByID(id int) (models.Promotion, error)
+	GetPromotionByCode(code string) (models.Promotion, error)
+	InsertPromotion(p models.Promotion) (int, error)
+	UpdatePromotion(p models.Promotion) error
+	AllExtras() ([]models.Extra, error)
+	GetExtraByID(id int) (models.Extra, error)
+	InsertExtra(e models.Extra) (int, error)
+	UpdateExtra(e models.Extra) error
+	AllTaxRules() ([]models.TaxRule, error)
+	GetTaxRuleByID(id int) (models.TaxRule, error)
+	InsertTaxRule(t models.TaxRule) (int, error)
+	UpdateTaxRule(t models.TaxRule) error
+	AllCurrencies() ([]models.Currency, error)
+	InsertCurrency(c models.Currency) (int, error)
+	UpdateCurrency(c models.Currency) error
+	InsertDepositPayment(p models.Payment) (int, error)
+	RevokeManageLinks(id int) (int, error)
+	CancelUnpaidReservations(now time.Time) (int, error)
+	UpdatePayment(p models.Payment) error
+	GetPaymentByID(id int) (models.Payment, error)
+	GetPaymentsForReservation(reservationID int) ([]models.Payment, error)
+	AllPolicies() ([]models.CancellationPolicy, error)
+	GetPolicyByID(id int) (models.CancellationPolicy, error)
+	InsertPolicy(p models.CancellationPolicy) (int, error)
+	UpdatePolicy(p models.CancellationPolicy) error
+	UpdateRoomPolicy(id, policyID int) error
+	GetInvoiceForReservation(reservationID int) (models.Invoice, error)
+	IssueInvoice(reservationID int, f models.Folio) (models.Invoice, error)
+	ChangeReservationDates(res models.Reservation) error
+	UpdateReservationStatus(change models.ReservationStatusChange) error
+	UpdateReservationStatuses(changes []models.ReservationStatusChange) error
+	GetStatusHistory(reservationID int) ([]models.ReservationStatusChange, error)
+	ReservationsArrivingOn(date time.Time) ([]models.Reservation, error)
+	ReservationsDepartingOn(date time.Time) ([]models.Reservation, error)
+	UpdateFrontDeskDetails(id int, roomKey, idDocument string) error
+	InsertDeskPayment(p models.Payment, paidBefore int) (int, error)
+	AmountsPaid(reservationIDs []int) (map[int]int, error)
+	MoveReservationRoom(move models.RoomMove) error
+	GetRoomMoves(reservationID int) ([]models.RoomMove, error)
+	InsertBookingGroup(g models.BookingGroup, holdIDs []int) (models.BookingGroup, error)
+	GetBookingGroupByID(id int) (models.BookingGroup, error)
+	UpdateBookingGroup(g models.BookingGroup) error
+	ChangeGroupDates(reservations []models.Reservation) error
+	AllWaitlistEntries() ([]models.WaitlistEntry, error)
+	WaitingWaitlistEntries() ([]models.WaitlistEntry, error)
+	GetWaitlistEntryByID(id int) (models.WaitlistEntry, error)
+	InsertWaitlistEntry(e models.WaitlistEntry) (int, error)
+	UpdateWaitlistEntry(e models.WaitlistEntry) error
+	OfferWaitlistEntry(e models.WaitlistEntry) error
+	ExpireWaitlistOffers(now time.Time) error
+	CountOpenWaitlistOffers(start, end, now time.Time) (int, error)
+	BookWaitlistEntry(id int, res models.Reservation) error
+	InsertHold(hold models.RoomRestriction) (int, error)
+	ExtendHold(hold models.RoomRestriction) (bool, error)
+	DeleteHold(id int) error
+	DeleteExpiredHolds(now time.Time) (int, error)
+	BookHeldRoom(res models.Reservation, holdID int, key models.IdempotencyKey) (int, error)
+	GetIdempotentReservationID(key models.IdempotencyKey) (int, error)
+	DeleteIdempotencyKeys(before time.Time) (int, error)
+	GetRestrictionsForAllRoomsByDate(start, end time.Time) ([]models.RoomRestriction, error)
+	GetCalendarEntries(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	AllCalendarFeeds() ([]models.CalendarFeed, error)
+	GetCalendarFeedByID(id int) (models.CalendarFeed, error)
+	GetCalendarFeedByToken(token string) (models.CalendarFeed, error)
+	InsertCalendarFeed(f models.CalendarFeed) error
+	UpdateCalendarFeedToken(id int, token string) error
+	AllCalendarSources() ([]models.CalendarSource, error)
+	GetCalendarSourceByID(id int) (models.CalendarSource, error)
+	InsertCalendarSource(s models.CalendarSource) (int, error)
+	UpdateCalendarSource(s models.CalendarSource) error
+	DeleteCalendarSource(id int) error
+	ReconcileExternalBookings(source models.CalendarSource, bookings []models.ExternalBooking) (models.CalendarSyncLog, error)
+	InsertCalendarSyncLog(l models.CalendarSyncLog) error
+	RecentCalendarSyncLogs(limit int) ([]models.CalendarSyncLog, error)
+	AllChannels() ([]models.Channel, error)
+	GetChannelByID(id int) (models.Channel, error)
+	InsertChannel(c models.Channel) (int, error)
+	UpdateChannel(c models.Channel) error
+	DeleteChannel(id int) error
+	ImportChannelReservation(cr models.ChannelReservation, res models.Reservation) (models.ChannelReservation, string, error)
+	ChannelConflicts() ([]models.ChannelReservation, error)
+	ResolveChannelConflict(id int) error
+	InsertChannelSyncLog(l models.ChannelSyncLog, pulledUntil time.Time) error
+	RecentChannelSyncLogs(limit int) ([]models.ChannelSyncLog, error)
+	AllWebhooks() ([]models.Webhook, error)
+	GetWebhookByID(id int) (models.Webhook, error)
+	InsertWebhook(w models.Webhook) (int, error)
+	UpdateWebhook(w models.Webhook) error
+	DeleteWebhook(id int) error
+	QueueWebhookEvent(event, payload string) (int, error)
+	InsertWebhookDelivery(d models.WebhookDelivery) (int, error)
+	ClaimDueWebhookDelivery(claimFor time.Duration) (models.WebhookDelivery, error)
+	ClaimWebhookDelivery(id int, claimFor time.Duration) (models.WebhookDelivery, error)
+	RecentWebhookDeliveries(limit int) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(d models.WebhookDelivery) error
+
+	InsertOutboxEvent(e events.Event) error
+	DueEvents(now time.Time, limit int) ([]models.OutboxEvent, error)
+	MarkEventDelivered(id int, subscriber string) error
+	MarkEventPublished(id int) error
+	UpdateOutboxEvent(o models.OutboxEvent) error
+
+	InsertAuditEntry(e models.AuditEntry) error
+	Audited(entries ...models.AuditEntry) DatabaseRepo
+	AuditEntries(f models.AuditFilter, limit int) ([]models.AuditEntry, error)
 }
\ No newline at end of file
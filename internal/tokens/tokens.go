@@ -0,0 +1,93 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned for tokens that were tampered with, signed for another purpose or have expired
+var ErrInvalid = errors.New("invalid or expired link")
+
+// Signer creates and checks signed tokens that identify a record in links sent to guests
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a signer using the given secret key
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// Sign returns a token for the record id, usable only for the given purpose.
+// A zero expires means the token never expires.
+func (s *Signer) Sign(purpose string, id int, expires time.Time) string {
+	var exp int64
+	if !expires.IsZero() {
+		exp = expires.Unix()
+	}
+
+	payload := fmt.Sprintf("%d.%d", id, exp)
+	return payload + "." + s.mac(purpose, payload)
+}
+
+// Verify checks the token and returns the record id it was signed for
+func (s *Signer) Verify(purpose, token string) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalid
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.mac(purpose, payload))) {
+		return 0, ErrInvalid
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, ErrInvalid
+	}
+
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	if exp > 0 && time.Now().Unix() > exp {
+		return 0, ErrInvalid
+	}
+
+	return id, nil
+}
+
+// ID returns the record id a token claims to be for, or 0 if it has none, without checking the signature.
+// It is for looking up what a token has to be verified against; only trust the id once Verify accepts it.
+func ID(token string) int {
+	id, err := strconv.Atoi(strings.SplitN(token, ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+func (s *Signer) mac(purpose, payload string) string {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(purpose + ":" + payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Random returns an unguessable token for values that only have to be unique, such as idempotency keys
+func Random() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,82 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	s := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	other := NewSigner([]byte("fedcba9876543210fedcba9876543210"))
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	valid := s.Sign("manage-booking:0", 42, future)
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name    string
+		purpose string
+		token   string
+		id      int
+	}{
+		{"valid", "manage-booking:0", valid, 42},
+		{"never expires", "manage-booking:0", s.Sign("manage-booking:0", 7, time.Time{}), 7},
+		{"other purpose", "manage-booking:1", valid, 0},
+		{"expired", "manage-booking:0", s.Sign("manage-booking:0", 42, past), 0},
+		{"other key", "manage-booking:0", other.Sign("manage-booking:0", 42, future), 0},
+		{"id changed", "manage-booking:0", "43." + parts[1] + "." + parts[2], 0},
+		{"expiry changed", "manage-booking:0", parts[0] + ".0." + parts[2], 0},
+		{"missing signature", "manage-booking:0", parts[0] + "." + parts[1], 0},
+		{"empty", "manage-booking:0", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := s.Verify(tt.purpose, tt.token)
+			if tt.id == 0 {
+				if err != ErrInvalid {
+					t.Errorf("expected ErrInvalid, got id %d and error %v", id, err)
+				}
+				return
+			}
+			if err != nil || id != tt.id {
+				t.Errorf("got id %d and error %v, want id %d", id, err, tt.id)
+			}
+		})
+	}
+}
+
+func TestID(t *testing.T) {
+	tests := []struct {
+		token string
+		id    int
+	}{
+		{"42.0.abc", 42},
+		{"42", 42},
+		{"", 0},
+		{"x.0.abc", 0},
+	}
+
+	for _, tt := range tests {
+		if got := ID(tt.token); got != tt.id {
+			t.Errorf("ID(%q): got %d, want %d", tt.token, got, tt.id)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	a, err := Random()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Random()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b || len(a) != 22 {
+		t.Errorf("expected two different 22 character tokens, got %q and %q", a, b)
+	}
+}
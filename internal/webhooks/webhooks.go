@@ -0,0 +1,147 @@
+// Package webhooks sends signed notifications of reservation events to endpoints set up by staff,
+// such as accounting or CRM tools
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NganJason/hotel-booking/internal/models"
+)
+
+// Events
+const (
+	EventReservationCreated   = "reservation.created"
+	EventReservationModified  = "reservation.modified"
+	EventReservationCancelled = "reservation.cancelled"
+	EventTest                 = "webhook.test"
+)
+
+// Events lists the events a webhook can be subscribed to
+var Events = []string{EventReservationCreated, EventReservationModified, EventReservationCancelled}
+
+// MaxAttempts is how many times a delivery is tried before it is given up on
+const MaxAttempts = 6
+
+// requestTimeout is how long an endpoint has to answer
+const requestTimeout = 10 * time.Second
+
+var backoff = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour}
+
+// Backoff returns how long to wait before trying a delivery again after it has failed attempts times
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	if attempts > len(backoff) {
+		return backoff[len(backoff)-1]
+	}
+	return backoff[attempts-1]
+}
+
+// Envelope is the JSON body of every delivery. ID is the same for every attempt at a delivery,
+// so an endpoint can ignore one it has already handled.
+type Envelope struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Reservation is how a reservation is described in an event
+type Reservation struct {
+	ID          int    `json:"id"`
+	Status      string `json:"status"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+	RoomID      int    `json:"room_id"`
+	RoomName    string `json:"room_name"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Guests      int    `json:"guests"`
+	Subtotal    int    `json:"subtotal"`
+	Discount    int    `json:"discount"`
+	ExtrasTotal int    `json:"extras_total"`
+	TaxTotal    int    `json:"tax_total"`
+	Total       int    `json:"total"`
+	Currency    string `json:"currency"`
+	PromoCode   string `json:"promo_code,omitempty"`
+	GroupID     int    `json:"group_id,omitempty"`
+}
+
+// NewReservation describes the reservation, with its amounts in cents of currency
+func NewReservation(res models.Reservation, currency string) Reservation {
+	return Reservation{
+		ID:          res.ID,
+		Status:      res.Status,
+		FirstName:   res.FirstName,
+		LastName:    res.LastName,
+		Email:       res.Email,
+		Phone:       res.Phone,
+		RoomID:      res.RoomID,
+		RoomName:    res.Room.RoomName,
+		StartDate:   res.StartDate.Format("2006-01-02"),
+		EndDate:     res.EndDate.Format("2006-01-02"),
+		Guests:      res.Guests,
+		Subtotal:    res.Subtotal,
+		Discount:    res.Discount,
+		ExtrasTotal: res.ExtrasTotal,
+		TaxTotal:    res.TaxTotal,
+		Total:       res.Total,
+		Currency:    currency,
+		PromoCode:   res.PromoCode,
+		GroupID:     res.GroupID,
+	}
+}
+
+// Sign returns the hex HMAC-SHA256, keyed with secret, of the timestamp and body joined by a dot.
+// Including the timestamp lets an endpoint reject old deliveries being replayed.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts the delivery's payload to its webhook, signed with the webhook's secret in the
+// X-Webhook-Signature header. It returns the response's status code, and an error unless it was 2xx.
+func Send(d models.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, d.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hotel-booking-webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(d.Webhook.Secret, timestamp, body))
+
+	client := http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,53 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{"payload", "s3cret", 1700000000, `{"id":"abc"}`, "72a3da75a9ce3af68e8c9684d47ea32e9cb023327faf846bf884edfa60e1130a"},
+		{"timestamp is signed", "s3cret", 1700000001, `{"id":"abc"}`, "44ec72c77e87bfc257c657976e9b810139f1d1ab247f025e9a4bffc287e77cab"},
+		{"empty", "", 0, "", "b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	}
+
+	for _, tt := range tests {
+		if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: Sign = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if Sign("s3cret", 1700000000, []byte("body")) == Sign("other", 1700000000, []byte("body")) {
+		t.Error("Sign gave the same signature for different secrets")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, time.Minute},
+		{2, 5 * time.Minute},
+		{3, 30 * time.Minute},
+		{4, 2 * time.Hour},
+		{5, 6 * time.Hour},
+		{6, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
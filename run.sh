@@ -1,2 +1,3 @@
 go build -o bookings cmd/web/*.go
-./bookings -dbname=hotel-booking -dbuser=jason.ngan -production=false
\ No newline at end of file
+# SIGNING_KEY has to be exported before running, e.g. SIGNING_KEY=$(openssl rand -hex 32)
+BASE_URL=${BASE_URL:-http://localhost:8080} ./bookings -dbname=hotel-booking -dbuser=jason.ngan -production=false
\ No newline at end of file